@@ -7,11 +7,14 @@ if(CMAKE_HOST_SYSTEM_NAME STREQUAL "Linux")
     include(btrfs)
 endif()
 
+# Comma separated `no_<engine>` tags of the engines left out of the worker, eg: "no_podman,no_lxd"
+set(WORKER_ENGINE_TAGS "" CACHE STRING "Engines excluded from the go-worker build")
+
 ExternalProject_Add(go-worker
         SOURCE_DIR ${CMAKE_SOURCE_DIR}/go-worker
         BUILD_IN_SOURCE 1
         CONFIGURE_COMMAND ""
-        BUILD_COMMAND make ${BTRFS_CGO_CFLAG} lib
+        BUILD_COMMAND make ${BTRFS_CGO_CFLAG} ENGINE_TAGS=${WORKER_ENGINE_TAGS} lib
         BUILD_BYPRODUCTS libworker.a libworker.h
         INSTALL_COMMAND ""
 )
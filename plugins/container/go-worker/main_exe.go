@@ -5,21 +5,28 @@ package main
 /*
 #include <stdio.h>
 #include <stdbool.h>
-void echo_cb(const char *json, bool added, bool initial_state) {
+#include <stdlib.h>
+bool echo_cb(const char *json, bool added, bool initial_state) {
 	if (initial_state) {
 		printf("[Pre-existing] Json: %s\n", json);
 	} else {
 		printf("[%s] Json: %s\n", added ? "Added" : "Removed", json);
 	}
+	return true;
+}
+void echo_log_cb(const char *msg, int severity) {
+	printf("[Log %d] %s\n", severity, msg);
 }
 */
 import "C"
 
 import (
 	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
 	"os"
 	"os/signal"
 	"syscall"
+	"unsafe"
 )
 
 func main() {
@@ -56,13 +63,30 @@ func main() {
 		  }
       }
    }`
-	if len(os.Args) > 1 {
-		initCfg = os.Args[1]
+	// `worker selftest [config]` only runs the self-test of the engines, eg:
+	// `go run -tags exe,containers_image_openpgp . selftest`
+	args := os.Args[1:]
+	selfTest := len(args) > 0 && args[0] == "selftest"
+	if selfTest {
+		args = args[1:]
+	}
+	if len(args) > 0 {
+		initCfg = args[0]
+	}
+	if selfTest {
+		if err := config.Load(initCfg); err != nil {
+			fmt.Println("Invalid config:", err)
+			os.Exit(1)
+		}
+		report := RunSelfTest()
+		fmt.Println(C.GoString(report))
+		C.free(unsafe.Pointer(report))
+		return
 	}
 	fmt.Println("Starting worker")
 	cstr := C.CString(initCfg)
 	enabledSocks := C.CString("")
-	ptr := StartWorker((*[0]byte)(C.echo_cb), cstr, &enabledSocks)
+	ptr := StartWorker((*[0]byte)(C.echo_cb), (*[0]byte)(C.echo_log_cb), cstr, &enabledSocks)
 	if ptr == nil {
 		fmt.Println("Failed to start worker; nothing configured?")
 		os.Exit(1)
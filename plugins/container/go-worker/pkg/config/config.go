@@ -2,25 +2,104 @@ package config
 
 import (
 	"encoding/json"
+	"time"
 )
 
 const (
 	defaultLabelMaxLen = 100
-	HookCreate         = 1
-	HookStart          = 2
+	// defaultStartupBudgetMs is the time engines are given to connect at startup.
+	defaultStartupBudgetMs = 5000
+	// defaultConnectRetryTimeoutMs is how long engines failing to connect at startup are retried.
+	defaultConnectRetryTimeoutMs = 30000
+	// defaultPollIntervalMs is the interval of the listings of engines polling for containers.
+	defaultPollIntervalMs = 2000
+	// defaultInspectConcurrency is the number of inspect calls engines run at once.
+	defaultInspectConcurrency = 4
+	// defaultCreateTimeoutMs is how long a remove event waits for the in-flight create of its container.
+	defaultCreateTimeoutMs = 2000
+	// defaultEventDeadlineMs is how long the inspection of a container may take before its event is sent incomplete.
+	defaultEventDeadlineMs = 2000
+	HookCreate             = 1
+	HookStart              = 2
+	HookExit               = 4
+
+	// IDFormatShort reports the 12 chars truncated container ID, like the docker CLI does.
+	IDFormatShort = "short"
+	// IDFormatFull reports the full container ID, as returned by the engines.
+	IDFormatFull = "full"
+
+	// EmitOnCreate sends the container event when the container gets created.
+	EmitOnCreate = "create"
+	// EmitOnStart sends the container event when the container starts;
+	// created but never started containers are not reported.
+	EmitOnStart = "start"
+	// EmitOnBoth sends the container event on create, and an update on start.
+	EmitOnBoth = "both"
+
+	// OutputLayoutDefault is the layout of the container events consumed by the plugin.
+	OutputLayoutDefault = "default"
+	// OutputLayoutLegacy keys the container event fields by the legacy field names,
+	// for consumers migrating from the former built-in container engine.
+	OutputLayoutLegacy = "legacy"
+
+	// defaultReinspectRetries is how many times a container reported with incomplete metadata is inspected again.
+	defaultReinspectRetries = 3
+
+	// EventDumpStdout dumps the container events to the standard output, in place of a file.
+	EventDumpStdout = "stdout"
+
+	// DuplicateIDsAll sends the events of each engine reporting a container with the same ID.
+	DuplicateIDsAll = "all"
+	// DuplicateIDsPrefer only sends the events of the preferred engine, by GetEnginePriority,
+	// for containers reported by several engines with the same ID.
+	DuplicateIDsPrefer = "prefer"
+	// DuplicateIDsMerge sends the events of the preferred engine, with the fields it leaves empty
+	// filled in by the other engines reporting the container.
+	DuplicateIDsMerge = "merge"
 )
 
+// TLSConfig holds the PEM files an engine endpoint is reached with over mTLS:
+// the client certificate and key, and the CA the server is verified with.
+type TLSConfig struct {
+	CA   string `json:"ca"`
+	Cert string `json:"cert"`
+	Key  string `json:"key"`
+}
+
 type SocketsEngine struct {
-	Enabled bool     `json:"enabled"`
-	Sockets []string `json:"sockets"`
+	Enabled            bool              `json:"enabled"`
+	Sockets            []string          `json:"sockets"`
+	EmitOn             string            `json:"emit_on"`
+	LabelFilter        map[string]string `json:"label_filter"`
+	PollInterval       int               `json:"poll_interval_ms"`
+	InspectConcurrency int               `json:"inspect_concurrency"`
+	Endpoint           string            `json:"endpoint"`
+	TLS                TLSConfig         `json:"tls"`
+	InfraDeny          []string          `json:"infra_deny"`
+	InfraAllow         []string          `json:"infra_allow"`
+	States             []string          `json:"states"`
 }
 
 type EngineCfg struct {
-	SocketsEngines map[string]SocketsEngine `json:"engines"`
-	LabelMaxLen    int                      `json:"label_max_len"`
-	WithSize       bool                     `json:"with_size"`
-	HostRoot       string                   `json:"host_root"`
-	Hooks          byte                     `json:"hooks"`
+	SocketsEngines   map[string]SocketsEngine `json:"engines"`
+	LabelMaxLen      int                      `json:"label_max_len"`
+	WithSize         bool                     `json:"with_size"`
+	HostRoot         string                   `json:"host_root"`
+	Hooks            byte                     `json:"hooks"`
+	IDFormat         string                   `json:"id_format"`
+	StartupBudget    int                      `json:"startup_budget_ms"`
+	ConnectRetry     int                      `json:"connect_retry_timeout_ms"`
+	ReplayBufferSize int                      `json:"replay_buffer_size"`
+	CreateTimeout    int                      `json:"create_timeout_ms"`
+	EventDeadline    int                      `json:"event_deadline_ms"`
+	OutputLayout     string                   `json:"output_layout"`
+	ReinspectRetries int                      `json:"reinspect_retries"`
+	ReinspectFields  []string                 `json:"reinspect_fields"`
+	EventDump        string                   `json:"event_dump"`
+	EventDumpOnly    bool                     `json:"event_dump_only"`
+	AckEvents        bool                     `json:"ack_events"`
+	DuplicateIDs     string                   `json:"duplicate_ids"`
+	EnginePriority   []string                 `json:"engine_priority"`
 }
 
 var c EngineCfg
@@ -30,6 +109,15 @@ func init() {
 	c.LabelMaxLen = defaultLabelMaxLen
 	c.WithSize = false
 	c.Hooks = HookCreate
+	c.IDFormat = IDFormatShort
+	c.StartupBudget = defaultStartupBudgetMs
+	c.ConnectRetry = defaultConnectRetryTimeoutMs
+	c.CreateTimeout = defaultCreateTimeoutMs
+	c.EventDeadline = defaultEventDeadlineMs
+	c.OutputLayout = OutputLayoutDefault
+	c.ReinspectRetries = defaultReinspectRetries
+	c.ReinspectFields = []string{"ip", "imagedigest"}
+	c.DuplicateIDs = DuplicateIDsAll
 }
 
 func Load(initCfg string) error {
@@ -56,6 +144,145 @@ func GetHostRoot() string {
 	return c.HostRoot
 }
 
+func GetIDFormat() string {
+	return c.IDFormat
+}
+
+// GetOutputLayout returns the layout of the container events JSON.
+func GetOutputLayout() string {
+	return c.OutputLayout
+}
+
+func GetStartupBudget() time.Duration {
+	return time.Duration(c.StartupBudget) * time.Millisecond
+}
+
+// GetConnectRetryTimeout returns how long the connection of an engine failing at startup
+// is retried before giving up; 0 disables the retries.
+func GetConnectRetryTimeout() time.Duration {
+	return time.Duration(c.ConnectRetry) * time.Millisecond
+}
+
+// GetEmitOn returns the lifecycle step the engine sends container events on.
+func GetEmitOn(engine string) string {
+	if emitOn := c.SocketsEngines[engine].EmitOn; emitOn != "" {
+		return emitOn
+	}
+	return EmitOnCreate
+}
+
+// GetLabelFilter returns the labels, with their values, containers must carry
+// to be reported by the engine; an empty value only requires the label.
+// It is nil when all containers are reported.
+func GetLabelFilter(engine string) map[string]string {
+	return c.SocketsEngines[engine].LabelFilter
+}
+
+// GetStates returns the states of the containers reported by the engine,
+// like event.StateRunning. It is nil when all states are reported.
+func GetStates(engine string) []string {
+	return c.SocketsEngines[engine].States
+}
+
+// GetPollInterval returns the interval between the container listings
+// of the engine, when it polls in place of listening on an events stream.
+func GetPollInterval(engine string) time.Duration {
+	if ms := c.SocketsEngines[engine].PollInterval; ms > 0 {
+		return time.Duration(ms) * time.Millisecond
+	}
+	return defaultPollIntervalMs * time.Millisecond
+}
+
+// GetInspectConcurrency returns the maximum number of inspect calls
+// the engine listener runs at once, to build the container events.
+func GetInspectConcurrency(engine string) int {
+	if n := c.SocketsEngines[engine].InspectConcurrency; n > 0 {
+		return n
+	}
+	return defaultInspectConcurrency
+}
+
+// GetRemoteEndpoint returns the network endpoint the engine is reached at over mTLS,
+// in place of its sockets, along with its TLS config.
+// It is false when either the endpoint or the TLS config is missing.
+func GetRemoteEndpoint(engine string) (string, TLSConfig, bool) {
+	eCfg := c.SocketsEngines[engine]
+	if eCfg.Endpoint == "" || eCfg.TLS == (TLSConfig{}) {
+		return "", TLSConfig{}, false
+	}
+	return eCfg.Endpoint, eCfg.TLS, true
+}
+
+// GetInfraDeny returns the rules matching the infrastructure containers not reported by the engine,
+// and whether they are configured, replacing the engine defaults; an empty list reports all of them.
+func GetInfraDeny(engine string) ([]string, bool) {
+	rules := c.SocketsEngines[engine].InfraDeny
+	return rules, rules != nil
+}
+
+// GetInfraAllow returns the rules matching the containers reported by the engine
+// even when matching its infra deny rules.
+func GetInfraAllow(engine string) []string {
+	return c.SocketsEngines[engine].InfraAllow
+}
+
+// GetCreateTimeout returns how long the remove event of a container is held,
+// waiting for its in-flight create to be delivered first.
+func GetCreateTimeout() time.Duration {
+	return time.Duration(c.CreateTimeout) * time.Millisecond
+}
+
+// GetEventDeadline returns how long the inspection of a container, building its event, may take
+// before the event is sent incomplete; 0 disables it.
+func GetEventDeadline() time.Duration {
+	return time.Duration(c.EventDeadline) * time.Millisecond
+}
+
+// GetReinspectRetries returns how many times a container whose event misses
+// any of the GetReinspectFields is inspected again; 0 disables it.
+func GetReinspectRetries() int {
+	return c.ReinspectRetries
+}
+
+// GetReinspectFields returns the container fields, by json name,
+// whose emptiness triggers the re-inspection of the container.
+func GetReinspectFields() []string {
+	return c.ReinspectFields
+}
+
+// GetEventDump returns where the JSON of each container event is dumped, as a line, for debugging:
+// EventDumpStdout or a file path, appended to. It is empty when disabled.
+func GetEventDump() string {
+	return c.EventDump
+}
+
+// IsEventDumpOnly returns whether the container events are only dumped, not sent to the callback.
+func IsEventDumpOnly() bool {
+	return c.EventDumpOnly
+}
+
+// IsAckEventsEnabled returns whether the consumer acknowledges the container events it processed,
+// to track the low-water mark of the ones it is done with.
+func IsAckEventsEnabled() bool {
+	return c.AckEvents
+}
+
+// GetDuplicateIDs returns how the containers reported by several engines with the same ID are reported,
+// like DuplicateIDsAll.
+func GetDuplicateIDs() string {
+	return c.DuplicateIDs
+}
+
+// GetEnginePriority returns the engine names, by decreasing priority, the preferred engine
+// of the containers reported by several engines is chosen by.
+func GetEnginePriority() []string {
+	return c.EnginePriority
+}
+
+func GetReplayBufferSize() int {
+	return c.ReplayBufferSize
+}
+
 func IsHookEnabled(hook byte) bool {
 	return c.Hooks&hook != 0
 }
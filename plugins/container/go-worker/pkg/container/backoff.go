@@ -0,0 +1,79 @@
+package container
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"math/rand/v2"
+	"time"
+)
+
+// retryLogInterval is the minimum interval between the warnings about the same failing operation.
+const retryLogInterval = 30 * time.Second
+
+// retrier paces the retries of a failing operation of an engine, like reaching a daemon that is down:
+// the wait doubles at each consecutive failure, starting from base up to max, with jitter,
+// so that many clients of the same runtime do not retry in lockstep.
+// The first failure is logged right away, the following ones collapsed into a warning
+// every retryLogInterval carrying the running retry count; the recovery is logged once.
+// Its state is reported in the engine status, until it succeeds again.
+// It is not safe for concurrent use.
+type retrier struct {
+	key       engineKey
+	operation string
+	base      time.Duration
+	max       time.Duration
+
+	// retries counts the consecutive failures.
+	retries int
+	// loggedAt is when the last warning got logged.
+	loggedAt time.Time
+}
+
+func newRetrier(name, socket, operation string, base, max time.Duration) *retrier {
+	return &retrier{key: engineKey{name: name, socket: socket}, operation: operation, base: base, max: max}
+}
+
+// fail accounts a failure of the operation, returning how long to wait before retrying it.
+func (r *retrier) fail(err error) time.Duration {
+	r.retries++
+	now := time.Now()
+	switch {
+	case r.retries == 1:
+		logger.Warnf("engine %s (%s): %s failed, retrying with backoff: %v", r.key.name, r.key.socket, r.operation, err)
+		r.loggedAt = now
+	case now.Sub(r.loggedAt) >= retryLogInterval:
+		logger.Warnf("engine %s (%s): %s still failing after %d retries: %v", r.key.name, r.key.socket, r.operation, r.retries-1, err)
+		r.loggedAt = now
+	}
+	wait := r.delay()
+	setBackoff(r.key, r.retries, wait)
+	return wait
+}
+
+// delay returns the wait before the next retry: half of the current backoff, plus a random part up to the other half.
+func (r *retrier) delay() time.Duration {
+	backoff := r.max
+	// Not to overflow, doubling from base
+	if shift := r.retries - 1; shift < 32 && r.base<<shift < r.max {
+		backoff = r.base << shift
+	}
+	return backoff/2 + rand.N(backoff/2+1)
+}
+
+// succeed accounts a success of the operation, resetting the backoff;
+// it returns whether it recovered from failures.
+func (r *retrier) succeed() bool {
+	if r.retries == 0 {
+		return false
+	}
+	logger.Infof("engine %s (%s): %s succeeded after %d retries", r.key.name, r.key.socket, r.operation, r.retries)
+	r.retries = 0
+	recovered(r.key)
+	return true
+}
+
+// giveUp stops retrying the operation, still failing: the backoff is not reported anymore, unlike the retries.
+func (r *retrier) giveUp() {
+	if r.retries > 0 {
+		setBackoff(r.key, r.retries, 0)
+	}
+}
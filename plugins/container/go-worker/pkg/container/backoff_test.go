@@ -0,0 +1,73 @@
+package container
+
+import (
+	"errors"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestRetrier(t *testing.T) {
+	var (
+		mu   sync.Mutex
+		logs []string
+	)
+	logger.SetSink(func(severity logger.Severity, msg string) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, msg)
+	})
+	t.Cleanup(func() {
+		logger.SetSink(nil)
+		ResetStatus()
+	})
+	setState("fake", "/run/fake.sock", EngineRunning, nil)
+	engineStatus := func() EngineStatus {
+		st := Status()
+		require.Len(t, st, 1)
+		return st[0]
+	}
+
+	r := newRetrier("fake", "/run/fake.sock", "listing containers", 100*time.Millisecond, time.Second)
+	assert.False(t, r.succeed())
+	err := errors.New("connection refused")
+	expectedMax := []time.Duration{100, 200, 400, 800, 1000, 1000, 1000}
+	for i, m := range expectedMax {
+		wait := r.fail(err)
+		m *= time.Millisecond
+		assert.GreaterOrEqual(t, wait, m/2, "retry %d", i+1)
+		assert.LessOrEqual(t, wait, m, "retry %d", i+1)
+		assert.Equal(t, i+1, engineStatus().Retries)
+		assert.Equal(t, wait.Milliseconds(), engineStatus().BackoffMs)
+	}
+	// Collapsed into the first warning
+	assert.Equal(t, []string{"engine fake (/run/fake.sock): listing containers failed, retrying with backoff: connection refused"}, logs)
+
+	r.loggedAt = r.loggedAt.Add(-retryLogInterval)
+	r.fail(err)
+	assert.Len(t, logs, 2)
+	assert.Equal(t, "engine fake (/run/fake.sock): listing containers still failing after 7 retries: connection refused", logs[1])
+
+	assert.True(t, r.succeed())
+	assert.Equal(t, "engine fake (/run/fake.sock): listing containers succeeded after 8 retries", logs[2])
+	st := engineStatus()
+	assert.Zero(t, st.Retries)
+	assert.Zero(t, st.BackoffMs)
+	assert.Equal(t, uint64(1), st.Reconnects)
+
+	// The backoff starts over
+	wait := r.fail(err)
+	assert.LessOrEqual(t, wait, 100*time.Millisecond)
+	assert.Len(t, logs, 4)
+	r.giveUp()
+	st = engineStatus()
+	assert.Equal(t, 1, st.Retries)
+	assert.Zero(t, st.BackoffMs)
+
+	// Never overflows
+	r.retries = 100
+	assert.LessOrEqual(t, r.fail(err), time.Second)
+}
@@ -0,0 +1,153 @@
+package container
+
+import (
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Cgroup drivers, as reported by the engines.
+const (
+	cgroupDriverCgroupfs = "cgroupfs"
+	cgroupDriverSystemd  = "systemd"
+)
+
+// hostCgroupsVersion returns the cgroups version of the host, read from HOST_ROOT sysfs, or 0 if unknown.
+// Hybrid hosts, with the unified hierarchy only mounted aside the v1 ones, are reported as version 1.
+func hostCgroupsVersion() int {
+	root := filepath.Join(config.GetHostRoot(), "/sys/fs/cgroup")
+	if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err == nil {
+		return 2
+	}
+	if _, err := os.Stat(root); err == nil {
+		return 1
+	}
+	return 0
+}
+
+// parseCgroupsVersion parses an engine reported cgroups version, eg: "2" or "v2",
+// falling back to the host one when not reported.
+func parseCgroupsVersion(version string) int {
+	if v, err := strconv.Atoi(strings.TrimPrefix(version, "v")); err == nil && (v == 1 || v == 2) {
+		return v
+	}
+	return hostCgroupsVersion()
+}
+
+// sliceCgroupPath returns the cgroup path of a systemd slice, where each dash
+// nests the slice in its parent one, eg: a-b.slice -> /a.slice/a-b.slice.
+// Slices already given as a path, eg: user.slice/user-1000.slice, are returned as is.
+func sliceCgroupPath(slice string) string {
+	if strings.Contains(slice, "/") {
+		return path.Clean("/" + slice)
+	}
+	name := strings.TrimSuffix(slice, ".slice")
+	if name == "" || name == "-" {
+		// -.slice is the root slice
+		return "/"
+	}
+	res := ""
+	prefix := ""
+	for _, part := range strings.Split(name, "-") {
+		prefix += part
+		res += "/" + prefix + ".slice"
+		prefix += "-"
+	}
+	return res
+}
+
+// scopeCgroupPath returns the cgroup path of the `<prefix>-<id>.scope` systemd unit in the parent slice,
+// or of the parent slice itself when the container is given a slice as unit.
+func scopeCgroupPath(slice, prefix, id string) string {
+	if strings.HasSuffix(id, ".slice") {
+		return path.Join(sliceCgroupPath(slice), id)
+	}
+	unit := id + ".scope"
+	if prefix != "" {
+		unit = prefix + "-" + unit
+	}
+	return path.Join(sliceCgroupPath(slice), unit)
+}
+
+// dockerCgroupPath derives the cgroup path of a docker container from its cgroup parent:
+// `<parent>/docker-<id>.scope` with the systemd driver, `<parent>/<id>` with the cgroupfs one.
+func dockerCgroupPath(driver, parent, id string) string {
+	if driver == cgroupDriverSystemd {
+		if parent == "" {
+			parent = "system.slice"
+		}
+		return scopeCgroupPath(parent, "docker", id)
+	}
+	if parent == "" {
+		parent = "/docker"
+	}
+	return path.Join("/", parent, id)
+}
+
+// podmanCgroupPath derives the cgroup path of a podman container from its cgroup parent:
+// `<parent>/libpod-<id>.scope` with the systemd manager, `<parent>/libpod-<id>` with the cgroupfs one.
+func podmanCgroupPath(manager, parent, id string) string {
+	if manager == cgroupDriverSystemd {
+		if parent == "" {
+			parent = "machine.slice"
+		}
+		return scopeCgroupPath(parent, "libpod", id)
+	}
+	if parent == "" {
+		parent = "/libpod_parent"
+	}
+	return path.Join("/", parent, "libpod-"+id)
+}
+
+// specCgroupPath returns the cgroup path from an OCI spec cgroupsPath, that is either a path,
+// with the cgroupfs driver, or `<slice>:<prefix>:<name>`, with the systemd one.
+// See https://github.com/opencontainers/runc/blob/main/docs/systemd.md
+func specCgroupPath(cgroupsPath string) string {
+	if cgroupsPath == "" {
+		return ""
+	}
+	if parts := strings.Split(cgroupsPath, ":"); len(parts) == 3 {
+		slice := parts[0]
+		if slice == "" {
+			slice = "system.slice"
+		}
+		return scopeCgroupPath(slice, parts[1], parts[2])
+	}
+	return path.Clean("/" + cgroupsPath)
+}
+
+// procCgroupPath returns the cgroup path of a running process, read from HOST_ROOT procfs,
+// for the unified hierarchy on version 2 and for the cpu controller one on version 1.
+// It is relative to the cgroup namespace of the worker, exactly like the path seen by the syscall side.
+func procCgroupPath(pid int, version int) (string, error) {
+	if pid <= 0 {
+		return "", fmt.Errorf("invalid pid %d", pid)
+	}
+	content, err := os.ReadFile(filepath.Join(config.GetHostRoot(), "/proc", strconv.Itoa(pid), "cgroup"))
+	if err != nil {
+		return "", err
+	}
+	// Each line is `<hierarchy id>:<controllers>:<path>`
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		fields := strings.SplitN(line, ":", 3)
+		if len(fields) != 3 {
+			continue
+		}
+		if version == 2 {
+			if fields[0] == "0" && fields[1] == "" {
+				return fields[2], nil
+			}
+			continue
+		}
+		for _, controller := range strings.Split(fields[1], ",") {
+			if controller == "cpu" {
+				return fields[2], nil
+			}
+		}
+	}
+	return "", fmt.Errorf("no cgroup v%d path for pid %d", version, pid)
+}
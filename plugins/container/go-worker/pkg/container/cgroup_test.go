@@ -0,0 +1,250 @@
+package container
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testCgroupID = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+
+func TestSliceCgroupPath(t *testing.T) {
+	tCases := map[string]struct {
+		slice        string
+		expectedPath string
+	}{
+		"Root": {
+			slice:        "-.slice",
+			expectedPath: "/",
+		},
+		"Top level": {
+			slice:        "system.slice",
+			expectedPath: "/system.slice",
+		},
+		"Nested": {
+			slice:        "kubepods-besteffort-pod1234.slice",
+			expectedPath: "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice",
+		},
+		"Path": {
+			slice:        "user.slice/user-1000.slice/user@1000.service/user.slice",
+			expectedPath: "/user.slice/user-1000.slice/user@1000.service/user.slice",
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedPath, sliceCgroupPath(tc.slice))
+		})
+	}
+}
+
+func TestDockerCgroupPath(t *testing.T) {
+	tCases := map[string]struct {
+		driver       string
+		parent       string
+		expectedPath string
+	}{
+		"Systemd": {
+			driver:       cgroupDriverSystemd,
+			expectedPath: "/system.slice/docker-" + testCgroupID + ".scope",
+		},
+		"Systemd with parent": {
+			driver:       cgroupDriverSystemd,
+			parent:       "falco-workload.slice",
+			expectedPath: "/falco.slice/falco-workload.slice/docker-" + testCgroupID + ".scope",
+		},
+		"Cgroupfs": {
+			driver:       cgroupDriverCgroupfs,
+			expectedPath: "/docker/" + testCgroupID,
+		},
+		"Cgroupfs with parent": {
+			driver:       cgroupDriverCgroupfs,
+			parent:       "/falco/workload",
+			expectedPath: "/falco/workload/" + testCgroupID,
+		},
+		"Unknown driver": {
+			expectedPath: "/docker/" + testCgroupID,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedPath, dockerCgroupPath(tc.driver, tc.parent, testCgroupID))
+		})
+	}
+}
+
+func TestPodmanCgroupPath(t *testing.T) {
+	tCases := map[string]struct {
+		manager      string
+		parent       string
+		expectedPath string
+	}{
+		"Systemd": {
+			manager:      cgroupDriverSystemd,
+			expectedPath: "/machine.slice/libpod-" + testCgroupID + ".scope",
+		},
+		"Systemd rootless": {
+			manager:      cgroupDriverSystemd,
+			parent:       "user.slice",
+			expectedPath: "/user.slice/libpod-" + testCgroupID + ".scope",
+		},
+		"Cgroupfs": {
+			manager:      cgroupDriverCgroupfs,
+			expectedPath: "/libpod_parent/libpod-" + testCgroupID,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedPath, podmanCgroupPath(tc.manager, tc.parent, testCgroupID))
+		})
+	}
+}
+
+func TestSpecCgroupPath(t *testing.T) {
+	tCases := map[string]struct {
+		cgroupsPath  string
+		expectedPath string
+	}{
+		"Empty": {
+			cgroupsPath:  "",
+			expectedPath: "",
+		},
+		"Cgroupfs": {
+			cgroupsPath:  "/k8s.io/" + testCgroupID,
+			expectedPath: "/k8s.io/" + testCgroupID,
+		},
+		"Cgroupfs relative": {
+			cgroupsPath:  "default/" + testCgroupID,
+			expectedPath: "/default/" + testCgroupID,
+		},
+		"Systemd containerd": {
+			cgroupsPath:  "kubepods-besteffort-pod1234.slice:cri-containerd:" + testCgroupID,
+			expectedPath: "/kubepods.slice/kubepods-besteffort.slice/kubepods-besteffort-pod1234.slice/cri-containerd-" + testCgroupID + ".scope",
+		},
+		"Systemd crio": {
+			cgroupsPath:  "kubepods-burstable-pod1234.slice:crio:" + testCgroupID,
+			expectedPath: "/kubepods.slice/kubepods-burstable.slice/kubepods-burstable-pod1234.slice/crio-" + testCgroupID + ".scope",
+		},
+		"Systemd default slice": {
+			cgroupsPath:  ":docker:" + testCgroupID,
+			expectedPath: "/system.slice/docker-" + testCgroupID + ".scope",
+		},
+		"Systemd slice unit": {
+			cgroupsPath:  "machine.slice::falco.slice",
+			expectedPath: "/machine.slice/falco.slice",
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedPath, specCgroupPath(tc.cgroupsPath))
+		})
+	}
+}
+
+func TestProcCgroupPath(t *testing.T) {
+	const hybridCgroup = `12:cpu,cpuacct:/docker/` + testCgroupID + `
+11:memory:/docker/` + testCgroupID + `
+1:name=systemd:/docker/` + testCgroupID + `
+0::/system.slice/containerd.service
+`
+	tCases := map[string]struct {
+		cgroup       string
+		version      int
+		expectedErr  bool
+		expectedPath string
+	}{
+		"Unified": {
+			cgroup:       "0::/system.slice/docker-" + testCgroupID + ".scope\n",
+			version:      2,
+			expectedPath: "/system.slice/docker-" + testCgroupID + ".scope",
+		},
+		"Hybrid v1": {
+			cgroup:       hybridCgroup,
+			version:      1,
+			expectedPath: "/docker/" + testCgroupID,
+		},
+		"Hybrid v2": {
+			cgroup:       hybridCgroup,
+			version:      2,
+			expectedPath: "/system.slice/containerd.service",
+		},
+		"No cpu controller": {
+			cgroup:      "0::/system.slice/docker-" + testCgroupID + ".scope\n",
+			version:     1,
+			expectedErr: true,
+		},
+	}
+
+	t.Cleanup(func() {
+		_ = config.Load(`{"host_root":""}`)
+	})
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			hostRoot := t.TempDir()
+			procDir := filepath.Join(hostRoot, "proc", "42")
+			require.NoError(t, os.MkdirAll(procDir, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(procDir, "cgroup"), []byte(tc.cgroup), 0o644))
+			require.NoError(t, config.Load(`{"host_root":"`+hostRoot+`"}`))
+
+			cgroupPath, err := procCgroupPath(42, tc.version)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPath, cgroupPath)
+		})
+	}
+
+	// Not running
+	_, err := procCgroupPath(0, 2)
+	assert.Error(t, err)
+}
+
+func TestCgroupsVersion(t *testing.T) {
+	tCases := map[string]struct {
+		files           []string
+		reported        string
+		expectedVersion int
+	}{
+		"Reported": {
+			reported:        "v1",
+			files:           []string{"sys/fs/cgroup/cgroup.controllers"},
+			expectedVersion: 1,
+		},
+		"Unified": {
+			files:           []string{"sys/fs/cgroup/cgroup.controllers"},
+			expectedVersion: 2,
+		},
+		"Legacy": {
+			files:           []string{"sys/fs/cgroup/cpu/cpu.shares"},
+			expectedVersion: 1,
+		},
+		"Unknown": {
+			reported:        "42",
+			expectedVersion: 0,
+		},
+	}
+
+	t.Cleanup(func() {
+		_ = config.Load(`{"host_root":""}`)
+	})
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			hostRoot := t.TempDir()
+			for _, file := range tc.files {
+				require.NoError(t, os.MkdirAll(filepath.Dir(filepath.Join(hostRoot, file)), 0o755))
+				require.NoError(t, os.WriteFile(filepath.Join(hostRoot, file), nil, 0o644))
+			}
+			require.NoError(t, config.Load(`{"host_root":"`+hostRoot+`"}`))
+
+			assert.Equal(t, tc.expectedVersion, parseCgroupsVersion(tc.reported))
+		})
+	}
+}
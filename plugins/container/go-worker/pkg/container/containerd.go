@@ -1,15 +1,20 @@
+//go:build !no_containerd
+
 package container
 
 import (
 	"context"
 	"github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/api/types/runc/options"
 	containerd "github.com/containerd/containerd/v2/client"
 	"github.com/containerd/containerd/v2/core/containers"
+	"github.com/containerd/containerd/v2/core/images"
 	"github.com/containerd/containerd/v2/pkg/namespaces"
 	"github.com/containerd/containerd/v2/pkg/oci"
 	"github.com/containerd/typeurl/v2"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"strconv"
 	"strings"
@@ -17,12 +22,15 @@ import (
 )
 
 func init() {
-	engineGenerators[typeContainerd] = newContainerdEngine
+	register(typeContainerd, newContainerdEngine)
 }
 
 type containerdEngine struct {
+	*infraFilter
+	ref    *clientRef
 	client *containerd.Client
 	socket string
+	images *containerdImages
 }
 
 func newContainerdEngine(_ context.Context, socket string) (Engine, error) {
@@ -30,24 +38,63 @@ func newContainerdEngine(_ context.Context, socket string) (Engine, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &containerdEngine{client: client, socket: socket}, nil
+	return &containerdEngine{infraFilter: newInfraFilter(typeContainerd), ref: openClient(string(typeContainerd), socket),
+		client: client, socket: socket, images: newContainerdImages()}, nil
 }
 
 func (c *containerdEngine) copy(ctx context.Context) (Engine, error) {
 	return newContainerdEngine(ctx, c.socket)
 }
 
+// Close closes the containerd client, along with its gRPC connection.
+func (c *containerdEngine) Close() error {
+	if !c.ref.release() {
+		return nil
+	}
+	return c.client.Close()
+}
+
+// containerdImagePulledAt returns when the image record was last updated, pointing it to its
+// current target, as it happens on pull; records are created on first pull.
+func containerdImagePulledAt(img images.Image) int64 {
+	if ts := timeToUnix(img.UpdatedAt); ts != 0 {
+		return ts
+	}
+	return timeToUnix(img.CreatedAt)
+}
+
+// containerdRuntime returns the binary the runc shim is configured to run, eg: `nvidia-container-runtime`,
+// or else the runtime name, eg: `io.containerd.runc.v2`.
+func containerdRuntime(runtime containers.RuntimeInfo) string {
+	if runtime.Options != nil {
+		if opts, err := typeurl.UnmarshalAny(runtime.Options); err == nil {
+			if runcOpts, ok := opts.(*options.Options); ok && runcOpts.BinaryName != "" {
+				return runcOpts.BinaryName
+			}
+		}
+	}
+	return runtime.Name
+}
+
 func (c *containerdEngine) ctrToInfo(namespacedContext context.Context, container containerd.Container) event.Info {
 	info, err := container.Info(namespacedContext)
 	if err != nil {
 		info = containers.Container{}
 	}
+	// User namespace and cgroup related: unknown without a spec
+	usernsMode, uidMappings, gidMappings := "", []event.IDMapping{}, []event.IDMapping{}
+	cgroupPath := ""
 	spec, err := container.Spec(namespacedContext)
 	if err != nil {
 		spec = &oci.Spec{
 			Process: &specs.Process{},
 			Mounts:  nil,
 		}
+	} else {
+		usernsMode, uidMappings, gidMappings = specUserns(spec.Linux)
+		if spec.Linux != nil {
+			cgroupPath = specCgroupPath(spec.Linux.CgroupsPath)
+		}
 	}
 
 	// Cpu related
@@ -133,14 +180,26 @@ func (c *containerdEngine) ctrToInfo(namespacedContext context.Context, containe
 		imageRepo   string
 		imageTag    string
 		imageSize   int64 = -1
+		pulledAt    int64
+		platform    imagePlatform
 	)
-	// TODO this is an extra API call; shall we move it behing config.GetWithSize()?
-	// Or rename `with_size` option with something more generic like `full_info`?
-	image, _ := container.Image(namespacedContext)
-	if image != nil {
-		imageDigest = image.Target().Digest.String()
-		if config.GetWithSize() {
-			imageSize = image.Target().Size
+	// Cached, as shared by many containers; missing until the image is ready
+	namespace, _ := namespaces.Namespace(namespacedContext)
+	if info.Image != "" {
+		meta, ok := c.images.get(containerdImageKey(namespace, info.Image), func() (containerdImageMeta, error) {
+			image, err := container.Image(namespacedContext)
+			if err != nil {
+				return containerdImageMeta{}, err
+			}
+			return c.imageMeta(namespacedContext, image.Metadata())
+		})
+		if ok {
+			imageDigest = meta.digest
+			pulledAt = meta.pulledAt
+			if config.GetWithSize() {
+				imageSize = meta.size
+			}
+			platform = meta.platform
 		}
 	}
 	imageRepoTag := strings.Split(info.Image, ":")
@@ -149,7 +208,13 @@ func (c *containerdEngine) ctrToInfo(namespacedContext context.Context, containe
 		imageTag = imageRepoTag[1]
 	}
 
-	// Network related - TODO
+	runtime := containerdRuntime(info.Runtime)
+
+	// Network related: only available when the CNI result got stored as annotation
+	networks := []event.Network{}
+	if result, ok := spec.Annotations[cniResultAnnotation]; ok {
+		networks = cniResultToNetworks(result)
+	}
 
 	labels := make(map[string]string)
 	for key, val := range info.Labels {
@@ -196,36 +261,77 @@ func (c *containerdEngine) ctrToInfo(namespacedContext context.Context, containe
 		privileged = false
 	}
 
+	// State related: containers without a task were never started
+	state := event.StateCreated
+	exit := exitInfo{}
+	task, err := container.Task(namespacedContext, nil)
+	if err == nil {
+		status, err := task.Status(namespacedContext)
+		if err == nil {
+			state = normalizeState(string(status.Status))
+			if state == event.StateExited {
+				exit.code = int(status.ExitStatus)
+				if !status.ExitTime.IsZero() {
+					exit.finishedAt = status.ExitTime.Unix()
+				}
+			}
+		} else {
+			state = event.StateUnknown
+		}
+	}
+
 	return event.Info{
 		Container: event.Container{
-			Type:             typeContainerd.ToCTValue(),
-			ID:               shortContainerID(container.ID()),
-			Name:             shortContainerID(container.ID()),
-			Image:            info.Image,
-			ImageDigest:      imageDigest,
-			ImageRepo:        imageRepo,
-			ImageTag:         imageTag,
-			User:             strconv.FormatUint(uint64(spec.Process.User.UID), 10),
-			CPUPeriod:        int64(cpuPeriod),
-			CPUQuota:         cpuQuota,
-			CPUShares:        int64(cpuShares),
-			CPUSetCPUCount:   cpusetCount,
-			CreatedTime:      info.CreatedAt.Unix(),
-			Env:              spec.Process.Env,
-			FullID:           container.ID(),
-			HostIPC:          hostIPC,
-			HostNetwork:      hostNetwork,
-			HostPID:          hostPID,
-			Ip:               "", // TODO
-			IsPodSandbox:     isPodSandbox,
-			Labels:           labels,
-			MemoryLimit:      memoryLimit,
-			SwapLimit:        swapLimit,
-			PodSandboxID:     info.SandboxID,
-			Privileged:       privileged,
-			PodSandboxLabels: podSandboxLabels,
-			Mounts:           mounts,
-			Size:             imageSize,
+			Type:              typeContainerd.ToCTValue(),
+			Engine:            string(typeContainerd),
+			ID:                containerID(container.ID()),
+			Name:              shortContainerID(container.ID()),
+			Image:             info.Image,
+			ImageDigest:       imageDigest,
+			ImageRepo:         imageRepo,
+			ImageTag:          imageTag,
+			User:              strconv.FormatUint(uint64(spec.Process.User.UID), 10),
+			CPUPeriod:         int64(cpuPeriod),
+			CPUQuota:          cpuQuota,
+			CPUShares:         int64(cpuShares),
+			CPUSetCPUCount:    cpusetCount,
+			CreatedTime:       info.CreatedAt.Unix(),
+			Env:               spec.Process.Env,
+			FullID:            container.ID(),
+			HostIPC:           hostIPC,
+			HostNetwork:       hostNetwork,
+			HostPID:           hostPID,
+			Ip:                "", // TODO
+			IsPodSandbox:      isPodSandbox,
+			Labels:            labels,
+			MemoryLimit:       memoryLimit,
+			SwapLimit:         swapLimit,
+			PodSandboxID:      info.SandboxID,
+			Privileged:        privileged,
+			PodSandboxLabels:  podSandboxLabels,
+			Mounts:            mounts,
+			Size:              imageSize,
+			State:             state,
+			ExitCode:          exit.code,
+			OOMKilled:         exit.oomKilled,
+			FinishedAt:        exit.finishedAt,
+			Networks:          networks,
+			UsernsMode:        usernsMode,
+			UIDMappings:       uidMappings,
+			GIDMappings:       gidMappings,
+			Entrypoint:        argv(spec.Process.Args),
+			Cmd:               []string{},
+			CgroupPath:        cgroupPath,
+			CgroupsVersion:    hostCgroupsVersion(),
+			NetworkAliases:    []string{},
+			ImagePulledAt:     pulledAt,
+			Devices:           devices(append(specDevices(spec.Linux), runtimeDevices(spec.Process.Env, spec.Annotations)...)...),
+			Runtime:           normalizeRuntime(runtime),
+			RuntimeRaw:        runtime,
+			ImageOS:           platform.os,
+			ImageArchitecture: platform.architecture,
+			ImageVariant:      platform.variant,
+			HostArchitecture:  hostArchitecture(),
 		},
 	}
 }
@@ -248,6 +354,15 @@ func (c *containerdEngine) get(ctx context.Context, containerId string) (*event.
 	return nil, nil
 }
 
+// apiVersion returns the containerd version, containerd versioning its API along with the daemon.
+func (c *containerdEngine) apiVersion(ctx context.Context) (string, error) {
+	version, err := c.client.Version(ctx)
+	if err != nil {
+		return "", err
+	}
+	return version.Version, nil
+}
+
 func (c *containerdEngine) Name() string {
 	return string(typeContainerd)
 }
@@ -269,13 +384,17 @@ func (c *containerdEngine) List(ctx context.Context) ([]event.Event, error) {
 			continue
 		}
 		for _, container := range containersList {
+			info := c.ctrToInfo(namespacedContext, container)
+			if !emitsListed(typeContainerd, info.State) {
+				continue
+			}
 			evts = append(evts, event.Event{
-				Info:     c.ctrToInfo(namespacedContext, container),
+				Info:     info,
 				IsCreate: true,
 			})
 		}
 	}
-	return evts, nil
+	return c.filterInfra(evts), nil
 }
 
 func (c *containerdEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
@@ -283,19 +402,28 @@ func (c *containerdEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-ch
 	eventsClient := c.client.EventService()
 
 	topics := make([]string, 0)
-	if config.IsHookEnabled(config.HookCreate) {
+	if emitsOnCreate(typeContainerd) {
 		topics = append(topics, `topic=="/containers/create"`)
 	}
-	if config.IsHookEnabled(config.HookStart) {
+	// Without the start hook, still needed to update create events with the running state.
+	startEmit, startUpdate := emitsOnStart(typeContainerd)
+	if startEmit || config.IsHookEnabled(config.HookCreate) {
 		topics = append(topics, `topic=="/tasks/start"`)
 	}
+	// Always needed to track exit details for the delete event.
+	topics = append(topics, `topic=="/tasks/oom"`)
+	topics = append(topics, `topic=="/tasks/exit"`)
 	topics = append(topics, `topic=="/containers/delete"`)
+	// Pre-warm the image metadata, and update the containers created before their image was ready.
+	topics = append(topics, `topic=="/images/create"`)
+	topics = append(topics, `topic=="/images/update"`)
+	topics = append(topics, `topic=="/images/delete"`)
 
 	eventsCh, _ := eventsClient.Subscribe(ctx, topics...)
-	wg.Add(1)
-	go func() {
+	GoListener(wg, c, func() {
 		defer close(outCh)
-		defer wg.Done()
+		exits := make(exitInfos)
+		waiters := newContainerdImageWaiters()
 		for {
 			select {
 			case <-ctx.Done():
@@ -313,6 +441,7 @@ func (c *containerdEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-ch
 					id       string
 					isCreate bool
 					image    string
+					state    string
 					info     event.Info
 				)
 				switch ev.Topic {
@@ -322,32 +451,97 @@ func (c *containerdEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-ch
 					id = ctrCreate.ID
 					isCreate = true
 					image = ctrCreate.Image
+					state = event.StateCreated
 				case "/tasks/start":
 					ctrStart := events.TaskStart{}
 					_ = typeurl.UnmarshalTo(ev.Event, &ctrStart)
 					id = ctrStart.ContainerID
 					isCreate = true
+					state = event.StateRunning
+				case "/tasks/oom":
+					taskOOM := events.TaskOOM{}
+					_ = typeurl.UnmarshalTo(ev.Event, &taskOOM)
+					info := exits[taskOOM.ContainerID]
+					info.oomKilled = true
+					exits.store(taskOOM.ContainerID, info)
+					continue
+				case "/tasks/exit":
+					taskExit := events.TaskExit{}
+					_ = typeurl.UnmarshalTo(ev.Event, &taskExit)
+					if taskExit.ID != taskExit.ContainerID {
+						// An exec'd process exited, not the container init one
+						continue
+					}
+					id = taskExit.ContainerID
+					info := exits[id]
+					info.code = int(taskExit.ExitStatus)
+					if taskExit.ExitedAt != nil {
+						info.finishedAt = taskExit.ExitedAt.AsTime().Unix()
+					}
+					exits.store(id, info)
+					if !config.IsHookEnabled(config.HookExit) {
+						continue
+					}
+					isCreate = true
+					state = event.StateExited
 				case "/containers/delete":
 					ctrDelete := events.ContainerDelete{}
 					_ = typeurl.UnmarshalTo(ev.Event, &ctrDelete)
 					id = ctrDelete.ID
 					isCreate = false
+					state = event.StateRemoved
+					waiters.remove(id)
+				case "/images/create":
+					imgCreate := events.ImageCreate{}
+					_ = typeurl.UnmarshalTo(ev.Event, &imgCreate)
+					c.imageReady(ctx, ev.Namespace, imgCreate.Name, waiters, outCh)
+					continue
+				case "/images/update":
+					imgUpdate := events.ImageUpdate{}
+					_ = typeurl.UnmarshalTo(ev.Event, &imgUpdate)
+					c.imageReady(ctx, ev.Namespace, imgUpdate.Name, waiters, outCh)
+					continue
+				case "/images/delete":
+					imgDelete := events.ImageDelete{}
+					_ = typeurl.UnmarshalTo(ev.Event, &imgDelete)
+					c.images.delete(containerdImageKey(ev.Namespace, imgDelete.Name))
+					continue
+				}
+				// minimum set of infos - either for containers/delete
+				// or for other hooks but with an error.
+				minimal := event.Info{
+					Container: event.Container{
+						Type:   typeContainerd.ToCTValue(),
+						Engine: string(typeContainerd),
+						ID:     containerID(id),
+						FullID: id,
+						Image:  image,
+						State:  state,
+					},
 				}
-				namespacedContext := namespaces.WithNamespace(ctx, ev.Namespace)
-				container, err := c.client.LoadContainer(namespacedContext, id)
-				if err != nil {
-					// minimum set of infos - either for containers/delete
-					// or for other hooks but with an error.
-					info = event.Info{
-						Container: event.Container{
-							Type:   typeContainerd.ToCTValue(),
-							ID:     shortContainerID(id),
-							FullID: id,
-							Image:  image,
-						},
+				info, _ = enrich(namespaces.WithNamespace(ctx, ev.Namespace), c, minimal,
+					func(ctx context.Context) (event.Info, error) {
+						container, err := c.client.LoadContainer(ctx, id)
+						if err != nil {
+							return event.Info{}, err
+						}
+						return c.ctrToInfo(ctx, container), nil
+					}, nil)
+				switch ev.Topic {
+				case "/tasks/start":
+					info.Update = startUpdate
+				case "/tasks/exit":
+					// The task status might not reflect the exit yet
+					info.State = state
+					exits[id].apply(&info.Container)
+				case "/containers/delete":
+					exits.take(id).apply(&info.Container)
+				}
+				if isCreate && info.Image != "" && info.ImageDigest == "" && !info.Degraded() {
+					// Sent now, updated once the image is ready
+					if !waiters.wait(containerdImageKey(ev.Namespace, info.Image), id) {
+						logger.Debugf("too many containers waiting for their image, skipping container %s", id)
 					}
-				} else {
-					info = c.ctrToInfo(namespacedContext, container)
 				}
 				outCh <- event.Event{
 					Info:     info,
@@ -355,6 +549,54 @@ func (c *containerdEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-ch
 				}
 			}
 		}
-	}()
-	return outCh, nil
+	})
+	return c.forwardInfra(ctx, wg, c, outCh), nil
+}
+
+// imageMeta returns the metadata of the image, resolving its platform from its content.
+func (c *containerdEngine) imageMeta(ctx context.Context, img images.Image) (containerdImageMeta, error) {
+	if img.Target.Digest == "" {
+		return containerdImageMeta{}, errContainerdImageNotReady
+	}
+	// Best effort: the content may not be available, eg: garbage collected
+	platform, _ := containerdImagePlatform(ctx, c.client.ContentStore(), img.Target)
+	return newContainerdImageMeta(img, platform), nil
+}
+
+// imageReady refreshes the cached metadata of an image created or updated, eg: once pulled or unpacked,
+// sending the update of the containers that were waiting for it.
+func (c *containerdEngine) imageReady(ctx context.Context, namespace, name string, waiters *containerdImageWaiters,
+	outCh chan<- event.Event) {
+	namespacedContext := namespaces.WithNamespace(ctx, namespace)
+	key := containerdImageKey(namespace, name)
+	img, err := c.client.ImageService().Get(namespacedContext, name)
+	if err != nil {
+		c.images.delete(key)
+		return
+	}
+	meta, err := c.imageMeta(namespacedContext, img)
+	if err != nil {
+		c.images.delete(key)
+		return
+	}
+	c.images.store(key, meta)
+	for _, id := range waiters.take(key) {
+		info, ok := enrich(namespacedContext, c, event.Info{}, func(ctx context.Context) (event.Info, error) {
+			container, err := c.client.LoadContainer(ctx, id)
+			if err != nil {
+				return event.Info{}, err
+			}
+			return c.ctrToInfo(ctx, container), nil
+		}, nil)
+		if !ok {
+			// Gone meanwhile
+			continue
+		}
+		info.Update = true
+		select {
+		case outCh <- event.Event{Info: info, IsCreate: true}:
+		case <-ctx.Done():
+			return
+		}
+	}
 }
@@ -0,0 +1,187 @@
+//go:build !no_containerd
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// maxContainerdImageWaiters bounds the containers waiting for the metadata of their image.
+const maxContainerdImageWaiters = 1024
+
+// containerdImageMeta is the metadata of a containerd image, the same for all of its containers.
+type containerdImageMeta struct {
+	digest   string
+	size     int64
+	pulledAt int64
+	platform imagePlatform
+}
+
+func newContainerdImageMeta(img images.Image, platform imagePlatform) containerdImageMeta {
+	return containerdImageMeta{
+		digest:   img.Target.Digest.String(),
+		size:     img.Target.Size,
+		pulledAt: containerdImagePulledAt(img),
+		platform: platform,
+	}
+}
+
+// errContainerdImageNotReady is returned for the images whose record does not point to any content yet.
+var errContainerdImageNotReady = errors.New("image not ready")
+
+// isHostPlatform returns whether the platform of a manifest list entry is the one of the node.
+func isHostPlatform(p *ocispec.Platform) bool {
+	return p != nil && p.OS == runtime.GOOS && p.Architecture == runtime.GOARCH
+}
+
+// containerdImagePlatform resolves the platform of the local image from its config descriptor.
+// For manifest lists, only the manifests whose content got pulled are considered, the host platform first,
+// as images pulled for a foreign platform only have the manifest of that platform.
+func containerdImagePlatform(ctx context.Context, provider content.Provider, target ocispec.Descriptor) (imagePlatform, error) {
+	manifests := []ocispec.Descriptor{target}
+	if images.IsIndexType(target.MediaType) {
+		p, err := content.ReadBlob(ctx, provider, target)
+		if err != nil {
+			return imagePlatform{}, err
+		}
+		var idx ocispec.Index
+		if err := json.Unmarshal(p, &idx); err != nil {
+			return imagePlatform{}, err
+		}
+		manifests = idx.Manifests
+		sort.SliceStable(manifests, func(i, j int) bool {
+			return isHostPlatform(manifests[i].Platform) && !isHostPlatform(manifests[j].Platform)
+		})
+	}
+	for _, desc := range manifests {
+		// Skip the attestation manifests too
+		if !images.IsManifestType(desc.MediaType) || (desc.Platform != nil && desc.Platform.OS == "unknown") {
+			continue
+		}
+		p, err := content.ReadBlob(ctx, provider, desc)
+		if err != nil {
+			// Not pulled
+			continue
+		}
+		var manifest ocispec.Manifest
+		if err := json.Unmarshal(p, &manifest); err != nil {
+			continue
+		}
+		platform, err := images.ConfigPlatform(ctx, provider, manifest.Config)
+		if err != nil {
+			continue
+		}
+		return imagePlatform{os: platform.OS, architecture: platform.Architecture, variant: platform.Variant}, nil
+	}
+	return imagePlatform{}, fmt.Errorf("no manifest of image %s available", target.Digest)
+}
+
+// containerdImageKey is the key of an image, by namespace as image names are namespaced.
+func containerdImageKey(namespace, name string) string {
+	return namespace + "/" + name
+}
+
+// containerdImages caches the metadata of the images by containerdImageKey, pre-warmed by the image events
+// of the listener, that refresh it once an image gets pulled again, or unpacked, and drop it on delete.
+// Images missing from the runtime are not cached.
+type containerdImages struct {
+	mu    sync.Mutex
+	metas map[string]containerdImageMeta
+}
+
+func newContainerdImages() *containerdImages {
+	return &containerdImages{metas: make(map[string]containerdImageMeta)}
+}
+
+// get returns the metadata of the image, looking it up on cache misses.
+func (c *containerdImages) get(key string, lookup func() (containerdImageMeta, error)) (containerdImageMeta, bool) {
+	c.mu.Lock()
+	meta, ok := c.metas[key]
+	c.mu.Unlock()
+	if ok {
+		return meta, true
+	}
+	meta, err := lookup()
+	if err != nil {
+		return containerdImageMeta{}, false
+	}
+	c.store(key, meta)
+	return meta, true
+}
+
+func (c *containerdImages) store(key string, meta containerdImageMeta) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.metas[key] = meta
+}
+
+func (c *containerdImages) delete(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.metas, key)
+}
+
+// containerdImageWaiters are the containers whose image metadata was not ready when inspected, by image key,
+// whose event must be followed by an update once it is.
+// Only used by the listener goroutine.
+type containerdImageWaiters struct {
+	byImage map[string]map[string]struct{}
+	// The image key of each waiting container, by container ID.
+	images map[string]string
+}
+
+func newContainerdImageWaiters() *containerdImageWaiters {
+	return &containerdImageWaiters{
+		byImage: make(map[string]map[string]struct{}),
+		images:  make(map[string]string),
+	}
+}
+
+// wait makes the container wait for the image; returns false if too many containers are already waiting.
+func (w *containerdImageWaiters) wait(key, id string) bool {
+	if _, ok := w.images[id]; !ok && len(w.images) >= maxContainerdImageWaiters {
+		return false
+	}
+	w.remove(id)
+	ids, ok := w.byImage[key]
+	if !ok {
+		ids = make(map[string]struct{})
+		w.byImage[key] = ids
+	}
+	ids[id] = struct{}{}
+	w.images[id] = key
+	return true
+}
+
+// remove stops the container from waiting, eg: once removed.
+func (w *containerdImageWaiters) remove(id string) {
+	key, ok := w.images[id]
+	if !ok {
+		return
+	}
+	delete(w.images, id)
+	delete(w.byImage[key], id)
+	if len(w.byImage[key]) == 0 {
+		delete(w.byImage, key)
+	}
+}
+
+// take returns the containers waiting for the image, that stop waiting.
+func (w *containerdImageWaiters) take(key string) []string {
+	ids := make([]string, 0, len(w.byImage[key]))
+	for id := range w.byImage[key] {
+		ids = append(ids, id)
+		delete(w.images, id)
+	}
+	delete(w.byImage, key)
+	return ids
+}
@@ -1,17 +1,33 @@
+//go:build !no_containerd
+
 package container
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"errors"
+	"github.com/containerd/containerd/api/types/runc/options"
 	containerd "github.com/containerd/containerd/v2/client"
+	"github.com/containerd/containerd/v2/core/containers"
+	"github.com/containerd/containerd/v2/core/content"
+	"github.com/containerd/containerd/v2/core/images"
 	"github.com/containerd/containerd/v2/pkg/namespaces"
 	"github.com/containerd/containerd/v2/pkg/oci"
+	"github.com/containerd/typeurl/v2"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
 	"github.com/google/uuid"
+	"github.com/opencontainers/go-digest"
+	ocispec "github.com/opencontainers/image-spec/specs-go/v1"
 	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"os/user"
+	"runtime"
+	"sort"
 	"sync"
 	"testing"
+	"time"
 )
 
 func testContainerd(t *testing.T, withFetcher bool) {
@@ -37,6 +53,8 @@ func testContainerd(t *testing.T, withFetcher bool) {
 		_, err = client.Pull(namespacedCtx, "docker.io/library/alpine:3.20.3")
 		assert.NoError(t, err)
 	}
+	img, err := client.GetImage(namespacedCtx, "docker.io/library/alpine:3.20.3")
+	require.NoError(t, err)
 
 	id := uuid.New()
 	var cpuQuota int64 = 2000
@@ -73,29 +91,47 @@ func testContainerd(t *testing.T, withFetcher bool) {
 	expectedEvent := event.Event{
 		Info: event.Info{
 			Container: event.Container{
-				Type:             typeContainerd.ToCTValue(),
-				ID:               shortContainerID(ctr.ID()),
-				Name:             shortContainerID(ctr.ID()),
-				Image:            "docker.io/library/alpine:3.20.3",
-				ImageRepo:        "docker.io/library/alpine",
-				ImageTag:         "3.20.3",
-				ImageDigest:      "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
-				CPUPeriod:        defaultCpuPeriod,
-				CPUQuota:         cpuQuota,
-				CPUShares:        defaultCpuShares,
-				CPUSetCPUCount:   2, // 0-1
-				Env:              nil,
-				FullID:           ctr.ID(),
-				HostIPC:          false,
-				HostPID:          false,
-				HostNetwork:      true,
-				Labels:           map[string]string{},
-				PodSandboxID:     "",
-				Privileged:       true,
-				PodSandboxLabels: nil,
-				Mounts:           []event.Mount{},
-				User:             "0",
-				Size:             -1,
+				Type:              typeContainerd.ToCTValue(),
+				Engine:            string(typeContainerd),
+				ID:                shortContainerID(ctr.ID()),
+				Name:              shortContainerID(ctr.ID()),
+				Image:             "docker.io/library/alpine:3.20.3",
+				ImageRepo:         "docker.io/library/alpine",
+				ImageTag:          "3.20.3",
+				ImageDigest:       "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
+				CPUPeriod:         defaultCpuPeriod,
+				CPUQuota:          cpuQuota,
+				CPUShares:         defaultCpuShares,
+				CPUSetCPUCount:    2, // 0-1
+				Env:               nil,
+				FullID:            ctr.ID(),
+				HostIPC:           false,
+				HostPID:           false,
+				HostNetwork:       true,
+				Labels:            map[string]string{},
+				PodSandboxID:      "",
+				Privileged:        true,
+				PodSandboxLabels:  nil,
+				Mounts:            []event.Mount{},
+				User:              "0",
+				Size:              -1,
+				State:             event.StateCreated,
+				Networks:          []event.Network{},
+				UsernsMode:        event.UsernsHost,
+				UIDMappings:       []event.IDMapping{},
+				GIDMappings:       []event.IDMapping{},
+				Entrypoint:        []string{},
+				Cmd:               []string{},
+				CgroupPath:        "",
+				CgroupsVersion:    hostCgroupsVersion(),
+				NetworkAliases:    []string{},
+				Devices:           []string{},
+				Runtime:           event.RuntimeRunc,
+				RuntimeRaw:        "io.containerd.runc.v2",
+				ImageOS:           "linux",
+				ImageArchitecture: runtime.GOARCH,
+				HostArchitecture:  hostArchitecture(),
+				ImagePulledAt:     img.Metadata().UpdatedAt.Unix(),
 			}},
 		IsCreate: true,
 	}
@@ -138,9 +174,12 @@ func testContainerd(t *testing.T, withFetcher bool) {
 	expectedEvent = event.Event{
 		Info: event.Info{
 			Container: event.Container{
-				Type:   typeContainerd.ToCTValue(),
-				ID:     shortContainerID(ctr.ID()),
-				FullID: ctr.ID(),
+				Type:     typeContainerd.ToCTValue(),
+				Engine:   string(typeContainerd),
+				ID:       shortContainerID(ctr.ID()),
+				FullID:   ctr.ID(),
+				State:    event.StateRemoved,
+				ExitCode: -1,
 			}},
 		IsCreate: false,
 	}
@@ -153,3 +192,218 @@ func testContainerd(t *testing.T, withFetcher bool) {
 func TestContainerd(t *testing.T) {
 	testContainerd(t, false)
 }
+
+func TestContainerdFetcher(t *testing.T) {
+	testContainerd(t, true)
+}
+
+func TestContainerdRuntime(t *testing.T) {
+	nvidiaOpts, err := typeurl.MarshalAny(&options.Options{BinaryName: "/usr/bin/nvidia-container-runtime"})
+	require.NoError(t, err)
+	defaultOpts, err := typeurl.MarshalAny(&options.Options{SystemdCgroup: true})
+	require.NoError(t, err)
+
+	tCases := map[string]struct {
+		runtime         containers.RuntimeInfo
+		expectedRuntime string
+	}{
+		"Shim": {
+			runtime:         containers.RuntimeInfo{Name: "io.containerd.kata.v2"},
+			expectedRuntime: "io.containerd.kata.v2",
+		},
+		"Shim binary": {
+			runtime:         containers.RuntimeInfo{Name: "io.containerd.runc.v2", Options: nvidiaOpts},
+			expectedRuntime: "/usr/bin/nvidia-container-runtime",
+		},
+		"Shim default binary": {
+			runtime:         containers.RuntimeInfo{Name: "io.containerd.runc.v2", Options: defaultOpts},
+			expectedRuntime: "io.containerd.runc.v2",
+		},
+		"Unknown": {
+			runtime:         containers.RuntimeInfo{},
+			expectedRuntime: "",
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRuntime, containerdRuntime(tc.runtime))
+		})
+	}
+}
+
+func TestContainerdImages(t *testing.T) {
+	const digest = "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a"
+	pulledAt := time.Unix(1731000000, 0)
+	img := images.Image{
+		Name:      "docker.io/library/alpine:3.20.3",
+		Target:    ocispec.Descriptor{Digest: digest, Size: 1024},
+		CreatedAt: pulledAt,
+	}
+	platform := imagePlatform{os: "linux", architecture: "arm64", variant: "v8"}
+	key := containerdImageKey("default", img.Name)
+	cache := newContainerdImages()
+	lookups := 0
+	lookup := func(err error) func() (containerdImageMeta, error) {
+		return func() (containerdImageMeta, error) {
+			lookups++
+			if err != nil {
+				return containerdImageMeta{}, err
+			}
+			return newContainerdImageMeta(img, platform), nil
+		}
+	}
+
+	// Not ready yet: not cached
+	_, ok := cache.get(key, lookup(errContainerdImageNotReady))
+	assert.False(t, ok)
+
+	// Pre-warmed by the image events: no lookup
+	cache.store(key, newContainerdImageMeta(img, platform))
+	meta, ok := cache.get(key, lookup(nil))
+	assert.True(t, ok)
+	assert.Equal(t, containerdImageMeta{digest: digest, size: 1024, pulledAt: pulledAt.Unix(), platform: platform}, meta)
+	assert.Equal(t, 1, lookups)
+
+	// Namespaced
+	_, ok = cache.get(containerdImageKey("k8s.io", img.Name), lookup(errors.New("image not found")))
+	assert.False(t, ok)
+	assert.Equal(t, 2, lookups)
+
+	cache.delete(key)
+	_, ok = cache.get(key, lookup(nil))
+	assert.True(t, ok)
+	assert.Equal(t, 3, lookups)
+}
+
+// memProvider is a content.Provider serving its blobs from memory.
+type memProvider map[digest.Digest][]byte
+
+type memReaderAt struct {
+	*bytes.Reader
+}
+
+func (memReaderAt) Close() error {
+	return nil
+}
+
+func (m memProvider) ReaderAt(_ context.Context, desc ocispec.Descriptor) (content.ReaderAt, error) {
+	blob, ok := m[desc.Digest]
+	if !ok {
+		return nil, errors.New("blob not found")
+	}
+	return memReaderAt{bytes.NewReader(blob)}, nil
+}
+
+// add stores the JSON of v, returning its descriptor.
+func (m memProvider) add(t *testing.T, mediaType string, v any, platform *ocispec.Platform) ocispec.Descriptor {
+	blob, err := json.Marshal(v)
+	require.NoError(t, err)
+	desc := ocispec.Descriptor{MediaType: mediaType, Digest: digest.FromBytes(blob), Size: int64(len(blob)), Platform: platform}
+	m[desc.Digest] = blob
+	return desc
+}
+
+// addImage stores the manifest of an image for the platform, along with its config, returning its descriptor.
+func (m memProvider) addImage(t *testing.T, platform ocispec.Platform) ocispec.Descriptor {
+	cfg := m.add(t, ocispec.MediaTypeImageConfig, ocispec.Image{Platform: platform}, nil)
+	return m.add(t, ocispec.MediaTypeImageManifest, ocispec.Manifest{MediaType: ocispec.MediaTypeImageManifest, Config: cfg}, &platform)
+}
+
+func TestContainerdImagePlatform(t *testing.T) {
+	host := ocispec.Platform{OS: runtime.GOOS, Architecture: runtime.GOARCH}
+	foreign := ocispec.Platform{OS: "linux", Architecture: "arm", Variant: "v7"}
+	if runtime.GOARCH == "arm" {
+		foreign.Architecture = "amd64"
+		foreign.Variant = ""
+	}
+	attestation := ocispec.Platform{OS: "unknown", Architecture: "unknown"}
+
+	tCases := map[string]struct {
+		// The platforms of the manifest list, if any, and the ones pulled
+		platforms        []ocispec.Platform
+		pulled           []ocispec.Platform
+		expectedPlatform imagePlatform
+		expectedErr      bool
+	}{
+		"Single platform": {
+			pulled:           []ocispec.Platform{foreign},
+			expectedPlatform: imagePlatform{os: foreign.OS, architecture: foreign.Architecture, variant: foreign.Variant},
+		},
+		"Manifest list": {
+			platforms:        []ocispec.Platform{attestation, foreign, host},
+			pulled:           []ocispec.Platform{attestation, foreign, host},
+			expectedPlatform: imagePlatform{os: host.OS, architecture: host.Architecture},
+		},
+		"Manifest list pulled for a foreign platform": {
+			platforms:        []ocispec.Platform{host, foreign},
+			pulled:           []ocispec.Platform{foreign},
+			expectedPlatform: imagePlatform{os: foreign.OS, architecture: foreign.Architecture, variant: foreign.Variant},
+		},
+		"Manifest list not pulled": {
+			platforms:   []ocispec.Platform{host, foreign},
+			expectedErr: true,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			provider := make(memProvider)
+			pulled := make([]ocispec.Descriptor, 0, len(tc.pulled))
+			for _, p := range tc.pulled {
+				pulled = append(pulled, provider.addImage(t, p))
+			}
+			var target ocispec.Descriptor
+			if len(pulled) > 0 {
+				target = pulled[0]
+			}
+			if tc.platforms != nil {
+				idx := ocispec.Index{MediaType: ocispec.MediaTypeImageIndex}
+				for _, p := range tc.platforms {
+					// Only the digest of the manifests not pulled is known
+					desc := (make(memProvider)).addImage(t, p)
+					for _, d := range pulled {
+						if d.Platform.Architecture == p.Architecture && d.Platform.OS == p.OS {
+							desc = d
+						}
+					}
+					idx.Manifests = append(idx.Manifests, desc)
+				}
+				target = provider.add(t, ocispec.MediaTypeImageIndex, idx, nil)
+			}
+
+			platform, err := containerdImagePlatform(context.Background(), provider, target)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedPlatform, platform)
+		})
+	}
+}
+
+func TestContainerdImageWaiters(t *testing.T) {
+	alpine := containerdImageKey("default", "docker.io/library/alpine:3.20.3")
+	nginx := containerdImageKey("default", "docker.io/library/nginx:1.27")
+	w := newContainerdImageWaiters()
+
+	assert.True(t, w.wait(alpine, "c1"))
+	assert.True(t, w.wait(alpine, "c2"))
+	assert.True(t, w.wait(nginx, "c3"))
+	assert.True(t, w.wait(alpine, "c4"))
+	// Removed before the image got ready
+	w.remove("c4")
+
+	ids := w.take(alpine)
+	sort.Strings(ids)
+	assert.Equal(t, []string{"c1", "c2"}, ids)
+	assert.Empty(t, w.take(alpine))
+	assert.Equal(t, []string{"c3"}, w.take(nginx))
+	assert.Empty(t, w.images)
+
+	for i := 0; i < maxContainerdImageWaiters; i++ {
+		require.True(t, w.wait(alpine, uuid.NewString()))
+	}
+	assert.False(t, w.wait(nginx, "c5"))
+}
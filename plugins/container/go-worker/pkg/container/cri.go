@@ -1,3 +1,5 @@
+//go:build !no_cri
+
 package container
 
 import (
@@ -6,9 +8,7 @@ import (
 	"fmt"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
-	internalapi "k8s.io/cri-api/pkg/apis"
 	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
-	remote "k8s.io/cri-client/pkg"
 	"strconv"
 	"strings"
 	"sync"
@@ -18,13 +18,38 @@ import (
 const maxCNILen = 4096
 
 func init() {
-	engineGenerators[typeCri] = newCriEngine
+	register(typeCri, newCriEngine)
+	registerRemote(typeCri, newCriRemoteEngine)
+}
+
+// criRuntime is the subset of internalapi.RuntimeService used by criEngine,
+// so that it can be served by criRemoteClient too.
+type criRuntime interface {
+	Version(ctx context.Context, apiVersion string) (*v1.VersionResponse, error)
+	ListContainers(ctx context.Context, filter *v1.ContainerFilter) ([]*v1.Container, error)
+	ContainerStatus(ctx context.Context, containerID string, verbose bool) (*v1.ContainerStatusResponse, error)
+	PodSandboxStatus(ctx context.Context, podSandboxID string, verbose bool) (*v1.PodSandboxStatusResponse, error)
+	ContainerStats(ctx context.Context, containerID string) (*v1.ContainerStats, error)
+	GetContainerEvents(ctx context.Context, containerEventsCh chan *v1.ContainerEventResponse,
+		connectionEstablishedCallback func(v1.RuntimeService_GetContainerEventsClient)) error
+}
+
+// criImages is the subset of internalapi.ImageManagerService used by criEngine.
+type criImages interface {
+	ImageStatus(ctx context.Context, image *v1.ImageSpec, verbose bool) (*v1.ImageStatusResponse, error)
 }
 
 type criEngine struct {
-	client  internalapi.RuntimeService
-	runtime int // as CT_FOO value
-	socket  string
+	*infraFilter
+	ref    *clientRef
+	client criRuntime
+	images criImages
+	// imageMetas caches the image metadata, by image ref
+	imageMetas *imageCache[criImageMeta]
+	runtime    int // as CT_FOO value
+	socket     string
+	// tlsCfg is set for engines reached at a remote endpoint, held by socket
+	tlsCfg *config.TLSConfig
 }
 
 // See https://github.com/falcosecurity/libs/blob/4d04cad02cd27e53cb18f431361a4d031836bb75/userspace/libsinsp/cri.hpp#L71
@@ -37,25 +62,67 @@ func getRuntime(runtime string) int {
 }
 
 func newCriEngine(ctx context.Context, socket string) (Engine, error) {
-	client, err := remote.NewRemoteRuntimeService(socket, 5*time.Second, nil, nil)
+	client, err := newCriSocketClient(socket, 5*time.Second)
 	if err != nil {
 		return nil, err
 	}
 	version, err := client.Version(ctx, "")
 	if err != nil {
+		_ = client.Close()
 		return nil, err
 	}
 	return &criEngine{
-		client:  client,
-		runtime: getRuntime(version.RuntimeName),
-		socket:  socket,
+		infraFilter: newInfraFilter(typeCri),
+		ref:         openClient(string(typeCri), socket),
+		client:      client,
+		images:      client,
+		imageMetas:  newImageCache[criImageMeta](),
+		runtime:     getRuntime(version.RuntimeName),
+		socket:      socket,
+	}, nil
+}
+
+// newCriRemoteEngine returns a criEngine reaching the runtime at endpoint, eg: a CRI proxy, over mTLS.
+func newCriRemoteEngine(ctx context.Context, endpoint string, tlsCfg config.TLSConfig) (Engine, error) {
+	client, err := newCriRemoteClient(endpoint, tlsCfg, 5*time.Second)
+	if err != nil {
+		return nil, err
+	}
+	version, err := client.Version(ctx, "")
+	if err != nil {
+		_ = client.Close()
+		return nil, err
+	}
+	return &criEngine{
+		infraFilter: newInfraFilter(typeCri),
+		ref:         openClient(string(typeCri), endpoint),
+		client:      client,
+		images:      client,
+		imageMetas:  newImageCache[criImageMeta](),
+		runtime:     getRuntime(version.RuntimeName),
+		socket:      endpoint,
+		tlsCfg:      &tlsCfg,
 	}, nil
 }
 
 func (c *criEngine) copy(ctx context.Context) (Engine, error) {
+	if c.tlsCfg != nil {
+		return newCriRemoteEngine(ctx, c.socket, *c.tlsCfg)
+	}
 	return newCriEngine(ctx, c.socket)
 }
 
+// Close closes the runtime client, along with its gRPC connection.
+func (c *criEngine) Close() error {
+	if !c.ref.release() {
+		return nil
+	}
+	if cl, ok := c.client.(closer); ok {
+		return cl.Close()
+	}
+	return nil
+}
+
 // Structures that maps container.Info() map
 type criInfo struct {
 	Privileged *bool `json:"privileged"`
@@ -67,18 +134,34 @@ type criInfo struct {
 			Key   string `json:"key"`
 			Value string `json:"value"`
 		} `json:"envs"`
+		Command []string `json:"command"`
+		Args    []string `json:"args"`
+		Devices []struct {
+			HostPath string `json:"host_path"`
+		} `json:"devices"`
 		Linux *struct {
 			SecurityContext *struct {
-				Privileged *bool `json:"privileged"`
+				Privileged       *bool `json:"privileged"`
+				NamespaceOptions *struct {
+					Pid      v1.NamespaceMode `json:"pid"`
+					TargetID string           `json:"target_id"`
+				} `json:"namespace_options"`
 			} `json:"security_context"`
 		} `json:"linux"`
 	} `json:"config"`
 	RuntimeSpec *struct {
 		Annotations map[string]string `json:"annotations"`
-		Linux       *struct {
+		Process     *struct {
+			Args []string `json:"args"`
+		} `json:"process"`
+		Linux *struct {
 			SecurityContext *struct {
 				Privileged *bool `json:"privileged"`
 			} `json:"security_context"`
+			CgroupsPath string `json:"cgroupsPath"`
+			Devices     []struct {
+				Path string `json:"path"`
+			} `json:"devices"`
 		} `json:"linux"`
 	} `json:"runtimeSpec"`
 }
@@ -117,6 +200,75 @@ func (info *criInfo) getEnvs() []string {
 	return env
 }
 
+// getCommand returns the container entrypoint and cmd from the CRI container config, that
+// kubernetes fills with the pod spec command and args; when missing, the resolved
+// argv of the runtime spec is returned as entrypoint.
+func (info *criInfo) getCommand() ([]string, []string) {
+	if info.Config != nil && (info.Config.Command != nil || info.Config.Args != nil) {
+		return argv(info.Config.Command), argv(info.Config.Args)
+	}
+	if info.RuntimeSpec != nil && info.RuntimeSpec.Process != nil {
+		return argv(info.RuntimeSpec.Process.Args), []string{}
+	}
+	return []string{}, []string{}
+}
+
+// getDevices returns the host devices mapped by the CRI container config, along with the device nodes
+// of the runtime spec and the devices allocated by the runtime, like GPUs.
+func (info *criInfo) getDevices(annotations map[string]string) []string {
+	res := make([]string, 0)
+	if info.Config != nil {
+		for _, d := range info.Config.Devices {
+			res = append(res, d.HostPath)
+		}
+	}
+	if info.RuntimeSpec != nil {
+		if info.RuntimeSpec.Linux != nil {
+			for _, d := range info.RuntimeSpec.Linux.Devices {
+				res = append(res, d.Path)
+			}
+		}
+		res = append(res, runtimeDevices(nil, info.RuntimeSpec.Annotations)...)
+	}
+	res = append(res, runtimeDevices(info.getEnvs(), annotations)...)
+	return devices(res...)
+}
+
+// getCgroupPath returns the container cgroup path from the runtime spec, if any.
+func (info *criInfo) getCgroupPath() string {
+	if info.RuntimeSpec != nil && info.RuntimeSpec.Linux != nil {
+		return specCgroupPath(info.RuntimeSpec.Linux.CgroupsPath)
+	}
+	return ""
+}
+
+// getSharedNamespaceTarget returns the ID of the container whose namespace this one joins:
+// the pod sandbox, whose network namespace is shared by all the pod containers unless on
+// the node network, or else the one its pid namespace targets, as per its CRI config.
+func (info *criInfo) getSharedNamespaceTarget(id, podSandboxID string, podNamespaces *v1.NamespaceOption) string {
+	if id == podSandboxID {
+		return ""
+	}
+	if podNamespaces.GetNetwork() != v1.NamespaceMode_NODE {
+		return containerID(podSandboxID)
+	}
+	pid := podNamespaces.GetPid()
+	targetID := ""
+	if info.Config != nil && info.Config.Linux != nil && info.Config.Linux.SecurityContext != nil &&
+		info.Config.Linux.SecurityContext.NamespaceOptions != nil {
+		pid = info.Config.Linux.SecurityContext.NamespaceOptions.Pid
+		targetID = info.Config.Linux.SecurityContext.NamespaceOptions.TargetID
+	}
+	switch pid {
+	case v1.NamespaceMode_POD:
+		return containerID(podSandboxID)
+	case v1.NamespaceMode_TARGET:
+		return containerID(targetID)
+	default:
+		return ""
+	}
+}
+
 func (info *criInfo) getAnnotation(key string) (string, bool) {
 	if info.RuntimeSpec != nil {
 		val, ok := info.RuntimeSpec.Annotations[key]
@@ -144,10 +296,80 @@ type cniSandboxInfo struct {
 		Interfaces []*CNIInterface `json:"interfaces"`
 	} `json:"cniResult"`
 	RuntimeSpec *struct {
+		Hostname    string            `json:"hostname"`
 		Annotations map[string]string `json:"annotations"`
 	} `json:"runtimeSpec"`
 }
 
+// getNetworkAliases returns the pod hostname, the name pod containers are resolved by
+// through the pod subdomain; pods on the node network share the node name instead, so have none.
+func (info *cniSandboxInfo) getNetworkAliases(hostNetwork bool) []string {
+	if hostNetwork || info.RuntimeSpec == nil {
+		return []string{}
+	}
+	return networkAliases(info.RuntimeSpec.Hostname)
+}
+
+// criImageInfo maps the verbose image status info, as reported by both containerd and cri-o.
+// The image spec is the config of the local image, so of the platform selected from a manifest list.
+type criImageInfo struct {
+	ImageSpec *struct {
+		Created      *time.Time `json:"created"`
+		OS           string     `json:"os"`
+		Architecture string     `json:"architecture"`
+		Variant      string     `json:"variant"`
+	} `json:"imageSpec"`
+}
+
+// criImageMeta is the metadata of an image, from its verbose status info.
+type criImageMeta struct {
+	// created is the build time of the image: CRI does not report when it got pulled.
+	created  int64
+	platform imagePlatform
+}
+
+// imageMeta returns the metadata of the image.
+func (c *criEngine) imageMeta(ctx context.Context, imageRef string) criImageMeta {
+	if c.images == nil || imageRef == "" {
+		return criImageMeta{}
+	}
+	return c.imageMetas.get(imageRef, func() (criImageMeta, error) {
+		status, err := c.images.ImageStatus(ctx, &v1.ImageSpec{Image: imageRef}, true)
+		if err != nil {
+			return criImageMeta{}, err
+		}
+		return criImageMeta{
+			created:  criImageCreated(status.GetInfo()),
+			platform: criImagePlatform(status.GetInfo()),
+		}, nil
+	})
+}
+
+// criImageCreated returns the image build time from the verbose image status info, or 0.
+func criImageCreated(info map[string]string) int64 {
+	var imgInfo criImageInfo
+	if err := json.Unmarshal([]byte(info["info"]), &imgInfo); err != nil {
+		return 0
+	}
+	if imgInfo.ImageSpec == nil || imgInfo.ImageSpec.Created == nil {
+		return 0
+	}
+	return timeToUnix(*imgInfo.ImageSpec.Created)
+}
+
+// criImagePlatform returns the image platform from the verbose image status info, empty when unknown.
+func criImagePlatform(info map[string]string) imagePlatform {
+	var imgInfo criImageInfo
+	if err := json.Unmarshal([]byte(info["info"]), &imgInfo); err != nil || imgInfo.ImageSpec == nil {
+		return imagePlatform{}
+	}
+	return imagePlatform{
+		os:           imgInfo.ImageSpec.OS,
+		architecture: imgInfo.ImageSpec.Architecture,
+		variant:      imgInfo.ImageSpec.Variant,
+	}
+}
+
 func (c *criEngine) ctrToInfo(ctx context.Context, ctr *v1.ContainerStatus, podSandboxStatus *v1.PodSandboxStatus,
 	info map[string]string, sandboxInfo map[string]string) event.Info {
 
@@ -236,7 +458,7 @@ func (c *criEngine) ctrToInfo(ctx context.Context, ctr *v1.ContainerStatus, podS
 				if err != nil {
 					cniJson = string(bytes)
 				}
-			} else if val, ok := cniInfo.RuntimeSpec.Annotations["io.kubernetes.cri-o.CNIResult"]; ok {
+			} else if val, ok := cniInfo.RuntimeSpec.Annotations[cniResultAnnotation]; ok {
 				cniJson = val
 			}
 
@@ -342,43 +564,118 @@ func (c *criEngine) ctrToInfo(ctx context.Context, ctr *v1.ContainerStatus, podS
 	if imageID == "" {
 		imageID = ctr.GetImageId()
 	}
+	imageMeta := c.imageMeta(ctx, ctr.GetImageRef())
+
+	state := criStateToState(ctr.GetState())
+	exit := exitInfo{}
+	if state == event.StateExited {
+		exit = criExitInfo(ctr)
+	}
+
+	entrypoint, cmd := ctrInfo.getCommand()
+	usernsMode, uidMappings, gidMappings := criUserns(podSandboxStatus.GetLinux().GetNamespaces().GetOptions().GetUsernsOptions())
 
 	return event.Info{
 		Container: event.Container{
-			Type:             c.runtime,
-			ID:               shortContainerID(ctr.Id),
-			Name:             ctr.GetMetadata().GetName(),
-			Image:            imageName,
-			ImageDigest:      imageDigest,
-			ImageID:          imageID,
-			ImageRepo:        imageRepo,
-			ImageTag:         imageTag,
-			User:             strconv.FormatInt(ctr.GetUser().GetLinux().GetUid(), 10),
-			CniJson:          cniJson,
-			CPUPeriod:        cpuPeriod,
-			CPUQuota:         cpuQuota,
-			CPUShares:        cpuShares,
-			CPUSetCPUCount:   cpusetCount,
-			CreatedTime:      nanoSecondsToUnix(ctr.CreatedAt),
-			Env:              ctrInfo.getEnvs(),
-			FullID:           ctr.Id,
-			HostIPC:          podSandboxStatus.Linux.Namespaces.Options.Ipc == v1.NamespaceMode_NODE,
-			HostNetwork:      podSandboxStatus.Linux.Namespaces.Options.Network == v1.NamespaceMode_NODE,
-			HostPID:          podSandboxStatus.Linux.Namespaces.Options.Pid == v1.NamespaceMode_NODE,
-			Ip:               podSandboxStatus.Network.Ip,
-			IsPodSandbox:     isPodSandbox,
-			Labels:           labels,
-			MemoryLimit:      memoryLimit,
-			SwapLimit:        swapLimit,
-			PodSandboxID:     podSandboxID,
-			Privileged:       ctrInfo.getPrivileged(),
-			PodSandboxLabels: podSandboxLabels,
-			Mounts:           mounts,
-			Size:             size,
+			Type:              c.runtime,
+			Engine:            string(typeCri),
+			ID:                containerID(ctr.Id),
+			Name:              ctr.GetMetadata().GetName(),
+			Image:             imageName,
+			ImageDigest:       imageDigest,
+			ImageID:           imageID,
+			ImageRepo:         imageRepo,
+			ImageTag:          imageTag,
+			User:              strconv.FormatInt(ctr.GetUser().GetLinux().GetUid(), 10),
+			CniJson:           cniJson,
+			CPUPeriod:         cpuPeriod,
+			CPUQuota:          cpuQuota,
+			CPUShares:         cpuShares,
+			CPUSetCPUCount:    cpusetCount,
+			CreatedTime:       nanoSecondsToUnix(ctr.CreatedAt),
+			Env:               ctrInfo.getEnvs(),
+			FullID:            ctr.Id,
+			HostIPC:           podSandboxStatus.Linux.Namespaces.Options.Ipc == v1.NamespaceMode_NODE,
+			HostNetwork:       podSandboxStatus.Linux.Namespaces.Options.Network == v1.NamespaceMode_NODE,
+			HostPID:           podSandboxStatus.Linux.Namespaces.Options.Pid == v1.NamespaceMode_NODE,
+			Ip:                podSandboxStatus.Network.Ip,
+			IsPodSandbox:      isPodSandbox,
+			Labels:            labels,
+			MemoryLimit:       memoryLimit,
+			SwapLimit:         swapLimit,
+			PodSandboxID:      podSandboxID,
+			Privileged:        ctrInfo.getPrivileged(),
+			PodSandboxLabels:  podSandboxLabels,
+			Mounts:            mounts,
+			Size:              size,
+			State:             state,
+			ExitCode:          exit.code,
+			OOMKilled:         exit.oomKilled,
+			FinishedAt:        exit.finishedAt,
+			Networks:          criNetworks(podSandboxStatus.Network),
+			UsernsMode:        usernsMode,
+			UIDMappings:       uidMappings,
+			GIDMappings:       gidMappings,
+			Entrypoint:        entrypoint,
+			Cmd:               cmd,
+			CgroupPath:        ctrInfo.getCgroupPath(),
+			CgroupsVersion:    hostCgroupsVersion(),
+			NetworkAliases:    cniInfo.getNetworkAliases(podSandboxStatus.Linux.Namespaces.Options.Network == v1.NamespaceMode_NODE),
+			ImagePulledAt:     imageMeta.created,
+			ImageOS:           imageMeta.platform.os,
+			ImageArchitecture: imageMeta.platform.architecture,
+			ImageVariant:      imageMeta.platform.variant,
+			HostArchitecture:  hostArchitecture(),
+			SharedNamespaceTarget: ctrInfo.getSharedNamespaceTarget(ctr.Id, podSandboxID,
+				podSandboxStatus.Linux.Namespaces.Options),
+			Devices: ctrInfo.getDevices(ctr.GetAnnotations()),
+			Runtime: event.RuntimeUnknown,
 		},
 	}
 }
 
+// criUserns returns the user namespace mode and mappings of the pod, shared by all the pod containers.
+// Pods not specifying it share the node user namespace.
+func criUserns(userns *v1.UserNamespace) (string, []event.IDMapping, []event.IDMapping) {
+	if userns == nil || userns.GetMode() != v1.NamespaceMode_POD {
+		return event.UsernsHost, []event.IDMapping{}, []event.IDMapping{}
+	}
+	toMappings := func(criMappings []*v1.IDMapping) []event.IDMapping {
+		mappings := make([]event.IDMapping, 0, len(criMappings))
+		for _, m := range criMappings {
+			mappings = append(mappings, event.IDMapping{ContainerID: m.GetContainerId(), HostID: m.GetHostId(), Size: m.GetLength()})
+		}
+		return mappings
+	}
+	return event.UsernsPrivate, toMappings(userns.GetUids()), toMappings(userns.GetGids())
+}
+
+// criNetworks returns the pod network, shared by all the pod containers.
+func criNetworks(status *v1.PodSandboxNetworkStatus) []event.Network {
+	addrs := ipAddresses(status.GetIp())
+	for _, ip := range status.GetAdditionalIps() {
+		addrs = append(addrs, ipAddresses(ip.GetIp())...)
+	}
+	if len(addrs) == 0 {
+		return []event.Network{}
+	}
+	return []event.Network{{IPAddresses: addrs}}
+}
+
+// criExitInfo returns the termination details of an exited container.
+func criExitInfo(ctr *v1.ContainerStatus) exitInfo {
+	return exitInfo{
+		code:       int(ctr.GetExitCode()),
+		oomKilled:  ctr.GetReason() == "OOMKilled",
+		finishedAt: nanoSecondsToUnix(ctr.GetFinishedAt()),
+	}
+}
+
+func criStateToState(state v1.ContainerState) string {
+	// CONTAINER_CREATED -> created
+	return normalizeState(strings.TrimPrefix(state.String(), "CONTAINER_"))
+}
+
 func (c *criEngine) get(ctx context.Context, containerId string) (*event.Event, error) {
 	ctrs, err := c.client.ListContainers(ctx, &v1.ContainerFilter{Id: containerId})
 	if err != nil || len(ctrs) == 0 {
@@ -399,6 +696,15 @@ func (c *criEngine) get(ctx context.Context, containerId string) (*event.Event,
 	return nil, nil
 }
 
+// apiVersion returns the CRI API version of the runtime, eg: v1.
+func (c *criEngine) apiVersion(ctx context.Context) (string, error) {
+	version, err := c.client.Version(ctx, "")
+	if err != nil {
+		return "", err
+	}
+	return version.RuntimeApiVersion, nil
+}
+
 func (c *criEngine) Name() string {
 	return string(typeCri)
 }
@@ -422,11 +728,13 @@ func (c *criEngine) List(ctx context.Context) ([]event.Event, error) {
 				Info: event.Info{
 					Container: event.Container{
 						Type:        c.runtime,
-						ID:          shortContainerID(ctr.Id),
+						Engine:      string(typeCri),
+						ID:          containerID(ctr.Id),
 						FullID:      ctr.Id,
 						ImageID:     ctr.ImageId,
 						CreatedTime: nanoSecondsToUnix(ctr.CreatedAt),
 						Labels:      ctr.Labels,
+						State:       criStateToState(ctr.State),
 					},
 				},
 			}
@@ -441,7 +749,7 @@ func (c *criEngine) List(ctx context.Context) ([]event.Event, error) {
 			}
 		}
 	}
-	return evts, nil
+	return c.filterInfra(evts), nil
 }
 
 // Listen set up container created event loop by call to GetContainerEvents of the criEngine client
@@ -450,13 +758,11 @@ func (c *criEngine) List(ctx context.Context) ([]event.Event, error) {
 func (c *criEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
 	containerEventsCh := make(chan *v1.ContainerEventResponse)
 	containerEventsErrorCh := make(chan error)
-	wg.Add(1)
-	go func() {
+	GoListener(wg, c, func() {
 		defer close(containerEventsCh)
 		defer close(containerEventsErrorCh)
-		defer wg.Done()
 		containerEventsErrorCh <- c.client.GetContainerEvents(ctx, containerEventsCh, nil)
-	}()
+	})
 
 	// Catch error on initialization containerEventsErrorCh
 	const containerEventsErrorTimeout = 10 * time.Millisecond
@@ -468,10 +774,8 @@ func (c *criEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan even
 	}
 
 	outCh := make(chan event.Event)
-	wg.Add(1)
-	go func() {
+	GoListener(wg, c, func() {
 		defer close(outCh)
-		defer wg.Done()
 		for {
 			select {
 			case <-ctx.Done():
@@ -506,32 +810,78 @@ func (c *criEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan even
 					// Always enabled
 				}
 
-				var info event.Info
-				// verbose true to return container.Info
-				ctr, err := c.client.ContainerStatus(ctx, evt.ContainerId, true)
-				if err != nil || ctr == nil {
-					info = event.Info{
-						Container: event.Container{
-							Type:        c.runtime,
-							ID:          shortContainerID(evt.ContainerId),
-							FullID:      evt.ContainerId,
-							CreatedTime: nanoSecondsToUnix(evt.CreatedAt),
-						},
-					}
-				} else {
-					cPodSandbox := evt.GetPodSandboxStatus()
-					podSandboxStatus, _ := c.client.PodSandboxStatus(ctx, cPodSandbox.GetId(), false)
-					if podSandboxStatus == nil {
-						podSandboxStatus = &v1.PodSandboxStatusResponse{}
-					}
-					info = c.ctrToInfo(ctx, ctr.GetStatus(), cPodSandbox, ctr.GetInfo(), podSandboxStatus.GetInfo())
-				}
+				info, _ := enrich(ctx, c, c.minimalEventInfo(evt), func(ctx context.Context) (event.Info, error) {
+					return c.eventInfo(ctx, evt)
+				}, nil)
 				outCh <- event.Event{
 					Info:     info,
 					IsCreate: evt.ContainerEventType != v1.ContainerEventType_CONTAINER_DELETED_EVENT,
 				}
 			}
 		}
-	}()
-	return outCh, nil
+	})
+	return c.forwardInfra(ctx, wg, c, outCh), nil
+}
+
+// minimalEventInfo returns the info of the container of an event with the minimum set of data,
+// sent whenever its status cannot be fetched.
+func (c *criEngine) minimalEventInfo(evt *v1.ContainerEventResponse) event.Info {
+	state := event.StateUnknown
+	switch evt.ContainerEventType {
+	case v1.ContainerEventType_CONTAINER_CREATED_EVENT:
+		state = event.StateCreated
+	case v1.ContainerEventType_CONTAINER_STARTED_EVENT:
+		state = event.StateRunning
+	case v1.ContainerEventType_CONTAINER_DELETED_EVENT:
+		state = event.StateRemoved
+	}
+	info := event.Info{
+		Container: event.Container{
+			Type:        c.runtime,
+			Engine:      string(typeCri),
+			ID:          containerID(evt.ContainerId),
+			FullID:      evt.ContainerId,
+			CreatedTime: nanoSecondsToUnix(evt.CreatedAt),
+			State:       state,
+		},
+	}
+	// The event carries the last known status of the pod containers
+	var status *v1.ContainerStatus
+	for _, s := range evt.GetContainersStatuses() {
+		if s.GetId() == evt.ContainerId {
+			status = s
+			break
+		}
+	}
+	info.Name = status.GetMetadata().GetName()
+	if state == event.StateRemoved {
+		exit := unknownExit
+		if status.GetState() == v1.ContainerState_CONTAINER_EXITED {
+			exit = criExitInfo(status)
+		}
+		exit.apply(&info.Container)
+	}
+	return info
+}
+
+// eventInfo fetches the status of the container of an event, along with the one of its pod sandbox.
+func (c *criEngine) eventInfo(ctx context.Context, evt *v1.ContainerEventResponse) (event.Info, error) {
+	// verbose true to return container.Info
+	ctr, err := c.client.ContainerStatus(ctx, evt.ContainerId, true)
+	if err != nil {
+		return event.Info{}, err
+	}
+	if ctr == nil {
+		return event.Info{}, fmt.Errorf("container %s not found", evt.ContainerId)
+	}
+	cPodSandbox := evt.GetPodSandboxStatus()
+	podSandboxStatus, _ := c.client.PodSandboxStatus(ctx, cPodSandbox.GetId(), false)
+	if podSandboxStatus == nil {
+		podSandboxStatus = &v1.PodSandboxStatusResponse{}
+	}
+	info := c.ctrToInfo(ctx, ctr.GetStatus(), cPodSandbox, ctr.GetInfo(), podSandboxStatus.GetInfo())
+	if evt.ContainerEventType == v1.ContainerEventType_CONTAINER_DELETED_EVENT {
+		info.State = event.StateRemoved
+	}
+	return info, nil
 }
@@ -0,0 +1,155 @@
+//go:build !no_cri
+
+package container
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"os"
+	"strings"
+	"time"
+)
+
+// criMaxMsgSize is the maximum size of the CRI responses, like for cri-client.
+const criMaxMsgSize = 16 * 1024 * 1024
+
+// criRemoteClient serves criRuntime and criImages over a gRPC connection, that, unlike the cri-client one,
+// can be secured by mTLS and closed. Like cri-client, unary calls are bound by timeout.
+type criRemoteClient struct {
+	conn    *grpc.ClientConn
+	runtime v1.RuntimeServiceClient
+	images  v1.ImageServiceClient
+	timeout time.Duration
+}
+
+// newCriRemoteClient returns a criRemoteClient for endpoint, as `host:port`, optionally
+// prefixed by `tcp://`, or any gRPC target. Like the other gRPC based engines, it connects lazily.
+func newCriRemoteClient(endpoint string, tlsCfg config.TLSConfig, timeout time.Duration) (*criRemoteClient, error) {
+	creds, err := tlsCredentials(tlsCfg)
+	if err != nil {
+		return nil, err
+	}
+	return newCriClient(strings.TrimPrefix(endpoint, "tcp://"), creds, timeout)
+}
+
+// newCriSocketClient returns a criRemoteClient for the runtime unix socket.
+func newCriSocketClient(socket string, timeout time.Duration) (*criRemoteClient, error) {
+	return newCriClient(enforceUnixProtocolIfEmpty(socket), insecure.NewCredentials(), timeout)
+}
+
+func newCriClient(target string, creds credentials.TransportCredentials, timeout time.Duration) (*criRemoteClient, error) {
+	conn, err := grpc.NewClient(target,
+		grpc.WithTransportCredentials(creds),
+		grpc.WithDefaultCallOptions(grpc.MaxCallRecvMsgSize(criMaxMsgSize)))
+	if err != nil {
+		return nil, err
+	}
+	return &criRemoteClient{
+		conn:    conn,
+		runtime: v1.NewRuntimeServiceClient(conn),
+		images:  v1.NewImageServiceClient(conn),
+		timeout: timeout,
+	}, nil
+}
+
+// tlsCredentials returns the mTLS credentials of cfg: the server is verified
+// with its CA, or the system ones when missing.
+func tlsCredentials(cfg config.TLSConfig) (credentials.TransportCredentials, error) {
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if cfg.Cert != "" || cfg.Key != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.Cert, cfg.Key)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	if cfg.CA != "" {
+		ca, err := os.ReadFile(cfg.CA)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load CA: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(ca) {
+			return nil, fmt.Errorf("no certificates found in CA %s", cfg.CA)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	return credentials.NewTLS(tlsConfig), nil
+}
+
+// Close closes the gRPC connection, interrupting the ongoing calls.
+func (r *criRemoteClient) Close() error {
+	return r.conn.Close()
+}
+
+func (r *criRemoteClient) Version(ctx context.Context, apiVersion string) (*v1.VersionResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.runtime.Version(ctx, &v1.VersionRequest{Version: apiVersion})
+}
+
+func (r *criRemoteClient) ListContainers(ctx context.Context, filter *v1.ContainerFilter) ([]*v1.Container, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	resp, err := r.runtime.ListContainers(ctx, &v1.ListContainersRequest{Filter: filter})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetContainers(), nil
+}
+
+func (r *criRemoteClient) ContainerStatus(ctx context.Context, containerID string, verbose bool) (*v1.ContainerStatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.runtime.ContainerStatus(ctx, &v1.ContainerStatusRequest{ContainerId: containerID, Verbose: verbose})
+}
+
+func (r *criRemoteClient) PodSandboxStatus(ctx context.Context, podSandboxID string, verbose bool) (*v1.PodSandboxStatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.runtime.PodSandboxStatus(ctx, &v1.PodSandboxStatusRequest{PodSandboxId: podSandboxID, Verbose: verbose})
+}
+
+func (r *criRemoteClient) ContainerStats(ctx context.Context, containerID string) (*v1.ContainerStats, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	resp, err := r.runtime.ContainerStats(ctx, &v1.ContainerStatsRequest{ContainerId: containerID})
+	if err != nil {
+		return nil, err
+	}
+	return resp.GetStats(), nil
+}
+
+// GetContainerEvents sends the container events to containerEventsCh, until the stream fails.
+func (r *criRemoteClient) GetContainerEvents(ctx context.Context, containerEventsCh chan *v1.ContainerEventResponse,
+	connectionEstablishedCallback func(v1.RuntimeService_GetContainerEventsClient)) error {
+	stream, err := r.runtime.GetContainerEvents(ctx, &v1.GetEventsRequest{})
+	if err != nil {
+		return err
+	}
+	if connectionEstablishedCallback != nil {
+		connectionEstablishedCallback(stream)
+	}
+	for {
+		resp, err := stream.Recv()
+		if err != nil {
+			return err
+		}
+		if resp != nil {
+			containerEventsCh <- resp
+		}
+	}
+}
+
+func (r *criRemoteClient) ImageStatus(ctx context.Context, image *v1.ImageSpec, verbose bool) (*v1.ImageStatusResponse, error) {
+	ctx, cancel := context.WithTimeout(ctx, r.timeout)
+	defer cancel()
+	return r.images.ImageStatus(ctx, &v1.ImageStatusRequest{Image: image, Verbose: verbose})
+}
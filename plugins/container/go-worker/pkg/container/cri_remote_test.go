@@ -0,0 +1,222 @@
+//go:build !no_cri
+
+package container
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	v1 "k8s.io/cri-api/pkg/apis/runtime/v1"
+	"k8s.io/cri-client/pkg/fake"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testPKI is a CA, along with a server and a client certificates it signed.
+type testPKI struct {
+	caFile string
+	server tls.Certificate
+	pool   *x509.CertPool
+	client config.TLSConfig
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	dir := t.TempDir()
+	writePEM := func(name, blockType string, der []byte) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der}), 0600))
+		return path
+	}
+
+	caKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	caTmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "test-ca"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		KeyUsage:              x509.KeyUsageCertSign,
+		BasicConstraintsValid: true,
+	}
+	caDER, err := x509.CreateCertificate(rand.Reader, caTmpl, caTmpl, &caKey.PublicKey, caKey)
+	require.NoError(t, err)
+	ca, err := x509.ParseCertificate(caDER)
+	require.NoError(t, err)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	issue := func(serial int64, usage x509.ExtKeyUsage) ([]byte, *ecdsa.PrivateKey) {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		require.NoError(t, err)
+		tmpl := &x509.Certificate{
+			SerialNumber: big.NewInt(serial),
+			Subject:      pkix.Name{CommonName: "localhost"},
+			DNSNames:     []string{"localhost"},
+			IPAddresses:  []net.IP{net.ParseIP("127.0.0.1")},
+			NotBefore:    time.Now().Add(-time.Hour),
+			NotAfter:     time.Now().Add(time.Hour),
+			KeyUsage:     x509.KeyUsageDigitalSignature,
+			ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		}
+		der, err := x509.CreateCertificate(rand.Reader, tmpl, ca, &key.PublicKey, caKey)
+		require.NoError(t, err)
+		return der, key
+	}
+
+	serverDER, serverKey := issue(2, x509.ExtKeyUsageServerAuth)
+	clientDER, clientKey := issue(3, x509.ExtKeyUsageClientAuth)
+	serverKeyDER, err := x509.MarshalECPrivateKey(serverKey)
+	require.NoError(t, err)
+	clientKeyDER, err := x509.MarshalECPrivateKey(clientKey)
+	require.NoError(t, err)
+	server, err := tls.LoadX509KeyPair(writePEM("server.crt", "CERTIFICATE", serverDER),
+		writePEM("server.key", "EC PRIVATE KEY", serverKeyDER))
+	require.NoError(t, err)
+
+	return testPKI{
+		caFile: writePEM("ca.crt", "CERTIFICATE", caDER),
+		server: server,
+		pool:   pool,
+		client: config.TLSConfig{
+			CA:   filepath.Join(dir, "ca.crt"),
+			Cert: writePEM("client.crt", "CERTIFICATE", clientDER),
+			Key:  writePEM("client.key", "EC PRIVATE KEY", clientKeyDER),
+		},
+	}
+}
+
+func TestCRIRemote(t *testing.T) {
+	pki := newTestPKI(t)
+
+	// The same runtime, served on a unix socket and on a TCP endpoint requiring mTLS
+	fakeRuntime := fake.NewFakeRemoteRuntime()
+	socket, err := fake.GenerateEndpoint()
+	require.NoError(t, err)
+	require.NoError(t, fakeRuntime.Start(socket))
+	t.Cleanup(fakeRuntime.Stop)
+
+	server := grpc.NewServer(grpc.Creds(credentials.NewTLS(&tls.Config{
+		Certificates: []tls.Certificate{pki.server},
+		ClientCAs:    pki.pool,
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+	})))
+	v1.RegisterRuntimeServiceServer(server, fakeRuntime)
+	v1.RegisterImageServiceServer(server, fakeRuntime)
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		_ = server.Serve(l)
+	}()
+	t.Cleanup(server.Stop)
+	endpoint := "tcp://" + l.Addr().String()
+
+	_, err = fakeRuntime.RunPodSandbox(context.Background(), &v1.RunPodSandboxRequest{
+		Config: &v1.PodSandboxConfig{
+			Metadata: &v1.PodSandboxMetadata{Name: "test_sandbox", Uid: "uid", Namespace: "default"},
+		},
+	})
+	require.NoError(t, err)
+	_, err = fakeRuntime.CreateContainer(context.Background(), &v1.CreateContainerRequest{
+		Config: &v1.ContainerConfig{
+			Metadata: &v1.ContainerMetadata{Name: "test_container"},
+			Image:    &v1.ImageSpec{Image: "alpine:3.20.3"},
+			Labels:   map[string]string{"foo": "bar"},
+		},
+		PodSandboxId: "test_sandbox",
+	})
+	require.NoError(t, err)
+
+	local, err := newCriEngine(context.Background(), socket)
+	require.NoError(t, err)
+	remote, err := newCriRemoteEngine(context.Background(), endpoint, pki.client)
+	require.NoError(t, err)
+	assert.Equal(t, endpoint, remote.Sock())
+
+	// Same metadata, regardless of the transport
+	localEvts, err := local.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, localEvts, 1)
+	remoteEvts, err := remote.List(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, localEvts, remoteEvts)
+
+	evt, err := remote.(getter).get(context.Background(), localEvts[0].FullID)
+	require.NoError(t, err)
+	assert.Equal(t, localEvts[0], *evt)
+
+	// Copies keep the transport
+	copied, err := remote.(copier).copy(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, pki.client, *copied.(*criEngine).tlsCfg)
+
+	// The endpoint requires a client certificate
+	_, err = newCriRemoteEngine(context.Background(), endpoint, config.TLSConfig{CA: pki.caFile})
+	assert.Error(t, err)
+	// Unknown files
+	_, err = newCriRemoteEngine(context.Background(), endpoint, config.TLSConfig{CA: "/does/not/exist"})
+	assert.Error(t, err)
+}
+
+func TestRemoteGenerators(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"cri":{"enabled":false}}}`)
+	})
+	tCases := map[string]struct {
+		cfg            string
+		expectedSocket string
+		expectedRemote bool
+	}{
+		"Unix socket": {
+			cfg:            `{"engines":{"cri":{"enabled":true,"sockets":["/run/not-existing/crio.sock"]}}}`,
+			expectedSocket: "/run/not-existing/crio.sock",
+		},
+		"Endpoint without TLS falls back to the sockets": {
+			cfg:            `{"engines":{"cri":{"enabled":true,"sockets":["/run/not-existing/crio.sock"],"endpoint":"cri-proxy:10010"}}}`,
+			expectedSocket: "/run/not-existing/crio.sock",
+		},
+		"Endpoint with TLS": {
+			cfg:            `{"engines":{"cri":{"enabled":true,"sockets":["/run/not-existing/crio.sock"],"endpoint":"cri-proxy:10010","tls":{"ca":"/etc/cri/ca.crt","cert":"/etc/cri/tls.crt","key":"/etc/cri/tls.key"}}}}`,
+			expectedSocket: "cri-proxy:10010",
+			expectedRemote: true,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, config.Load(tc.cfg))
+			var generators []EngineGenerator
+			for _, g := range ConfiguredGenerators() {
+				if g.Name == string(typeCri) {
+					generators = append(generators, g)
+				}
+			}
+			require.Len(t, generators, 1)
+			assert.Equal(t, tc.expectedSocket, generators[0].Socket)
+			assert.Equal(t, tc.expectedRemote, generators[0].Remote)
+
+			// Remote endpoints are always attempted
+			existing, err := Generators()
+			require.NoError(t, err)
+			found := false
+			for _, g := range existing {
+				found = found || g.Socket == tc.expectedSocket
+			}
+			assert.Equal(t, tc.expectedRemote, found)
+		})
+	}
+}
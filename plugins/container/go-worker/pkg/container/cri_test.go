@@ -1,3 +1,5 @@
+//go:build !no_cri
+
 package container
 
 import (
@@ -198,6 +200,7 @@ func TestCRIInfoMap(t *testing.T) {
 	var ctrInfo criInfo
 	err := json.Unmarshal([]byte(jsonInfo), &ctrInfo)
 	assert.NoError(t, err)
+	assert.Equal(t, "/k8s.io/570b00d1f91393c91dfc131d7887f37def66902e360e63a7526e7c74fae53c0d", ctrInfo.getCgroupPath())
 }
 
 func testCRIFake(t *testing.T, withFetcher bool) {
@@ -258,6 +261,7 @@ func testCRIFake(t *testing.T, withFetcher bool) {
 		Info: event.Info{
 			Container: event.Container{
 				Type:             typeCri.ToCTValue(),
+				Engine:           string(typeCri),
 				ID:               "test_sandbox",
 				Name:             "test_container",
 				Image:            "alpine:3.20.3",
@@ -278,6 +282,19 @@ func testCRIFake(t *testing.T, withFetcher bool) {
 				PodSandboxLabels: map[string]string{},
 				Mounts:           []event.Mount{},
 				Size:             -1,
+				State:            event.StateCreated,
+				Networks:         []event.Network{},
+				UsernsMode:       event.UsernsHost,
+				UIDMappings:      []event.IDMapping{},
+				GIDMappings:      []event.IDMapping{},
+				Entrypoint:       []string{},
+				Cmd:              []string{},
+				CgroupPath:       "",
+				CgroupsVersion:   hostCgroupsVersion(),
+				NetworkAliases:   []string{},
+				Devices:          []string{},
+				Runtime:          event.RuntimeUnknown,
+				HostArchitecture: hostArchitecture(),
 			}},
 		IsCreate: true,
 	}
@@ -308,10 +325,286 @@ func testCRIFake(t *testing.T, withFetcher bool) {
 	// fakeruntime.GetContainerEvents() returns nil. Cannot be tested.
 }
 
+func TestCriUserns(t *testing.T) {
+	tCases := map[string]struct {
+		userns              *v1.UserNamespace
+		expectedMode        string
+		expectedUIDMappings []event.IDMapping
+	}{
+		"Unset": {
+			userns:              nil,
+			expectedMode:        event.UsernsHost,
+			expectedUIDMappings: []event.IDMapping{},
+		},
+		"Node": {
+			userns:              &v1.UserNamespace{Mode: v1.NamespaceMode_NODE},
+			expectedMode:        event.UsernsHost,
+			expectedUIDMappings: []event.IDMapping{},
+		},
+		"Pod": {
+			userns: &v1.UserNamespace{
+				Mode: v1.NamespaceMode_POD,
+				Uids: []*v1.IDMapping{{ContainerId: 0, HostId: 65536, Length: 65536}},
+				Gids: []*v1.IDMapping{{ContainerId: 0, HostId: 65536, Length: 65536}},
+			},
+			expectedMode:        event.UsernsPrivate,
+			expectedUIDMappings: []event.IDMapping{{ContainerID: 0, HostID: 65536, Size: 65536}},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			mode, uidMappings, gidMappings := criUserns(tc.userns)
+			assert.Equal(t, tc.expectedMode, mode)
+			assert.Equal(t, tc.expectedUIDMappings, uidMappings)
+			assert.Equal(t, tc.expectedUIDMappings, gidMappings)
+		})
+	}
+}
+
+func TestCriCommand(t *testing.T) {
+	tCases := map[string]struct {
+		info               string
+		expectedEntrypoint []string
+		expectedCmd        []string
+	}{
+		"Config": {
+			info:               `{"config": {"command": ["/bin/sh", "-c"], "args": ["sleep 10"]}, "runtimeSpec": {"process": {"args": ["/bin/sh", "-c", "sleep 10"]}}}`,
+			expectedEntrypoint: []string{"/bin/sh", "-c"},
+			expectedCmd:        []string{"sleep 10"},
+		},
+		"ConfigArgsOnly": {
+			info:               `{"config": {"args": ["sleep 10"]}}`,
+			expectedEntrypoint: []string{},
+			expectedCmd:        []string{"sleep 10"},
+		},
+		"RuntimeSpec": {
+			info:               `{"config": {}, "runtimeSpec": {"process": {"args": ["/bin/sh"]}}}`,
+			expectedEntrypoint: []string{"/bin/sh"},
+			expectedCmd:        []string{},
+		},
+		"None": {
+			info:               `{}`,
+			expectedEntrypoint: []string{},
+			expectedCmd:        []string{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			var info criInfo
+			require.NoError(t, json.Unmarshal([]byte(tc.info), &info))
+			entrypoint, cmd := info.getCommand()
+			assert.Equal(t, tc.expectedEntrypoint, entrypoint)
+			assert.Equal(t, tc.expectedCmd, cmd)
+		})
+	}
+}
+
+func TestCriNetworkAliases(t *testing.T) {
+	tCases := map[string]struct {
+		info            string
+		hostNetwork     bool
+		expectedAliases []string
+	}{
+		"Pod hostname": {
+			info:            `{"runtimeSpec":{"hostname":"web-0","annotations":{}}}`,
+			expectedAliases: []string{"web-0"},
+		},
+		"Host network": {
+			info:            `{"runtimeSpec":{"hostname":"node-1"}}`,
+			hostNetwork:     true,
+			expectedAliases: []string{},
+		},
+		"No hostname": {
+			info:            `{"runtimeSpec":{"annotations":{}}}`,
+			expectedAliases: []string{},
+		},
+		"No runtime spec": {
+			info:            `{}`,
+			expectedAliases: []string{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			var info cniSandboxInfo
+			require.NoError(t, json.Unmarshal([]byte(tc.info), &info))
+			assert.Equal(t, tc.expectedAliases, info.getNetworkAliases(tc.hostNetwork))
+		})
+	}
+}
+
+func TestCriSharedNamespaceTarget(t *testing.T) {
+	const (
+		sandboxID = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+		ctrID     = "6a2ecd8c9ee2e2b4bd3c3e7fa2a2a8a91d1ee8d42d97a5ac1f6b04e3f3bf5b3c"
+		targetID  = "c1b9e5c0ba1d1f0ab06e0fb15ab6c6e4b96c0f3d9ec8b1a2f5d3b0e2c4f6a8b0"
+	)
+	nodeNetwork := &v1.NamespaceOption{Network: v1.NamespaceMode_NODE, Pid: v1.NamespaceMode_CONTAINER}
+	tCases := map[string]struct {
+		id             string
+		info           string
+		podNamespaces  *v1.NamespaceOption
+		expectedTarget string
+	}{
+		"Pod sandbox": {
+			id:             sandboxID,
+			info:           `{}`,
+			podNamespaces:  &v1.NamespaceOption{},
+			expectedTarget: "",
+		},
+		"Pod network": {
+			id:             ctrID,
+			info:           `{}`,
+			podNamespaces:  &v1.NamespaceOption{Network: v1.NamespaceMode_POD},
+			expectedTarget: sandboxID[:shortIDLength],
+		},
+		"Node network": {
+			id:             ctrID,
+			info:           `{}`,
+			podNamespaces:  nodeNetwork,
+			expectedTarget: "",
+		},
+		"Node network sharing the pod pid namespace": {
+			id:             ctrID,
+			info:           `{}`,
+			podNamespaces:  &v1.NamespaceOption{Network: v1.NamespaceMode_NODE, Pid: v1.NamespaceMode_POD},
+			expectedTarget: sandboxID[:shortIDLength],
+		},
+		"Node network targeting a pid namespace": {
+			id:             ctrID,
+			info:           `{"config":{"linux":{"security_context":{"namespace_options":{"network":2,"pid":3,"target_id":"` + targetID + `"}}}}}`,
+			podNamespaces:  nodeNetwork,
+			expectedTarget: targetID[:shortIDLength],
+		},
+		"Node network with its own pid namespace": {
+			id:             ctrID,
+			info:           `{"config":{"linux":{"security_context":{"namespace_options":{"network":2,"pid":1}}}}}`,
+			podNamespaces:  &v1.NamespaceOption{Network: v1.NamespaceMode_NODE, Pid: v1.NamespaceMode_POD},
+			expectedTarget: "",
+		},
+		"No pod": {
+			id:             ctrID,
+			info:           `{}`,
+			podNamespaces:  nil,
+			expectedTarget: sandboxID[:shortIDLength],
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			var info criInfo
+			require.NoError(t, json.Unmarshal([]byte(tc.info), &info))
+			assert.Equal(t, tc.expectedTarget, info.getSharedNamespaceTarget(tc.id, sandboxID, tc.podNamespaces))
+		})
+	}
+}
+
+func TestCriImageCreated(t *testing.T) {
+	tCases := map[string]struct {
+		info             map[string]string
+		expectedCreated  int64
+		expectedPlatform imagePlatform
+	}{
+		"Containerd": {
+			info:             map[string]string{"info": `{"chainID":"sha256:abc","imageSpec":{"created":"2024-09-06T12:05:36Z","architecture":"amd64","os":"linux"}}`},
+			expectedCreated:  1725624336,
+			expectedPlatform: imagePlatform{os: "linux", architecture: "amd64"},
+		},
+		"Variant": {
+			info:             map[string]string{"info": `{"imageSpec":{"created":"2024-09-06T12:05:36Z","architecture":"arm64","os":"linux","variant":"v8"}}`},
+			expectedCreated:  1725624336,
+			expectedPlatform: imagePlatform{os: "linux", architecture: "arm64", variant: "v8"},
+		},
+		"Missing created": {
+			info:             map[string]string{"info": `{"imageSpec":{"architecture":"amd64"}}`},
+			expectedCreated:  0,
+			expectedPlatform: imagePlatform{architecture: "amd64"},
+		},
+		"Not verbose": {
+			info:            nil,
+			expectedCreated: 0,
+		},
+		"Malformed": {
+			info:            map[string]string{"info": `{"imageSpec":`},
+			expectedCreated: 0,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedCreated, criImageCreated(tc.info))
+			assert.Equal(t, tc.expectedPlatform, criImagePlatform(tc.info))
+		})
+	}
+}
+
+func TestCriMinimalEventInfo(t *testing.T) {
+	const id = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+	statuses := []*v1.ContainerStatus{
+		{Id: "0f3a", Metadata: &v1.ContainerMetadata{Name: "sidecar"}},
+		{
+			Id:         id,
+			Metadata:   &v1.ContainerMetadata{Name: "nginx"},
+			State:      v1.ContainerState_CONTAINER_EXITED,
+			ExitCode:   137,
+			Reason:     "OOMKilled",
+			FinishedAt: 1725624336000000000,
+		},
+	}
+	expected := func(state string, exit *exitInfo) event.Info {
+		info := event.Info{Container: event.Container{
+			Type:   typeCri.ToCTValue(),
+			Engine: string(typeCri),
+			ID:     containerID(id),
+			FullID: id,
+			Name:   "nginx",
+			State:  state,
+		}}
+		if exit != nil {
+			exit.apply(&info.Container)
+		}
+		return info
+	}
+	tCases := map[string]struct {
+		evt          *v1.ContainerEventResponse
+		expectedInfo event.Info
+	}{
+		"Created": {
+			evt:          &v1.ContainerEventResponse{ContainerId: id, ContainerEventType: v1.ContainerEventType_CONTAINER_CREATED_EVENT, ContainersStatuses: statuses},
+			expectedInfo: expected(event.StateCreated, nil),
+		},
+		"Deleted": {
+			evt:          &v1.ContainerEventResponse{ContainerId: id, ContainerEventType: v1.ContainerEventType_CONTAINER_DELETED_EVENT, ContainersStatuses: statuses},
+			expectedInfo: expected(event.StateRemoved, &exitInfo{code: 137, oomKilled: true, finishedAt: 1725624336}),
+		},
+		"Deleted, no status": {
+			evt: &v1.ContainerEventResponse{ContainerId: id, ContainerEventType: v1.ContainerEventType_CONTAINER_DELETED_EVENT},
+			expectedInfo: func() event.Info {
+				info := expected(event.StateRemoved, &unknownExit)
+				info.Name = ""
+				return info
+			}(),
+		},
+	}
+
+	cri := &criEngine{runtime: typeCri.ToCTValue()}
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedInfo, cri.minimalEventInfo(tc.evt))
+		})
+	}
+}
+
 func TestCRIFake(t *testing.T) {
 	testCRIFake(t, false)
 }
 
+func TestCRIFakeFetcher(t *testing.T) {
+	testCRIFake(t, true)
+}
+
 func testCRI(t *testing.T, withFetcher bool) {
 	const criSocket = "/run/containerd/containerd.sock"
 	client, err := remote.NewRemoteRuntimeService(criSocket, 5*time.Second, nil, nil)
@@ -330,6 +623,7 @@ func testCRI(t *testing.T, withFetcher bool) {
 			Namespace: "default",
 			Attempt:   0,
 		},
+		Hostname: "test-pod",
 	}
 	sandboxName, err := client.RunPodSandbox(context.Background(), podSandboxConfig, "")
 	assert.NoError(t, err)
@@ -344,6 +638,8 @@ func testCRI(t *testing.T, withFetcher bool) {
 		_, err = imageClient.PullImage(context.Background(), imageSpec, nil, podSandboxConfig)
 		assert.NoError(t, err)
 	}
+	imageStatus, err := imageClient.ImageStatus(context.Background(), imageSpec, true)
+	require.NoError(t, err)
 
 	ctr, err := client.CreateContainer(context.Background(), sandboxName, &v1.ContainerConfig{
 		Metadata: &v1.ContainerMetadata{
@@ -373,28 +669,48 @@ func testCRI(t *testing.T, withFetcher bool) {
 	expectedEvent := event.Event{
 		Info: event.Info{
 			Container: event.Container{
-				Type:             typeContainerd.ToCTValue(),
-				ID:               shortContainerID(ctr),
-				Name:             "test_container",
-				Image:            "docker.io/library/alpine:3.20.3",
-				ImageDigest:      "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
-				ImageID:          "3.20.3",
-				ImageRepo:        "docker.io/library/alpine",
-				ImageTag:         "3.20.3",
-				User:             "0",
-				CPUPeriod:        defaultCpuPeriod,
-				CPUQuota:         2000,
-				CPUShares:        defaultCpuShares,
-				CPUSetCPUCount:   3,
-				Env:              []string{"test=container"},
-				FullID:           ctr,
-				Labels:           map[string]string{"foo": "bar", "io.kubernetes.sandbox.id": sandboxName, "io.kubernetes.pod.name": "test", "io.kubernetes.pod.namespace": "default", "io.kubernetes.pod.uid": id.String()},
-				PodSandboxID:     sandboxName,
-				Privileged:       false,
-				PodSandboxLabels: map[string]string{},
-				Mounts:           []event.Mount{},
-				IsPodSandbox:     true,
-				Size:             -1,
+				Type:              typeContainerd.ToCTValue(),
+				Engine:            string(typeCri),
+				ID:                shortContainerID(ctr),
+				Name:              "test_container",
+				Image:             "docker.io/library/alpine:3.20.3",
+				ImageDigest:       "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
+				ImageID:           "3.20.3",
+				ImageRepo:         "docker.io/library/alpine",
+				ImageTag:          "3.20.3",
+				User:              "0",
+				CPUPeriod:         defaultCpuPeriod,
+				CPUQuota:          2000,
+				CPUShares:         defaultCpuShares,
+				CPUSetCPUCount:    3,
+				Env:               []string{"test=container"},
+				FullID:            ctr,
+				Labels:            map[string]string{"foo": "bar", "io.kubernetes.sandbox.id": sandboxName, "io.kubernetes.pod.name": "test", "io.kubernetes.pod.namespace": "default", "io.kubernetes.pod.uid": id.String()},
+				PodSandboxID:      sandboxName,
+				Privileged:        false,
+				PodSandboxLabels:  map[string]string{},
+				Mounts:            []event.Mount{},
+				IsPodSandbox:      true,
+				Size:              -1,
+				State:             event.StateCreated,
+				Networks:          []event.Network{},
+				UsernsMode:        event.UsernsHost,
+				UIDMappings:       []event.IDMapping{},
+				GIDMappings:       []event.IDMapping{},
+				Entrypoint:        []string{"/bin/sh"},
+				Cmd:               []string{},
+				CgroupPath:        "/k8s.io/" + ctr,
+				CgroupsVersion:    hostCgroupsVersion(),
+				NetworkAliases:    []string{"test-pod"},
+				Devices:           []string{},
+				Runtime:           event.RuntimeUnknown,
+				ImagePulledAt:     criImageCreated(imageStatus.GetInfo()),
+				ImageOS:           criImagePlatform(imageStatus.GetInfo()).os,
+				ImageArchitecture: criImagePlatform(imageStatus.GetInfo()).architecture,
+				ImageVariant:      criImagePlatform(imageStatus.GetInfo()).variant,
+				HostArchitecture:  hostArchitecture(),
+				// Joins the pod sandbox network namespace
+				SharedNamespaceTarget: shortContainerID(sandboxName),
 			}},
 		IsCreate: true,
 	}
@@ -447,9 +763,12 @@ func testCRI(t *testing.T, withFetcher bool) {
 		Info: event.Info{
 			Container: event.Container{
 				Type:        typeContainerd.ToCTValue(),
+				Engine:      string(typeCri),
 				ID:          ctr[:shortIDLength],
 				FullID:      ctr,
 				CreatedTime: expectedEvent.CreatedTime,
+				State:       event.StateRemoved,
+				ExitCode:    -1,
 			}},
 		IsCreate: false,
 	}
@@ -465,3 +784,20 @@ func testCRI(t *testing.T, withFetcher bool) {
 func TestCRI(t *testing.T) {
 	testCRI(t, false)
 }
+
+func TestCRIFetcher(t *testing.T) {
+	testCRI(t, true)
+}
+
+func TestCriEventSchema(t *testing.T) {
+	cri := &criEngine{runtime: typeCri.ToCTValue()}
+	assertMatchesSchema(t, event.Event{Info: cri.ctrToInfo(context.Background(), &v1.ContainerStatus{
+		Id:       "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+		Metadata: &v1.ContainerMetadata{Name: "test"},
+		Image:    &v1.ImageSpec{Image: "fedora:38"},
+		Mounts: []*v1.Mount{{
+			ContainerPath: "/tmp",
+			HostPath:      "/tmp",
+		}},
+	}, nil, nil, nil), IsCreate: true})
+}
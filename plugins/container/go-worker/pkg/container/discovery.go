@@ -0,0 +1,161 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"sort"
+	"time"
+)
+
+const (
+	// A failed engine connection is retried after connectRetryBackoff,
+	// doubling the wait at each attempt up to connectRetryMaxBackoff, with jitter.
+	connectRetryBackoff    = 100 * time.Millisecond
+	connectRetryMaxBackoff = 5 * time.Second
+)
+
+// errTooManyClients fails the connection of an engine already holding maxOpenClients, until some get closed.
+var errTooManyClients = errors.New("too many open clients")
+
+// Discovered is an engine that successfully connected, along with its pre-existing containers.
+type Discovered struct {
+	Engine     Engine
+	Containers []event.Event
+	// ListErr is set when listing failed, so Containers may be incomplete.
+	ListErr error
+	idx     int
+}
+
+// Discover connects to all the engines in parallel, waiting at most budget for them.
+// It returns the engines that connected in time, in generators order, as soon as all of them
+// resolved or the budget expired; engines still connecting are reported as such in Status(),
+// and delivered on the returned channel once connected.
+// The channel is closed when all the connection attempts completed or ctx is done.
+// Engines failing to connect, like the ones whose runtime does not serve its socket yet, are retried
+// with backoff for up to retryTimeout, then reported as failed in Status().
+func Discover(ctx context.Context, generators []EngineGenerator, budget, retryTimeout time.Duration) ([]Discovered, <-chan Discovered) {
+	// Buffered, so that attempts completing after the budget never block.
+	resCh := make(chan *Discovered, len(generators))
+	for i, g := range generators {
+		setState(g.Name, g.Socket, EngineConnecting, nil)
+		go func() {
+			resCh <- discover(ctx, g, i, retryTimeout)
+		}()
+	}
+
+	ready := make([]Discovered, 0, len(generators))
+	pending := len(generators)
+	timer := time.NewTimer(budget)
+	defer timer.Stop()
+wait:
+	for pending > 0 {
+		select {
+		case d := <-resCh:
+			pending--
+			if d != nil {
+				ready = append(ready, *d)
+			}
+		case <-timer.C:
+			logger.Warnf("%d engines did not connect within %s, moving them to background", pending, budget)
+			break wait
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool {
+		return ready[i].idx < ready[j].idx
+	})
+
+	lateCh := make(chan Discovered)
+	go func() {
+		defer close(lateCh)
+		for ; pending > 0; pending-- {
+			var d *Discovered
+			select {
+			case d = <-resCh:
+			case <-ctx.Done():
+				closeDiscovered(resCh, pending)
+				return
+			}
+			if d == nil {
+				continue
+			}
+			select {
+			case lateCh <- *d:
+			case <-ctx.Done():
+				CloseEngine(d.Engine)
+				closeDiscovered(resCh, pending-1)
+				return
+			}
+		}
+	}()
+	return ready, lateCh
+}
+
+// closeDiscovered closes, in background, the engines of the pending connection attempts, never delivered.
+func closeDiscovered(resCh <-chan *Discovered, pending int) {
+	go func() {
+		for ; pending > 0; pending-- {
+			if d := <-resCh; d != nil {
+				CloseEngine(d.Engine)
+			}
+		}
+	}()
+}
+
+// discover creates the engine, retrying for up to retryTimeout, and lists its pre-existing containers;
+// it returns nil on failure.
+func discover(ctx context.Context, g EngineGenerator, idx int, retryTimeout time.Duration) *Discovered {
+	e, err := connect(ctx, g, retryTimeout)
+	if err != nil {
+		logger.Warnf("failed to create engine %s (%s): %v", g.Name, g.Socket, err)
+		setState(g.Name, g.Socket, EngineFailed, err)
+		return nil
+	}
+	// The engine is now tracked by its own name and socket
+	forgetState(g.Name, g.Socket)
+	SetEngineState(e, EngineConnecting, nil)
+	// An engine failing to list is still used, to listen for new containers.
+	containers, err := e.List(ctx)
+	return &Discovered{Engine: e, Containers: containers, ListErr: err, idx: idx}
+}
+
+// connect creates the engine of g, retrying with backoff while it fails until retryTimeout expires or ctx is done;
+// a zero retryTimeout attempts once. While retried, the engine is reported as connecting, along with the last error
+// and its backoff.
+// Engines already holding maxOpenClients, like when the previous clients of a flapping runtime are not closed yet,
+// are not attempted.
+func connect(ctx context.Context, g EngineGenerator, retryTimeout time.Duration) (Engine, error) {
+	deadline := time.Now().Add(retryTimeout)
+	r := newRetrier(g.Name, g.Socket, "connection", connectRetryBackoff, connectRetryMaxBackoff)
+	for attempt := 1; ; attempt++ {
+		var e Engine
+		err := errTooManyClients
+		if countOpenClients(g.Name, g.Socket) < maxOpenClients {
+			e, err = g.New(ctx)
+		}
+		if err == nil {
+			r.succeed()
+			return e, nil
+		}
+		wait := time.Until(deadline)
+		if wait <= 0 || ctx.Err() != nil {
+			r.giveUp()
+			if attempt > 1 {
+				err = fmt.Errorf("giving up after %d attempts: %w", attempt, err)
+			}
+			return nil, err
+		}
+		wait = min(r.fail(err), wait)
+		setState(g.Name, g.Socket, EngineConnecting, err)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			r.giveUp()
+			return nil, err
+		}
+	}
+}
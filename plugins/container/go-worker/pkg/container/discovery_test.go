@@ -0,0 +1,232 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type fakeEngine struct {
+	socket string
+}
+
+func (f *fakeEngine) Name() string {
+	return "fake"
+}
+
+func (f *fakeEngine) Sock() string {
+	return f.socket
+}
+
+func (f *fakeEngine) List(_ context.Context) ([]event.Event, error) {
+	return []event.Event{{Info: event.Info{Container: event.Container{FullID: f.socket}}}}, nil
+}
+
+func (f *fakeEngine) Listen(_ context.Context, _ *sync.WaitGroup) (<-chan event.Event, error) {
+	return nil, errors.New("not implemented")
+}
+
+// fakeGenerator returns a generator connecting after delay, or failing if fail is set.
+func fakeGenerator(socket string, delay time.Duration, fail bool) EngineGenerator {
+	return EngineGenerator{
+		Name:   "fake",
+		Socket: socket,
+		New: func(ctx context.Context) (Engine, error) {
+			select {
+			case <-time.After(delay):
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+			if fail {
+				return nil, errors.New("connection refused")
+			}
+			return &fakeEngine{socket: socket}, nil
+		},
+	}
+}
+
+// flakyGenerator returns a generator failing its first failures attempts.
+func flakyGenerator(socket string, failures int) EngineGenerator {
+	var attempts atomic.Int32
+	return EngineGenerator{
+		Name:   "fake",
+		Socket: socket,
+		New: func(ctx context.Context) (Engine, error) {
+			if attempts.Add(1) <= int32(failures) {
+				return nil, errors.New("connection refused")
+			}
+			return &fakeEngine{socket: socket}, nil
+		},
+	}
+}
+
+func TestDiscover(t *testing.T) {
+	tCases := map[string]struct {
+		generators     []EngineGenerator
+		budget         time.Duration
+		retryTimeout   time.Duration
+		expectedReady  []string
+		expectedLate   []string
+		expectedStatus map[string]EngineState
+	}{
+		"All ready": {
+			generators: []EngineGenerator{
+				fakeGenerator("/a.sock", 10*time.Millisecond, false),
+				fakeGenerator("/b.sock", 0, false),
+			},
+			budget:         time.Second,
+			expectedReady:  []string{"/a.sock", "/b.sock"},
+			expectedStatus: map[string]EngineState{"/a.sock": EngineConnecting, "/b.sock": EngineConnecting},
+		},
+		"Slow engine": {
+			generators: []EngineGenerator{
+				fakeGenerator("/a.sock", 0, false),
+				fakeGenerator("/slow.sock", 200*time.Millisecond, false),
+			},
+			budget:         20 * time.Millisecond,
+			expectedReady:  []string{"/a.sock"},
+			expectedLate:   []string{"/slow.sock"},
+			expectedStatus: map[string]EngineState{"/a.sock": EngineConnecting, "/slow.sock": EngineConnecting},
+		},
+		"Failing engine": {
+			generators: []EngineGenerator{
+				fakeGenerator("/a.sock", 0, false),
+				fakeGenerator("/failing.sock", 0, true),
+			},
+			budget:         time.Second,
+			expectedReady:  []string{"/a.sock"},
+			expectedStatus: map[string]EngineState{"/a.sock": EngineConnecting, "/failing.sock": EngineFailed},
+		},
+		"Retried engine": {
+			generators: []EngineGenerator{
+				fakeGenerator("/a.sock", 0, false),
+				flakyGenerator("/flaky.sock", 2),
+			},
+			budget:         time.Second,
+			retryTimeout:   time.Second,
+			expectedReady:  []string{"/a.sock", "/flaky.sock"},
+			expectedStatus: map[string]EngineState{"/a.sock": EngineConnecting, "/flaky.sock": EngineConnecting},
+		},
+		"Retried engine after budget": {
+			generators: []EngineGenerator{
+				fakeGenerator("/a.sock", 0, false),
+				flakyGenerator("/flaky.sock", 2),
+			},
+			budget:         50 * time.Millisecond,
+			retryTimeout:   time.Second,
+			expectedReady:  []string{"/a.sock"},
+			expectedLate:   []string{"/flaky.sock"},
+			expectedStatus: map[string]EngineState{"/a.sock": EngineConnecting, "/flaky.sock": EngineConnecting},
+		},
+		"Retries timeout": {
+			generators: []EngineGenerator{
+				fakeGenerator("/a.sock", 0, false),
+				fakeGenerator("/failing.sock", 0, true),
+			},
+			budget:         time.Second,
+			retryTimeout:   150 * time.Millisecond,
+			expectedReady:  []string{"/a.sock"},
+			expectedStatus: map[string]EngineState{"/a.sock": EngineConnecting, "/failing.sock": EngineFailed},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			ResetStatus()
+			t.Cleanup(ResetStatus)
+
+			start := time.Now()
+			ready, late := Discover(context.Background(), tc.generators, tc.budget, tc.retryTimeout)
+			assert.Less(t, time.Since(start), tc.budget+100*time.Millisecond)
+
+			readySocks := make([]string, 0)
+			for _, d := range ready {
+				readySocks = append(readySocks, d.Engine.Sock())
+				require.Len(t, d.Containers, 1)
+				assert.Equal(t, d.Engine.Sock(), d.Containers[0].FullID)
+			}
+			assert.Equal(t, tc.expectedReady, readySocks)
+
+			status := make(map[string]EngineState)
+			for _, st := range Status() {
+				status[st.Socket] = st.State
+			}
+			assert.Equal(t, tc.expectedStatus, status)
+
+			lateSocks := make([]string, 0)
+			for d := range late {
+				lateSocks = append(lateSocks, d.Engine.Sock())
+			}
+			if tc.expectedLate == nil {
+				assert.Empty(t, lateSocks)
+			} else {
+				assert.Equal(t, tc.expectedLate, lateSocks)
+			}
+		})
+	}
+}
+
+func TestDiscoverCanceled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	_, late := Discover(ctx, []EngineGenerator{fakeGenerator("/slow.sock", time.Minute, false)}, time.Millisecond, 0)
+	cancel()
+
+	select {
+	case _, ok := <-late:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("late engines channel not closed on cancel")
+	}
+}
+
+func TestDiscoverRetryCanceled(t *testing.T) {
+	ResetStatus()
+	t.Cleanup(ResetStatus)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, late := Discover(ctx, []EngineGenerator{fakeGenerator("/failing.sock", 0, true)}, time.Millisecond, time.Minute)
+	// Retried in background, reporting why
+	require.Eventually(t, func() bool {
+		st := Status()
+		return len(st) == 1 && st[0].State == EngineConnecting && st[0].Error == "connection refused"
+	}, time.Second, 10*time.Millisecond)
+	cancel()
+
+	select {
+	case _, ok := <-late:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("late engines channel not closed on cancel")
+	}
+}
+
+func TestConnectTooManyClients(t *testing.T) {
+	refs := make([]*clientRef, 0, maxOpenClients)
+	for i := 0; i < maxOpenClients; i++ {
+		refs = append(refs, openClient("fake", "/a.sock"))
+	}
+	t.Cleanup(func() {
+		for _, ref := range refs {
+			ref.release()
+		}
+	})
+
+	_, err := connect(context.Background(), fakeGenerator("/a.sock", 0, false), 0)
+	assert.ErrorIs(t, err, errTooManyClients)
+	// Other sockets of the engine are not affected
+	_, err = connect(context.Background(), fakeGenerator("/b.sock", 0, false), 0)
+	assert.NoError(t, err)
+
+	// Released once
+	assert.True(t, refs[0].release())
+	assert.False(t, refs[0].release())
+	assert.Equal(t, maxOpenClients-1, countOpenClients("fake", "/a.sock"))
+	_, err = connect(context.Background(), fakeGenerator("/a.sock", 0, false), 0)
+	assert.NoError(t, err)
+}
@@ -1,106 +1,136 @@
+//go:build !no_docker
+
 package container
 
 import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"github.com/docker/docker/api/types/container"
 	"github.com/docker/docker/api/types/events"
 	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/docker/api/types/system"
+	"github.com/docker/docker/api/types/versions"
 	"github.com/docker/docker/client"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"slices"
+	"strconv"
 	"strings"
 	"sync"
 	"time"
 )
 
-const k8sLastAppliedConfigLabel = "io.kubernetes.container.last-applied-config"
+const (
+	// dockerMinEventsAPIVersion is the first API version supporting the events filters we rely on;
+	// older daemons are polled instead.
+	dockerMinEventsAPIVersion = "1.22"
+)
 
 func init() {
-	engineGenerators[typeDocker] = newDockerEngine
+	register(typeDocker, newDockerEngine)
 }
 
 type dockerEngine struct {
 	*client.Client
-	socket string
+	*infraFilter
+	states  *stateFilter
+	ref     *clientRef
+	socket  string
+	polling bool
+	// Whether the daemon runs containers in remapped user namespaces by default.
+	remapped bool
+	// The daemon cgroup driver and cgroups version.
+	cgroupDriver   string
+	cgroupsVersion int
+	// Bounds the concurrent inspects of the listener.
+	inspects *inspectPool
 }
 
-func newDockerEngine(_ context.Context, socket string) (Engine, error) {
+func newDockerEngine(ctx context.Context, socket string) (Engine, error) {
 	cl, err := client.NewClientWithOpts(client.FromEnv,
 		client.WithAPIVersionNegotiation(),
 		client.WithHost(enforceUnixProtocolIfEmpty(socket)))
 	if err != nil {
 		return nil, err
 	}
-	return &dockerEngine{Client: cl, socket: socket}, nil
-}
-
-func (dc *dockerEngine) copy(ctx context.Context) (Engine, error) {
-	return newDockerEngine(ctx, dc.socket)
-}
-
-type Probe struct {
-	Exec *struct {
-		Command []string `json:"command"`
-	} `json:"exec"`
-}
-
-type Healthcheck struct {
-	Test []string `json:"Test"`
-}
-
-type k8sPodSpecInfo struct {
-	Spec *struct {
-		Containers []struct {
-			LivenessProbe  *Probe       `json:"livenessProbe"`
-			ReadinessProbe *Probe       `json:"readinessProbe"`
-			Healthcheck    *Healthcheck `json:"healthcheck"`
-		} `json:"containers"`
-	} `json:"spec"`
+	// Negotiate now instead of on first request, to know whether events are supported.
+	cl.NegotiateAPIVersion(ctx)
+	polling := versions.LessThan(cl.ClientVersion(), dockerMinEventsAPIVersion)
+	if polling {
+		logger.Infof("docker engine %s: using API version %s, polling containers", socket, cl.ClientVersion())
+	} else {
+		logger.Infof("docker engine %s: using API version %s", socket, cl.ClientVersion())
+	}
+	dc := &dockerEngine{Client: cl, socket: socket, polling: polling, cgroupDriver: cgroupDriverCgroupfs,
+		infraFilter: newInfraFilter(typeDocker), states: newStateFilter(typeDocker), ref: openClient(string(typeDocker), socket)}
+	dc.inspects = newInspectPool(dc, config.GetInspectConcurrency(string(typeDocker)))
+	if info, err := cl.Info(ctx); err == nil {
+		dc.remapped = dockerDaemonRemapped(info)
+		if info.CgroupDriver != "" {
+			dc.cgroupDriver = info.CgroupDriver
+		}
+		dc.cgroupsVersion = parseCgroupsVersion(info.CgroupVersion)
+	} else {
+		dc.cgroupsVersion = hostCgroupsVersion()
+	}
+	return dc, nil
 }
 
-// normalizeArg removes pairs of leading/trailing " or ' chars, if present
-func normalizeArg(val string) string {
-	strings.TrimPrefix(val, `"`)
-	strings.TrimPrefix(val, `'`)
-	return val
+// dockerDaemonRemapped returns whether the daemon is configured with userns-remap, or is rootless.
+func dockerDaemonRemapped(info system.Info) bool {
+	opts, err := system.DecodeSecurityOptions(info.SecurityOptions)
+	if err != nil {
+		return false
+	}
+	for _, opt := range opts {
+		if opt.Name == "userns" || opt.Name == "rootless" {
+			return true
+		}
+	}
+	return false
 }
 
-func parseLivenessReadinessProbe(probe *Probe) *event.Probe {
-	if probe == nil || probe.Exec == nil || probe.Exec.Command == nil {
-		return nil
+// userns returns the user namespace mode and mappings of a container.
+func (dc *dockerEngine) userns(ctr *container.InspectResponse, hostCfg *container.HostConfig) (string, []event.IDMapping, []event.IDMapping) {
+	if hostCfg.UsernsMode.IsHost() {
+		return event.UsernsHost, []event.IDMapping{}, []event.IDMapping{}
+	}
+	// Mappings are not exposed by the API: read them from the running container.
+	if ctr.State != nil {
+		if mode, uidMappings, gidMappings, err := procUserns(ctr.State.Pid); err == nil {
+			return mode, uidMappings, gidMappings
+		}
 	}
-	p := event.Probe{}
-	p.Exe = normalizeArg(probe.Exec.Command[0])
-	for _, arg := range probe.Exec.Command[1:] {
-		p.Args = append(p.Args, normalizeArg(arg))
+	if dc.remapped || hostCfg.UsernsMode.IsPrivate() {
+		return event.UsernsPrivate, []event.IDMapping{}, []event.IDMapping{}
 	}
-	return &p
+	return event.UsernsHost, []event.IDMapping{}, []event.IDMapping{}
 }
 
-func parseHealthcheckProbe(hcheck *container.HealthConfig) *event.Probe {
-	if hcheck == nil || len(hcheck.Test) <= 1 {
-		return nil
+// cgroupPath returns the cgroup path of a container, read from the running container if possible.
+func (dc *dockerEngine) cgroupPath(ctr *container.InspectResponse, hostCfg *container.HostConfig) string {
+	if ctr.State != nil {
+		if cgroupPath, err := procCgroupPath(ctr.State.Pid, dc.cgroupsVersion); err == nil {
+			return cgroupPath
+		}
 	}
-	p := event.Probe{}
+	return dockerCgroupPath(dc.cgroupDriver, hostCfg.CgroupParent, ctr.ID)
+}
 
-	switch hcheck.Test[0] {
-	case "CMD":
-		p.Exe = normalizeArg(hcheck.Test[1])
-		for _, arg := range hcheck.Test[2:] {
-			p.Args = append(p.Args, normalizeArg(arg))
-		}
-	case "CMD-SHELL":
-		p.Exe = "/bin/sh"
-		p.Args = append(p.Args, "-c")
-		p.Args = append(p.Args, hcheck.Test[1])
-	default:
+func (dc *dockerEngine) copy(ctx context.Context) (Engine, error) {
+	return newDockerEngine(ctx, dc.socket)
+}
+
+// Close closes the daemon client, releasing its connections.
+func (dc *dockerEngine) Close() error {
+	if !dc.ref.release() {
 		return nil
 	}
-	return &p
+	return dc.Client.Close()
 }
 
 func (dc *dockerEngine) ctrToInfo(ctx context.Context, ctr container.InspectResponse) event.Info {
@@ -242,16 +272,36 @@ func (dc *dockerEngine) ctrToInfo(ctx context.Context, ctr container.InspectResp
 	}
 
 	ip := netCfg.IPAddress
-	if ip == "" {
-		if hostCfg.NetworkMode.IsContainer() {
-			secondaryID := hostCfg.NetworkMode.ConnectedContainer()
-			secondary, _ := dc.ContainerInspect(ctx, secondaryID)
-			if secondary.NetworkSettings != nil {
-				ip = secondary.NetworkSettings.IPAddress
-			}
+	sharedTarget := sharedNamespaceTarget(string(hostCfg.NetworkMode), string(hostCfg.PidMode))
+	if sharedTarget != "" {
+		// The target may be referenced by name
+		secondary, err := dc.ContainerInspect(ctx, sharedTarget)
+		if err == nil {
+			sharedTarget = containerID(secondary.ID)
+		}
+		if ip == "" && hostCfg.NetworkMode.IsContainer() && secondary.NetworkSettings != nil {
+			ip = secondary.NetworkSettings.IPAddress
 		}
 	}
 
+	networks := make([]event.Network, 0, len(netCfg.Networks))
+	for name, endpoint := range netCfg.Networks {
+		if endpoint == nil {
+			continue
+		}
+		networks = append(networks, event.Network{
+			Name:        name,
+			IPAddresses: ipAddresses(endpoint.IPAddress, endpoint.GlobalIPv6Address),
+			MAC:         endpoint.MacAddress,
+		})
+	}
+	sortNetworks(networks)
+	aliases := dockerNetworkAliases(netCfg.Networks)
+	// Containers only attached to user defined networks have no default ip
+	if ip == "" {
+		ip = firstIPAddress(networks)
+	}
+
 	createdTime, _ := time.Parse(time.RFC3339Nano, ctr.Created)
 
 	var (
@@ -271,10 +321,26 @@ func (dc *dockerEngine) ctrToInfo(ctx context.Context, ctr container.InspectResp
 		size = *ctr.SizeRw
 	}
 
+	state := event.StateUnknown
+	exit := exitInfo{}
+	if ctr.State != nil {
+		state = normalizeState(ctr.State.Status)
+		if state == event.StateExited {
+			exit.code = ctr.State.ExitCode
+			exit.oomKilled = ctr.State.OOMKilled
+			if finishedAt, err := time.Parse(time.RFC3339Nano, ctr.State.FinishedAt); err == nil && !finishedAt.IsZero() {
+				exit.finishedAt = finishedAt.Unix()
+			}
+		}
+	}
+
+	usernsMode, uidMappings, gidMappings := dc.userns(&ctr, hostCfg)
+
 	return event.Info{
 		Container: event.Container{
 			Type:             typeDocker.ToCTValue(),
-			ID:               shortContainerID(ctr.ID),
+			Engine:           string(typeDocker),
+			ID:               containerID(ctr.ID),
 			Name:             name,
 			Image:            cfg.Image,
 			ImageDigest:      imageDigest,
@@ -304,6 +370,32 @@ func (dc *dockerEngine) ctrToInfo(ctx context.Context, ctr container.InspectResp
 			LivenessProbe:    livenessProbe,
 			ReadinessProbe:   readinessProbe,
 			HealthcheckProbe: healthcheckProbe,
+			State:            state,
+			ExitCode:         exit.code,
+			OOMKilled:        exit.oomKilled,
+			FinishedAt:       exit.finishedAt,
+			Networks:         networks,
+			UsernsMode:       usernsMode,
+			UIDMappings:      uidMappings,
+			GIDMappings:      gidMappings,
+			Entrypoint:       argv(cfg.Entrypoint),
+			Cmd:              argv(cfg.Cmd),
+			CgroupPath:       dc.cgroupPath(&ctr, hostCfg),
+			CgroupsVersion:   dc.cgroupsVersion,
+			NetworkAliases:   aliases,
+			ImagePulledAt:    dockerImagePulledAt(img),
+			// Resolved from the network, or else pid, mode
+			SharedNamespaceTarget: sharedTarget,
+			// Only the restarts triggered by the restart policy, kept up to date on events
+			RestartCount: ctr.RestartCount,
+			Devices:      devices(append(dockerDevices(hostCfg), runtimeDevices(cfg.Env, hostCfg.Annotations)...)...),
+			Runtime:      normalizeRuntime(hostCfg.Runtime),
+			RuntimeRaw:   hostCfg.Runtime,
+			// The platform of the local image, the one selected from a manifest list when pulled
+			ImageOS:           img.Os,
+			ImageArchitecture: img.Architecture,
+			ImageVariant:      img.Variant,
+			HostArchitecture:  hostArchitecture(),
 		},
 	}
 }
@@ -320,6 +412,11 @@ func (dc *dockerEngine) get(ctx context.Context, containerId string) (*event.Eve
 	}, nil
 }
 
+// apiVersion returns the API version negotiated with the daemon.
+func (dc *dockerEngine) apiVersion(_ context.Context) (string, error) {
+	return dc.ClientVersion(), nil
+}
+
 func (dc *dockerEngine) Name() string {
 	return string(typeDocker)
 }
@@ -329,100 +426,404 @@ func (dc *dockerEngine) Sock() string {
 }
 
 func (dc *dockerEngine) List(ctx context.Context) ([]event.Event, error) {
-	containers, err := dc.ContainerList(ctx, container.ListOptions{All: true})
+	containers, err := dc.ContainerList(ctx, container.ListOptions{All: true, Filters: dc.listFilters()})
 	if err != nil {
 		return nil, err
 	}
 
-	evts := make([]event.Event, len(containers))
-	for idx, ctr := range containers {
+	evts := make([]event.Event, 0, len(containers))
+	for _, ctr := range containers {
+		if !emitsListed(typeDocker, normalizeState(ctr.State)) {
+			continue
+		}
 		ctrJson, _, err := dc.ContainerInspectWithRaw(ctx, ctr.ID, config.GetWithSize())
 		if err != nil {
 			// Minimum set of infos
-			evts[idx] = event.Event{
+			evts = append(evts, event.Event{
 				Info: event.Info{
 					Container: event.Container{
 						Type:        typeDocker.ToCTValue(),
-						ID:          shortContainerID(ctr.ID),
+						Engine:      string(typeDocker),
+						ID:          containerID(ctr.ID),
 						Image:       ctr.Image,
 						FullID:      ctr.ID,
 						ImageID:     ctr.ImageID,
 						CreatedTime: nanoSecondsToUnix(ctr.Created),
+						State:       normalizeState(ctr.State),
 					},
 				},
 				IsCreate: true,
-			}
+			})
+			continue
 		}
-		evts[idx] = event.Event{
+		evts = append(evts, event.Event{
 			Info:     dc.ctrToInfo(ctx, ctrJson),
 			IsCreate: true,
+		})
+	}
+	return dc.filterInfra(dc.states.filterStates(evts)), nil
+}
+
+// dockerStatuses are the statuses of the containers listing filter, for each state the engine `states` may select.
+var dockerStatuses = map[string][]string{
+	event.StateCreated:    {"created"},
+	event.StateRunning:    {"running"},
+	event.StatePaused:     {"paused"},
+	event.StateRestarting: {"restarting"},
+	event.StateExited:     {"exited", "dead", "removing"},
+}
+
+// listFilters returns the server-side filters of the initial containers listing, selecting the configured
+// labels and states. The polling listings ignore the states instead, not to take the containers
+// changing state for removed ones.
+func (dc *dockerEngine) listFilters() filters.Args {
+	flts := labelFilters()
+	if dc.states == nil {
+		return flts
+	}
+	for _, state := range dc.states.states {
+		for _, status := range dockerStatuses[state] {
+			flts.Add("status", status)
 		}
 	}
-	return evts, nil
+	return flts
+}
+
+// labelFilters returns the server-side filters selecting the containers carrying all the configured labels,
+// so that the daemon does not even send the events of the other ones.
+// An empty value matches any container carrying the label.
+func labelFilters() filters.Args {
+	flts := filters.NewArgs()
+	for key, value := range config.GetLabelFilter(string(typeDocker)) {
+		if value == "" {
+			flts.Add("label", key)
+		} else {
+			flts.Add("label", key+"="+value)
+		}
+	}
+	return flts
+}
+
+// listenActions returns the container actions to be listened for, depending on the enabled hooks.
+func listenActions() []events.Action {
+	actions := make([]events.Action, 0)
+	if emitsOnCreate(typeDocker) {
+		actions = append(actions, events.ActionCreate)
+	}
+	// Containers run, and get their networks attached, on start: without the start hook,
+	// it is still needed to update create events with the running state.
+	if emit, _ := emitsOnStart(typeDocker); emit || config.IsHookEnabled(config.HookCreate) {
+		actions = append(actions, events.ActionStart)
+	}
+	// Always needed to track exit details for the destroy event.
+	return append(actions, events.ActionOOM, events.ActionDie, events.ActionDestroy)
 }
 
 func (dc *dockerEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
 	outCh := make(chan event.Event)
 
-	flts := filters.NewArgs()
+	var (
+		msgs <-chan events.Message
+		errs <-chan error
+	)
+	flts := labelFilters()
 	flts.Add("type", string(events.ContainerEventType))
-	if config.IsHookEnabled(config.HookCreate) {
-		flts.Add("event", string(events.ActionCreate))
+	for _, action := range listenActions() {
+		flts.Add("event", string(action))
 	}
-	if config.IsHookEnabled(config.HookStart) {
-		flts.Add("event", string(events.ActionStart))
+	if !dc.polling {
+		msgs, errs = dc.Events(ctx, events.ListOptions{Filters: flts})
 	}
-	flts.Add("event", string(events.ActionDestroy))
-
-	msgs, _ := dc.Events(ctx, events.ListOptions{Filters: flts})
-	wg.Add(1)
-	go func() {
+	GoListener(wg, dc, func() {
 		defer close(outCh)
-		defer wg.Done()
+		// Jobs still running would send on the closed outCh
+		defer dc.inspects.Wait()
+		exits := make(exitInfos)
+		if dc.polling {
+			dc.poller(exits).poll(ctx, outCh, false)
+			return
+		}
 		for {
 			select {
 			case <-ctx.Done():
 				return
+			case err := <-errs:
+				if ctx.Err() != nil {
+					return
+				}
+				logger.Warnf("docker engine %s: events stream failed, falling back to polling: %v", dc.socket, err)
+				// Listening again once the daemon, if down, is back
+				if !dc.poller(exits).poll(ctx, outCh, true) {
+					return
+				}
+				logger.Infof("docker engine %s: listening on the events stream again", dc.socket)
+				// Down to the second, not to miss the events since the listing
+				since := strconv.FormatInt(time.Now().Unix(), 10)
+				msgs, errs = dc.Events(ctx, events.ListOptions{Filters: flts, Since: since})
 			case msg, ok := <-msgs:
 				if !ok {
 					// msgs has been closed - kill the goroutine
 					return
 				}
-				var (
-					ctrJson container.InspectResponse
-					err     error
-				)
-				switch msg.Action {
-				case events.ActionCreate, events.ActionStart:
-					ctrJson, _, err = dc.ContainerInspectWithRaw(ctx, msg.Actor.ID, config.GetWithSize())
-					if err == nil {
-						outCh <- event.Event{
-							Info:     dc.ctrToInfo(ctx, ctrJson),
-							IsCreate: true,
-						}
-					}
-				case events.ActionDestroy:
-					err = errors.New("inspect useless on action destroy")
-				}
+				dc.handleMessage(ctx, msg, exits, outCh)
+			}
+		}
+	})
+	return dc.forwardInfra(ctx, wg, dc, dc.states.forwardStates(ctx, wg, dc, outCh)), nil
+}
 
-				// This is called for ActionDestroy
-				// AND as a fallback whenever ContainerInspectWithRaw fails.
-				if err != nil {
-					// At least send an event with the minimum set of data
-					outCh <- event.Event{
-						Info: event.Info{
-							Container: event.Container{
-								Type:   typeDocker.ToCTValue(),
-								ID:     shortContainerID(msg.Actor.ID),
-								FullID: msg.Actor.ID,
-								Image:  msg.Actor.Attributes["image"],
-							},
-						},
-						IsCreate: msg.Action != events.ActionDestroy,
-					}
-				}
+// handleMessage sends the event for a container action, if any, to outCh.
+// Events needing an inspect are built through the engine inspect pool: events of different
+// containers may be sent out of order, while the ones of each container keep their order.
+func (dc *dockerEngine) handleMessage(ctx context.Context, msg events.Message, exits exitInfos, outCh chan<- event.Event) {
+	switch msg.Action {
+	case events.ActionOOM:
+		info := exits[msg.Actor.ID]
+		info.oomKilled = true
+		exits.store(msg.Actor.ID, info)
+		return
+	case events.ActionDie:
+		info := exits[msg.Actor.ID]
+		code, convErr := strconv.Atoi(msg.Actor.Attributes["exitCode"])
+		if convErr != nil {
+			code = -1
+		}
+		info.code = code
+		info.finishedAt = msg.Time
+		exits.store(msg.Actor.ID, info)
+		if !config.IsHookEnabled(config.HookExit) {
+			return
+		}
+		fallthrough
+	case events.ActionCreate, events.ActionStart:
+		restarted := msg.Action == events.ActionStart && exits.restart(msg.Actor.ID)
+		// exits is only meant to be used by the listener goroutine: copy what the job needs
+		exit := exits[msg.Actor.ID]
+		dc.inspects.Go(ctx, msg.Actor.ID, true, func(release func()) (event.Event, bool) {
+			return dc.inspectMessage(ctx, msg, exit, restarted, release)
+		}, outCh)
+	case events.ActionDestroy:
+		// Inspect useless on action destroy
+		evt := dc.minimalEvent(msg, exits.take(msg.Actor.ID))
+		dc.inspects.Go(ctx, msg.Actor.ID, false, func(release func()) (event.Event, bool) {
+			release()
+			return evt, true
+		}, outCh)
+	}
+}
+
+// inspectMessage returns the event for a create, start or die action, if any.
+// exit holds the termination details observed so far; restarted is set for the start
+// of a container that exited, always sent as an update of the already reported container.
+// release is called once done with the inspect calls.
+func (dc *dockerEngine) inspectMessage(ctx context.Context, msg events.Message, exit exitInfo, restarted bool, release func()) (event.Event, bool) {
+	emit, update := emitsOnStart(typeDocker)
+	if restarted && (emit || emitsOnCreate(typeDocker)) {
+		emit, update = true, true
+	}
+	minimal := dc.minimalEvent(msg, exit)
+	info, ok := enrich(ctx, dc, minimal.Info, func(ctx context.Context) (event.Info, error) {
+		ctrJson, _, err := dc.ContainerInspectWithRaw(ctx, msg.Actor.ID, config.GetWithSize())
+		if err != nil {
+			return event.Info{}, err
+		}
+		return dc.ctrToInfo(ctx, ctrJson), nil
+	}, release)
+	if !ok {
+		minimal.Info = info
+		if msg.Action == events.ActionStart {
+			minimal.Update = update
+		}
+		return minimal, true
+	}
+	exit.applyRestarts(&info.Container)
+	if msg.Action == events.ActionStart {
+		// Without emitting on start, still an update of the create event: the container runs
+		info.Update = update
+	}
+	return event.Event{
+		Info:     info,
+		IsCreate: true,
+	}, true
+}
+
+// minimalEvent returns the event for a container action with the minimum set of data,
+// for ActionDestroy AND as a fallback whenever ContainerInspectWithRaw fails.
+func (dc *dockerEngine) minimalEvent(msg events.Message, exit exitInfo) event.Event {
+	ctr := event.Container{
+		Type:   typeDocker.ToCTValue(),
+		Engine: string(typeDocker),
+		ID:     containerID(msg.Actor.ID),
+		FullID: msg.Actor.ID,
+		Name:   msg.Actor.Attributes["name"],
+		Image:  msg.Actor.Attributes["image"],
+		State:  actionToState(msg.Action),
+	}
+	info := event.Info{Container: ctr}
+	switch msg.Action {
+	case events.ActionStart:
+		_, info.Update = emitsOnStart(typeDocker)
+	case events.ActionDie, events.ActionDestroy:
+		exit.apply(&info.Container)
+	}
+	exit.applyRestarts(&info.Container)
+	return event.Event{
+		Info:     info,
+		IsCreate: msg.Action != events.ActionDestroy,
+	}
+}
+
+// dockerDevices returns the host devices mapped into the container, and the devices it requested,
+// like the GPUs requested through `--gpus`.
+func dockerDevices(hostCfg *container.HostConfig) []string {
+	res := make([]string, 0, len(hostCfg.Devices))
+	for _, d := range hostCfg.Devices {
+		res = append(res, d.PathOnHost)
+	}
+	for _, req := range hostCfg.DeviceRequests {
+		// CDI requests hold the CDI device names
+		if req.Driver == "cdi" {
+			res = append(res, req.DeviceIDs...)
+			continue
+		}
+		isGPU := req.Driver == "nvidia" || slices.ContainsFunc(req.Capabilities, func(caps []string) bool {
+			return slices.Contains(caps, "gpu")
+		})
+		if !isGPU {
+			continue
+		}
+		switch {
+		case len(req.DeviceIDs) > 0:
+			for _, id := range req.DeviceIDs {
+				res = append(res, nvidiaGPUKind+"="+id)
+			}
+		case req.Count < 0:
+			res = append(res, nvidiaGPUKind+"=all")
+		default:
+			res = append(res, nvidiaGPUKind)
+		}
+	}
+	return res
+}
+
+// dockerImagePulledAt returns when the image was last tagged locally, as it happens on pull;
+// images never tagged, like the ones pulled by digest, fall back to their build time.
+func dockerImagePulledAt(img image.InspectResponse) int64 {
+	if ts := timeToUnix(img.Metadata.LastTagTime); ts != 0 {
+		return ts
+	}
+	created, err := time.Parse(time.RFC3339Nano, img.Created)
+	if err != nil {
+		return 0
+	}
+	return created.Unix()
+}
+
+// dockerNetworkAliases returns the names the container is resolved by, on its networks.
+// The default bridge has no embedded DNS: its endpoints are skipped, so that containers
+// only attached to it have no aliases, instead of their name.
+func dockerNetworkAliases(networks map[string]*network.EndpointSettings) []string {
+	names := make([]string, 0)
+	for name, endpoint := range networks {
+		if endpoint == nil || name == network.NetworkBridge {
+			continue
+		}
+		names = append(names, endpoint.Aliases...)
+		// Daemons since API 1.45 report the container name and aliases here
+		names = append(names, endpoint.DNSNames...)
+	}
+	return networkAliases(names...)
+}
+
+func summaryIsRunning(ctr *container.Summary) bool {
+	if ctr.State != "" {
+		return ctr.State == "running"
+	}
+	// Daemons older than API 1.23 only report the human readable status
+	return strings.HasPrefix(ctr.Status, "Up")
+}
+
+// listPolled lists the containers for polling, as events only carrying their image and state.
+func (dc *dockerEngine) listPolled(ctx context.Context) ([]event.Event, error) {
+	list, err := dc.ContainerList(ctx, container.ListOptions{All: true, Filters: labelFilters()})
+	if err != nil {
+		return nil, err
+	}
+	evts := make([]event.Event, 0, len(list))
+	for idx := range list {
+		state := normalizeState(list[idx].State)
+		if summaryIsRunning(&list[idx]) {
+			state = event.StateRunning
+		}
+		evts = append(evts, event.Event{
+			Info: event.Info{
+				Container: event.Container{
+					FullID: list[idx].ID,
+					Image:  list[idx].Image,
+					State:  state,
+				},
+			},
+			IsCreate: true,
+		})
+	}
+	return evts, nil
+}
+
+// changeMessages returns the container actions explaining a change between two listings,
+// in the order they happened.
+func changeMessages(c change, now int64) []events.Message {
+	running := func(evt *event.Event) bool {
+		return evt != nil && evt.State == event.StateRunning
+	}
+	ctr := c.cur
+	if ctr == nil {
+		ctr = c.prev
+	}
+	newMessage := func(action events.Action) events.Message {
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: action,
+			Actor: events.Actor{
+				ID:         ctr.FullID,
+				Attributes: map[string]string{"image": ctr.Image},
+			},
+			Time: now,
+		}
+	}
+	msgs := make([]events.Message, 0)
+	switch {
+	case c.prev == nil:
+		msgs = append(msgs, newMessage(events.ActionCreate))
+		if running(c.cur) {
+			msgs = append(msgs, newMessage(events.ActionStart))
+		}
+	case c.cur == nil:
+		if running(c.prev) {
+			msgs = append(msgs, newMessage(events.ActionDie))
+		}
+		msgs = append(msgs, newMessage(events.ActionDestroy))
+	case !running(c.prev) && running(c.cur):
+		msgs = append(msgs, newMessage(events.ActionStart))
+	case running(c.prev) && !running(c.cur):
+		msgs = append(msgs, newMessage(events.ActionDie))
+	}
+	return msgs
+}
+
+// poller returns the pollingListener emulating the events stream through periodic container listings,
+// for daemons not supporting the events filters, or whose events stream failed:
+// the changes are turned into the actions listened for, handled like the streamed ones.
+func (dc *dockerEngine) poller(exits exitInfos) *pollingListener {
+	actions := make(map[events.Action]bool)
+	for _, action := range listenActions() {
+		actions[action] = true
+	}
+	return newPollingListener(dc, typeDocker, dc.listPolled, func(ctx context.Context, c change, outCh chan<- event.Event) bool {
+		for _, msg := range changeMessages(c, time.Now().Unix()) {
+			if actions[msg.Action] {
+				dc.handleMessage(ctx, msg, exits, outCh)
 			}
 		}
-	}()
-	return outCh, nil
+		return ctx.Err() == nil
+	})
 }
@@ -1,16 +1,28 @@
+//go:build !no_docker
+
 package container
 
 import (
 	"context"
+	"encoding/json"
 	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/docker/docker/api/types/filters"
 	"github.com/docker/docker/api/types/image"
+	"github.com/docker/docker/api/types/network"
 	"github.com/docker/docker/client"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"io"
+	"net"
+	"net/http"
+	"path/filepath"
 	"runtime"
 	"sync"
 	"testing"
+	"time"
 )
 
 func testDocker(t *testing.T, withFetcher bool) {
@@ -31,6 +43,8 @@ func testDocker(t *testing.T, withFetcher bool) {
 		_, err = io.Copy(io.Discard, pullRes)
 		assert.NoError(t, err)
 	}
+	img, err := dockerClient.ImageInspect(context.Background(), "alpine:3.20.3")
+	require.NoError(t, err)
 
 	ctr, err := dockerClient.ContainerCreate(context.Background(), &container.Config{
 		User:   "testuser",
@@ -57,26 +71,45 @@ func testDocker(t *testing.T, withFetcher bool) {
 	expectedEvent := event.Event{
 		Info: event.Info{
 			Container: event.Container{
-				Type:           typeDocker.ToCTValue(),
-				ID:             ctr.ID[:shortIDLength],
-				Name:           "test_container",
-				Image:          "alpine:3.20.3",
-				ImageDigest:    "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
-				ImageID:        imageId,
-				ImageRepo:      "alpine",
-				ImageTag:       "3.20.3",
-				User:           "testuser",
-				CPUPeriod:      defaultCpuPeriod,
-				CPUQuota:       2000,
-				CPUShares:      defaultCpuShares,
-				CPUSetCPUCount: 2, // 0-1
-				Env:            []string{"env=env", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
-				FullID:         ctr.ID,
-				Labels:         map[string]string{"foo": "bar"},
-				Privileged:     true,
-				Mounts:         []event.Mount{},
-				PortMappings:   []event.PortMapping{},
-				Size:           -1,
+				Type:              typeDocker.ToCTValue(),
+				Engine:            string(typeDocker),
+				ID:                ctr.ID[:shortIDLength],
+				Name:              "test_container",
+				Image:             "alpine:3.20.3",
+				ImageDigest:       "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
+				ImageID:           imageId,
+				ImageRepo:         "alpine",
+				ImageTag:          "3.20.3",
+				User:              "testuser",
+				CPUPeriod:         defaultCpuPeriod,
+				CPUQuota:          2000,
+				CPUShares:         defaultCpuShares,
+				CPUSetCPUCount:    2, // 0-1
+				Env:               []string{"env=env", "PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"},
+				FullID:            ctr.ID,
+				Labels:            map[string]string{"foo": "bar"},
+				Privileged:        true,
+				Mounts:            []event.Mount{},
+				PortMappings:      []event.PortMapping{},
+				Size:              -1,
+				State:             event.StateCreated,
+				Networks:          []event.Network{{Name: "bridge", IPAddresses: []string{}}},
+				UsernsMode:        event.UsernsHost,
+				UIDMappings:       []event.IDMapping{},
+				GIDMappings:       []event.IDMapping{},
+				Entrypoint:        []string{},
+				Cmd:               []string{"/bin/sh"},
+				CgroupPath:        dockerCgroupPath(engine.(*dockerEngine).cgroupDriver, "", ctr.ID),
+				CgroupsVersion:    engine.(*dockerEngine).cgroupsVersion,
+				NetworkAliases:    []string{},
+				Devices:           []string{},
+				Runtime:           event.RuntimeRunc,
+				RuntimeRaw:        "runc",
+				ImageOS:           img.Os,
+				ImageArchitecture: img.Architecture,
+				ImageVariant:      img.Variant,
+				HostArchitecture:  hostArchitecture(),
+				ImagePulledAt:     dockerImagePulledAt(img),
 				HealthcheckProbe: &event.Probe{
 					Exe:  "/tmp/foo",
 					Args: []string{"bar"},
@@ -121,10 +154,13 @@ func testDocker(t *testing.T, withFetcher bool) {
 	expectedEvent = event.Event{
 		Info: event.Info{
 			Container: event.Container{
-				Type:   typeDocker.ToCTValue(),
-				ID:     ctr.ID[:shortIDLength],
-				FullID: ctr.ID,
-				Image:  "alpine:3.20.3",
+				Type:     typeDocker.ToCTValue(),
+				Engine:   string(typeDocker),
+				ID:       ctr.ID[:shortIDLength],
+				FullID:   ctr.ID,
+				Image:    "alpine:3.20.3",
+				State:    event.StateRemoved,
+				ExitCode: -1,
 			}},
 		IsCreate: false,
 	}
@@ -136,3 +172,728 @@ func testDocker(t *testing.T, withFetcher bool) {
 func TestDocker(t *testing.T) {
 	testDocker(t, false)
 }
+
+func TestDockerFetcher(t *testing.T) {
+	testDocker(t, true)
+}
+
+func TestDockerImagePulledAt(t *testing.T) {
+	tagTime := time.Date(2024, 10, 1, 8, 0, 0, 0, time.UTC)
+	tCases := map[string]struct {
+		img              image.InspectResponse
+		expectedPulledAt int64
+	}{
+		"Tagged": {
+			img:              image.InspectResponse{Created: "2024-09-06T12:05:36Z", Metadata: image.Metadata{LastTagTime: tagTime}},
+			expectedPulledAt: tagTime.Unix(),
+		},
+		"Never tagged": {
+			img:              image.InspectResponse{Created: "2024-09-06T12:05:36.123456789Z"},
+			expectedPulledAt: 1725624336,
+		},
+		"Unknown image": {
+			img:              image.InspectResponse{},
+			expectedPulledAt: 0,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedPulledAt, dockerImagePulledAt(tc.img))
+		})
+	}
+}
+
+func TestDockerNetworkAliases(t *testing.T) {
+	tCases := map[string]struct {
+		networks        map[string]*network.EndpointSettings
+		expectedAliases []string
+	}{
+		"Default bridge": {
+			networks:        map[string]*network.EndpointSettings{"bridge": {IPAddress: "172.17.0.2"}},
+			expectedAliases: []string{},
+		},
+		"Default bridge with legacy aliases": {
+			networks:        map[string]*network.EndpointSettings{"bridge": {Aliases: []string{"sharp_poincare"}}},
+			expectedAliases: []string{},
+		},
+		"User defined networks": {
+			networks: map[string]*network.EndpointSettings{
+				"frontend": {Aliases: []string{"web"}, DNSNames: []string{"sharp_poincare", "2400edb296c5", "web"}},
+				"backend":  {Aliases: []string{"api", ""}, DNSNames: []string{"sharp_poincare", "api"}},
+				"bridge":   {IPAddress: "172.17.0.2"},
+				"broken":   nil,
+			},
+			expectedAliases: []string{"2400edb296c5", "api", "sharp_poincare", "web"},
+		},
+		"No networks": {
+			networks:        nil,
+			expectedAliases: []string{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedAliases, dockerNetworkAliases(tc.networks))
+		})
+	}
+}
+
+func TestDockerDevices(t *testing.T) {
+	tCases := map[string]struct {
+		hostCfg         container.HostConfig
+		expectedDevices []string
+	}{
+		"No devices": {
+			hostCfg:         container.HostConfig{},
+			expectedDevices: []string{},
+		},
+		"Mapped devices": {
+			hostCfg: container.HostConfig{Resources: container.Resources{Devices: []container.DeviceMapping{
+				{PathOnHost: "/dev/fuse", PathInContainer: "/dev/fuse", CgroupPermissions: "rwm"},
+				{PathOnHost: "/dev/sda", PathInContainer: "/dev/xvda", CgroupPermissions: "r"},
+			}}},
+			expectedDevices: []string{"/dev/fuse", "/dev/sda"},
+		},
+		"All GPUs": {
+			hostCfg: container.HostConfig{Resources: container.Resources{DeviceRequests: []container.DeviceRequest{
+				{Count: -1, Capabilities: [][]string{{"gpu"}}},
+			}}},
+			expectedDevices: []string{"nvidia.com/gpu=all"},
+		},
+		"GPUs by ID": {
+			hostCfg: container.HostConfig{Resources: container.Resources{DeviceRequests: []container.DeviceRequest{
+				{Driver: "nvidia", DeviceIDs: []string{"1", "0"}},
+			}}},
+			expectedDevices: []string{"nvidia.com/gpu=0", "nvidia.com/gpu=1"},
+		},
+		"GPUs by count": {
+			hostCfg: container.HostConfig{Resources: container.Resources{DeviceRequests: []container.DeviceRequest{
+				{Count: 2, Capabilities: [][]string{{"gpu", "utility"}}},
+			}}},
+			expectedDevices: []string{"nvidia.com/gpu"},
+		},
+		"CDI devices": {
+			hostCfg: container.HostConfig{Resources: container.Resources{DeviceRequests: []container.DeviceRequest{
+				{Driver: "cdi", DeviceIDs: []string{"vendor.com/device=foo"}},
+			}}},
+			expectedDevices: []string{"vendor.com/device=foo"},
+		},
+		"Not a GPU": {
+			hostCfg: container.HostConfig{Resources: container.Resources{DeviceRequests: []container.DeviceRequest{
+				{Driver: "fpga", Count: 1, Capabilities: [][]string{{"compute"}}},
+			}}},
+			expectedDevices: []string{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedDevices, devices(dockerDevices(&tc.hostCfg)...))
+		})
+	}
+}
+
+func TestChangeMessages(t *testing.T) {
+	polled := func(state string) *event.Event {
+		return &event.Event{Info: event.Info{Container: event.Container{FullID: "a", Image: "alpine", State: state}}, IsCreate: true}
+	}
+	tCases := map[string]struct {
+		change          change
+		expectedActions []events.Action
+	}{
+		"New stopped container": {
+			change:          change{cur: polled(event.StateCreated)},
+			expectedActions: []events.Action{events.ActionCreate},
+		},
+		"New running container": {
+			change:          change{cur: polled(event.StateRunning)},
+			expectedActions: []events.Action{events.ActionCreate, events.ActionStart},
+		},
+		"Started container": {
+			change:          change{prev: polled(event.StateCreated), cur: polled(event.StateRunning)},
+			expectedActions: []events.Action{events.ActionStart},
+		},
+		"Exited container": {
+			change:          change{prev: polled(event.StateRunning), cur: polled(event.StateExited)},
+			expectedActions: []events.Action{events.ActionDie},
+		},
+		"Removed running container": {
+			change:          change{prev: polled(event.StateRunning)},
+			expectedActions: []events.Action{events.ActionDie, events.ActionDestroy},
+		},
+		"Removed stopped container": {
+			change:          change{prev: polled(event.StateExited)},
+			expectedActions: []events.Action{events.ActionDestroy},
+		},
+		"Never started container": {
+			change:          change{prev: polled(event.StateCreated), cur: polled(event.StateExited)},
+			expectedActions: []events.Action{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			msgs := changeMessages(tc.change, 10)
+			actions := make([]events.Action, 0, len(msgs))
+			for _, msg := range msgs {
+				assert.Equal(t, "a", msg.Actor.ID)
+				assert.Equal(t, "alpine", msg.Actor.Attributes["image"])
+				assert.Equal(t, int64(10), msg.Time)
+				actions = append(actions, msg.Action)
+			}
+			assert.Equal(t, tc.expectedActions, actions)
+		})
+	}
+
+	// Daemons older than API 1.23 only report the human readable status
+	assert.True(t, summaryIsRunning(&container.Summary{Status: "Up 2 minutes"}))
+	assert.False(t, summaryIsRunning(&container.Summary{Status: "Exited (0) 2 minutes ago"}))
+}
+
+// serveDockerAPI serves a fake docker API over a unix socket, streaming msgs on the events endpoint.
+// Listed containers are c1, created but never started, and c2, running after 2 restarts;
+// like the daemon does, msgs are filtered by the requested actions.
+func serveDockerAPI(t *testing.T, msgs []events.Message) string {
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	states := map[string]string{"c1": "created", "c2": "running", "c3": "running", "c4": "running"}
+	// Networks get an address once the container starts
+	ips := map[string]string{"c4": "172.17.0.4"}
+	restarts := map[string]int{"c2": 2}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.45")
+		_, _ = w.Write([]byte("OK"))
+	})
+	labels := map[string]map[string]string{
+		"c1": {"team": "falco"},
+		"c2": {"team": "other"},
+		"c3": {"team": "falco"},
+		"c4": {"team": "falco"},
+	}
+	mux.HandleFunc("/v1.45/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		flts, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		list := make([]container.Summary, 0)
+		for _, id := range []string{"c1", "c2"} {
+			if flts.MatchKVList("label", labels[id]) && flts.ExactMatch("status", states[id]) {
+				list = append(list, container.Summary{ID: id, Image: "alpine", State: states[id], Labels: labels[id]})
+			}
+		}
+		_ = json.NewEncoder(w).Encode(list)
+	})
+	mux.HandleFunc("/v1.45/containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		var netCfg *container.NetworkSettings
+		if ip, ok := ips[id]; ok {
+			netCfg = &container.NetworkSettings{
+				Networks: map[string]*network.EndpointSettings{"bridge": {IPAddress: ip}},
+			}
+		}
+		_ = json.NewEncoder(w).Encode(container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				ID:           id,
+				Created:      "2024-11-07T11:10:03Z",
+				State:        &container.State{Status: states[id]},
+				RestartCount: restarts[id],
+			},
+			Config:          &container.Config{Image: "alpine"},
+			NetworkSettings: netCfg,
+		})
+	})
+	mux.HandleFunc("/v1.45/images/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"message":"no such image"}`))
+	})
+	mux.HandleFunc("/v1.45/events", func(w http.ResponseWriter, r *http.Request) {
+		flts, err := filters.FromJSON(r.URL.Query().Get("filters"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		for _, msg := range msgs {
+			if flts.ExactMatch("event", string(msg.Action)) && flts.MatchKVList("label", msg.Actor.Attributes) {
+				_ = json.NewEncoder(w).Encode(msg)
+			}
+		}
+		w.(http.Flusher).Flush()
+		// Keep the stream open until the client goes away
+		<-r.Context().Done()
+	})
+	srv := &http.Server{Handler: mux}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+	return socket
+}
+
+func TestEmitOn(t *testing.T) {
+	msg := func(id string, action events.Action) events.Message {
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: action,
+			Actor:  events.Actor{ID: id, Attributes: map[string]string{"image": "alpine"}},
+			Time:   1,
+		}
+	}
+
+	type emitted struct {
+		id       string
+		isCreate bool
+		update   bool
+	}
+	tCases := map[string]struct {
+		emitOn         string
+		id             string
+		expectedListed []emitted
+		expectedEvents []emitted
+	}{
+		"Create": {
+			emitOn:         config.EmitOnCreate,
+			id:             "c3",
+			expectedListed: []emitted{{"c1", true, false}, {"c2", true, false}},
+			// The create event gets updated with the running state
+			expectedEvents: []emitted{{"c3", true, false}, {"c3", true, true}, {"c3", false, false}},
+		},
+		"Create, with networks": {
+			emitOn:         config.EmitOnCreate,
+			id:             "c4",
+			expectedListed: []emitted{{"c1", true, false}, {"c2", true, false}},
+			// The create event gets updated with the networks
+			expectedEvents: []emitted{{"c4", true, false}, {"c4", true, true}, {"c4", false, false}},
+		},
+		"Start": {
+			emitOn:         config.EmitOnStart,
+			id:             "c3",
+			expectedListed: []emitted{{"c2", true, false}},
+			expectedEvents: []emitted{{"c3", true, false}, {"c3", false, false}},
+		},
+		"Start, with networks": {
+			emitOn:         config.EmitOnStart,
+			id:             "c4",
+			expectedListed: []emitted{{"c2", true, false}},
+			expectedEvents: []emitted{{"c4", true, false}, {"c4", false, false}},
+		},
+		"Both": {
+			emitOn:         config.EmitOnBoth,
+			id:             "c3",
+			expectedListed: []emitted{{"c1", true, false}, {"c2", true, false}},
+			expectedEvents: []emitted{{"c3", true, false}, {"c3", true, true}, {"c3", false, false}},
+		},
+	}
+
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"emit_on":""}}}`)
+	})
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, config.Load(`{"engines":{"docker":{"emit_on":"`+tc.emitOn+`"}}}`))
+			socket := serveDockerAPI(t, []events.Message{
+				msg(tc.id, events.ActionCreate),
+				msg(tc.id, events.ActionStart),
+				msg(tc.id, events.ActionDestroy),
+			})
+			engine, err := newDockerEngine(context.Background(), socket)
+			require.NoError(t, err)
+
+			// Listed events are the initial state: never updates
+			evts, err := engine.List(context.Background())
+			require.NoError(t, err)
+			listed := make([]emitted, 0, len(evts))
+			for _, evt := range evts {
+				listed = append(listed, emitted{evt.FullID, evt.IsCreate, evt.Update})
+			}
+			assert.Equal(t, tc.expectedListed, listed)
+
+			wg := sync.WaitGroup{}
+			cancelCtx, cancel := context.WithCancel(context.Background())
+			listCh, err := engine.Listen(cancelCtx, &wg)
+			require.NoError(t, err)
+			received := make([]emitted, 0, len(tc.expectedEvents))
+			for range tc.expectedEvents {
+				evt := waitOnChannelOrTimeout(t, listCh)
+				received = append(received, emitted{evt.FullID, evt.IsCreate, evt.Update})
+			}
+			assert.Equal(t, tc.expectedEvents, received)
+			cancel()
+			for range listCh {
+			}
+			wg.Wait()
+		})
+	}
+}
+
+func TestRestartCount(t *testing.T) {
+	msg := func(action events.Action, exitCode string) events.Message {
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: action,
+			Actor:  events.Actor{ID: "c3", Attributes: map[string]string{"image": "alpine", "exitCode": exitCode}},
+			Time:   1,
+		}
+	}
+	// A crash-looping container, restarted on error, on OOM and by its restart policy
+	socket := serveDockerAPI(t, []events.Message{
+		msg(events.ActionCreate, ""),
+		msg(events.ActionStart, ""),
+		msg(events.ActionDie, "1"),
+		msg(events.ActionStart, ""),
+		msg(events.ActionOOM, ""),
+		msg(events.ActionDie, "137"),
+		msg(events.ActionStart, ""),
+		msg(events.ActionDie, "0"),
+		msg(events.ActionStart, ""),
+		msg(events.ActionDestroy, ""),
+	})
+
+	type emitted struct {
+		isCreate bool
+		update   bool
+		count    int
+		reason   string
+	}
+	expected := []emitted{
+		{true, false, 0, ""},
+		{true, true, 0, ""},
+		{true, true, 1, event.RestartReasonError},
+		{true, true, 2, event.RestartReasonOOM},
+		{true, true, 3, event.RestartReasonPolicy},
+		{false, false, 3, event.RestartReasonPolicy},
+	}
+
+	engine, err := newDockerEngine(context.Background(), socket)
+	require.NoError(t, err)
+
+	// Listed containers report the restarts counted by the daemon
+	evts, err := engine.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, evts, 2)
+	assert.Equal(t, "c2", evts[1].FullID)
+	assert.Equal(t, 2, evts[1].RestartCount)
+
+	wg := sync.WaitGroup{}
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	listCh, err := engine.Listen(cancelCtx, &wg)
+	require.NoError(t, err)
+	received := make([]emitted, 0, len(expected))
+	for range expected {
+		evt := waitOnChannelOrTimeout(t, listCh)
+		received = append(received, emitted{evt.IsCreate, evt.Update, evt.RestartCount, evt.LastRestartReason})
+	}
+	assert.Equal(t, expected, received)
+	cancel()
+	for range listCh {
+	}
+	wg.Wait()
+}
+
+func TestLabelFilter(t *testing.T) {
+	msg := func(id, team string) events.Message {
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionCreate,
+			Actor:  events.Actor{ID: id, Attributes: map[string]string{"image": "alpine", "team": team}},
+			Time:   1,
+		}
+	}
+	socket := serveDockerAPI(t, []events.Message{
+		msg("c4", "other"),
+		msg("c3", "falco"),
+	})
+
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"label_filter":null}}}`)
+	})
+	require.NoError(t, config.Load(`{"engines":{"docker":{"label_filter":{"team":"falco"}}}}`))
+	engine, err := newDockerEngine(context.Background(), socket)
+	require.NoError(t, err)
+
+	// The initial state applies the same filter
+	evts, err := engine.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, evts, 1)
+	assert.Equal(t, "c1", evts[0].FullID)
+
+	wg := sync.WaitGroup{}
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	listCh, err := engine.Listen(cancelCtx, &wg)
+	require.NoError(t, err)
+	evt := waitOnChannelOrTimeout(t, listCh)
+	assert.Equal(t, "c3", evt.FullID)
+	cancel()
+	for range listCh {
+	}
+	wg.Wait()
+}
+
+func TestDockerStates(t *testing.T) {
+	msg := func(id string, action events.Action) events.Message {
+		return events.Message{
+			Type:   events.ContainerEventType,
+			Action: action,
+			Actor:  events.Actor{ID: id, Attributes: map[string]string{"image": "alpine"}},
+			Time:   1,
+		}
+	}
+	socket := serveDockerAPI(t, []events.Message{
+		msg("c1", events.ActionCreate),
+		msg("c3", events.ActionCreate),
+		msg("c1", events.ActionDestroy),
+		msg("c2", events.ActionDestroy),
+	})
+
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"states":null}}}`)
+	})
+	require.NoError(t, config.Load(`{"engines":{"docker":{"states":["running"]}}}`))
+	engine, err := newDockerEngine(context.Background(), socket)
+	require.NoError(t, err)
+
+	// The initial state is filtered by the daemon
+	evts, err := engine.List(context.Background())
+	require.NoError(t, err)
+	require.Len(t, evts, 1)
+	assert.Equal(t, "c2", evts[0].FullID)
+
+	wg := sync.WaitGroup{}
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	listCh, err := engine.Listen(cancelCtx, &wg)
+	require.NoError(t, err)
+	// c1 never started: neither its create nor its removal are reported.
+	// Events of different containers may be sent out of order.
+	isCreate := make(map[string]bool)
+	for i := 0; i < 2; i++ {
+		evt := waitOnChannelOrTimeout(t, listCh)
+		isCreate[evt.FullID] = evt.IsCreate
+	}
+	assert.Equal(t, map[string]bool{"c3": true, "c2": false}, isCreate)
+	cancel()
+	for range listCh {
+	}
+	wg.Wait()
+}
+
+func TestDockerReconnect(t *testing.T) {
+	require.NoError(t, config.Load(`{"engines":{"docker":{"poll_interval_ms":10}}}`))
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"poll_interval_ms":0}}}`)
+		ResetStatus()
+	})
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	// The daemon goes down while streaming, then comes back
+	var (
+		mu    sync.Mutex
+		down  bool
+		since []string
+	)
+	isDown := func() bool {
+		mu.Lock()
+		defer mu.Unlock()
+		return down
+	}
+	streaming := make(chan struct{})
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.45")
+		_, _ = w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/v1.45/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		if isDown() {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		_ = json.NewEncoder(w).Encode([]container.Summary{})
+	})
+	mux.HandleFunc("/v1.45/containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(container.InspectResponse{
+			ContainerJSONBase: &container.ContainerJSONBase{
+				ID:      r.PathValue("id"),
+				Created: "2024-11-07T11:10:03Z",
+				State:   &container.State{Status: "created"},
+			},
+			Config: &container.Config{Image: "alpine"},
+		})
+	})
+	mux.HandleFunc("/v1.45/images/{name}/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/v1.45/events", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		since = append(since, r.URL.Query().Get("since"))
+		resumed := len(since) > 1
+		mu.Unlock()
+		w.WriteHeader(http.StatusOK)
+		if !resumed {
+			w.(http.Flusher).Flush()
+			<-streaming
+			// Going down, breaking the stream
+			return
+		}
+		_ = json.NewEncoder(w).Encode(events.Message{
+			Type:   events.ContainerEventType,
+			Action: events.ActionCreate,
+			Actor:  events.Actor{ID: "c3", Attributes: map[string]string{"image": "alpine"}},
+			Time:   time.Now().Unix(),
+		})
+		w.(http.Flusher).Flush()
+		<-r.Context().Done()
+	})
+	srv := &http.Server{Handler: mux}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	engine, err := newDockerEngine(context.Background(), socket)
+	require.NoError(t, err)
+	setState(engine.Name(), socket, EngineRunning, nil)
+	wg := sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	listCh, err := engine.Listen(ctx, &wg)
+	require.NoError(t, err)
+
+	mu.Lock()
+	down = true
+	mu.Unlock()
+	close(streaming)
+	require.Eventually(t, func() bool {
+		st := Status()
+		return len(st) == 1 && st[0].Retries >= 2 && st[0].BackoffMs > 0
+	}, 5*time.Second, 5*time.Millisecond)
+
+	mu.Lock()
+	down = false
+	mu.Unlock()
+	evt := waitOnChannelOrTimeout(t, listCh)
+	assert.Equal(t, "c3", evt.FullID)
+	assert.True(t, evt.IsCreate)
+	st := Status()
+	require.Len(t, st, 1)
+	assert.Zero(t, st[0].Retries)
+	assert.Equal(t, uint64(1), st[0].Reconnects)
+	mu.Lock()
+	assert.Len(t, since, 2)
+	assert.Empty(t, since[0])
+	assert.NotEmpty(t, since[1])
+	mu.Unlock()
+
+	cancel()
+	for range listCh {
+	}
+	wg.Wait()
+}
+
+func TestDockerPolling(t *testing.T) {
+	require.NoError(t, config.Load(`{"engines":{"docker":{"poll_interval_ms":10}}}`))
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"poll_interval_ms":0}}}`)
+	})
+	socket := filepath.Join(t.TempDir(), "docker.sock")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	// A daemon too old for the events filters: c2 gets started, then removed
+	var (
+		mu     sync.Mutex
+		listed = []container.Summary{{ID: "c1", Image: "alpine", Status: "Up 2 minutes"}}
+	)
+	setListed := func(list ...container.Summary) {
+		mu.Lock()
+		defer mu.Unlock()
+		listed = list
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_ping", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Api-Version", "1.21")
+		_, _ = w.Write([]byte("OK"))
+	})
+	mux.HandleFunc("/v1.21/containers/json", func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		_ = json.NewEncoder(w).Encode(listed)
+	})
+	mux.HandleFunc("/v1.21/containers/{id}/json", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+	})
+	mux.HandleFunc("/v1.21/events", func(w http.ResponseWriter, r *http.Request) {
+		t.Error("events stream requested")
+	})
+	srv := &http.Server{Handler: mux}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+
+	engine, err := newDockerEngine(context.Background(), socket)
+	require.NoError(t, err)
+	wg := sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	listCh, err := engine.Listen(ctx, &wg)
+	require.NoError(t, err)
+
+	// Once the pre-existing c1 got listed
+	time.Sleep(50 * time.Millisecond)
+	c2 := container.Summary{ID: "c2", Image: "alpine", Status: "Up 1 second"}
+	setListed(listed[0], c2)
+	// Created then started, like reported by the events stream
+	evt := waitOnChannelOrTimeout(t, listCh)
+	assert.Equal(t, "c2", evt.FullID)
+	assert.True(t, evt.IsCreate)
+	assert.Equal(t, event.StateCreated, evt.State)
+	evt = waitOnChannelOrTimeout(t, listCh)
+	assert.Equal(t, "c2", evt.FullID)
+	assert.True(t, evt.IsCreate)
+	assert.Equal(t, event.StateRunning, evt.State)
+
+	setListed(listed[0])
+	evt = waitOnChannelOrTimeout(t, listCh)
+	assert.Equal(t, "c2", evt.FullID)
+	assert.False(t, evt.IsCreate)
+	assert.Equal(t, event.StateRemoved, evt.State)
+
+	cancel()
+	for range listCh {
+	}
+	wg.Wait()
+}
+
+func TestDockerEventSchema(t *testing.T) {
+	var sizeRw int64 = 10
+
+	// No daemon listening: image inspect fails and only the container inspect data is used.
+	docker, err := newDockerEngine(context.Background(), "/non/existent/docker.sock")
+	require.NoError(t, err)
+	assertMatchesSchema(t, event.Event{Info: docker.(*dockerEngine).ctrToInfo(context.Background(), container.InspectResponse{
+		ContainerJSONBase: &container.ContainerJSONBase{
+			ID:      "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+			Name:    "/sharp_poincare",
+			Image:   "sha256:0ca0fed353fb77c247abada85aebc667fd1f5fa0b5f6ab1efb26867ba18f2f0a",
+			Created: time.Now().Format(time.RFC3339Nano),
+			SizeRw:  &sizeRw,
+		},
+		Config: &container.Config{
+			Image:  "fedora:38",
+			Env:    []string{"FGC=f38"},
+			Labels: map[string]string{"foo": "bar"},
+			Healthcheck: &container.HealthConfig{
+				Test: []string{"CMD-SHELL", "exit 0"},
+			},
+		},
+	}), IsCreate: true})
+}
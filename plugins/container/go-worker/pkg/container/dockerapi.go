@@ -0,0 +1,90 @@
+//go:build !no_docker || (linux && !no_podman)
+
+package container
+
+import (
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/events"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"strings"
+)
+
+// Helpers shared by the engines speaking the docker API: docker and podman.
+
+type Probe struct {
+	Exec *struct {
+		Command []string `json:"command"`
+	} `json:"exec"`
+}
+
+type Healthcheck struct {
+	Test []string `json:"Test"`
+}
+
+type k8sPodSpecInfo struct {
+	Spec *struct {
+		Containers []struct {
+			LivenessProbe  *Probe       `json:"livenessProbe"`
+			ReadinessProbe *Probe       `json:"readinessProbe"`
+			Healthcheck    *Healthcheck `json:"healthcheck"`
+		} `json:"containers"`
+	} `json:"spec"`
+}
+
+// normalizeArg removes pairs of leading/trailing " or ' chars, if present
+func normalizeArg(val string) string {
+	strings.TrimPrefix(val, `"`)
+	strings.TrimPrefix(val, `'`)
+	return val
+}
+
+func parseLivenessReadinessProbe(probe *Probe) *event.Probe {
+	if probe == nil || probe.Exec == nil || probe.Exec.Command == nil {
+		return nil
+	}
+	p := event.Probe{}
+	p.Exe = normalizeArg(probe.Exec.Command[0])
+	for _, arg := range probe.Exec.Command[1:] {
+		p.Args = append(p.Args, normalizeArg(arg))
+	}
+	return &p
+}
+
+func parseHealthcheckProbe(hcheck *container.HealthConfig) *event.Probe {
+	if hcheck == nil || len(hcheck.Test) <= 1 {
+		return nil
+	}
+	p := event.Probe{}
+
+	switch hcheck.Test[0] {
+	case "CMD":
+		p.Exe = normalizeArg(hcheck.Test[1])
+		for _, arg := range hcheck.Test[2:] {
+			p.Args = append(p.Args, normalizeArg(arg))
+		}
+	case "CMD-SHELL":
+		p.Exe = "/bin/sh"
+		p.Args = append(p.Args, "-c")
+		p.Args = append(p.Args, hcheck.Test[1])
+	default:
+		return nil
+	}
+	return &p
+}
+
+// actionToState returns the container state implied by an event action,
+// used when the container cannot be inspected.
+func actionToState(action events.Action) string {
+	switch action {
+	case events.ActionCreate:
+		return event.StateCreated
+	case events.ActionStart:
+		return event.StateRunning
+	case events.ActionDie:
+		return event.StateExited
+	case events.ActionDestroy, events.ActionRemove:
+		return event.StateRemoved
+	default:
+		return event.StateUnknown
+	}
+}
@@ -1,15 +1,22 @@
 package container
 
 import (
+	"container/list"
 	"context"
 	"encoding/binary"
+	"encoding/json"
 	"fmt"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"net/netip"
 	"net/url"
 	"os"
 	"path/filepath"
+	"runtime"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"sync"
@@ -28,6 +35,23 @@ const (
 	typeCri        engineType = "cri"
 	typeCrio       engineType = "cri-o"
 	typeContainerd engineType = "containerd"
+	typeLxd        engineType = "lxd"
+	typeExternal   engineType = "external"
+)
+
+// k8sLastAppliedConfigLabel is the label kubectl sets to the full object config, filtered out by the engines.
+const k8sLastAppliedConfigLabel = "io.kubernetes.container.last-applied-config"
+
+// cniResultAnnotation holds the CNI result json of the container network setup.
+const cniResultAnnotation = "io.kubernetes.cri-o.CNIResult"
+
+const (
+	// nvidiaVisibleDevicesEnv selects the GPUs the NVIDIA container runtime exposes to the container.
+	nvidiaVisibleDevicesEnv = "NVIDIA_VISIBLE_DEVICES"
+	// nvidiaGPUKind is the CDI kind of the NVIDIA GPUs.
+	nvidiaGPUKind = "nvidia.com/gpu"
+	// cdiAnnotationPrefix prefixes the annotations requesting CDI devices, eg: nvidia.com/gpu=0.
+	cdiAnnotationPrefix = "cdi.k8s.io/"
 )
 
 type engineType string
@@ -46,18 +70,83 @@ func (t engineType) ToCTValue() int {
 		return 7
 	case typeCrio:
 		return 8
+	case typeLxd:
+		return 1 // CT_LXC
+	case typeExternal:
+		return 5 // CT_CUSTOM
 	default:
 		return 0xffff // unknown
 	}
 }
 
 type engineGenerator func(context.Context, string) (Engine, error)
-type EngineGenerator func(ctx context.Context) (Engine, error)
 
-// Hooked up by each engine through init()
+// EngineGenerator creates the engine for a single enabled socket.
+type EngineGenerator struct {
+	Name   string
+	Socket string
+	// Remote is set for generators connecting to a network endpoint, held by Socket:
+	// they are always attempted, and their socket is not watched.
+	Remote bool
+	New    func(ctx context.Context) (Engine, error)
+}
+
+// The engine registry, hooked up by each engine through register in its init().
+// Every engine source file is guarded by a `no_<engine>` build tag, eg: `no_docker`,
+// so that excluded engines are neither compiled nor linked, and missing from the registry.
 var engineGenerators = make(map[engineType]engineGenerator)
 
+// remoteEngineGenerator creates an engine reaching its endpoint over mTLS.
+type remoteEngineGenerator func(ctx context.Context, endpoint string, tlsCfg config.TLSConfig) (Engine, error)
+
+// Hooked up through registerRemote by the engines that can be reached over the network
+var remoteEngineGenerators = make(map[engineType]remoteEngineGenerator)
+
+// goEngines are all the engine types implemented by the worker, whether built in or not.
+var goEngines = []engineType{typeDocker, typePodman, typeCri, typeContainerd, typeLxd, typeExternal}
+
+// register adds the generator of an engine type to the registry.
+func register(t engineType, gen engineGenerator) {
+	engineGenerators[t] = gen
+}
+
+// registerRemote adds the generator reaching an engine type over the network to the registry.
+func registerRemote(t engineType, gen remoteEngineGenerator) {
+	remoteEngineGenerators[t] = gen
+}
+
+// Registered returns the sorted names of the engines built in.
+func Registered() []string {
+	names := make([]string, 0, len(engineGenerators))
+	for t := range engineGenerators {
+		names = append(names, string(t))
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Generators returns the generators for the enabled sockets that exist.
 func Generators() ([]EngineGenerator, error) {
+	c := config.Get()
+	for _, t := range goEngines {
+		if _, ok := engineGenerators[t]; !ok && c.SocketsEngines[string(t)].Enabled {
+			logger.Warnf("engine %s is enabled but excluded from the build, skipping it", t)
+		}
+	}
+
+	generators := make([]EngineGenerator, 0)
+	for _, g := range ConfiguredGenerators() {
+		// Even if `stat` returns an err that is not NotExist,
+		// try to generate an engine for the socket.
+		if g.Remote || socketExists(g.Socket) {
+			generators = append(generators, g)
+		}
+	}
+	return generators, nil
+}
+
+// ConfiguredGenerators returns the generators for all the enabled sockets, existing or not.
+func ConfiguredGenerators() []EngineGenerator {
 	generators := make([]EngineGenerator, 0)
 
 	c := config.Get()
@@ -66,20 +155,34 @@ func Generators() ([]EngineGenerator, error) {
 		if !ok || !eCfg.Enabled {
 			continue
 		}
-		// For each specified socket, return a closure to generate its engine
+		// A remote endpoint replaces the sockets
+		if endpoint, tlsCfg, ok := config.GetRemoteEndpoint(string(engineName)); ok {
+			if remoteGen, ok := remoteEngineGenerators[engineName]; ok {
+				generators = append(generators, EngineGenerator{
+					Name:   string(engineName),
+					Socket: endpoint,
+					Remote: true,
+					New: func(ctx context.Context) (Engine, error) {
+						return remoteGen(ctx, endpoint, tlsCfg)
+					},
+				})
+				continue
+			}
+		}
+		// For each specified socket, return a generator for its engine
 		for _, socket := range eCfg.Sockets {
 			// Properly account for HOST_ROOT env variable
 			socket = filepath.Join(config.GetHostRoot(), socket)
-			// Even if `stat` returns an err that is not NotExist,
-			// try to generate an engine for the socket.
-			if _, statErr := os.Stat(socket); !os.IsNotExist(statErr) {
-				generators = append(generators, func(ctx context.Context) (Engine, error) {
+			generators = append(generators, EngineGenerator{
+				Name:   string(engineName),
+				Socket: socket,
+				New: func(ctx context.Context) (Engine, error) {
 					return engineGen(ctx, socket)
-				})
-			}
+				},
+			})
 		}
 	}
-	return generators, nil
+	return generators
 }
 
 type getter interface {
@@ -101,6 +204,30 @@ type Engine interface {
 	Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error)
 }
 
+// Attacher is implemented by engines relying on the other ones, like the fetcher,
+// to be notified about engines attached after the worker started, or torn down.
+type Attacher interface {
+	Attach(e Engine)
+	Detach(e Engine)
+}
+
+// closer is implemented by the engines holding a client of their runtime, closed once the engine is no longer used.
+type closer interface {
+	Close() error
+}
+
+// CloseEngine closes the client of an engine no longer used, like a torn down one,
+// releasing its runtime connections; it is a no-op for engines holding none, or already closed.
+func CloseEngine(e Engine) {
+	c, ok := e.(closer)
+	if !ok {
+		return
+	}
+	if err := c.Close(); err != nil {
+		logger.Warnf("failed to close engine %s (%s): %v", e.Name(), e.Sock(), err)
+	}
+}
+
 func enforceUnixProtocolIfEmpty(socket string) string {
 	base, _ := url.Parse(socket)
 	if base.Scheme == "" {
@@ -110,10 +237,96 @@ func enforceUnixProtocolIfEmpty(socket string) string {
 	return socket
 }
 
+// argv returns a copy of args, that is never nil, so that it is always serialized as an array.
+func argv(args []string) []string {
+	return append(make([]string, 0, len(args)), args...)
+}
+
 func nanoSecondsToUnix(ns int64) int64 {
 	return time.Unix(0, ns).Unix()
 }
 
+// timeToUnix returns t as unix seconds, or 0 when it is not set.
+func timeToUnix(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.Unix()
+}
+
+// maxCachedImages bounds the images cached by each imageCache: as images get pulled and pruned
+// over the node lifetime, the least recently used ones are evicted first.
+const maxCachedImages = 512
+
+// imageCache caches image metadata, like timestamps or platforms, by image digest: images are shared
+// by many containers, and the metadata of a given digest does not change.
+// It holds up to size images, the least recently used being evicted.
+type imageCache[T any] struct {
+	mu    sync.Mutex
+	size  int
+	metas map[string]*list.Element
+	// The cached imageMeta, from the most recently used.
+	lru *list.List
+}
+
+// imageMeta is the metadata of an image, cached by imageCache.
+type imageMeta[T any] struct {
+	digest string
+	meta   T
+}
+
+func newImageCache[T any]() *imageCache[T] {
+	return &imageCache[T]{
+		size:  maxCachedImages,
+		metas: make(map[string]*list.Element),
+		lru:   list.New(),
+	}
+}
+
+// get returns the metadata of the image digest, looking it up on cache misses.
+// Failed lookups are not cached, and return the zero value.
+func (c *imageCache[T]) get(digest string, lookup func() (T, error)) T {
+	c.mu.Lock()
+	if elem, ok := c.metas[digest]; ok {
+		c.lru.MoveToFront(elem)
+		meta := elem.Value.(imageMeta[T]).meta
+		c.mu.Unlock()
+		return meta
+	}
+	c.mu.Unlock()
+	meta, err := lookup()
+	if err != nil {
+		var zero T
+		return zero
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if elem, ok := c.metas[digest]; ok {
+		// Looked up concurrently
+		c.lru.MoveToFront(elem)
+		return meta
+	}
+	c.metas[digest] = c.lru.PushFront(imageMeta[T]{digest: digest, meta: meta})
+	for c.lru.Len() > c.size {
+		oldest := c.lru.Back()
+		c.lru.Remove(oldest)
+		delete(c.metas, oldest.Value.(imageMeta[T]).digest)
+	}
+	return meta
+}
+
+// imagePlatform is the platform an image is built for, see event.Container.ImageOS.
+type imagePlatform struct {
+	os           string
+	architecture string
+	variant      string
+}
+
+// hostArchitecture returns the architecture of the node, as named by OCI platforms.
+func hostArchitecture() string {
+	return runtime.GOARCH
+}
+
 // Examples:
 // 1,7 -> 2
 // 1-4,7 -> 4 + 1 -> 5
@@ -147,6 +360,322 @@ func countCPUSet(cpuSet string) int64 {
 	return counter
 }
 
+// normalizeState maps a runtime specific container state to one of the event.State* values.
+func normalizeState(state string) string {
+	switch strings.ToLower(state) {
+	case "created", "configured", "initialized":
+		return event.StateCreated
+	case "running", "stopping":
+		return event.StateRunning
+	case "paused", "pausing", "frozen", "freezing":
+		return event.StatePaused
+	case "restarting":
+		return event.StateRestarting
+	case "exited", "stopped", "dead", "removing":
+		return event.StateExited
+	default:
+		return event.StateUnknown
+	}
+}
+
+// normalizeRuntime maps the runtime reported by the engine, a name, a binary path or
+// a containerd shim name like `io.containerd.runc.v2`, to one of the event.Runtime constants.
+func normalizeRuntime(runtime string) string {
+	if runtime == "" {
+		return event.RuntimeUnknown
+	}
+	name := strings.ToLower(filepath.Base(runtime))
+	switch {
+	// The NVIDIA runtime wraps runc: check it first
+	case strings.Contains(name, "nvidia"):
+		return event.RuntimeNvidia
+	case strings.Contains(name, "kata"):
+		return event.RuntimeKata
+	case strings.Contains(name, "runsc"), strings.Contains(name, "gvisor"):
+		return event.RuntimeGVisor
+	case strings.Contains(name, "crun"):
+		return event.RuntimeCrun
+	case strings.Contains(name, "runc"):
+		return event.RuntimeRunc
+	default:
+		return event.RuntimeOther
+	}
+}
+
+// exitInfo holds the termination details of a container.
+// restarts and restartReason are kept across the runs of the container, unlike the other details.
+type exitInfo struct {
+	code       int
+	oomKilled  bool
+	finishedAt int64
+
+	restarts      int
+	restartReason string
+}
+
+var unknownExit = exitInfo{code: -1}
+
+func (e exitInfo) apply(c *event.Container) {
+	c.ExitCode = e.code
+	c.OOMKilled = e.oomKilled
+	c.FinishedAt = e.finishedAt
+}
+
+// applyRestarts sets the restarts observed so far, unless the engine reported more of them.
+func (e exitInfo) applyRestarts(c *event.Container) {
+	c.RestartCount = max(c.RestartCount, e.restarts)
+	if e.restartReason != "" {
+		c.LastRestartReason = e.restartReason
+	}
+}
+
+// exited returns whether the container exit got observed.
+func (e exitInfo) exited() bool {
+	return e.finishedAt != 0 || e.oomKilled
+}
+
+// reason returns the cause of a restart following the exit.
+func (e exitInfo) reason() string {
+	switch {
+	case e.oomKilled:
+		return event.RestartReasonOOM
+	case e.code != 0:
+		return event.RestartReasonError
+	default:
+		return event.RestartReasonPolicy
+	}
+}
+
+// Bound for the number of tracked exitInfos per engine.
+const maxExitInfos = 4096
+
+// exitInfos remembers termination details observed through die/exit events, keyed by container ID,
+// since the container can no longer be inspected once it gets removed.
+// It is only meant to be used by a single engine listener goroutine.
+type exitInfos map[string]exitInfo
+
+func (e exitInfos) store(id string, info exitInfo) {
+	if _, ok := e[id]; !ok && len(e) >= maxExitInfos {
+		// Forget an arbitrary entry
+		for k := range e {
+			delete(e, k)
+			break
+		}
+	}
+	e[id] = info
+}
+
+// restart accounts the start of a container, returning whether it is a restart, following its exit;
+// the termination details of its previous run are forgotten.
+func (e exitInfos) restart(id string) bool {
+	info, ok := e[id]
+	if !ok || !info.exited() {
+		return false
+	}
+	e[id] = exitInfo{restarts: info.restarts + 1, restartReason: info.reason()}
+	return true
+}
+
+// take returns and forgets the termination details for a container,
+// or unknownExit if they were never observed.
+func (e exitInfos) take(id string) exitInfo {
+	info, ok := e[id]
+	if !ok {
+		return unknownExit
+	}
+	delete(e, id)
+	return info
+}
+
+// ipAddresses returns the non-empty addresses, without their CIDR prefix length if any.
+func ipAddresses(addrs ...string) []string {
+	res := make([]string, 0, len(addrs))
+	for _, addr := range addrs {
+		addr, _, _ = strings.Cut(addr, "/")
+		if addr != "" {
+			res = append(res, addr)
+		}
+	}
+	return res
+}
+
+// sortNetworks sorts networks by name, since engines report them as maps.
+func sortNetworks(networks []event.Network) {
+	sort.Slice(networks, func(i, j int) bool {
+		return networks[i].Name < networks[j].Name
+	})
+}
+
+// networkAliases returns the non empty names, sorted and without duplicates,
+// since engines report them per network.
+func networkAliases(names ...string) []string {
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return slices.Compact(res)
+}
+
+// devices returns the non-empty device paths and names, sorted and without duplicates.
+func devices(names ...string) []string {
+	res := make([]string, 0, len(names))
+	for _, name := range names {
+		if name != "" {
+			res = append(res, name)
+		}
+	}
+	sort.Strings(res)
+	return slices.Compact(res)
+}
+
+// runtimeDevices returns the devices allocated to the container by the runtime, as CDI names:
+// the GPUs selected through the NVIDIA runtime env, eg: `nvidia.com/gpu=0` or `nvidia.com/gpu=all`,
+// and the devices requested through the CDI annotations.
+func runtimeDevices(env []string, annotations map[string]string) []string {
+	res := make([]string, 0)
+	for _, e := range env {
+		val, ok := strings.CutPrefix(e, nvidiaVisibleDevicesEnv+"=")
+		if !ok {
+			continue
+		}
+		for _, id := range strings.Split(val, ",") {
+			// none and void expose no GPU
+			if id = strings.TrimSpace(id); id != "" && id != "none" && id != "void" {
+				res = append(res, nvidiaGPUKind+"="+id)
+			}
+		}
+	}
+	for key, val := range annotations {
+		if strings.HasPrefix(key, cdiAnnotationPrefix) {
+			for _, name := range strings.Split(val, ",") {
+				res = append(res, strings.TrimSpace(name))
+			}
+		}
+	}
+	return res
+}
+
+// specDevices returns the paths of the device nodes created by the OCI runtime spec.
+func specDevices(linux *specs.Linux) []string {
+	if linux == nil {
+		return []string{}
+	}
+	res := make([]string, 0, len(linux.Devices))
+	for _, d := range linux.Devices {
+		res = append(res, d.Path)
+	}
+	return res
+}
+
+// sharedNamespaceTarget returns the container joined by the first of the given namespace modes
+// in the `container:<id or name>` form, used by docker and podman, or empty.
+func sharedNamespaceTarget(modes ...string) string {
+	for _, mode := range modes {
+		if target, ok := strings.CutPrefix(mode, "container:"); ok && target != "" {
+			return target
+		}
+	}
+	return ""
+}
+
+// firstIPAddress returns the first address of the first network that has one, if any.
+func firstIPAddress(networks []event.Network) string {
+	for _, n := range networks {
+		if len(n.IPAddresses) > 0 {
+			return n.IPAddresses[0]
+		}
+	}
+	return ""
+}
+
+// cniResult is the subset of a CNI result used to report networks.
+// See https://www.cni.dev/docs/spec/#add-success
+type cniResult struct {
+	Interfaces []struct {
+		Name    string `json:"name"`
+		Mac     string `json:"mac"`
+		Sandbox string `json:"sandbox"`
+	} `json:"interfaces"`
+	IPs []struct {
+		Address   string `json:"address"`
+		Interface *int   `json:"interface"`
+	} `json:"ips"`
+}
+
+// cniResultToNetworks returns a network for each interface inside the container
+// reported by a CNI result json; the result does not tell network names.
+func cniResultToNetworks(result string) []event.Network {
+	var res cniResult
+	if err := json.Unmarshal([]byte(result), &res); err != nil {
+		return []event.Network{}
+	}
+	networks := make([]event.Network, 0)
+	// Index of each interface network, if inside the container
+	ifaceNetwork := make(map[int]int)
+	for i, iface := range res.Interfaces {
+		if iface.Sandbox == "" {
+			// Host side interface, eg: the bridge or veth peer
+			continue
+		}
+		ifaceNetwork[i] = len(networks)
+		networks = append(networks, event.Network{
+			IPAddresses: []string{},
+			MAC:         iface.Mac,
+			Interface:   iface.Name,
+		})
+	}
+	for _, ip := range res.IPs {
+		addrs := ipAddresses(ip.Address)
+		if len(addrs) == 0 {
+			continue
+		}
+		if ip.Interface != nil {
+			if idx, ok := ifaceNetwork[*ip.Interface]; ok {
+				networks[idx].IPAddresses = append(networks[idx].IPAddresses, addrs...)
+			}
+			continue
+		}
+		// No interface reference: attach it to the first container one.
+		if len(networks) == 0 {
+			networks = append(networks, event.Network{IPAddresses: []string{}})
+		}
+		networks[0].IPAddresses = append(networks[0].IPAddresses, addrs...)
+	}
+	return networks
+}
+
+// containerID returns the container ID to be reported in events, depending on the configured format.
+// The full ID is always reported separately.
+func containerID(id string) string {
+	if config.GetIDFormat() == config.IDFormatFull {
+		return id
+	}
+	return shortContainerID(id)
+}
+
+// emitsOnCreate returns whether the engine sends the container event on create.
+func emitsOnCreate(t engineType) bool {
+	return config.IsHookEnabled(config.HookCreate) && config.GetEmitOn(string(t)) != config.EmitOnStart
+}
+
+// emitsOnStart returns whether the engine sends the container event on start,
+// and whether it is an update of the one sent on create; so is the event sent on start
+// to fill the networks in, when the engine does not emit on it.
+func emitsOnStart(t engineType) (emit bool, update bool) {
+	if config.GetEmitOn(string(t)) == config.EmitOnStart {
+		return true, false
+	}
+	return config.GetEmitOn(string(t)) == config.EmitOnBoth || config.IsHookEnabled(config.HookStart), emitsOnCreate(t)
+}
+
+// emitsListed returns whether a pre-existing container in the given state is reported.
+func emitsListed(t engineType, state string) bool {
+	return state != event.StateCreated || config.GetEmitOn(string(t)) != config.EmitOnStart
+}
+
 func shortContainerID(id string) string {
 	if len(id) > shortIDLength {
 		return id[:shortIDLength]
@@ -180,3 +709,82 @@ func parsePortBindingHostPort(port string) (uint16, error) {
 
 	return uint16(convertedPort), nil
 }
+
+// hostIDMapping is the identity mapping of the initial user namespace.
+var hostIDMapping = event.IDMapping{ContainerID: 0, HostID: 0, Size: 4294967295}
+
+// idMappingsUserns returns the user namespace mode implied by the uid mappings of a process,
+// along with the mappings to be reported.
+func idMappingsUserns(uidMappings []event.IDMapping, gidMappings []event.IDMapping) (string, []event.IDMapping, []event.IDMapping) {
+	if len(uidMappings) == 1 && uidMappings[0] == hostIDMapping {
+		return event.UsernsHost, []event.IDMapping{}, []event.IDMapping{}
+	}
+	return event.UsernsPrivate, uidMappings, gidMappings
+}
+
+// parseIDMappings parses a /proc/<pid>/{uid,gid}_map file content.
+func parseIDMappings(content string) ([]event.IDMapping, error) {
+	mappings := make([]event.IDMapping, 0)
+	for _, line := range strings.Split(strings.TrimSpace(content), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 0 {
+			continue
+		}
+		if len(fields) != 3 {
+			return nil, fmt.Errorf("malformed id mapping: %q", line)
+		}
+		var ids [3]uint32
+		for i, field := range fields {
+			id, err := strconv.ParseUint(field, 10, 32)
+			if err != nil {
+				return nil, err
+			}
+			ids[i] = uint32(id)
+		}
+		mappings = append(mappings, event.IDMapping{ContainerID: ids[0], HostID: ids[1], Size: ids[2]})
+	}
+	return mappings, nil
+}
+
+// procUserns returns the user namespace mode and mappings of a running process, read from HOST_ROOT procfs.
+func procUserns(pid int) (string, []event.IDMapping, []event.IDMapping, error) {
+	if pid <= 0 {
+		return "", nil, nil, fmt.Errorf("invalid pid %d", pid)
+	}
+	procDir := filepath.Join(config.GetHostRoot(), "/proc", strconv.Itoa(pid))
+	mappings := make([][]event.IDMapping, 0, 2)
+	for _, file := range []string{"uid_map", "gid_map"} {
+		content, err := os.ReadFile(filepath.Join(procDir, file))
+		if err != nil {
+			return "", nil, nil, err
+		}
+		m, err := parseIDMappings(string(content))
+		if err != nil {
+			return "", nil, nil, err
+		}
+		mappings = append(mappings, m)
+	}
+	mode, uidMappings, gidMappings := idMappingsUserns(mappings[0], mappings[1])
+	return mode, uidMappings, gidMappings, nil
+}
+
+// specUserns returns the user namespace mode and mappings from an OCI spec.
+func specUserns(linux *specs.Linux) (string, []event.IDMapping, []event.IDMapping) {
+	if linux == nil {
+		return event.UsernsHost, []event.IDMapping{}, []event.IDMapping{}
+	}
+	for _, ns := range linux.Namespaces {
+		if ns.Type == specs.UserNamespace {
+			return event.UsernsPrivate, specIDMappings(linux.UIDMappings), specIDMappings(linux.GIDMappings)
+		}
+	}
+	return event.UsernsHost, []event.IDMapping{}, []event.IDMapping{}
+}
+
+func specIDMappings(specMappings []specs.LinuxIDMapping) []event.IDMapping {
+	mappings := make([]event.IDMapping, 0, len(specMappings))
+	for _, m := range specMappings {
+		mappings = append(mappings, event.IDMapping{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+	return mappings
+}
@@ -2,8 +2,16 @@ package container
 
 import (
 	"encoding/binary"
+	"errors"
 	"github.com/docker/docker/client"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/opencontainers/runtime-spec/specs-go"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"strconv"
 	"testing"
 )
 
@@ -140,3 +148,351 @@ func TestParsePortBindingHostPort(t *testing.T) {
 		})
 	}
 }
+
+func TestNormalizeState(t *testing.T) {
+	tCases := map[string]struct {
+		state         string
+		expectedState string
+	}{
+		"Docker created":     {state: "created", expectedState: event.StateCreated},
+		"Podman configured":  {state: "configured", expectedState: event.StateCreated},
+		"Running":            {state: "running", expectedState: event.StateRunning},
+		"CRI running":        {state: "RUNNING", expectedState: event.StateRunning},
+		"Containerd pausing": {state: "pausing", expectedState: event.StatePaused},
+		"Docker restarting":  {state: "restarting", expectedState: event.StateRestarting},
+		"Containerd stopped": {state: "stopped", expectedState: event.StateExited},
+		"Docker dead":        {state: "dead", expectedState: event.StateExited},
+		"Empty":              {state: "", expectedState: event.StateUnknown},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedState, normalizeState(tc.state))
+		})
+	}
+}
+
+func TestNormalizeRuntime(t *testing.T) {
+	tCases := map[string]struct {
+		runtime         string
+		expectedRuntime string
+	}{
+		"Docker runc":          {runtime: "runc", expectedRuntime: event.RuntimeRunc},
+		"Containerd runc shim": {runtime: "io.containerd.runc.v2", expectedRuntime: event.RuntimeRunc},
+		"Podman crun":          {runtime: "crun", expectedRuntime: event.RuntimeCrun},
+		"Crun binary":          {runtime: "/usr/bin/crun", expectedRuntime: event.RuntimeCrun},
+		"Kata":                 {runtime: "kata-runtime", expectedRuntime: event.RuntimeKata},
+		"Kata shim":            {runtime: "io.containerd.kata.v2", expectedRuntime: event.RuntimeKata},
+		"GVisor":               {runtime: "runsc", expectedRuntime: event.RuntimeGVisor},
+		"GVisor shim":          {runtime: "io.containerd.runsc.v1", expectedRuntime: event.RuntimeGVisor},
+		"NVIDIA":               {runtime: "nvidia", expectedRuntime: event.RuntimeNvidia},
+		"NVIDIA binary":        {runtime: "/usr/bin/nvidia-container-runtime", expectedRuntime: event.RuntimeNvidia},
+		"Other":                {runtime: "youki", expectedRuntime: event.RuntimeOther},
+		"Empty":                {runtime: "", expectedRuntime: event.RuntimeUnknown},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedRuntime, normalizeRuntime(tc.runtime))
+		})
+	}
+}
+
+func TestExitInfos(t *testing.T) {
+	exits := make(exitInfos)
+
+	// Never observed
+	assert.Equal(t, unknownExit, exits.take("foo"))
+
+	exits.store("foo", exitInfo{code: 137, oomKilled: true, finishedAt: 10})
+	var ctr event.Container
+	exits.take("foo").apply(&ctr)
+	assert.Equal(t, 137, ctr.ExitCode)
+	assert.True(t, ctr.OOMKilled)
+	assert.Equal(t, int64(10), ctr.FinishedAt)
+
+	// Forgotten once taken
+	assert.Equal(t, unknownExit, exits.take("foo"))
+
+	// Bounded
+	for i := 0; i < maxExitInfos+10; i++ {
+		exits.store(strconv.Itoa(i), exitInfo{code: i})
+	}
+	assert.Len(t, exits, maxExitInfos)
+}
+
+func TestContainerID(t *testing.T) {
+	const fullID = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+	tCases := map[string]struct {
+		format     string
+		id         string
+		expectedID string
+	}{
+		"Short":          {format: config.IDFormatShort, id: fullID, expectedID: fullID[:shortIDLength]},
+		"Short short ID": {format: config.IDFormatShort, id: "2400edb296c5", expectedID: "2400edb296c5"},
+		"Full":           {format: config.IDFormatFull, id: fullID, expectedID: fullID},
+	}
+
+	t.Cleanup(func() {
+		_ = config.Load(`{"id_format":"short"}`)
+	})
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.NoError(t, config.Load(`{"id_format":"`+tc.format+`"}`))
+			assert.Equal(t, tc.expectedID, containerID(tc.id))
+		})
+	}
+}
+
+func TestSharedNamespaceTarget(t *testing.T) {
+	tCases := map[string]struct {
+		modes          []string
+		expectedTarget string
+	}{
+		"Network":          {modes: []string{"container:web", "private"}, expectedTarget: "web"},
+		"Network over pid": {modes: []string{"container:web", "container:db"}, expectedTarget: "web"},
+		"Pid":              {modes: []string{"bridge", "container:2400edb296c5"}, expectedTarget: "2400edb296c5"},
+		"Not sharing":      {modes: []string{"host", ""}, expectedTarget: ""},
+		"No target":        {modes: []string{"container:"}, expectedTarget: ""},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedTarget, sharedNamespaceTarget(tc.modes...))
+		})
+	}
+}
+
+func TestCNIResultToNetworks(t *testing.T) {
+	tCases := map[string]struct {
+		result           string
+		expectedNetworks []event.Network
+	}{
+		"Bridge": {
+			// From a cri-o io.kubernetes.cri-o.CNIResult annotation
+			result: `{"cniVersion":"1.0.0","interfaces":[{"name":"cni0","mac":"7a:1c:2b:3d:4e:5f"},{"name":"veth1a2b3c4d","mac":"9e:8d:7c:6b:5a:49"},{"name":"eth0","mac":"0a:58:0a:f4:00:05","sandbox":"/var/run/netns/2b3c"}],"ips":[{"interface":2,"address":"10.244.0.5/24","gateway":"10.244.0.1"},{"interface":2,"address":"fd00:10:244::5/64","gateway":"fd00:10:244::1"}],"routes":[{"dst":"0.0.0.0/0"}],"dns":{}}`,
+			expectedNetworks: []event.Network{{
+				IPAddresses: []string{"10.244.0.5", "fd00:10:244::5"},
+				MAC:         "0a:58:0a:f4:00:05",
+				Interface:   "eth0",
+			}},
+		},
+		"No interfaces": {
+			result:           `{"cniVersion":"0.4.0","ips":[{"address":"10.88.0.5/16"}]}`,
+			expectedNetworks: []event.Network{{IPAddresses: []string{"10.88.0.5"}}},
+		},
+		"Invalid": {
+			result:           "{",
+			expectedNetworks: []event.Network{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedNetworks, cniResultToNetworks(tc.result))
+		})
+	}
+}
+
+func TestIPAddresses(t *testing.T) {
+	assert.Equal(t, []string{"172.17.0.2", "fd00::2"}, ipAddresses("172.17.0.2", "", "fd00::2/64"))
+	assert.Empty(t, ipAddresses("", ""))
+	networks := []event.Network{{Name: "bridge", IPAddresses: []string{}}, {Name: "custom", IPAddresses: []string{"172.18.0.2"}}}
+	assert.Equal(t, "172.18.0.2", firstIPAddress(networks))
+}
+
+func TestProcUserns(t *testing.T) {
+	tCases := map[string]struct {
+		uidMap              string
+		gidMap              string
+		expectedErr         bool
+		expectedMode        string
+		expectedUIDMappings []event.IDMapping
+		expectedGIDMappings []event.IDMapping
+	}{
+		"Host": {
+			uidMap:              "         0          0 4294967295\n",
+			gidMap:              "         0          0 4294967295\n",
+			expectedMode:        event.UsernsHost,
+			expectedUIDMappings: []event.IDMapping{},
+			expectedGIDMappings: []event.IDMapping{},
+		},
+		"Remapped": {
+			uidMap:       "         0     100000      65536\n",
+			gidMap:       "         0     100000      65536\n     65536       1000          1\n",
+			expectedMode: event.UsernsPrivate,
+			expectedUIDMappings: []event.IDMapping{
+				{ContainerID: 0, HostID: 100000, Size: 65536},
+			},
+			expectedGIDMappings: []event.IDMapping{
+				{ContainerID: 0, HostID: 100000, Size: 65536},
+				{ContainerID: 65536, HostID: 1000, Size: 1},
+			},
+		},
+		"Malformed": {
+			uidMap:      "0 100000\n",
+			gidMap:      "0 100000 65536\n",
+			expectedErr: true,
+		},
+	}
+
+	t.Cleanup(func() {
+		_ = config.Load(`{"host_root":""}`)
+	})
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			hostRoot := t.TempDir()
+			procDir := filepath.Join(hostRoot, "proc", "42")
+			require.NoError(t, os.MkdirAll(procDir, 0o755))
+			require.NoError(t, os.WriteFile(filepath.Join(procDir, "uid_map"), []byte(tc.uidMap), 0o644))
+			require.NoError(t, os.WriteFile(filepath.Join(procDir, "gid_map"), []byte(tc.gidMap), 0o644))
+			require.NoError(t, config.Load(`{"host_root":"`+hostRoot+`"}`))
+
+			mode, uidMappings, gidMappings, err := procUserns(42)
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedMode, mode)
+			assert.Equal(t, tc.expectedUIDMappings, uidMappings)
+			assert.Equal(t, tc.expectedGIDMappings, gidMappings)
+		})
+	}
+
+	// Not running
+	_, _, _, err := procUserns(0)
+	assert.Error(t, err)
+}
+
+func TestSpecUserns(t *testing.T) {
+	tCases := map[string]struct {
+		linux               *specs.Linux
+		expectedMode        string
+		expectedUIDMappings []event.IDMapping
+	}{
+		"No linux section": {
+			linux:               nil,
+			expectedMode:        event.UsernsHost,
+			expectedUIDMappings: []event.IDMapping{},
+		},
+		"Host": {
+			linux: &specs.Linux{
+				Namespaces: []specs.LinuxNamespace{{Type: specs.PIDNamespace}, {Type: specs.NetworkNamespace}},
+			},
+			expectedMode:        event.UsernsHost,
+			expectedUIDMappings: []event.IDMapping{},
+		},
+		"Remapped": {
+			linux: &specs.Linux{
+				Namespaces:  []specs.LinuxNamespace{{Type: specs.PIDNamespace}, {Type: specs.UserNamespace}},
+				UIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 65536, Size: 65536}},
+				GIDMappings: []specs.LinuxIDMapping{{ContainerID: 0, HostID: 65536, Size: 65536}},
+			},
+			expectedMode:        event.UsernsPrivate,
+			expectedUIDMappings: []event.IDMapping{{ContainerID: 0, HostID: 65536, Size: 65536}},
+		},
+		"Joined user namespace": {
+			linux: &specs.Linux{
+				Namespaces: []specs.LinuxNamespace{{Type: specs.UserNamespace, Path: "/proc/42/ns/user"}},
+			},
+			expectedMode:        event.UsernsPrivate,
+			expectedUIDMappings: []event.IDMapping{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			mode, uidMappings, gidMappings := specUserns(tc.linux)
+			assert.Equal(t, tc.expectedMode, mode)
+			assert.Equal(t, tc.expectedUIDMappings, uidMappings)
+			// All cases use the same mappings for groups
+			assert.Equal(t, tc.expectedUIDMappings, gidMappings)
+		})
+	}
+}
+
+func TestRuntimeDevices(t *testing.T) {
+	tCases := map[string]struct {
+		env             []string
+		annotations     map[string]string
+		expectedDevices []string
+	}{
+		"No devices": {
+			env:             []string{"PATH=/usr/bin"},
+			expectedDevices: []string{},
+		},
+		"NVIDIA GPUs": {
+			env:             []string{"NVIDIA_VISIBLE_DEVICES=0, 1", "NVIDIA_DRIVER_CAPABILITIES=compute"},
+			expectedDevices: []string{"nvidia.com/gpu=0", "nvidia.com/gpu=1"},
+		},
+		"All NVIDIA GPUs": {
+			env:             []string{"NVIDIA_VISIBLE_DEVICES=all"},
+			expectedDevices: []string{"nvidia.com/gpu=all"},
+		},
+		"No NVIDIA GPU": {
+			env:             []string{"NVIDIA_VISIBLE_DEVICES=none", "NVIDIA_VISIBLE_DEVICES=void", "NVIDIA_VISIBLE_DEVICES="},
+			expectedDevices: []string{},
+		},
+		"CDI annotations": {
+			annotations: map[string]string{
+				"cdi.k8s.io/nvidia-device-plugin_uuid": "nvidia.com/gpu=GPU-3a8b1c2d,nvidia.com/gpu=GPU-4f5e6d7c",
+				"io.kubernetes.cri-o.Devices":          "/dev/fuse",
+			},
+			expectedDevices: []string{"nvidia.com/gpu=GPU-3a8b1c2d", "nvidia.com/gpu=GPU-4f5e6d7c"},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expectedDevices, devices(runtimeDevices(tc.env, tc.annotations)...))
+		})
+	}
+}
+
+func TestImageCache(t *testing.T) {
+	times := newImageCache[int64]()
+	lookups := 0
+	lookup := func(ts int64, err error) func() (int64, error) {
+		return func() (int64, error) {
+			lookups++
+			return ts, err
+		}
+	}
+
+	// Failed lookups are not cached
+	assert.Equal(t, int64(0), times.get("sha256:a", lookup(0, errors.New("not found"))))
+	assert.Equal(t, int64(1725624336), times.get("sha256:a", lookup(1725624336, nil)))
+	assert.Equal(t, int64(1725624336), times.get("sha256:a", lookup(42, nil)))
+	// Missing timestamps are
+	assert.Equal(t, int64(0), times.get("sha256:b", lookup(0, nil)))
+	assert.Equal(t, int64(0), times.get("sha256:b", lookup(42, nil)))
+	assert.Equal(t, 3, lookups)
+}
+
+func TestImageCacheEviction(t *testing.T) {
+	times := newImageCache[int64]()
+	times.size = 2
+	lookups := 0
+	lookup := func(ts int64) func() (int64, error) {
+		return func() (int64, error) {
+			lookups++
+			return ts, nil
+		}
+	}
+
+	times.get("sha256:a", lookup(1))
+	times.get("sha256:b", lookup(2))
+	// a is used again, so that b is the least recently used one
+	assert.Equal(t, int64(1), times.get("sha256:a", lookup(42)))
+	times.get("sha256:c", lookup(3))
+	assert.Equal(t, 3, lookups)
+	assert.Len(t, times.metas, 2)
+	assert.Equal(t, 2, times.lru.Len())
+
+	// b got evicted, looked up again, evicting a in turn
+	assert.Equal(t, int64(42), times.get("sha256:b", lookup(42)))
+	assert.Equal(t, int64(3), times.get("sha256:c", lookup(0)))
+	assert.Equal(t, 4, lookups)
+	assert.NotContains(t, times.metas, "sha256:a")
+}
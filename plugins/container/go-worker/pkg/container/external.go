@@ -0,0 +1,201 @@
+//go:build !no_external
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container/external"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"sync"
+)
+
+func init() {
+	register(typeExternal, newExternalEngine)
+}
+
+// externalEngine talks to container runtimes not supported natively,
+// through the gRPC service defined by the external package.
+type externalEngine struct {
+	*infraFilter
+	ref    *clientRef
+	conn   *grpc.ClientConn
+	client external.EngineClient
+	socket string
+}
+
+func newExternalEngine(_ context.Context, socket string) (Engine, error) {
+	// Connects lazily, and reconnects on its own, like the other gRPC based engines.
+	conn, err := grpc.NewClient(enforceUnixProtocolIfEmpty(socket), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		return nil, err
+	}
+	return &externalEngine{infraFilter: newInfraFilter(typeExternal), ref: openClient(string(typeExternal), socket),
+		conn: conn, client: external.NewEngineClient(conn), socket: socket}, nil
+}
+
+func (ec *externalEngine) copy(ctx context.Context) (Engine, error) {
+	return newExternalEngine(ctx, ec.socket)
+}
+
+// Close closes the gRPC connection, interrupting the ongoing calls.
+func (ec *externalEngine) Close() error {
+	if !ec.ref.release() {
+		return nil
+	}
+	return ec.conn.Close()
+}
+
+// externalContainerToInfo translates a container reported by the external engine,
+// as the JSON `container` object of the events.
+// Fields that are not reported get the defaults used by the other engines.
+func externalContainerToInfo(ctr *external.Container) (event.Info, error) {
+	c := event.Container{
+		CPUPeriod:        defaultCpuPeriod,
+		CPUShares:        defaultCpuShares,
+		Env:              []string{},
+		Labels:           map[string]string{},
+		PortMappings:     []event.PortMapping{},
+		Mounts:           []event.Mount{},
+		Size:             -1,
+		State:            event.StateUnknown,
+		ExitCode:         unknownExit.code,
+		Networks:         []event.Network{},
+		UIDMappings:      []event.IDMapping{},
+		GIDMappings:      []event.IDMapping{},
+		Entrypoint:       []string{},
+		Cmd:              []string{},
+		NetworkAliases:   []string{},
+		Devices:          []string{},
+		Runtime:          event.RuntimeUnknown,
+		HostArchitecture: hostArchitecture(),
+	}
+	if err := json.Unmarshal([]byte(ctr.GetJson()), &c); err != nil {
+		return event.Info{}, err
+	}
+	if c.FullID == "" {
+		c.FullID = c.ID
+	}
+	if c.FullID == "" {
+		return event.Info{}, errors.New("missing container id")
+	}
+	c.Type = typeExternal.ToCTValue()
+	c.Engine = string(typeExternal)
+	c.ID = containerID(c.FullID)
+	for key, val := range c.Labels {
+		if len(val) > config.GetLabelMaxLen() {
+			delete(c.Labels, key)
+		}
+	}
+	return event.Info{Container: c}, nil
+}
+
+func (ec *externalEngine) get(ctx context.Context, containerId string) (*event.Event, error) {
+	ctr, err := ec.client.Inspect(ctx, &external.InspectRequest{Id: containerId})
+	if err != nil {
+		return nil, err
+	}
+	info, err := externalContainerToInfo(ctr)
+	if err != nil {
+		return nil, err
+	}
+	return &event.Event{
+		Info:     info,
+		IsCreate: true,
+	}, nil
+}
+
+func (ec *externalEngine) Name() string {
+	return string(typeExternal)
+}
+
+func (ec *externalEngine) Sock() string {
+	return ec.socket
+}
+
+func (ec *externalEngine) List(ctx context.Context) ([]event.Event, error) {
+	resp, err := ec.client.List(ctx, &external.ListRequest{})
+	if err != nil {
+		return nil, err
+	}
+	evts := make([]event.Event, 0, len(resp.GetContainers()))
+	for _, ctr := range resp.GetContainers() {
+		info, err := externalContainerToInfo(ctr)
+		if err != nil {
+			logger.Warnf("skipping container listed by external engine %s: %v", ec.socket, err)
+			continue
+		}
+		evts = append(evts, event.Event{
+			Info:     info,
+			IsCreate: true,
+		})
+	}
+	return ec.filterInfra(evts), nil
+}
+
+// externalEventToEvent translates a lifecycle event of the external engine.
+func externalEventToEvent(evt *external.ContainerEvent) (event.Event, error) {
+	info, err := externalContainerToInfo(evt.GetContainer())
+	if err != nil {
+		return event.Event{}, err
+	}
+	switch evt.GetAction() {
+	case external.Action_ACTION_CREATED:
+		return event.Event{Info: info, IsCreate: true}, nil
+	case external.Action_ACTION_UPDATED:
+		info.Update = true
+		return event.Event{Info: info, IsCreate: true}, nil
+	case external.Action_ACTION_REMOVED:
+		info.State = event.StateRemoved
+		return event.Event{Info: info, IsCreate: false}, nil
+	default:
+		return event.Event{}, fmt.Errorf("unknown action %v", evt.GetAction())
+	}
+}
+
+func (ec *externalEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
+	stream, err := ec.client.Watch(ctx, &external.WatchRequest{})
+	if err != nil {
+		return nil, err
+	}
+
+	outCh := make(chan event.Event)
+	GoListener(wg, ec, func() {
+		defer close(outCh)
+		for {
+			msg, err := stream.Recv()
+			if status.Code(err) == codes.Unimplemented {
+				// Engines are free not to stream events: poll them instead
+				logger.Infof("external engine %s does not stream events, polling containers", ec.socket)
+				newPollingListener(ec, typeExternal, ec.List, nil).poll(ctx, outCh, false)
+				return
+			}
+			if err != nil {
+				// Stream closed, or ctx done - kill the goroutine
+				if ctx.Err() == nil {
+					logger.Warnf("external engine %s stopped streaming: %v", ec.socket, err)
+				}
+				return
+			}
+			evt, err := externalEventToEvent(msg)
+			if err != nil {
+				logger.Warnf("skipping event of external engine %s: %v", ec.socket, err)
+				continue
+			}
+			select {
+			case outCh <- evt:
+			case <-ctx.Done():
+				return
+			}
+		}
+	})
+	return ec.forwardInfra(ctx, wg, ec, outCh), nil
+}
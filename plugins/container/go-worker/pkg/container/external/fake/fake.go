@@ -0,0 +1,174 @@
+// Package fake provides a reference implementation of the external engine service,
+// keeping its containers in memory; it is meant to be used in tests.
+package fake
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container/external"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Server serves the external engine service on a unix socket.
+// Containers are identified by their full ID, and described by the JSON
+// `container` object of the worker events.
+type Server struct {
+	external.UnimplementedEngineServer
+
+	mu         sync.Mutex
+	containers map[string]string
+	// Each watcher channel, along with the one closed once it stops watching.
+	watchers map[chan *external.ContainerEvent]chan struct{}
+	noWatch  bool
+	server   *grpc.Server
+}
+
+func NewServer() *Server {
+	return &Server{
+		containers: make(map[string]string),
+		watchers:   make(map[chan *external.ContainerEvent]chan struct{}),
+	}
+}
+
+// Start serves on socket, until Stop is called.
+func (s *Server) Start(socket string) error {
+	l, err := net.Listen("unix", socket)
+	if err != nil {
+		return err
+	}
+	s.Serve(l)
+	return nil
+}
+
+// Serve serves on l, along with the listeners already served, until Stop is called.
+func (s *Server) Serve(l net.Listener) {
+	if s.server == nil {
+		s.server = grpc.NewServer()
+		external.RegisterEngineServer(s.server, s)
+	}
+	go func() {
+		_ = s.server.Serve(l)
+	}()
+}
+
+// Stop closes the listener and all the connections, interrupting the watchers.
+func (s *Server) Stop() {
+	if s.server != nil {
+		s.server.Stop()
+	}
+}
+
+// Create adds a container, notifying the watchers.
+func (s *Server) Create(id, json string) {
+	s.notify(id, json, external.Action_ACTION_CREATED)
+}
+
+// Update replaces the metadata of a container, notifying the watchers.
+func (s *Server) Update(id, json string) {
+	s.notify(id, json, external.Action_ACTION_UPDATED)
+}
+
+// Remove removes a container, notifying the watchers with its last metadata.
+func (s *Server) Remove(id string) {
+	s.mu.Lock()
+	json, ok := s.containers[id]
+	s.mu.Unlock()
+	if ok {
+		s.notify(id, json, external.Action_ACTION_REMOVED)
+	}
+}
+
+// DisableWatch makes Watch unimplemented, like for engines only able to list containers.
+func (s *Server) DisableWatch() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.noWatch = true
+}
+
+// Watchers returns the number of streams currently watching,
+// so that tests can wait for them before changing containers.
+func (s *Server) Watchers() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.watchers)
+}
+
+func (s *Server) notify(id, json string, action external.Action) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if action == external.Action_ACTION_REMOVED {
+		delete(s.containers, id)
+	} else {
+		s.containers[id] = json
+	}
+	evt := &external.ContainerEvent{Action: action, Container: &external.Container{Json: json}}
+	for ch, done := range s.watchers {
+		select {
+		case ch <- evt:
+		case <-done:
+		}
+	}
+}
+
+func (s *Server) List(_ context.Context, _ *external.ListRequest) (*external.ListResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	ids := make([]string, 0, len(s.containers))
+	for id := range s.containers {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+	resp := &external.ListResponse{Containers: make([]*external.Container, 0, len(ids))}
+	for _, id := range ids {
+		resp.Containers = append(resp.Containers, &external.Container{Json: s.containers[id]})
+	}
+	return resp, nil
+}
+
+func (s *Server) Inspect(_ context.Context, req *external.InspectRequest) (*external.Container, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, json := range s.containers {
+		if req.GetId() != "" && strings.HasPrefix(id, req.GetId()) {
+			return &external.Container{Json: json}, nil
+		}
+	}
+	return nil, status.Errorf(codes.NotFound, "container %s not found", req.GetId())
+}
+
+func (s *Server) Watch(req *external.WatchRequest, stream grpc.ServerStreamingServer[external.ContainerEvent]) error {
+	s.mu.Lock()
+	noWatch := s.noWatch
+	s.mu.Unlock()
+	if noWatch {
+		return s.UnimplementedEngineServer.Watch(req, stream)
+	}
+	// Buffered, so that notifying does not wait for slow watchers
+	ch := make(chan *external.ContainerEvent, 64)
+	done := make(chan struct{})
+	s.mu.Lock()
+	s.watchers[ch] = done
+	s.mu.Unlock()
+	defer func() {
+		// Unblock any notify, before waiting for it to release the lock
+		close(done)
+		s.mu.Lock()
+		delete(s.watchers, ch)
+		s.mu.Unlock()
+	}()
+	for {
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case evt := <-ch:
+			if err := stream.Send(evt); err != nil {
+				return err
+			}
+		}
+	}
+}
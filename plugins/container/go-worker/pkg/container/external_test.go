@@ -0,0 +1,201 @@
+//go:build !no_external
+
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container/external"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container/external/fake"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	externalFullID = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+	externalJSON   = `{"id":"` + externalFullID + `","name":"in-house","image":"fedora:38","state":"running","labels":{"foo":"bar"},"unknown":42}`
+)
+
+func expectedExternalEvent(isCreate bool, update bool, state string) event.Event {
+	return event.Event{
+		Info: event.Info{
+			Container: event.Container{
+				Type:             typeExternal.ToCTValue(),
+				Engine:           string(typeExternal),
+				ID:               "2400edb296c5",
+				FullID:           externalFullID,
+				Name:             "in-house",
+				Image:            "fedora:38",
+				CPUPeriod:        defaultCpuPeriod,
+				CPUShares:        defaultCpuShares,
+				Env:              []string{},
+				Labels:           map[string]string{"foo": "bar"},
+				PortMappings:     []event.PortMapping{},
+				Mounts:           []event.Mount{},
+				Size:             -1,
+				State:            state,
+				ExitCode:         -1,
+				Networks:         []event.Network{},
+				UIDMappings:      []event.IDMapping{},
+				GIDMappings:      []event.IDMapping{},
+				Entrypoint:       []string{},
+				Cmd:              []string{},
+				NetworkAliases:   []string{},
+				Devices:          []string{},
+				Runtime:          event.RuntimeUnknown,
+				HostArchitecture: hostArchitecture(),
+			},
+			Update: update,
+		},
+		IsCreate: isCreate,
+	}
+}
+
+func TestExternalContainerToInfo(t *testing.T) {
+	tCases := map[string]struct {
+		json          string
+		expectedErr   bool
+		expectedID    string
+		expectedFull  string
+		expectedState string
+	}{
+		"Full ID only": {
+			json:          `{"full_id":"` + externalFullID + `"}`,
+			expectedID:    "2400edb296c5",
+			expectedFull:  externalFullID,
+			expectedState: event.StateUnknown,
+		},
+		"Short ID only": {
+			json:          `{"id":"in-house-1","state":"created"}`,
+			expectedID:    "in-house-1",
+			expectedFull:  "in-house-1",
+			expectedState: event.StateCreated,
+		},
+		"Type is overridden": {
+			json:          `{"type":0,"id":"in-house-1"}`,
+			expectedID:    "in-house-1",
+			expectedFull:  "in-house-1",
+			expectedState: event.StateUnknown,
+		},
+		"Missing ID": {
+			json:        `{"name":"in-house"}`,
+			expectedErr: true,
+		},
+		"Malformed": {
+			json:        `{"id":`,
+			expectedErr: true,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			info, err := externalContainerToInfo(&external.Container{Json: tc.json})
+			if tc.expectedErr {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, typeExternal.ToCTValue(), info.Type)
+			assert.Equal(t, tc.expectedID, info.ID)
+			assert.Equal(t, tc.expectedFull, info.FullID)
+			assert.Equal(t, tc.expectedState, info.State)
+			assert.Equal(t, int64(-1), info.Size)
+		})
+	}
+}
+
+func TestExternal(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "external.sock")
+	server := fake.NewServer()
+	require.NoError(t, server.Start(socket))
+	t.Cleanup(server.Stop)
+	server.Create(externalFullID, externalJSON)
+	server.Create("broken", `{"id":`)
+
+	engine, err := newExternalEngine(context.Background(), socket)
+	require.NoError(t, err)
+
+	// The broken container is skipped
+	evts, err := engine.List(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []event.Event{expectedExternalEvent(true, false, event.StateRunning)}, evts)
+
+	evt, err := engine.(getter).get(context.Background(), "2400edb296c5")
+	require.NoError(t, err)
+	assert.Equal(t, expectedExternalEvent(true, false, event.StateRunning), *evt)
+
+	_, err = engine.(getter).get(context.Background(), "unknown")
+	assert.Error(t, err)
+
+	wg := sync.WaitGroup{}
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	listCh, err := engine.Listen(cancelCtx, &wg)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return server.Watchers() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	server.Remove(externalFullID)
+	server.Update("broken", `{"id":`)
+	server.Create(externalFullID, externalJSON)
+	server.Update(externalFullID, externalJSON)
+	assert.Equal(t, expectedExternalEvent(false, false, event.StateRemoved), waitOnChannelOrTimeout(t, listCh))
+	assert.Equal(t, expectedExternalEvent(true, false, event.StateRunning), waitOnChannelOrTimeout(t, listCh))
+	assert.Equal(t, expectedExternalEvent(true, true, event.StateRunning), waitOnChannelOrTimeout(t, listCh))
+
+	// Listener goroutine leaves once the runtime goes away
+	server.Stop()
+	select {
+	case _, ok := <-listCh:
+		assert.False(t, ok)
+	case <-time.After(5 * time.Second):
+		t.Fatal("listener not stopped on server stop")
+	}
+
+	// Now the runtime is gone, listening fails
+	_, err = engine.Listen(cancelCtx, &wg)
+	assert.Error(t, err)
+}
+
+func TestExternalPolling(t *testing.T) {
+	require.NoError(t, config.Load(`{"engines":{"external":{"poll_interval_ms":10}}}`))
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"external":{"poll_interval_ms":0}}}`)
+	})
+
+	socket := filepath.Join(t.TempDir(), "external.sock")
+	server := fake.NewServer()
+	server.DisableWatch()
+	require.NoError(t, server.Start(socket))
+	t.Cleanup(server.Stop)
+
+	engine, err := newExternalEngine(context.Background(), socket)
+	require.NoError(t, err)
+
+	wg := sync.WaitGroup{}
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	listCh, err := engine.Listen(cancelCtx, &wg)
+	require.NoError(t, err)
+
+	// Give the listener the time to fall back to polling, with its first listing
+	time.Sleep(100 * time.Millisecond)
+	server.Create(externalFullID, externalJSON)
+	assert.Equal(t, expectedExternalEvent(true, false, event.StateRunning), waitOnChannelOrTimeout(t, listCh))
+	server.Remove(externalFullID)
+	assert.Equal(t, expectedExternalEvent(false, false, event.StateRemoved), waitOnChannelOrTimeout(t, listCh))
+}
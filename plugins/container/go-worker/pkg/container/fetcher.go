@@ -16,23 +16,25 @@ FetcherChan requests are published through a CGO exposed API: AskForContainerInf
 */
 
 type fetcher struct {
-	getters     []getter
-	ctx         context.Context
+	*engineGetters
 	fetcherChan chan string
 }
 
-// NewFetcherEngine returns a fetcher engine.
-// The fetcher engine is responsible to allow us to get() single container
-// trying all container engines enabled.
-func NewFetcherEngine(_ context.Context, fetcherChan chan string, containerEngines []Engine) Engine {
-	f := fetcher{
+// engineGetters are copies of the enabled engines, used to get() single containers.
+type engineGetters struct {
+	// Since podman relies upon context to store
+	// connection-related info,
+	// we need a unique context for the copies
+	// to avoid tampering with real podman engine context.
+	ctx     context.Context
+	mu      sync.RWMutex
+	getters []getter
+}
+
+func newEngineGetters(containerEngines []Engine) *engineGetters {
+	g := engineGetters{
+		ctx:     context.Background(),
 		getters: make([]getter, len(containerEngines)),
-		// Since podman relies upon context to store
-		// connection-related info,
-		// we need a unique context for fetcher
-		// to avoid tampering with real podman engine context.
-		ctx:         context.Background(),
-		fetcherChan: fetcherChan,
 	}
 	for i, engine := range containerEngines {
 		copyEngine, ok := engine.(copier)
@@ -40,13 +42,87 @@ func NewFetcherEngine(_ context.Context, fetcherChan chan string, containerEngin
 			// We need all engines to implement the copier interface to be copied by fetcher.
 			panic("not a copier")
 		}
-		e, _ := copyEngine.copy(f.ctx)
+		e, _ := copyEngine.copy(g.ctx)
 		if e != nil {
 			// No type check since Engine interface extends getter.
-			f.getters[i] = e.(getter)
+			g.getters[i] = e.(getter)
+		}
+	}
+	return &g
+}
+
+// NewFetcherEngine returns a fetcher engine.
+// The fetcher engine is responsible to allow us to get() single container
+// trying all container engines enabled.
+func NewFetcherEngine(_ context.Context, fetcherChan chan string, containerEngines []Engine) Engine {
+	return &fetcher{
+		engineGetters: newEngineGetters(containerEngines),
+		fetcherChan:   fetcherChan,
+	}
+}
+
+// Attach lets the getters also try an engine that connected after their creation.
+func (g *engineGetters) Attach(engine Engine) {
+	copyEngine, ok := engine.(copier)
+	if !ok {
+		panic("not a copier")
+	}
+	e, _ := copyEngine.copy(g.ctx)
+	if e == nil {
+		return
+	}
+	g.mu.Lock()
+	g.getters = append(g.getters, e.(getter))
+	g.mu.Unlock()
+}
+
+// Detach stops the getters from trying an engine that got torn down, closing its copy.
+func (g *engineGetters) Detach(engine Engine) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	// A new slice, since get iterates over the previous one without locking
+	getters := make([]getter, 0, len(g.getters))
+	for _, e := range g.getters {
+		if e, ok := e.(Engine); ok && e.Name() == engine.Name() && e.Sock() == engine.Sock() {
+			CloseEngine(e)
+			continue
 		}
+		getters = append(getters, e)
 	}
-	return &f
+	g.getters = getters
+}
+
+// Close closes the copies of all the engines.
+func (g *engineGetters) Close() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for _, e := range g.getters {
+		if e, ok := e.(Engine); ok {
+			CloseEngine(e)
+		}
+	}
+	g.getters = nil
+	return nil
+}
+
+// lookup returns info about a single container from the first engine knowing it, or nil.
+func (g *engineGetters) lookup(containerId string) *event.Event {
+	g.mu.RLock()
+	getters := g.getters
+	g.mu.RUnlock()
+	for _, e := range getters {
+		if e == nil {
+			continue
+		}
+		if evt, _ := e.get(g.ctx, containerId); evt != nil {
+			// Not reported by the engine, even when asked for
+			if h, ok := e.(infraHider); ok && h.isInfra(&evt.Container) {
+				return nil
+			}
+			return evt
+		}
+	}
+	return nil
 }
 
 func (f *fetcher) Name() string {
@@ -70,12 +146,8 @@ func (f *fetcher) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.
 	const containerFetchRetryInterval = 30 * time.Millisecond
 	const containerFetchRetryTimeout = 150 * time.Millisecond
 	outCh := make(chan event.Event)
-	wg.Add(1)
-	go func() {
-		defer func() {
-			close(outCh)
-			wg.Done()
-		}()
+	GoListener(wg, f, func() {
+		defer close(outCh)
 		containerFirstSeen := make(map[string]time.Time)
 		for {
 			select {
@@ -92,14 +164,10 @@ func (f *fetcher) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.
 				} else {
 					containerFirstSeen[containerId] = now
 				}
-				for _, e := range f.getters {
-					evt, _ := e.get(f.ctx, containerId)
-					if evt != nil {
-						outCh <- *evt
-						found = true
-						delete(containerFirstSeen, containerId)
-						break
-					}
+				if evt := f.lookup(containerId); evt != nil {
+					outCh <- *evt
+					found = true
+					delete(containerFirstSeen, containerId)
 				}
 				if !found {
 					go func() {
@@ -109,6 +177,6 @@ func (f *fetcher) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.
 				}
 			}
 		}
-	}()
+	})
 	return outCh, nil
 }
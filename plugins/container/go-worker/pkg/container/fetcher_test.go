@@ -9,24 +9,14 @@ import (
 	"time"
 )
 
-func TestDockerFetcher(t *testing.T) {
-	testDocker(t, true)
-}
-
-func TestContainerdFetcher(t *testing.T) {
-	testContainerd(t, true)
-}
-
-func TestPodmanFetcher(t *testing.T) {
-	testPodman(t, true)
-}
-
-func TestCRIFakeFetcher(t *testing.T) {
-	testCRIFake(t, true)
-}
-
-func TestCRIFetcher(t *testing.T) {
-	testCRI(t, true)
+func waitOnChannelOrTimeout(t *testing.T, ch <-chan event.Event) event.Event {
+	select {
+	case ret := <-ch:
+		return ret
+	case <-time.After(5 * time.Second):
+		t.Error("timed out waiting for channel")
+	}
+	return event.Event{}
 }
 
 func testFetcher(t *testing.T, containerEngine Engine, containerId string, expectedEvent event.Event) {
@@ -59,6 +49,7 @@ func testFetcher(t *testing.T, containerEngine Engine, containerId string, expec
 	}()
 
 	evt := waitOnChannelOrTimeout(t, listCh)
+	assertMatchesSchema(t, evt)
 	// This needs to be updated on the fly
 	expectedEvent.CreatedTime = evt.CreatedTime
 	// In some cases, the env ordering might differ thus we manually check it and then copy it
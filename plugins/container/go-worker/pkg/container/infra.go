@@ -0,0 +1,192 @@
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"path"
+	"strings"
+	"sync"
+)
+
+// defaultInfraDeny are the rules matching the infrastructure containers of each engine,
+// not reported unless the engine `infra_deny` replaces them.
+var defaultInfraDeny = map[engineType][]string{
+	// The builders of `docker buildx` with the docker-container driver
+	typeDocker: {"name:buildx_buildkit_*"},
+	// The infra containers of the pods, holding their namespaces
+	typePodman: {"image:localhost/podman-pause:*"},
+	// The containers of docker, reported by the docker engine, and the CRI pod sandboxes, reported by the cri one
+	typeContainerd: {"label:com.docker/engine.bundle.path", "label:io.cri-containerd.kind=sandbox"},
+}
+
+// infraRule matches containers by label, eg: `label:io.cri-containerd.kind=sandbox` or `label:com.docker/engine.bundle.path`,
+// by name or by image, eg: `name:buildx_buildkit_*` or `image:localhost/podman-pause:*`, using path.Match patterns.
+type infraRule struct {
+	kind    string
+	key     string
+	value   string
+	anyVal  bool
+	pattern string
+}
+
+func parseInfraRule(rule string) (infraRule, bool) {
+	kind, arg, ok := strings.Cut(rule, ":")
+	if !ok || arg == "" {
+		return infraRule{}, false
+	}
+	switch kind {
+	case "label":
+		key, value, hasValue := strings.Cut(arg, "=")
+		return infraRule{kind: kind, key: key, value: value, anyVal: !hasValue}, key != ""
+	case "name", "image":
+		// Fail early on malformed patterns
+		if _, err := path.Match(arg, ""); err != nil {
+			return infraRule{}, false
+		}
+		return infraRule{kind: kind, pattern: arg}, true
+	default:
+		return infraRule{}, false
+	}
+}
+
+func (r infraRule) matches(ctr *event.Container) bool {
+	switch r.kind {
+	case "label":
+		value, ok := ctr.Labels[r.key]
+		return ok && (r.anyVal || value == r.value)
+	case "name":
+		ok, _ := path.Match(r.pattern, ctr.Name)
+		return ok
+	case "image":
+		ok, _ := path.Match(r.pattern, ctr.Image)
+		return ok
+	}
+	return false
+}
+
+func parseInfraRules(engine engineType, rules []string) []infraRule {
+	res := make([]infraRule, 0, len(rules))
+	for _, rule := range rules {
+		r, ok := parseInfraRule(rule)
+		if !ok {
+			logger.Warnf("engine %s: invalid infra rule %q, ignoring it", engine, rule)
+			continue
+		}
+		res = append(res, r)
+	}
+	return res
+}
+
+// infraHider is implemented by the engines not reporting their infrastructure containers,
+// so that they are not reported when fetched either.
+type infraHider interface {
+	isInfra(ctr *event.Container) bool
+}
+
+// infraFilter drops the events of the infrastructure containers of an engine, the ones matching any of its deny rules
+// but none of its allow ones. The remove events of the hidden containers, that cannot match the rules
+// as only carrying the container ID, are dropped too.
+// A nil infraFilter hides nothing.
+type infraFilter struct {
+	allow []infraRule
+	deny  []infraRule
+
+	mu sync.Mutex
+	// The full IDs of the hidden containers, until removed
+	hidden map[string]struct{}
+}
+
+func newInfraFilter(engine engineType) *infraFilter {
+	deny, ok := config.GetInfraDeny(string(engine))
+	if !ok {
+		deny = defaultInfraDeny[engine]
+	}
+	return &infraFilter{
+		allow:  parseInfraRules(engine, config.GetInfraAllow(string(engine))),
+		deny:   parseInfraRules(engine, deny),
+		hidden: make(map[string]struct{}),
+	}
+}
+
+// isInfra returns whether the container is an infrastructure one, not to be reported.
+func (f *infraFilter) isInfra(ctr *event.Container) bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.allow {
+		if r.matches(ctr) {
+			return false
+		}
+	}
+	for _, r := range f.deny {
+		if r.matches(ctr) {
+			return true
+		}
+	}
+	return false
+}
+
+// hidesInfra returns whether the event must be dropped, keeping track of the hidden containers.
+func (f *infraFilter) hidesInfra(evt *event.Event) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if !evt.IsCreate {
+		_, ok := f.hidden[evt.FullID]
+		delete(f.hidden, evt.FullID)
+		return ok
+	}
+	// Later events of a hidden container, like updates, may miss the metadata it got hidden by
+	if _, ok := f.hidden[evt.FullID]; ok {
+		return true
+	}
+	if f.isInfra(&evt.Container) {
+		f.hidden[evt.FullID] = struct{}{}
+		return true
+	}
+	return false
+}
+
+// filterInfra drops the listed events of the infrastructure containers.
+func (f *infraFilter) filterInfra(evts []event.Event) []event.Event {
+	if f == nil {
+		return evts
+	}
+	res := evts[:0]
+	for _, evt := range evts {
+		if !f.hidesInfra(&evt) {
+			res = append(res, evt)
+		}
+	}
+	return res
+}
+
+// forwardInfra returns a channel forwarding the events of the engine listener inCh,
+// but the ones of the infrastructure containers; it gets closed with inCh, that is drained once ctx is done.
+func (f *infraFilter) forwardInfra(ctx context.Context, wg *sync.WaitGroup, e Engine, inCh <-chan event.Event) <-chan event.Event {
+	if f == nil {
+		return inCh
+	}
+	outCh := make(chan event.Event)
+	GoListener(wg, e, func() {
+		defer close(outCh)
+		for evt := range inCh {
+			if f.hidesInfra(&evt) {
+				continue
+			}
+			select {
+			case outCh <- evt:
+			case <-ctx.Done():
+				// Unblock the listener until it exits
+				for range inCh {
+				}
+				return
+			}
+		}
+	})
+	return outCh
+}
@@ -0,0 +1,151 @@
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func infraEvent(id, name, image string, labels map[string]string) event.Event {
+	return event.Event{
+		IsCreate: true,
+		Info: event.Info{Container: event.Container{
+			ID:     id,
+			FullID: id + "d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+			Name:   name,
+			Image:  image,
+			Labels: labels,
+		}},
+	}
+}
+
+func TestInfraFilter(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"infra_deny":null,"infra_allow":null},
+			"containerd":{"infra_deny":null,"infra_allow":null}}}`)
+	})
+	builder := infraEvent("2400edb296c5", "buildx_buildkit_builder0", "moby/buildkit:buildx-stable-1", nil)
+	app := infraEvent("3511fec307d6", "sharp_poincare", "fedora:38", map[string]string{"team": "falco"})
+	sandbox := infraEvent("4622fed418e7", "", "registry.k8s.io/pause:3.10",
+		map[string]string{"io.cri-containerd.kind": "sandbox"})
+	dockerManaged := infraEvent("5733fee529f8", "", "", map[string]string{"com.docker/engine.bundle.path": "/run/docker"})
+
+	tCases := map[string]struct {
+		cfg         string
+		engine      engineType
+		evts        []event.Event
+		expectedIDs []string
+	}{
+		"Docker defaults": {
+			cfg:         `{"engines":{"docker":{"infra_deny":null,"infra_allow":null}}}`,
+			engine:      typeDocker,
+			evts:        []event.Event{builder, app},
+			expectedIDs: []string{"3511fec307d6"},
+		},
+		"Containerd defaults": {
+			cfg:         `{"engines":{"containerd":{"infra_deny":null,"infra_allow":null}}}`,
+			engine:      typeContainerd,
+			evts:        []event.Event{sandbox, dockerManaged, app},
+			expectedIDs: []string{"3511fec307d6"},
+		},
+		"No defaults": {
+			engine:      typeLxd,
+			evts:        []event.Event{builder, sandbox, app},
+			expectedIDs: []string{"2400edb296c5", "4622fed418e7", "3511fec307d6"},
+		},
+		"Defaults replaced": {
+			cfg:         `{"engines":{"docker":{"infra_deny":["label:team=falco"],"infra_allow":null}}}`,
+			engine:      typeDocker,
+			evts:        []event.Event{builder, app},
+			expectedIDs: []string{"2400edb296c5"},
+		},
+		"Defaults disabled": {
+			cfg:         `{"engines":{"docker":{"infra_deny":[],"infra_allow":null}}}`,
+			engine:      typeDocker,
+			evts:        []event.Event{builder, app},
+			expectedIDs: []string{"2400edb296c5", "3511fec307d6"},
+		},
+		"Allowed": {
+			cfg:         `{"engines":{"containerd":{"infra_deny":null,"infra_allow":["image:registry.k8s.io/pause:*"]}}}`,
+			engine:      typeContainerd,
+			evts:        []event.Event{sandbox, dockerManaged},
+			expectedIDs: []string{"4622fed418e7"},
+		},
+		"Invalid rules": {
+			cfg:         `{"engines":{"docker":{"infra_deny":["buildx","label:","name:[","image:fedora:*"],"infra_allow":null}}}`,
+			engine:      typeDocker,
+			evts:        []event.Event{builder, app},
+			expectedIDs: []string{"2400edb296c5"},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			if tc.cfg != "" {
+				require.NoError(t, config.Load(tc.cfg))
+			}
+			f := newInfraFilter(tc.engine)
+			ids := make([]string, 0)
+			for _, evt := range f.filterInfra(append([]event.Event{}, tc.evts...)) {
+				ids = append(ids, evt.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestForwardInfra(t *testing.T) {
+	require.NoError(t, config.Load(`{"engines":{"docker":{"infra_deny":null,"infra_allow":null}}}`))
+	f := newInfraFilter(typeDocker)
+	builder := infraEvent("2400edb296c5", "buildx_buildkit_builder0", "moby/buildkit:buildx-stable-1", nil)
+	app := infraEvent("3511fec307d6", "sharp_poincare", "fedora:38", nil)
+	// Minimal events, only carrying the ID
+	builderStart := event.Event{IsCreate: true, Info: event.Info{Container: event.Container{ID: builder.ID,
+		FullID: builder.FullID}, Update: true}}
+	builderRemove := event.Event{Info: event.Info{Container: event.Container{ID: builder.ID, FullID: builder.FullID}}}
+	appRemove := event.Event{Info: event.Info{Container: event.Container{ID: app.ID, FullID: app.FullID}}}
+
+	inCh := make(chan event.Event)
+	wg := sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outCh := f.forwardInfra(ctx, &wg, &fakeEngine{}, inCh)
+	go func() {
+		for _, evt := range []event.Event{builder, app, builderStart, builderRemove, appRemove} {
+			inCh <- evt
+		}
+		close(inCh)
+	}()
+
+	forwarded := make([]event.Event, 0)
+	for evt := range outCh {
+		forwarded = append(forwarded, evt)
+	}
+	wg.Wait()
+	assert.Equal(t, []event.Event{app, appRemove}, forwarded)
+	assert.Empty(t, f.hidden)
+	// Nor reported when fetched
+	assert.True(t, f.isInfra(&builder.Container))
+}
+
+func TestForwardInfraStop(t *testing.T) {
+	f := newInfraFilter(typeLxd)
+	inCh := make(chan event.Event)
+	wg := sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	outCh := f.forwardInfra(ctx, &wg, &fakeEngine{}, inCh)
+	// A listener that never checks ctx, blocked on sending
+	go func() {
+		defer close(inCh)
+		inCh <- infraEvent("3511fec307d6", "sharp_poincare", "fedora:38", nil)
+		inCh <- infraEvent("3511fec307d6", "sharp_poincare", "fedora:38", nil)
+	}()
+	cancel()
+	wg.Wait()
+	_, ok := <-outCh
+	assert.False(t, ok)
+}
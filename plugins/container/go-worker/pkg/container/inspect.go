@@ -0,0 +1,208 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"runtime/debug"
+	"sync"
+)
+
+// errNotContainer is returned by the inspect jobs of the instances that are not containers, eg: LXD virtual machines,
+// not to be reported at all.
+var errNotContainer = errors.New("not a container instance")
+
+// jobPanic is the panic of an inspect job, raised again by enrich in the goroutine waiting for it,
+// along with the stack of the job goroutine, since the one raising it again tells nothing.
+type jobPanic struct {
+	value any
+	stack []byte
+}
+
+func (p jobPanic) String() string {
+	return fmt.Sprint(p.value)
+}
+
+// enrich returns the info of a container built by job, its inspection, bounded by `event_deadline_ms`.
+// If job fails, or does not return in time, minimal is returned in its place, along with false:
+// on failure it is marked as partial, eg: for containers already removed, and past the deadline
+// as incomplete, without waiting for job, and accounted in the engine status,
+// so that the container gets inspected again.
+// Since job may keep running past the deadline, it must not touch the state of the listener;
+// release, if not nil, is called once job returns, eg: to free the inspectPool slot job runs in.
+func enrich(ctx context.Context, e Engine, minimal event.Info, job func(ctx context.Context) (event.Info, error), release func()) (event.Info, bool) {
+	if release == nil {
+		release = func() {}
+	}
+	deadline := config.GetEventDeadline()
+	if deadline <= 0 {
+		defer release()
+		info, err := job(ctx)
+		if err != nil {
+			return partial(ctx, e, minimal, err), false
+		}
+		return info, true
+	}
+
+	jobCtx, cancel := context.WithTimeout(ctx, deadline)
+	defer cancel()
+	type result struct {
+		info     event.Info
+		err      error
+		panicked *jobPanic
+	}
+	// Buffered, so that a job returning past the deadline never blocks.
+	resCh := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() {
+			if r := recover(); r != nil {
+				res.panicked = &jobPanic{value: r, stack: debug.Stack()}
+			}
+			release()
+			resCh <- res
+		}()
+		res.info, res.err = job(jobCtx)
+	}()
+
+	select {
+	case res := <-resCh:
+		if res.panicked != nil {
+			// Like for the listener itself, marking the engine as failed
+			panic(*res.panicked)
+		}
+		if res.err == nil {
+			return res.info, true
+		}
+		if !errors.Is(jobCtx.Err(), context.DeadlineExceeded) {
+			return partial(ctx, e, minimal, res.err), false
+		}
+	case <-jobCtx.Done():
+		if ctx.Err() != nil {
+			return minimal, false
+		}
+	}
+	logger.Warnf("engine %s (%s): container %s not inspected within %s, sending it incomplete",
+		e.Name(), e.Sock(), minimal.ID, deadline)
+	addDeadlineHit(e)
+	minimal.Incomplete = true
+	return minimal, false
+}
+
+// partial marks minimal as partial, as its inspection failed with err, unless ctx is done,
+// the instance is not a container or it is removed, remove events only carrying the minimal metadata anyway.
+func partial(ctx context.Context, e Engine, minimal event.Info, err error) event.Info {
+	if ctx.Err() != nil || errors.Is(err, errNotContainer) || minimal.State == event.StateRemoved {
+		return minimal
+	}
+	logger.Debugf("engine %s (%s): failed to inspect container %s, sending it partial: %v",
+		e.Name(), e.Sock(), minimal.ID, err)
+	minimal.Partial = true
+	return minimal
+}
+
+// inspectPool runs the inspect calls of an engine listener concurrently, bounded by
+// the engine `inspect_concurrency`, so that a burst of container events does not
+// stampede the daemon. Events of the same container are still sent in order.
+type inspectPool struct {
+	engine Engine
+	sem    chan struct{}
+	wg     sync.WaitGroup
+
+	mu sync.Mutex
+	// For each container with jobs in flight, the channel closed once its last job is done.
+	last map[string]chan struct{}
+}
+
+func newInspectPool(engine Engine, size int) *inspectPool {
+	if size <= 0 {
+		size = 1
+	}
+	return &inspectPool{
+		engine: engine,
+		sem:    make(chan struct{}, size),
+		last:   make(map[string]chan struct{}),
+	}
+}
+
+// Go runs job in a new goroutine, once the pool has a free slot, then sends its event, if any,
+// to outCh, after the events of the previous jobs for the same container ID.
+// job must free the slot calling release, once done with its inspect calls: the ones enrich keeps
+// making past the deadline still hold it, not to exceed the pool size on a slow daemon.
+// It blocks while the pool is full, so that the listener stops reading further events.
+// If create, job inspects a create, tracked as in flight by the CreateTracker of ctx, if any,
+// from now on, until its event is delivered or, if job sends none, it is done.
+// Nothing is run, nor sent, once ctx is done.
+func (p *inspectPool) Go(ctx context.Context, id string, create bool, job func(release func()) (event.Event, bool), outCh chan<- event.Event) {
+	if ctx.Err() != nil {
+		return
+	}
+	tracker, tracked := createTrackerFrom(ctx)
+	tracked = tracked && create
+	if tracked {
+		tracker.StartCreate(containerID(id))
+	}
+	select {
+	case p.sem <- struct{}{}:
+	case <-ctx.Done():
+		return
+	}
+
+	p.mu.Lock()
+	prev := p.last[id]
+	done := make(chan struct{})
+	p.last[id] = done
+	p.mu.Unlock()
+
+	// Like the listener itself, a panicking job marks the engine as failed
+	GoListener(&p.wg, p.engine, func() {
+		defer func() {
+			close(done)
+			p.mu.Lock()
+			if p.last[id] == done {
+				delete(p.last, id)
+			}
+			p.mu.Unlock()
+		}()
+
+		// The slot is only held for the job, not while waiting to send
+		release := sync.OnceFunc(func() { <-p.sem })
+		evt, ok := func() (event.Event, bool) {
+			panicking := true
+			defer func() {
+				// Not to recover the panic, losing its stack
+				if panicking {
+					release()
+				}
+			}()
+			evt, ok := job(release)
+			panicking = false
+			return evt, ok
+		}()
+		if prev != nil {
+			select {
+			case <-prev:
+			case <-ctx.Done():
+				return
+			}
+		}
+		if !ok {
+			if tracked {
+				tracker.DropCreate(containerID(id))
+			}
+			return
+		}
+		select {
+		case outCh <- evt:
+		case <-ctx.Done():
+		}
+	})
+}
+
+// Wait waits for all the jobs to be done; listeners call it before closing outCh.
+func (p *inspectPool) Wait() {
+	p.wg.Wait()
+}
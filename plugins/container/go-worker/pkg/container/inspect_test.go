@@ -0,0 +1,395 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestInspectPool(t *testing.T) {
+	const (
+		size       = 3
+		containers = 20
+		actions    = 5
+	)
+	pool := newInspectPool(&fakeEngine{socket: "/run/fake.sock"}, size)
+
+	var running, maxRunning atomic.Int32
+	job := func(id string, seq int) func(func()) (event.Event, bool) {
+		return func(release func()) (event.Event, bool) {
+			defer release()
+			n := running.Add(1)
+			defer running.Add(-1)
+			for {
+				m := maxRunning.Load()
+				if n <= m || maxRunning.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			// Later jobs of a container are faster, still they must not overtake the former ones
+			time.Sleep(time.Duration(actions-seq) * time.Millisecond)
+			// Skipped events do not block the following ones
+			if seq == 1 {
+				return event.Event{}, false
+			}
+			return event.Event{Info: event.Info{Container: event.Container{FullID: id, ExitCode: seq}}}, true
+		}
+	}
+
+	outCh := make(chan event.Event)
+	received := make(map[string][]int)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for evt := range outCh {
+			received[evt.FullID] = append(received[evt.FullID], evt.ExitCode)
+		}
+	}()
+
+	// A burst of events, interleaving the containers
+	for seq := 0; seq < actions; seq++ {
+		for i := 0; i < containers; i++ {
+			id := fmt.Sprintf("c%d", i)
+			pool.Go(context.Background(), id, false, job(id, seq), outCh)
+		}
+	}
+	pool.Wait()
+	close(outCh)
+	<-done
+
+	assert.LessOrEqual(t, maxRunning.Load(), int32(size))
+	assert.Equal(t, int32(size), maxRunning.Load())
+	assert.Len(t, received, containers)
+	for id, seqs := range received {
+		assert.Equal(t, []int{0, 2, 3, 4}, seqs, id)
+	}
+	pool.mu.Lock()
+	assert.Empty(t, pool.last)
+	pool.mu.Unlock()
+}
+
+func TestInspectPoolCancel(t *testing.T) {
+	pool := newInspectPool(&fakeEngine{socket: "/run/fake.sock"}, 1)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	// Nobody reads: the first job holds the send, the second one its turn
+	outCh := make(chan event.Event)
+	var jobs sync.WaitGroup
+	jobs.Add(2)
+	job := func(release func()) (event.Event, bool) {
+		defer jobs.Done()
+		release()
+		return event.Event{}, true
+	}
+	pool.Go(ctx, "c1", false, job, outCh)
+	pool.Go(ctx, "c1", false, job, outCh)
+	jobs.Wait()
+
+	cancel()
+	pool.Wait()
+	// Once ctx is done, jobs are not even run
+	pool.Go(ctx, "c1", false, func(func()) (event.Event, bool) {
+		t.Error("job run after cancel")
+		return event.Event{}, true
+	}, outCh)
+	pool.Wait()
+}
+
+// fakeCreateTracker records the calls of the inspectPool, as "start <id>" and "drop <id>".
+type fakeCreateTracker struct {
+	mu    sync.Mutex
+	calls []string
+}
+
+func (f *fakeCreateTracker) StartCreate(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "start "+id)
+}
+
+func (f *fakeCreateTracker) DropCreate(id string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls = append(f.calls, "drop "+id)
+}
+
+func TestInspectPoolTracker(t *testing.T) {
+	tracker := &fakeCreateTracker{}
+	ctx := WithCreateTracker(context.Background(), tracker)
+	const fullID = "0123456789abcdef0123456789abcdef"
+
+	tCases := map[string]struct {
+		create   bool
+		send     bool
+		expected []string
+	}{
+		"Create": {
+			create: true,
+			send:   true,
+			// Done by the worker, once the event is delivered
+			expected: []string{"start 0123456789ab"},
+		},
+		"Create, not sent": {
+			create:   true,
+			send:     false,
+			expected: []string{"start 0123456789ab", "drop 0123456789ab"},
+		},
+		"Remove": {
+			create:   false,
+			send:     true,
+			expected: nil,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			tracker.calls = nil
+			pool := newInspectPool(&fakeEngine{socket: "/run/fake.sock"}, 1)
+			outCh := make(chan event.Event, 1)
+			pool.Go(ctx, fullID, tc.create, func(release func()) (event.Event, bool) {
+				release()
+				// Tracked as soon as the job is queued
+				if tc.create {
+					assert.Equal(t, []string{"start 0123456789ab"}, tracker.calls)
+				}
+				return event.Event{}, tc.send
+			}, outCh)
+			pool.Wait()
+			assert.Equal(t, tc.expected, tracker.calls)
+		})
+	}
+
+	// No tracker, nothing to track
+	pool := newInspectPool(&fakeEngine{socket: "/run/fake.sock"}, 1)
+	pool.Go(context.Background(), fullID, true, func(release func()) (event.Event, bool) {
+		release()
+		return event.Event{}, false
+	}, make(chan event.Event))
+	pool.Wait()
+}
+
+func TestInspectPoolDeadline(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"event_deadline_ms":2000}`)
+		ResetStatus()
+	})
+	require.NoError(t, config.Load(`{"event_deadline_ms":10}`))
+	engine := &fakeEngine{socket: "/run/fake.sock"}
+	pool := newInspectPool(engine, 1)
+
+	// A slow daemon, answering well past the deadline
+	var inFlight, maxInFlight atomic.Int32
+	inspect := func(_ context.Context) (event.Info, error) {
+		n := inFlight.Add(1)
+		defer inFlight.Add(-1)
+		for {
+			m := maxInFlight.Load()
+			if n <= m || maxInFlight.CompareAndSwap(m, n) {
+				break
+			}
+		}
+		time.Sleep(50 * time.Millisecond)
+		return event.Info{}, nil
+	}
+
+	outCh := make(chan event.Event)
+	received := make([]event.Event, 0)
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for evt := range outCh {
+			received = append(received, evt)
+		}
+	}()
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("c%d", i)
+		pool.Go(context.Background(), id, false, func(release func()) (event.Event, bool) {
+			minimal := event.Info{Container: event.Container{ID: id}}
+			info, _ := enrich(context.Background(), engine, minimal, inspect, release)
+			return event.Event{Info: info}, true
+		}, outCh)
+	}
+	pool.Wait()
+	close(outCh)
+	<-done
+
+	// Each event is sent incomplete, still the inspect calls never overlap
+	require.Len(t, received, 3)
+	for _, evt := range received {
+		assert.True(t, evt.Incomplete)
+	}
+	assert.Equal(t, int32(1), maxInFlight.Load())
+}
+
+func TestEnrich(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"event_deadline_ms":2000}`)
+	})
+	minimal := event.Info{Container: event.Container{ID: "2400edb296c5", State: event.StateRunning}}
+	full := event.Info{Container: event.Container{ID: "2400edb296c5", Name: "nginx", State: event.StateRunning}}
+	slow := func(ctx context.Context) (event.Info, error) {
+		select {
+		case <-ctx.Done():
+			return event.Info{}, ctx.Err()
+		case <-time.After(time.Second):
+			return full, nil
+		}
+	}
+	partial := minimal
+	partial.Partial = true
+	removed := minimal
+	removed.State = event.StateRemoved
+	tCases := map[string]struct {
+		deadline     int
+		minimal      *event.Info
+		job          func(ctx context.Context) (event.Info, error)
+		expectedInfo event.Info
+		expectedOk   bool
+		expectedHits uint64
+	}{
+		"Inspected": {
+			deadline: 50,
+			job: func(_ context.Context) (event.Info, error) {
+				return full, nil
+			},
+			expectedInfo: full,
+			expectedOk:   true,
+		},
+		"Failed": {
+			deadline: 50,
+			job: func(_ context.Context) (event.Info, error) {
+				return event.Info{}, errors.New("no such container")
+			},
+			expectedInfo: partial,
+		},
+		"Failed, disabled": {
+			deadline: 0,
+			job: func(_ context.Context) (event.Info, error) {
+				return event.Info{}, errors.New("no such container")
+			},
+			expectedInfo: partial,
+		},
+		"Failed on remove": {
+			deadline: 50,
+			minimal:  &removed,
+			job: func(_ context.Context) (event.Info, error) {
+				return event.Info{}, errors.New("no such container")
+			},
+			expectedInfo: removed,
+		},
+		"Not a container": {
+			deadline: 50,
+			job: func(_ context.Context) (event.Info, error) {
+				return event.Info{}, errNotContainer
+			},
+			expectedInfo: minimal,
+		},
+		"Deadline hit": {
+			deadline: 50,
+			job:      slow,
+			expectedInfo: func() event.Info {
+				info := minimal
+				info.Incomplete = true
+				return info
+			}(),
+			expectedHits: 1,
+		},
+		"Deadline ignored by the job": {
+			deadline: 50,
+			job: func(_ context.Context) (event.Info, error) {
+				time.Sleep(time.Second)
+				return full, nil
+			},
+			expectedInfo: func() event.Info {
+				info := minimal
+				info.Incomplete = true
+				return info
+			}(),
+			expectedHits: 1,
+		},
+		"Disabled": {
+			deadline: 0,
+			job: func(_ context.Context) (event.Info, error) {
+				time.Sleep(100 * time.Millisecond)
+				return full, nil
+			},
+			expectedInfo: full,
+			expectedOk:   true,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, config.Load(fmt.Sprintf(`{"event_deadline_ms":%d}`, tc.deadline)))
+			ResetStatus()
+			t.Cleanup(ResetStatus)
+			engine := &fakeEngine{socket: "/run/fake.sock"}
+			SetEngineState(engine, EngineRunning, nil)
+
+			m := minimal
+			if tc.minimal != nil {
+				m = *tc.minimal
+			}
+			start := time.Now()
+			info, ok := enrich(context.Background(), engine, m, tc.job, nil)
+			assert.Less(t, time.Since(start), 500*time.Millisecond)
+			assert.Equal(t, tc.expectedInfo, info)
+			assert.Equal(t, tc.expectedOk, ok)
+			st := Status()
+			require.Len(t, st, 1)
+			assert.Equal(t, tc.expectedHits, st[0].DeadlineHits)
+		})
+	}
+}
+
+func TestEnrichPanic(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"event_deadline_ms":2000}`)
+	})
+	require.NoError(t, config.Load(`{"event_deadline_ms":50}`))
+	released := false
+
+	defer func() {
+		p, ok := recover().(jobPanic)
+		require.True(t, ok)
+		assert.Equal(t, "boom", p.String())
+		// Along with the stack of the job goroutine
+		assert.Contains(t, string(p.stack), "panickingInspect")
+		assert.True(t, released)
+	}()
+	enrich(context.Background(), &fakeEngine{}, event.Info{}, panickingInspect, func() {
+		released = true
+	})
+	t.Error("panic not raised again")
+}
+
+func panickingInspect(_ context.Context) (event.Info, error) {
+	panic("boom")
+}
+
+func TestEnrichCancel(t *testing.T) {
+	ResetStatus()
+	t.Cleanup(ResetStatus)
+	engine := &fakeEngine{socket: "/run/fake.sock"}
+	SetEngineState(engine, EngineRunning, nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	// Not a deadline hit: the listener is leaving
+	minimal := event.Info{Container: event.Container{ID: "2400edb296c5"}}
+	info, ok := enrich(ctx, engine, minimal, func(ctx context.Context) (event.Info, error) {
+		<-ctx.Done()
+		return event.Info{}, ctx.Err()
+	}, nil)
+	assert.False(t, ok)
+	assert.Equal(t, minimal, info)
+	assert.Zero(t, Status()[0].DeadlineHits)
+}
@@ -0,0 +1,475 @@
+//go:build !no_lxd
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/gorilla/websocket"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	lxdDefaultProject = "default"
+	// lxdProfileLabelPrefix prefixes the labels each instance profile is reported as.
+	lxdProfileLabelPrefix = "lxd.profile."
+
+	lxdActionCreated  = "instance-created"
+	lxdActionStarted  = "instance-started"
+	lxdActionStopped  = "instance-stopped"
+	lxdActionShutdown = "instance-shutdown"
+	lxdActionDeleted  = "instance-deleted"
+)
+
+func init() {
+	register(typeLxd, newLxdEngine)
+}
+
+// lxdEngine talks to the LXD REST API over its unix socket.
+// See https://documentation.ubuntu.com/lxd/en/latest/rest-api/
+type lxdEngine struct {
+	*infraFilter
+	ref    *clientRef
+	client *http.Client
+	dialer *websocket.Dialer
+	socket string
+}
+
+func newLxdEngine(_ context.Context, socket string) (Engine, error) {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	return &lxdEngine{
+		infraFilter: newInfraFilter(typeLxd),
+		ref:         openClient(string(typeLxd), socket),
+		client:      &http.Client{Transport: &http.Transport{DialContext: dial}},
+		dialer:      &websocket.Dialer{NetDialContext: dial, HandshakeTimeout: 5 * time.Second},
+		socket:      socket,
+	}, nil
+}
+
+func (lc *lxdEngine) copy(ctx context.Context) (Engine, error) {
+	return newLxdEngine(ctx, lc.socket)
+}
+
+// Close closes the idle connections of the REST client; the events websocket is closed with its context.
+func (lc *lxdEngine) Close() error {
+	if !lc.ref.release() {
+		return nil
+	}
+	lc.client.CloseIdleConnections()
+	return nil
+}
+
+// lxdResponse is the envelope of all LXD sync responses.
+type lxdResponse struct {
+	Type      string          `json:"type"`
+	ErrorCode int             `json:"error_code"`
+	Error     string          `json:"error"`
+	Metadata  json.RawMessage `json:"metadata"`
+}
+
+type lxdInstance struct {
+	Name           string            `json:"name"`
+	Project        string            `json:"project"`
+	Type           string            `json:"type"`
+	Status         string            `json:"status"`
+	CreatedAt      time.Time         `json:"created_at"`
+	Profiles       []string          `json:"profiles"`
+	ExpandedConfig map[string]string `json:"expanded_config"`
+}
+
+type lxdImage struct {
+	Aliases []struct {
+		Name string `json:"name"`
+	} `json:"aliases"`
+}
+
+type lxdEvent struct {
+	Type     string `json:"type"`
+	Project  string `json:"project"`
+	Metadata struct {
+		Action  string `json:"action"`
+		Source  string `json:"source"`
+		Project string `json:"project"`
+	} `json:"metadata"`
+}
+
+// lxdLifecycle is an instance lifecycle change, parsed from an LXD event.
+type lxdLifecycle struct {
+	action  string
+	project string
+	name    string
+}
+
+// parseLxdEvent extracts the instance lifecycle change from an LXD event;
+// ok is false for events not about instances.
+func parseLxdEvent(data []byte) (lxdLifecycle, bool, error) {
+	var evt lxdEvent
+	if err := json.Unmarshal(data, &evt); err != nil {
+		return lxdLifecycle{}, false, err
+	}
+	if evt.Type != "lifecycle" || !strings.HasPrefix(evt.Metadata.Action, "instance-") {
+		return lxdLifecycle{}, false, nil
+	}
+	// Source is like "/1.0/instances/c1?project=foo"
+	source, err := url.Parse(evt.Metadata.Source)
+	if err != nil {
+		return lxdLifecycle{}, false, err
+	}
+	name, found := strings.CutPrefix(source.Path, "/1.0/instances/")
+	if !found || name == "" || strings.Contains(name, "/") {
+		return lxdLifecycle{}, false, nil
+	}
+	project := evt.Metadata.Project
+	if project == "" {
+		project = evt.Project
+	}
+	if project == "" {
+		project = source.Query().Get("project")
+	}
+	return lxdLifecycle{action: evt.Metadata.Action, project: project, name: name}, true, nil
+}
+
+// lxdContainerID returns the container ID as found in instance cgroups, ie: lxc.payload.<project>_<name>
+// for non-default projects, lxc.payload.<name> otherwise.
+func lxdContainerID(project, name string) string {
+	if project == "" || project == lxdDefaultProject {
+		return name
+	}
+	return project + "_" + name
+}
+
+// lxdSplitContainerID is the inverse of lxdContainerID; LXD instance names cannot contain underscores.
+func lxdSplitContainerID(id string) (string, string) {
+	if project, name, found := strings.Cut(id, "_"); found {
+		return project, name
+	}
+	return lxdDefaultProject, id
+}
+
+// lxdImageAlias returns the image alias an instance was created from:
+// the first local alias if any, else the remote one, like "ubuntu/jammy".
+func lxdImageAlias(img *lxdImage, cfg map[string]string) string {
+	if img != nil && len(img.Aliases) > 0 {
+		return img.Aliases[0].Name
+	}
+	if cfg["image.os"] == "" {
+		return ""
+	}
+	if cfg["image.release"] == "" {
+		return strings.ToLower(cfg["image.os"])
+	}
+	return strings.ToLower(cfg["image.os"]) + "/" + cfg["image.release"]
+}
+
+// lxdIDMap is an entry of the volatile.idmap.current instance config.
+type lxdIDMap struct {
+	IsUID    bool   `json:"Isuid"`
+	IsGID    bool   `json:"Isgid"`
+	HostID   uint32 `json:"Hostid"`
+	NsID     uint32 `json:"Nsid"`
+	MapRange uint32 `json:"Maprange"`
+}
+
+// lxdCgroupPath returns the cgroup path of a container, that liblxc names after the
+// project-qualified instance name, ie: its lxdContainerID.
+func lxdCgroupPath(id string) string {
+	return "/lxc.payload." + id
+}
+
+// lxdUserns returns the user namespace mode and mappings of an instance;
+// unprivileged containers always run in a remapped user namespace.
+func lxdUserns(cfg map[string]string) (string, []event.IDMapping, []event.IDMapping) {
+	uidMappings := make([]event.IDMapping, 0)
+	gidMappings := make([]event.IDMapping, 0)
+	if cfg["security.privileged"] == "true" {
+		return event.UsernsHost, uidMappings, gidMappings
+	}
+	var idmaps []lxdIDMap
+	if err := json.Unmarshal([]byte(cfg["volatile.idmap.current"]), &idmaps); err == nil {
+		for _, m := range idmaps {
+			mapping := event.IDMapping{ContainerID: m.NsID, HostID: m.HostID, Size: m.MapRange}
+			if m.IsUID {
+				uidMappings = append(uidMappings, mapping)
+			}
+			if m.IsGID {
+				gidMappings = append(gidMappings, mapping)
+			}
+		}
+	}
+	return event.UsernsPrivate, uidMappings, gidMappings
+}
+
+func lxdInstanceToInfo(instance *lxdInstance, img *lxdImage) event.Info {
+	cfg := instance.ExpandedConfig
+	id := lxdContainerID(instance.Project, instance.Name)
+
+	labels := make(map[string]string)
+	for _, profile := range instance.Profiles {
+		labels[lxdProfileLabelPrefix+profile] = "true"
+	}
+	for key, val := range cfg {
+		if label, found := strings.CutPrefix(key, "user."); found && len(val) <= config.GetLabelMaxLen() {
+			labels[label] = val
+		}
+	}
+
+	env := make([]string, 0)
+	for key, val := range cfg {
+		if name, found := strings.CutPrefix(key, "environment."); found {
+			env = append(env, name+"="+val)
+		}
+	}
+	sort.Strings(env)
+
+	// limits.cpu is either a number of CPUs or a set of them
+	var cpusetCount int64
+	if cpus := cfg["limits.cpu"]; cpus != "" {
+		var err error
+		if cpusetCount, err = strconv.ParseInt(cpus, 10, 64); err != nil {
+			cpusetCount = countCPUSet(cpus)
+		}
+	}
+
+	usernsMode, uidMappings, gidMappings := lxdUserns(cfg)
+
+	return event.Info{
+		Container: event.Container{
+			Type:             typeLxd.ToCTValue(),
+			Engine:           string(typeLxd),
+			ID:               id,
+			Name:             instance.Name,
+			Image:            lxdImageAlias(img, cfg),
+			ImageID:          cfg["volatile.base_image"],
+			ImageRepo:        cfg["image.os"],
+			ImageTag:         cfg["image.release"],
+			CPUPeriod:        defaultCpuPeriod,
+			CPUShares:        defaultCpuShares,
+			CPUSetCPUCount:   cpusetCount,
+			CreatedTime:      instance.CreatedAt.Unix(),
+			Env:              env,
+			FullID:           id,
+			Labels:           labels,
+			Privileged:       cfg["security.privileged"] == "true",
+			Mounts:           []event.Mount{},
+			PortMappings:     []event.PortMapping{},
+			Size:             -1,
+			State:            normalizeState(instance.Status),
+			ExitCode:         unknownExit.code,
+			Networks:         []event.Network{},
+			UsernsMode:       usernsMode,
+			UIDMappings:      uidMappings,
+			GIDMappings:      gidMappings,
+			Entrypoint:       []string{},
+			Cmd:              []string{},
+			CgroupPath:       lxdCgroupPath(id),
+			CgroupsVersion:   hostCgroupsVersion(),
+			NetworkAliases:   []string{},
+			Devices:          []string{},
+			Runtime:          event.RuntimeUnknown,
+			HostArchitecture: hostArchitecture(),
+		},
+	}
+}
+
+// query performs a GET on the LXD API and decodes the response metadata into res.
+func (lc *lxdEngine) query(ctx context.Context, path string, res any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, "http://lxd"+path, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := lc.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	var lxdResp lxdResponse
+	if err = json.Unmarshal(body, &lxdResp); err != nil {
+		return err
+	}
+	if lxdResp.Type == "error" {
+		return fmt.Errorf("lxd error %d: %s", lxdResp.ErrorCode, lxdResp.Error)
+	}
+	return json.Unmarshal(lxdResp.Metadata, res)
+}
+
+func (lc *lxdEngine) instanceToInfo(ctx context.Context, instance *lxdInstance) event.Info {
+	var img *lxdImage
+	if fingerprint := instance.ExpandedConfig["volatile.base_image"]; fingerprint != "" {
+		img = &lxdImage{}
+		path := "/1.0/images/" + url.PathEscape(fingerprint) + "?project=" + url.QueryEscape(instance.Project)
+		if err := lc.query(ctx, path, img); err != nil {
+			img = nil
+		}
+	}
+	return lxdInstanceToInfo(instance, img)
+}
+
+func (lc *lxdEngine) inspect(ctx context.Context, project, name string) (*lxdInstance, error) {
+	var instance lxdInstance
+	path := "/1.0/instances/" + url.PathEscape(name) + "?project=" + url.QueryEscape(project)
+	if err := lc.query(ctx, path, &instance); err != nil {
+		return nil, err
+	}
+	if instance.Type != "container" {
+		return nil, errNotContainer
+	}
+	return &instance, nil
+}
+
+func (lc *lxdEngine) get(ctx context.Context, containerId string) (*event.Event, error) {
+	project, name := lxdSplitContainerID(containerId)
+	instance, err := lc.inspect(ctx, project, name)
+	if err != nil {
+		return nil, err
+	}
+	return &event.Event{
+		Info:     lc.instanceToInfo(ctx, instance),
+		IsCreate: true,
+	}, nil
+}
+
+// apiVersion returns the version of the LXD REST API, eg: 1.0.
+func (lc *lxdEngine) apiVersion(ctx context.Context) (string, error) {
+	var server struct {
+		APIVersion string `json:"api_version"`
+	}
+	if err := lc.query(ctx, "/1.0", &server); err != nil {
+		return "", err
+	}
+	return server.APIVersion, nil
+}
+
+func (lc *lxdEngine) Name() string {
+	return string(typeLxd)
+}
+
+func (lc *lxdEngine) Sock() string {
+	return lc.socket
+}
+
+func (lc *lxdEngine) List(ctx context.Context) ([]event.Event, error) {
+	var instances []lxdInstance
+	if err := lc.query(ctx, "/1.0/instances?recursion=1&all-projects=true&filter=type+eq+container", &instances); err != nil {
+		return nil, err
+	}
+	evts := make([]event.Event, 0, len(instances))
+	for idx := range instances {
+		// Older LXD versions do not support filtering
+		if instances[idx].Type != "container" {
+			continue
+		}
+		evts = append(evts, event.Event{
+			Info:     lc.instanceToInfo(ctx, &instances[idx]),
+			IsCreate: true,
+		})
+	}
+	return lc.filterInfra(evts), nil
+}
+
+func (lc *lxdEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
+	conn, _, err := lc.dialer.DialContext(ctx, "ws://lxd/1.0/events?type=lifecycle&all-projects=true", nil)
+	if err != nil {
+		return nil, err
+	}
+
+	outCh := make(chan event.Event)
+	GoListener(wg, lc, func() {
+		defer close(outCh)
+		// Unblock the ReadMessage below once done.
+		stop := context.AfterFunc(ctx, func() {
+			_ = conn.Close()
+		})
+		defer func() {
+			stop()
+			_ = conn.Close()
+		}()
+		for {
+			_, data, err := conn.ReadMessage()
+			if err != nil {
+				// Connection closed - kill the goroutine
+				return
+			}
+			lifecycle, ok, _ := parseLxdEvent(data)
+			if !ok {
+				continue
+			}
+			var hook byte
+			switch lifecycle.action {
+			case lxdActionCreated:
+				hook = config.HookCreate
+			case lxdActionStarted:
+				hook = config.HookStart
+			case lxdActionStopped, lxdActionShutdown:
+				hook = config.HookExit
+			case lxdActionDeleted:
+				// Inspect is useless on a deleted instance;
+				// at least send an event with the minimal set of data
+				id := lxdContainerID(lifecycle.project, lifecycle.name)
+				outCh <- event.Event{
+					Info: event.Info{
+						Container: event.Container{
+							Type:     typeLxd.ToCTValue(),
+							Engine:   string(typeLxd),
+							ID:       id,
+							FullID:   id,
+							Name:     lifecycle.name,
+							State:    event.StateRemoved,
+							ExitCode: unknownExit.code,
+						},
+					},
+					IsCreate: false,
+				}
+				continue
+			default:
+				continue
+			}
+			if !config.IsHookEnabled(hook) {
+				continue
+			}
+			id := lxdContainerID(lifecycle.project, lifecycle.name)
+			minimal := event.Info{
+				Container: event.Container{
+					Type:   typeLxd.ToCTValue(),
+					Engine: string(typeLxd),
+					ID:     id,
+					FullID: id,
+					Name:   lifecycle.name,
+					State:  event.StateUnknown,
+				},
+			}
+			info, ok := enrich(ctx, lc, minimal, func(ctx context.Context) (event.Info, error) {
+				instance, err := lc.inspect(ctx, lifecycle.project, lifecycle.name)
+				if err != nil {
+					return event.Info{}, err
+				}
+				return lc.instanceToInfo(ctx, instance), nil
+			}, nil)
+			// Inspect fails for virtual machines, not reported, or for instances already gone
+			if ok || info.Degraded() {
+				outCh <- event.Event{
+					Info:     info,
+					IsCreate: true,
+				}
+			}
+		}
+	})
+	return lc.forwardInfra(ctx, wg, lc, outCh), nil
+}
@@ -0,0 +1,307 @@
+//go:build linux && !no_lxd
+
+package container
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/gorilla/websocket"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"net"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+// Recorded from `lxc query /1.0/instances/c1` on LXD 5.21
+const lxdInstanceJSON = `{
+	"architecture": "x86_64",
+	"config": {
+		"image.os": "Ubuntu",
+		"image.release": "jammy",
+		"volatile.base_image": "0b3b0fd3ac3e0c1e4b8e3c6297ac1b3b527d6bc7a2e3f5b3c8e5c74d3b4e1c02"
+	},
+	"created_at": "2024-10-01T10:00:00.123456789Z",
+	"description": "",
+	"ephemeral": false,
+	"expanded_config": {
+		"environment.FOO": "bar",
+		"image.os": "Ubuntu",
+		"image.release": "jammy",
+		"limits.cpu": "0-1",
+		"security.privileged": "true",
+		"user.team": "falco",
+		"volatile.base_image": "0b3b0fd3ac3e0c1e4b8e3c6297ac1b3b527d6bc7a2e3f5b3c8e5c74d3b4e1c02"
+	},
+	"location": "none",
+	"name": "c1",
+	"profiles": ["default", "web"],
+	"project": "default",
+	"stateful": false,
+	"status": "Running",
+	"status_code": 103,
+	"type": "container"
+}`
+
+const lxdImageJSON = `{"aliases": [{"name": "jammy", "description": ""}], "fingerprint": "0b3b0fd3ac3e"}`
+
+func expectedLxdEvent(image string) event.Event {
+	return event.Event{
+		Info: event.Info{
+			Container: event.Container{
+				Type:           typeLxd.ToCTValue(),
+				Engine:         string(typeLxd),
+				ID:             "c1",
+				Name:           "c1",
+				Image:          image,
+				ImageID:        "0b3b0fd3ac3e0c1e4b8e3c6297ac1b3b527d6bc7a2e3f5b3c8e5c74d3b4e1c02",
+				ImageRepo:      "Ubuntu",
+				ImageTag:       "jammy",
+				CPUPeriod:      defaultCpuPeriod,
+				CPUShares:      defaultCpuShares,
+				CPUSetCPUCount: 2,
+				CreatedTime:    1727776800,
+				Env:            []string{"FOO=bar"},
+				FullID:         "c1",
+				Labels: map[string]string{
+					"lxd.profile.default": "true",
+					"lxd.profile.web":     "true",
+					"team":                "falco",
+				},
+				Privileged:       true,
+				Mounts:           []event.Mount{},
+				PortMappings:     []event.PortMapping{},
+				Size:             -1,
+				State:            event.StateRunning,
+				ExitCode:         -1,
+				Networks:         []event.Network{},
+				UsernsMode:       event.UsernsHost,
+				UIDMappings:      []event.IDMapping{},
+				GIDMappings:      []event.IDMapping{},
+				Entrypoint:       []string{},
+				Cmd:              []string{},
+				CgroupPath:       "/lxc.payload.c1",
+				CgroupsVersion:   hostCgroupsVersion(),
+				NetworkAliases:   []string{},
+				Devices:          []string{},
+				Runtime:          event.RuntimeUnknown,
+				HostArchitecture: hostArchitecture(),
+			},
+		},
+		IsCreate: true,
+	}
+}
+
+func TestLxdInstanceToInfo(t *testing.T) {
+	var instance lxdInstance
+	require.NoError(t, json.Unmarshal([]byte(lxdInstanceJSON), &instance))
+
+	var img lxdImage
+	require.NoError(t, json.Unmarshal([]byte(lxdImageJSON), &img))
+
+	tCases := map[string]struct {
+		img           *lxdImage
+		expectedImage string
+	}{
+		"Local alias":  {img: &img, expectedImage: "jammy"},
+		"Remote alias": {img: nil, expectedImage: "ubuntu/jammy"},
+	}
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			info := lxdInstanceToInfo(&instance, tc.img)
+			assert.Equal(t, expectedLxdEvent(tc.expectedImage).Info, info)
+			assertMatchesSchema(t, event.Event{Info: info})
+		})
+	}
+
+	instance.Project = "prod"
+	info := lxdInstanceToInfo(&instance, nil)
+	assert.Equal(t, "prod_c1", info.ID)
+	assert.Equal(t, "/lxc.payload.prod_c1", info.CgroupPath)
+}
+
+func TestParseLxdEvent(t *testing.T) {
+	tCases := map[string]struct {
+		json              string
+		expectedOk        bool
+		expectedLifecycle lxdLifecycle
+	}{
+		"Created": {
+			json:              `{"type":"lifecycle","timestamp":"2024-10-01T10:00:00Z","metadata":{"action":"instance-created","source":"/1.0/instances/c1","context":{},"project":"default"},"location":"none","project":"default"}`,
+			expectedOk:        true,
+			expectedLifecycle: lxdLifecycle{action: lxdActionCreated, project: "default", name: "c1"},
+		},
+		"Deleted in project": {
+			json:              `{"type":"lifecycle","timestamp":"2024-10-01T10:00:00Z","metadata":{"action":"instance-deleted","source":"/1.0/instances/c2?project=prod","context":{}},"location":"none"}`,
+			expectedOk:        true,
+			expectedLifecycle: lxdLifecycle{action: lxdActionDeleted, project: "prod", name: "c2"},
+		},
+		"Snapshot": {
+			json:       `{"type":"lifecycle","metadata":{"action":"instance-snapshot-created","source":"/1.0/instances/c1/snapshots/snap0"},"project":"default"}`,
+			expectedOk: false,
+		},
+		"Image": {
+			json:       `{"type":"lifecycle","metadata":{"action":"image-created","source":"/1.0/images/0b3b0fd3ac3e"},"project":"default"}`,
+			expectedOk: false,
+		},
+		"Logging": {
+			json:       `{"type":"logging","metadata":{"message":"Started instance"}}`,
+			expectedOk: false,
+		},
+	}
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			lifecycle, ok, err := parseLxdEvent([]byte(tc.json))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expectedOk, ok)
+			if tc.expectedOk {
+				assert.Equal(t, tc.expectedLifecycle, lifecycle)
+			}
+		})
+	}
+
+	_, _, err := parseLxdEvent([]byte("{"))
+	assert.Error(t, err)
+}
+
+// serveLxd serves a fake LXD API over a unix socket, pushing events on the events endpoint.
+func serveLxd(t *testing.T, events []string) string {
+	socket := filepath.Join(t.TempDir(), "unix.socket")
+	l, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+
+	sync := func(metadata string) string {
+		return `{"type":"sync","status":"Success","status_code":200,"metadata":` + metadata + `}`
+	}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/1.0/instances", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(sync(`[` + lxdInstanceJSON + `,{"name":"vm1","project":"default","type":"virtual-machine"}]`)))
+	})
+	mux.HandleFunc("/1.0/instances/c1", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(sync(lxdInstanceJSON)))
+	})
+	mux.HandleFunc("/1.0/images/", func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"type":"error","error":"Image not found","error_code":404}`))
+	})
+	mux.HandleFunc("/1.0/events", func(w http.ResponseWriter, r *http.Request) {
+		upgrader := websocket.Upgrader{}
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		for _, evt := range events {
+			_ = conn.WriteMessage(websocket.TextMessage, []byte(evt))
+		}
+		// Keep the stream open until the client goes away
+		_, _, _ = conn.ReadMessage()
+	})
+	srv := &http.Server{Handler: mux}
+	go func() {
+		_ = srv.Serve(l)
+	}()
+	t.Cleanup(func() {
+		_ = srv.Close()
+	})
+	return socket
+}
+
+func TestLxd(t *testing.T) {
+	socket := serveLxd(t, []string{
+		`{"type":"lifecycle","metadata":{"action":"instance-created","source":"/1.0/instances/c1"},"project":"default"}`,
+		`{"type":"lifecycle","metadata":{"action":"instance-started","source":"/1.0/instances/c1"},"project":"default"}`,
+		`{"type":"lifecycle","metadata":{"action":"instance-deleted","source":"/1.0/instances/c1"},"project":"default"}`,
+	})
+
+	engine, err := newLxdEngine(context.Background(), socket)
+	require.NoError(t, err)
+
+	// Image alias lookup fails: remote alias is used
+	evts, err := engine.List(context.Background())
+	require.NoError(t, err)
+	assert.Equal(t, []event.Event{expectedLxdEvent("ubuntu/jammy")}, evts)
+
+	evt, err := engine.(getter).get(context.Background(), "c1")
+	require.NoError(t, err)
+	assert.Equal(t, expectedLxdEvent("ubuntu/jammy"), *evt)
+
+	wg := sync.WaitGroup{}
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		wg.Wait()
+	})
+
+	listCh, err := engine.Listen(cancelCtx, &wg)
+	require.NoError(t, err)
+
+	// Only the create hook is enabled by default: the start event is skipped
+	assert.Equal(t, expectedLxdEvent("ubuntu/jammy"), waitOnChannelOrTimeout(t, listCh))
+	assert.Equal(t, event.Event{
+		Info: event.Info{
+			Container: event.Container{
+				Type:     typeLxd.ToCTValue(),
+				Engine:   string(typeLxd),
+				ID:       "c1",
+				FullID:   "c1",
+				Name:     "c1",
+				State:    event.StateRemoved,
+				ExitCode: -1,
+			},
+		},
+		IsCreate: false,
+	}, waitOnChannelOrTimeout(t, listCh))
+
+	// Listener goroutine leaves on cancel
+	cancel()
+	select {
+	case _, ok := <-listCh:
+		assert.False(t, ok)
+	case <-time.After(time.Second):
+		t.Fatal("listener not stopped on cancel")
+	}
+}
+
+func TestLxdUserns(t *testing.T) {
+	tCases := map[string]struct {
+		cfg                 map[string]string
+		expectedMode        string
+		expectedUIDMappings []event.IDMapping
+		expectedGIDMappings []event.IDMapping
+	}{
+		"Privileged": {
+			cfg:                 map[string]string{"security.privileged": "true"},
+			expectedMode:        event.UsernsHost,
+			expectedUIDMappings: []event.IDMapping{},
+			expectedGIDMappings: []event.IDMapping{},
+		},
+		"Unprivileged": {
+			cfg: map[string]string{
+				"volatile.idmap.current": `[{"Isuid":true,"Isgid":false,"Hostid":1000000,"Nsid":0,"Maprange":1000000000},{"Isuid":false,"Isgid":true,"Hostid":1000000,"Nsid":0,"Maprange":1000000000}]`,
+			},
+			expectedMode:        event.UsernsPrivate,
+			expectedUIDMappings: []event.IDMapping{{ContainerID: 0, HostID: 1000000, Size: 1000000000}},
+			expectedGIDMappings: []event.IDMapping{{ContainerID: 0, HostID: 1000000, Size: 1000000000}},
+		},
+		"Unprivileged never started": {
+			cfg:                 map[string]string{},
+			expectedMode:        event.UsernsPrivate,
+			expectedUIDMappings: []event.IDMapping{},
+			expectedGIDMappings: []event.IDMapping{},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			mode, uidMappings, gidMappings := lxdUserns(tc.cfg)
+			assert.Equal(t, tc.expectedMode, mode)
+			assert.Equal(t, tc.expectedUIDMappings, uidMappings)
+			assert.Equal(t, tc.expectedGIDMappings, gidMappings)
+		})
+	}
+}
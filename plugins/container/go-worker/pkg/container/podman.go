@@ -1,14 +1,14 @@
-//go:build linux
+//go:build linux && !no_podman
 
 package container
 
 import (
 	"context"
 	"encoding/json"
-	"errors"
 	"github.com/containers/podman/v5/libpod/define"
 	"github.com/containers/podman/v5/pkg/bindings"
 	"github.com/containers/podman/v5/pkg/bindings/containers"
+	"github.com/containers/podman/v5/pkg/bindings/images"
 	"github.com/containers/podman/v5/pkg/bindings/system"
 	"github.com/containers/podman/v5/pkg/domain/entities/types"
 	"github.com/docker/docker/api/types/container"
@@ -20,13 +20,23 @@ import (
 	"sync"
 )
 
+// podmanActionDied is the libpod events API action emitted when a container exits.
+const podmanActionDied events.Action = "died"
+
 func init() {
-	engineGenerators[typePodman] = newPodmanEngine
+	register(typePodman, newPodmanEngine)
 }
 
 type podmanEngine struct {
+	*infraFilter
+	ref    *clientRef
 	pCtx   context.Context
 	socket string
+	// Whether the service is rootless, thus running containers in a remapped user namespace.
+	rootless       bool
+	cgroupsVersion int
+	// imagePlatforms caches the image platforms, by image ID
+	imagePlatforms *imageCache[imagePlatform]
 }
 
 func newPodmanEngine(ctx context.Context, socket string) (Engine, error) {
@@ -34,13 +44,99 @@ func newPodmanEngine(ctx context.Context, socket string) (Engine, error) {
 	if err != nil {
 		return nil, err
 	}
-	return &podmanEngine{pCtx: conn, socket: socket}, nil
+	pc := &podmanEngine{infraFilter: newInfraFilter(typePodman), ref: openClient(string(typePodman), socket), pCtx: conn, socket: socket,
+		imagePlatforms: newImageCache[imagePlatform]()}
+	if info, err := system.Info(conn, nil); err == nil && info.Host != nil {
+		pc.rootless = info.Host.Security.Rootless
+		pc.cgroupsVersion = parseCgroupsVersion(info.Host.CgroupsVersion)
+	} else {
+		pc.cgroupsVersion = hostCgroupsVersion()
+	}
+	return pc, nil
+}
+
+// podmanMinimalInfo returns the info of the container of an event with the minimal set of data,
+// for ActionRemove AND as a fallback whenever Inspect fails.
+func podmanMinimalInfo(ev types.Event) event.Info {
+	return event.Info{Container: event.Container{
+		Type:   typePodman.ToCTValue(),
+		Engine: string(typePodman),
+		ID:     containerID(ev.Actor.ID),
+		FullID: ev.Actor.ID,
+		Name:   ev.Actor.Attributes["name"],
+		Image:  ev.Actor.Attributes["image"],
+		State:  podmanActionToState(ev.Action),
+	}}
+}
+
+// inspectEvent returns the info of the container of an event, or its minimal one, along with false,
+// if the inspection fails or takes longer than `event_deadline_ms`.
+func (pc *podmanEngine) inspectEvent(ctx context.Context, ev types.Event, size bool) (event.Info, bool) {
+	return enrich(ctx, pc, podmanMinimalInfo(ev), func(ctx context.Context) (event.Info, error) {
+		// A child of the connection context, to keep its client
+		inspectCtx, cancel := context.WithCancel(pc.pCtx)
+		defer cancel()
+		stop := context.AfterFunc(ctx, cancel)
+		defer stop()
+		ctr, err := containers.Inspect(inspectCtx, ev.Actor.ID, &containers.InspectOptions{Size: &size})
+		if err != nil {
+			return event.Info{}, err
+		}
+		return pc.ctrToInfo(ctr), nil
+	}, nil)
+}
+
+// podmanIDMappings parses inspect `container:host:size` id mappings.
+func podmanIDMappings(inspectMappings []string) ([]event.IDMapping, error) {
+	return parseIDMappings(strings.ReplaceAll(strings.Join(inspectMappings, "\n"), ":", " "))
+}
+
+// userns returns the user namespace mode and mappings of a container.
+func (pc *podmanEngine) userns(ctr *define.InspectContainerData, hostCfg *define.InspectContainerHostConfig) (string, []event.IDMapping, []event.IDMapping) {
+	if m := hostCfg.IDMappings; m != nil && len(m.UIDMap) > 0 {
+		uidMappings, uidErr := podmanIDMappings(m.UIDMap)
+		gidMappings, gidErr := podmanIDMappings(m.GIDMap)
+		if uidErr == nil && gidErr == nil {
+			return event.UsernsPrivate, uidMappings, gidMappings
+		}
+	}
+	// The rootless user namespace is not reflected by inspect: read it from the running container.
+	if ctr.State != nil {
+		if mode, uidMappings, gidMappings, err := procUserns(ctr.State.Pid); err == nil {
+			return mode, uidMappings, gidMappings
+		}
+	}
+	if pc.rootless || (hostCfg.UsernsMode != "" && hostCfg.UsernsMode != "host") {
+		return event.UsernsPrivate, []event.IDMapping{}, []event.IDMapping{}
+	}
+	return event.UsernsHost, []event.IDMapping{}, []event.IDMapping{}
+}
+
+// cgroupPath returns the cgroup path of a container, as reported by inspect for running containers.
+func (pc *podmanEngine) cgroupPath(ctr *define.InspectContainerData, hostCfg *define.InspectContainerHostConfig) string {
+	if ctr.State != nil && ctr.State.CgroupPath != "" {
+		return ctr.State.CgroupPath
+	}
+	return podmanCgroupPath(hostCfg.CgroupManager, hostCfg.CgroupParent, ctr.ID)
 }
 
 func (pc *podmanEngine) copy(ctx context.Context) (Engine, error) {
 	return newPodmanEngine(ctx, pc.socket)
 }
 
+// Close closes the idle connections of the service client; the streaming ones are closed with their context.
+func (pc *podmanEngine) Close() error {
+	if !pc.ref.release() {
+		return nil
+	}
+	conn, err := bindings.GetClient(pc.pCtx)
+	if err != nil {
+		return err
+	}
+	conn.Client.CloseIdleConnections()
+	return nil
+}
+
 func (pc *podmanEngine) ctrToInfo(ctr *define.InspectContainerData) event.Info {
 	cfg := ctr.Config
 	if cfg == nil {
@@ -70,6 +166,28 @@ func (pc *podmanEngine) ctrToInfo(ctr *define.InspectContainerData) event.Info {
 		})
 	}
 
+	networks := make([]event.Network, 0, len(netCfg.Networks))
+	for name, n := range netCfg.Networks {
+		if n == nil {
+			continue
+		}
+		addrs := ipAddresses(n.IPAddress, n.GlobalIPv6Address)
+		for _, secondary := range append(n.SecondaryIPAddresses, n.SecondaryIPv6Addresses...) {
+			addrs = append(addrs, ipAddresses(secondary.Addr)...)
+		}
+		networks = append(networks, event.Network{
+			Name:        name,
+			IPAddresses: addrs,
+			MAC:         n.MacAddress,
+		})
+	}
+	sortNetworks(networks)
+	// Containers only attached to user defined networks have no default ip
+	ip := netCfg.IPAddress
+	if ip == "" {
+		ip = firstIPAddress(networks)
+	}
+
 	portMappings := make([]event.PortMapping, 0)
 	for port, portBindings := range netCfg.Ports {
 		if !strings.Contains(port, "/tcp") {
@@ -102,6 +220,7 @@ func (pc *podmanEngine) ctrToInfo(ctr *define.InspectContainerData) event.Info {
 		imageRepo string
 		imageTag  string
 	)
+	platform := pc.imagePlatform(ctr.Image)
 	imageRepoTag := strings.Split(ctr.ImageName, ":")
 	if len(imageRepoTag) == 2 {
 		imageRepo = imageRepoTag[0]
@@ -159,10 +278,26 @@ func (pc *podmanEngine) ctrToInfo(ctr *define.InspectContainerData) event.Info {
 		size = *ctr.SizeRw
 	}
 
+	state := event.StateUnknown
+	exit := exitInfo{}
+	if ctr.State != nil {
+		state = normalizeState(ctr.State.Status)
+		if state == event.StateExited {
+			exit.code = int(ctr.State.ExitCode)
+			exit.oomKilled = ctr.State.OOMKilled
+			if !ctr.State.FinishedAt.IsZero() {
+				exit.finishedAt = ctr.State.FinishedAt.Unix()
+			}
+		}
+	}
+
+	usernsMode, uidMappings, gidMappings := pc.userns(ctr, hostCfg)
+
 	return event.Info{
 		Container: event.Container{
 			Type:             typePodman.ToCTValue(),
-			ID:               shortContainerID(ctr.ID),
+			Engine:           string(typePodman),
+			ID:               containerID(ctr.ID),
 			Name:             name,
 			Image:            ctr.ImageName,
 			ImageDigest:      ctr.ImageDigest,
@@ -180,7 +315,7 @@ func (pc *podmanEngine) ctrToInfo(ctr *define.InspectContainerData) event.Info {
 			HostIPC:          hostCfg.IpcMode == "host",
 			HostNetwork:      hostCfg.NetworkMode == "host",
 			HostPID:          hostCfg.PidMode == "host",
-			Ip:               netCfg.IPAddress,
+			Ip:               ip,
 			IsPodSandbox:     isPodSandbox,
 			Labels:           labels,
 			MemoryLimit:      hostCfg.Memory,
@@ -192,10 +327,58 @@ func (pc *podmanEngine) ctrToInfo(ctr *define.InspectContainerData) event.Info {
 			LivenessProbe:    livenessProbe,
 			ReadinessProbe:   readinessProbe,
 			HealthcheckProbe: healthcheckProbe,
+			State:            state,
+			ExitCode:         exit.code,
+			OOMKilled:        exit.oomKilled,
+			FinishedAt:       exit.finishedAt,
+			Networks:         networks,
+			UsernsMode:       usernsMode,
+			UIDMappings:      uidMappings,
+			GIDMappings:      gidMappings,
+			Entrypoint:       argv(cfg.Entrypoint),
+			Cmd:              argv(cfg.Cmd),
+			CgroupPath:       pc.cgroupPath(ctr, hostCfg),
+			CgroupsVersion:   pc.cgroupsVersion,
+			NetworkAliases:   []string{},
+			// Podman references the joined container by ID
+			SharedNamespaceTarget: containerID(sharedNamespaceTarget(hostCfg.NetworkMode, hostCfg.PidMode)),
+			Devices:               devices(append(podmanDevices(hostCfg), runtimeDevices(cfg.Env, cfg.Annotations)...)...),
+			Runtime:               normalizeRuntime(ctr.OCIRuntime),
+			RuntimeRaw:            ctr.OCIRuntime,
+			ImageOS:               platform.os,
+			ImageArchitecture:     platform.architecture,
+			HostArchitecture:      hostArchitecture(),
 		},
 	}
 }
 
+// imagePlatform returns the platform of the local image, the one selected from a manifest list when pulled;
+// podman does not report its variant.
+func (pc *podmanEngine) imagePlatform(imageID string) imagePlatform {
+	if imageID == "" {
+		return imagePlatform{}
+	}
+	return pc.imagePlatforms.get(imageID, func() (imagePlatform, error) {
+		img, err := images.GetImage(pc.pCtx, imageID, nil)
+		if err != nil {
+			return imagePlatform{}, err
+		}
+		if img.ImageData == nil {
+			return imagePlatform{}, nil
+		}
+		return imagePlatform{os: img.Os, architecture: img.Architecture}, nil
+	})
+}
+
+// podmanDevices returns the host devices mapped into the container.
+func podmanDevices(hostCfg *define.InspectContainerHostConfig) []string {
+	res := make([]string, 0, len(hostCfg.Devices))
+	for _, d := range hostCfg.Devices {
+		res = append(res, d.PathOnHost)
+	}
+	return res
+}
+
 func (pc *podmanEngine) get(_ context.Context, containerId string) (*event.Event, error) {
 	size := config.GetWithSize()
 	ctrInfo, err := containers.Inspect(pc.pCtx, containerId, &containers.InspectOptions{Size: &size})
@@ -209,6 +392,18 @@ func (pc *podmanEngine) get(_ context.Context, containerId string) (*event.Event
 	}, nil
 }
 
+// apiVersion returns the API version of the podman service.
+func (pc *podmanEngine) apiVersion(_ context.Context) (string, error) {
+	report, err := system.Version(pc.pCtx, nil)
+	if err != nil {
+		return "", err
+	}
+	if report.Server == nil {
+		return "", nil
+	}
+	return report.Server.APIVersion, nil
+}
+
 func (pc *podmanEngine) Name() string {
 	return string(typePodman)
 }
@@ -226,17 +421,22 @@ func (pc *podmanEngine) List(_ context.Context) ([]event.Event, error) {
 		return nil, err
 	}
 	for _, c := range cList {
+		if !emitsListed(typePodman, normalizeState(c.State)) {
+			continue
+		}
 		ctrInfo, err := containers.Inspect(pc.pCtx, c.ID, &containers.InspectOptions{Size: &size})
 		if err != nil {
 			evts = append(evts, event.Event{
 				Info: event.Info{
 					Container: event.Container{
 						Type:        typePodman.ToCTValue(),
-						ID:          shortContainerID(c.ID),
+						Engine:      string(typePodman),
+						ID:          containerID(c.ID),
 						Image:       c.Image,
 						FullID:      c.ID,
 						ImageID:     c.ImageID,
 						CreatedTime: c.Created.Unix(),
+						State:       normalizeState(c.State),
 					},
 				},
 				IsCreate: true,
@@ -249,7 +449,14 @@ func (pc *podmanEngine) List(_ context.Context) ([]event.Event, error) {
 		}
 
 	}
-	return evts, nil
+	return pc.filterInfra(evts), nil
+}
+
+func podmanActionToState(action events.Action) string {
+	if action == podmanActionDied {
+		return event.StateExited
+	}
+	return actionToState(action)
 }
 
 // Set up container created event listener by call to system.Events
@@ -261,12 +468,16 @@ func (pc *podmanEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan
 		"type":  {string(events.ContainerEventType)},
 		"event": make([]string, 0),
 	}
-	if config.IsHookEnabled(config.HookCreate) {
+	if emitsOnCreate(typePodman) {
 		filters["event"] = append(filters["event"], string(events.ActionCreate))
 	}
-	if config.IsHookEnabled(config.HookStart) {
+	// Containers run, and get their networks attached, on start: without the start hook,
+	// it is still needed to update create events with the running state.
+	if emit, _ := emitsOnStart(typePodman); emit || config.IsHookEnabled(config.HookCreate) {
 		filters["event"] = append(filters["event"], string(events.ActionStart))
 	}
+	// Always needed to track exit details for the remove event.
+	filters["event"] = append(filters["event"], string(podmanActionDied))
 	filters["event"] = append(filters["event"], string(events.ActionRemove))
 
 	evChn := make(chan types.Event)
@@ -280,14 +491,13 @@ func (pc *podmanEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan
 	}
 
 	outCh := make(chan event.Event)
-	wg.Add(1)
-	go func() {
+	GoListener(wg, pc, func() {
 		defer func() {
-			wg.Done()
 			close(cancelChan)
 			close(outCh)
 		}()
 		size := config.GetWithSize()
+		exits := make(exitInfos)
 		// Blocking: convert all events from podman to json strings
 		// and send them to the main loop until the channel is closed
 		for {
@@ -302,40 +512,57 @@ func (pc *podmanEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan
 					return
 				}
 				var (
-					ctr *define.InspectContainerData
-					err error
+					info      event.Info
+					inspected bool
 				)
 				switch ev.Action {
+				case podmanActionDied:
+					code, convErr := strconv.Atoi(ev.Actor.Attributes["containerExitCode"])
+					if convErr != nil {
+						code = -1
+					}
+					exits.store(ev.Actor.ID, exitInfo{code: code, finishedAt: ev.Time})
+					if !config.IsHookEnabled(config.HookExit) {
+						continue
+					}
+					fallthrough
 				case events.ActionCreate, events.ActionStart:
-					ctr, err = containers.Inspect(pc.pCtx, ev.Actor.ID, &containers.InspectOptions{Size: &size})
-					if err == nil {
+					info, inspected = pc.inspectEvent(ctx, ev, size)
+					if inspected {
+						if ev.Action == events.ActionStart {
+							// Without emitting on start, still an update of the create event: the container runs
+							_, info.Update = emitsOnStart(typePodman)
+						}
 						outCh <- event.Event{
-							Info:     pc.ctrToInfo(ctr),
+							Info:     info,
 							IsCreate: true,
 						}
+						continue
 					}
 				case events.ActionRemove:
-					err = errors.New("inspect useless on action destroy")
+					// Inspect useless on action destroy
+					info = podmanMinimalInfo(ev)
+				default:
+					continue
 				}
 
 				// This is called for ActionRemove
-				// AND as a fallback whenever Inspect fails.
-				if err != nil {
-					// At least send an event with the minimal set of data
-					outCh <- event.Event{
-						Info: event.Info{
-							Container: event.Container{
-								Type:   typePodman.ToCTValue(),
-								ID:     shortContainerID(ev.Actor.ID),
-								FullID: ev.Actor.ID,
-								Image:  ev.Actor.Attributes["image"],
-							},
-						},
-						IsCreate: ev.Action != events.ActionRemove,
-					}
+				// AND as a fallback whenever Inspect fails:
+				// at least send an event with the minimal set of data
+				switch ev.Action {
+				case events.ActionStart:
+					_, info.Update = emitsOnStart(typePodman)
+				case podmanActionDied:
+					exits[ev.Actor.ID].apply(&info.Container)
+				case events.ActionRemove:
+					exits.take(ev.Actor.ID).apply(&info.Container)
+				}
+				outCh <- event.Event{
+					Info:     info,
+					IsCreate: ev.Action != events.ActionRemove,
 				}
 			}
 		}
-	}()
-	return outCh, nil
+	})
+	return pc.forwardInfra(ctx, wg, pc, outCh), nil
 }
@@ -1,4 +1,4 @@
-//go:build linux
+//go:build linux && !no_podman
 
 package container
 
@@ -6,6 +6,7 @@ import (
 	"context"
 	"fmt"
 	"github.com/containers/image/v5/manifest"
+	"github.com/containers/podman/v5/libpod/define"
 	"github.com/containers/podman/v5/pkg/bindings"
 	"github.com/containers/podman/v5/pkg/bindings/containers"
 	"github.com/containers/podman/v5/pkg/bindings/images"
@@ -20,16 +21,6 @@ import (
 	"time"
 )
 
-func waitOnChannelOrTimeout(t *testing.T, ch <-chan event.Event) event.Event {
-	select {
-	case ret := <-ch:
-		return ret
-	case <-time.After(5 * time.Second):
-		t.Error("timed out waiting for channel")
-	}
-	return event.Event{}
-}
-
 func testPodman(t *testing.T, withFetcher bool) {
 	usr, err := user.Current()
 	assert.NoError(t, err)
@@ -93,25 +84,42 @@ func testPodman(t *testing.T, withFetcher bool) {
 	expectedEvent := event.Event{
 		Info: event.Info{
 			Container: event.Container{
-				Type:           typePodman.ToCTValue(),
-				ID:             shortContainerID(ctr.ID),
-				Name:           "test_container",
-				Image:          "docker.io/library/alpine:3.20.3",
-				ImageDigest:    "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
-				ImageID:        imageId,
-				ImageRepo:      "docker.io/library/alpine",
-				ImageTag:       "3.20.3",
-				User:           "testuser",
-				CPUPeriod:      defaultCpuPeriod,
-				CPUQuota:       2000,
-				CPUShares:      defaultCpuShares,
-				CPUSetCPUCount: 2, // 0-1
-				FullID:         ctr.ID,
-				Labels:         map[string]string{"foo": "bar"},
-				Privileged:     true,
-				Mounts:         []event.Mount{},
-				PortMappings:   []event.PortMapping{},
-				Size:           -1,
+				Type:              typePodman.ToCTValue(),
+				Engine:            string(typePodman),
+				ID:                shortContainerID(ctr.ID),
+				Name:              "test_container",
+				Image:             "docker.io/library/alpine:3.20.3",
+				ImageDigest:       "sha256:1e42bbe2508154c9126d48c2b8a75420c3544343bf86fd041fb7527e017a4b4a",
+				ImageID:           imageId,
+				ImageRepo:         "docker.io/library/alpine",
+				ImageTag:          "3.20.3",
+				User:              "testuser",
+				CPUPeriod:         defaultCpuPeriod,
+				CPUQuota:          2000,
+				CPUShares:         defaultCpuShares,
+				CPUSetCPUCount:    2, // 0-1
+				FullID:            ctr.ID,
+				Labels:            map[string]string{"foo": "bar"},
+				Privileged:        true,
+				Mounts:            []event.Mount{},
+				PortMappings:      []event.PortMapping{},
+				Size:              -1,
+				State:             event.StateCreated,
+				Networks:          []event.Network{{Name: "podman", IPAddresses: []string{}}},
+				UsernsMode:        event.UsernsHost,
+				UIDMappings:       []event.IDMapping{},
+				GIDMappings:       []event.IDMapping{},
+				Entrypoint:        []string{},
+				Cmd:               []string{"/bin/sh"},
+				CgroupPath:        "/machine.slice/libpod-" + ctr.ID + ".scope",
+				CgroupsVersion:    engine.(*podmanEngine).cgroupsVersion,
+				NetworkAliases:    []string{},
+				Devices:           []string{},
+				Runtime:           event.RuntimeCrun,
+				RuntimeRaw:        "crun",
+				ImageOS:           "linux",
+				ImageArchitecture: runtime.GOARCH,
+				HostArchitecture:  hostArchitecture(),
 				HealthcheckProbe: &event.Probe{
 					Exe:  "/bin/sh",
 					Args: []string{"-c", "echo hello world"},
@@ -161,10 +169,13 @@ func testPodman(t *testing.T, withFetcher bool) {
 	expectedEvent = event.Event{
 		Info: event.Info{
 			Container: event.Container{
-				Type:   typePodman.ToCTValue(),
-				ID:     shortContainerID(ctr.ID),
-				FullID: ctr.ID,
-				Image:  "docker.io/library/alpine:3.20.3",
+				Type:     typePodman.ToCTValue(),
+				Engine:   string(typePodman),
+				ID:       shortContainerID(ctr.ID),
+				FullID:   ctr.ID,
+				Image:    "docker.io/library/alpine:3.20.3",
+				State:    event.StateRemoved,
+				ExitCode: -1,
 			}},
 		IsCreate: false,
 	}
@@ -175,3 +186,19 @@ func testPodman(t *testing.T, withFetcher bool) {
 func TestPodman(t *testing.T) {
 	testPodman(t, false)
 }
+
+func TestPodmanFetcher(t *testing.T) {
+	testPodman(t, true)
+}
+
+func TestPodmanEventSchema(t *testing.T) {
+	podman := &podmanEngine{}
+	assertMatchesSchema(t, event.Event{Info: podman.ctrToInfo(&define.InspectContainerData{
+		ID:        "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+		Name:      "sharp_poincare",
+		ImageName: "fedora:38",
+		Config: &define.InspectContainerConfig{
+			Labels: map[string]string{"foo": "bar"},
+		},
+	}), IsCreate: true})
+}
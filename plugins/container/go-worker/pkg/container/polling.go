@@ -0,0 +1,152 @@
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"sort"
+	"time"
+)
+
+// listRetryMaxBackoff caps the wait between the listings of an engine failing to list its containers,
+// eg: while its daemon is down.
+const listRetryMaxBackoff = time.Minute
+
+// listFunc lists the existing containers, as create events; Engine.List is one.
+type listFunc func(ctx context.Context) ([]event.Event, error)
+
+// change is the transition of a container between two listings: prev is nil for a new container,
+// and cur for a container gone; both are set for a container whose state changed.
+type change struct {
+	prev *event.Event
+	cur  *event.Event
+}
+
+// changeFunc sends the events explaining a change to outCh, returning false once ctx is done.
+type changeFunc func(ctx context.Context, c change, outCh chan<- event.Event) bool
+
+// pollingListener emulates an events stream for engines not providing one,
+// diffing periodic container listings against the previous one:
+// engines only have to supply their list function and, optionally,
+// how to turn the changes into events, eg: docker building them from its actions.
+type pollingListener struct {
+	engine   Engine
+	list     listFunc
+	onChange changeFunc
+	interval time.Duration
+}
+
+// newPollingListener returns a pollingListener listing every `poll_interval_ms` configured
+// for the engine type; with a nil onChange, the changes are sent by sendChange.
+func newPollingListener(engine Engine, t engineType, list listFunc, onChange changeFunc) *pollingListener {
+	if onChange == nil {
+		onChange = sendChange
+	}
+	return &pollingListener{
+		engine:   engine,
+		list:     list,
+		onChange: onChange,
+		interval: config.GetPollInterval(string(t)),
+	}
+}
+
+// poll sends the events of the changes found listing every interval, until ctx is done.
+// The first successful listing only initializes the known containers, since the pre-existing ones
+// are already reported by List(). Failed listings, like while the daemon is down, are retried
+// with backoff, from interval up to listRetryMaxBackoff. When resume is set, it returns true
+// as soon as a listing succeeds after failing, for the events stream to be listened on again.
+func (p *pollingListener) poll(ctx context.Context, outCh chan<- event.Event, resume bool) bool {
+	r := newRetrier(p.engine.Name(), p.engine.Sock(), "listing containers", p.interval, max(p.interval, listRetryMaxBackoff))
+	timer := time.NewTimer(p.interval)
+	defer timer.Stop()
+	var known map[string]event.Event
+	for {
+		wait := p.interval
+		evts, err := p.list(ctx)
+		if err != nil {
+			if ctx.Err() != nil {
+				return false
+			}
+			wait = r.fail(err)
+		} else {
+			recovered := r.succeed()
+			changes, next := diffSnapshots(known, evts)
+			if known != nil {
+				for _, c := range changes {
+					if !p.onChange(ctx, c, outCh) {
+						return false
+					}
+				}
+			}
+			known = next
+			if recovered && resume {
+				return true
+			}
+		}
+		timer.Reset(wait)
+		select {
+		case <-ctx.Done():
+			return false
+		case <-timer.C:
+		}
+	}
+}
+
+// sendChange sends a create event for a new container, and a destroy one, carrying its last known
+// metadata, for a container gone; state changes are not reported.
+func sendChange(ctx context.Context, c change, outCh chan<- event.Event) bool {
+	var evt event.Event
+	switch {
+	case c.prev == nil:
+		evt = *c.cur
+		evt.IsCreate = true
+	case c.cur == nil:
+		evt = *c.prev
+		evt.IsCreate = false
+		evt.Update = false
+		evt.State = event.StateRemoved
+	default:
+		return true
+	}
+	select {
+	case outCh <- evt:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// diffSnapshots returns the changes explaining the transition from the known containers,
+// by full ID, to the listed ones, along with the new known ones. Changes are sorted by container full ID.
+func diffSnapshots(known map[string]event.Event, list []event.Event) ([]change, map[string]event.Event) {
+	changes := make([]change, 0)
+	next := make(map[string]event.Event, len(list))
+	for i := range list {
+		cur := &list[i]
+		next[cur.FullID] = *cur
+		prev, ok := known[cur.FullID]
+		switch {
+		case !ok:
+			changes = append(changes, change{cur: cur})
+		case prev.State != cur.State:
+			changes = append(changes, change{prev: &prev, cur: cur})
+		}
+	}
+	for id := range known {
+		if _, ok := next[id]; !ok {
+			prev := known[id]
+			changes = append(changes, change{prev: &prev})
+		}
+	}
+	sort.SliceStable(changes, func(i, j int) bool {
+		return changeID(changes[i]) < changeID(changes[j])
+	})
+	return changes, next
+}
+
+func changeID(c change) string {
+	if c.cur != nil {
+		return c.cur.FullID
+	}
+	return c.prev.FullID
+}
@@ -0,0 +1,203 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func polledEvent(id string, isCreate bool, state string) event.Event {
+	return event.Event{
+		Info: event.Info{
+			Container: event.Container{
+				ID:     id,
+				FullID: id,
+				Image:  "alpine",
+				State:  state,
+			},
+		},
+		IsCreate: isCreate,
+	}
+}
+
+func TestDiffSnapshots(t *testing.T) {
+	ptr := func(evt event.Event) *event.Event {
+		return &evt
+	}
+	tCases := map[string]struct {
+		known           map[string]event.Event
+		list            []event.Event
+		expectedChanges []change
+		expectedKnown   []string
+	}{
+		"First listing": {
+			known: nil,
+			list:  []event.Event{polledEvent("b", true, event.StateRunning), polledEvent("a", true, event.StateCreated)},
+			expectedChanges: []change{
+				{cur: ptr(polledEvent("a", true, event.StateCreated))},
+				{cur: ptr(polledEvent("b", true, event.StateRunning))},
+			},
+			expectedKnown: []string{"a", "b"},
+		},
+		"Nothing changed": {
+			known:           map[string]event.Event{"a": polledEvent("a", true, event.StateRunning)},
+			list:            []event.Event{polledEvent("a", true, event.StateRunning)},
+			expectedChanges: []change{},
+			expectedKnown:   []string{"a"},
+		},
+		"State changed": {
+			known: map[string]event.Event{"a": polledEvent("a", true, event.StateCreated)},
+			list:  []event.Event{polledEvent("a", true, event.StateRunning)},
+			expectedChanges: []change{
+				{prev: ptr(polledEvent("a", true, event.StateCreated)), cur: ptr(polledEvent("a", true, event.StateRunning))},
+			},
+			expectedKnown: []string{"a"},
+		},
+		"Container gone": {
+			known:           map[string]event.Event{"a": polledEvent("a", true, event.StateRunning)},
+			list:            []event.Event{},
+			expectedChanges: []change{{prev: ptr(polledEvent("a", true, event.StateRunning))}},
+			expectedKnown:   []string{},
+		},
+		"Container replaced": {
+			known: map[string]event.Event{"b": polledEvent("b", true, event.StateRunning)},
+			list:  []event.Event{polledEvent("a", false, event.StateCreated)},
+			expectedChanges: []change{
+				{cur: ptr(polledEvent("a", false, event.StateCreated))},
+				{prev: ptr(polledEvent("b", true, event.StateRunning))},
+			},
+			expectedKnown: []string{"a"},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			changes, next := diffSnapshots(tc.known, tc.list)
+			assert.Equal(t, tc.expectedChanges, changes)
+			ids := make([]string, 0, len(next))
+			for id := range next {
+				ids = append(ids, id)
+			}
+			assert.ElementsMatch(t, tc.expectedKnown, ids)
+		})
+	}
+}
+
+func TestSendChange(t *testing.T) {
+	tCases := map[string]struct {
+		change       change
+		expectedEvts []event.Event
+	}{
+		"New container": {
+			change:       change{cur: &event.Event{Info: polledEvent("a", false, event.StateCreated).Info}},
+			expectedEvts: []event.Event{polledEvent("a", true, event.StateCreated)},
+		},
+		"State changes are not reported": {
+			change: change{
+				prev: &event.Event{Info: polledEvent("a", true, event.StateCreated).Info},
+				cur:  &event.Event{Info: polledEvent("a", true, event.StateRunning).Info},
+			},
+			expectedEvts: []event.Event{},
+		},
+		"Container gone": {
+			change:       change{prev: &event.Event{Info: event.Info{Container: polledEvent("a", true, event.StateRunning).Container, Update: true}}},
+			expectedEvts: []event.Event{polledEvent("a", false, event.StateRemoved)},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			outCh := make(chan event.Event, 1)
+			assert.True(t, sendChange(context.Background(), tc.change, outCh))
+			close(outCh)
+			evts := make([]event.Event, 0)
+			for evt := range outCh {
+				evts = append(evts, evt)
+			}
+			assert.Equal(t, tc.expectedEvts, evts)
+		})
+	}
+}
+
+func TestPollingListener(t *testing.T) {
+	require.NoError(t, config.Load(`{"engines":{"fake":{"poll_interval_ms":10}}}`))
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"fake":{"poll_interval_ms":0}}}`)
+		ResetStatus()
+	})
+	setState("fake", "/run/fake.sock", EngineRunning, nil)
+
+	var (
+		mu      sync.Mutex
+		listed  = []event.Event{polledEvent("a", true, event.StateRunning)}
+		listErr error
+	)
+	list := func(_ context.Context) ([]event.Event, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]event.Event{}, listed...), listErr
+	}
+	setListed := func(evts []event.Event, err error) {
+		mu.Lock()
+		defer mu.Unlock()
+		listed = evts
+		listErr = err
+	}
+
+	p := newPollingListener(&fakeEngine{socket: "/run/fake.sock"}, "fake", list, nil)
+	assert.Equal(t, 10*time.Millisecond, p.interval)
+
+	cancelCtx, cancel := context.WithCancel(context.Background())
+	listCh := make(chan event.Event)
+	polled := make(chan bool)
+	go func() {
+		polled <- p.poll(cancelCtx, listCh, false)
+	}()
+
+	// The first listing only records the pre-existing containers
+	time.Sleep(30 * time.Millisecond)
+	// Failing listings are retried with backoff
+	setListed(nil, errors.New("connection refused"))
+	require.Eventually(t, func() bool {
+		st := Status()
+		return len(st) == 1 && st[0].Retries > 0 && st[0].BackoffMs > 0
+	}, 5*time.Second, 5*time.Millisecond)
+	setListed([]event.Event{polledEvent("b", true, event.StateCreated)}, nil)
+	assert.Equal(t, polledEvent("a", false, event.StateRemoved), waitOnChannelOrTimeout(t, listCh))
+	assert.Equal(t, polledEvent("b", true, event.StateCreated), waitOnChannelOrTimeout(t, listCh))
+	st := Status()
+	require.Len(t, st, 1)
+	assert.Zero(t, st[0].Retries)
+	assert.Zero(t, st[0].BackoffMs)
+	assert.Equal(t, uint64(1), st[0].Reconnects)
+
+	cancel()
+	assert.False(t, <-polled)
+}
+
+func TestPollingListenerResume(t *testing.T) {
+	require.NoError(t, config.Load(`{"engines":{"fake":{"poll_interval_ms":10}}}`))
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"fake":{"poll_interval_ms":0}}}`)
+		ResetStatus()
+	})
+
+	var listings atomic.Int32
+	list := func(_ context.Context) ([]event.Event, error) {
+		// Down for the first listings
+		if listings.Add(1) <= 2 {
+			return nil, errors.New("connection refused")
+		}
+		return []event.Event{polledEvent("a", true, event.StateRunning)}, nil
+	}
+	p := newPollingListener(&fakeEngine{socket: "/run/fake.sock"}, "fake", list, nil)
+	assert.True(t, p.poll(context.Background(), make(chan event.Event), true))
+	assert.Equal(t, int32(3), listings.Load())
+}
@@ -0,0 +1,38 @@
+package container
+
+import (
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"runtime"
+	"runtime/debug"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// buildTags returns the build tags the test binary got built with.
+func buildTags(t *testing.T) []string {
+	info, ok := debug.ReadBuildInfo()
+	require.True(t, ok)
+	for _, s := range info.Settings {
+		if s.Key == "-tags" {
+			return strings.Split(s.Value, ",")
+		}
+	}
+	return nil
+}
+
+// TestRegistry checks that the registry holds exactly the engines not excluded by their `no_<engine>` tag;
+// run `make test-tags` to exercise it with each engine excluded.
+func TestRegistry(t *testing.T) {
+	tags := buildTags(t)
+	for _, engine := range goEngines {
+		expected := !slices.Contains(tags, "no_"+string(engine))
+		if engine == typePodman && runtime.GOOS != "linux" {
+			expected = false
+		}
+		assert.Equal(t, expected, slices.Contains(Registered(), string(engine)), "engine %s", engine)
+	}
+	_, ok := remoteEngineGenerators[typeCri]
+	assert.Equal(t, !slices.Contains(tags, "no_cri"), ok)
+}
@@ -0,0 +1,223 @@
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"slices"
+	"sync"
+	"time"
+)
+
+const (
+	// maxReinspects bounds the containers waiting to be inspected again.
+	maxReinspects = 1024
+	// reinspectBackoff is the delay before the first re-inspection, doubled before each following one.
+	reinspectBackoff = 250 * time.Millisecond
+)
+
+// Reinspecter is implemented by engines inspecting again the containers reported with incomplete metadata,
+// like the reinspector, to be notified of the events delivered by the other engines.
+type Reinspecter interface {
+	Reinspect(evt event.Event)
+}
+
+// pendingReinspect is a container waiting to be inspected again.
+type pendingReinspect struct {
+	evt     event.Event
+	attempt int
+	due     time.Time
+}
+
+/*
+Reinspector is a fake engine, like the fetcher, inspecting again the containers whose create event
+missed any of the `reinspect_fields`, eg: an IP address not assigned yet, since the inspection happened
+before the runtime finished setting the container up, or that got reported incomplete, as not inspected
+within `event_deadline_ms`, or partial, as their inspection failed.
+Up to `reinspect_retries` inspections are made, doubling the delay between them, and an update event
+is sent as soon as one fills in any missing field.
+Containers are inspected one at a time, and at most maxReinspects of them wait, to keep the cost bounded;
+their removal cancels their re-inspection.
+*/
+type reinspector struct {
+	*engineGetters
+	fields  []string
+	retries int
+
+	mu      sync.Mutex
+	pending map[string]*pendingReinspect
+	// Signaled when a new container is pending.
+	wake chan struct{}
+}
+
+// NewReinspectEngine returns a reinspector engine, trying all container engines enabled.
+func NewReinspectEngine(_ context.Context, containerEngines []Engine) Engine {
+	return &reinspector{
+		engineGetters: newEngineGetters(containerEngines),
+		fields:        config.GetReinspectFields(),
+		retries:       config.GetReinspectRetries(),
+		pending:       make(map[string]*pendingReinspect),
+		wake:          make(chan struct{}, 1),
+	}
+}
+
+func (r *reinspector) Name() string {
+	return ""
+}
+
+func (r *reinspector) Sock() string {
+	return ""
+}
+
+func (r *reinspector) List(_ context.Context) ([]event.Event, error) {
+	panic("do not call")
+}
+
+// Reinspect schedules the re-inspection of the container of a create event missing any of the fields,
+// or degraded, or cancels it on remove. Later events of a pending container replace its known metadata.
+// It never blocks.
+func (r *reinspector) Reinspect(evt event.Event) {
+	key := evt.ID
+	if r.retries <= 0 || key == "" {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	p, ok := r.pending[key]
+	if !evt.IsCreate || (!evt.Degraded() && len(evt.EmptyFields(r.fields)) == 0) {
+		delete(r.pending, key)
+		return
+	}
+	if ok {
+		p.evt = evt
+		return
+	}
+	if len(r.pending) >= maxReinspects {
+		logger.Debugf("too many containers waiting to be inspected again, skipping container %s", key)
+		return
+	}
+	r.pending[key] = &pendingReinspect{evt: evt, due: time.Now().Add(reinspectBackoff)}
+	select {
+	case r.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Listen sends the update events of the containers whose re-inspection filled in any missing field.
+func (r *reinspector) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
+	outCh := make(chan event.Event)
+	GoListener(wg, r, func() {
+		defer close(outCh)
+		timer := time.NewTimer(time.Hour)
+		defer timer.Stop()
+		for {
+			if due, ok := r.next(); ok {
+				timer.Reset(time.Until(due))
+			} else {
+				timer.Stop()
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-r.wake:
+				continue
+			case <-timer.C:
+			}
+			for _, key := range r.due(time.Now()) {
+				evt, ok := r.inspect(key)
+				if !ok {
+					continue
+				}
+				select {
+				case outCh <- evt:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	})
+	return outCh, nil
+}
+
+// next returns when the first pending container is due, if any.
+func (r *reinspector) next() (time.Time, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	var (
+		first time.Time
+		found bool
+	)
+	for _, p := range r.pending {
+		if !found || p.due.Before(first) {
+			first = p.due
+			found = true
+		}
+	}
+	return first, found
+}
+
+// due returns the pending containers to be inspected by now.
+func (r *reinspector) due(now time.Time) []string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	keys := make([]string, 0)
+	for key, p := range r.pending {
+		if !now.Before(p.due) {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// inspect inspects a pending container again, rescheduling it while fields are missing, or it is incomplete,
+// and retries are left, and returns its update event, if it got complete or any missing field got filled in.
+func (r *reinspector) inspect(key string) (event.Event, bool) {
+	r.mu.Lock()
+	p, ok := r.pending[key]
+	if !ok {
+		r.mu.Unlock()
+		return event.Event{}, false
+	}
+	id := p.evt.FullID
+	if id == "" {
+		id = p.evt.ID
+	}
+	r.mu.Unlock()
+
+	fresh := r.lookup(id)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.pending[key] != p {
+		// Removed meanwhile
+		return event.Event{}, false
+	}
+	p.attempt++
+	missing := p.evt.EmptyFields(r.fields)
+	filled := false
+	if fresh != nil {
+		filled = p.evt.Degraded() && !fresh.Degraded()
+		still := fresh.EmptyFields(r.fields)
+		for _, field := range missing {
+			filled = filled || !slices.Contains(still, field)
+		}
+		if filled {
+			p.evt = *fresh
+			missing = still
+		}
+	}
+	if (len(missing) == 0 && !p.evt.Degraded()) || p.attempt >= r.retries {
+		delete(r.pending, key)
+	} else {
+		p.due = time.Now().Add(reinspectBackoff << p.attempt)
+	}
+	if !filled {
+		return event.Event{}, false
+	}
+	logger.Debugf("container %s inspected again, sending its update", key)
+	evt := *fresh
+	evt.IsCreate = true
+	evt.Update = true
+	return evt, true
+}
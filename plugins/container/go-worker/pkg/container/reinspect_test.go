@@ -0,0 +1,214 @@
+package container
+
+import (
+	"context"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+	"time"
+)
+
+// inspectEngine answers each get with the next of its events, repeating the last one.
+type inspectEngine struct {
+	mu    sync.Mutex
+	evts  []event.Event
+	calls int
+}
+
+func (e *inspectEngine) Name() string {
+	return "inspect"
+}
+
+func (e *inspectEngine) Sock() string {
+	return "/run/inspect.sock"
+}
+
+func (e *inspectEngine) List(_ context.Context) ([]event.Event, error) {
+	return nil, nil
+}
+
+func (e *inspectEngine) Listen(_ context.Context, _ *sync.WaitGroup) (<-chan event.Event, error) {
+	return make(chan event.Event), nil
+}
+
+func (e *inspectEngine) copy(_ context.Context) (Engine, error) {
+	return e, nil
+}
+
+func (e *inspectEngine) get(_ context.Context, _ string) (*event.Event, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	evt := e.evts[min(e.calls, len(e.evts)-1)]
+	e.calls++
+	return &evt, nil
+}
+
+func (e *inspectEngine) getCalls() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.calls
+}
+
+func reinspectEvent(id, ip, digest string) event.Event {
+	return event.Event{
+		IsCreate: true,
+		Info: event.Info{Container: event.Container{
+			ID:          id,
+			FullID:      id + "d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+			Ip:          ip,
+			ImageDigest: digest,
+		}},
+	}
+}
+
+func TestReinspect(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"reinspect_retries":3,"reinspect_fields":["ip","imagedigest"]}`)
+	})
+	const digest = "sha256:b9ff6f23cceb5bde20bb1f79b492b98d71ef7a7ae518ca1b15b26661a11e6a94"
+	tCases := map[string]struct {
+		cfg           string
+		created       event.Event
+		inspected     []event.Event
+		removed       bool
+		expectedCalls int
+		expectedEvt   *event.Event
+	}{
+		"Filled on second retry": {
+			cfg:     `{"reinspect_retries":3,"reinspect_fields":["ip","imagedigest"]}`,
+			created: reinspectEvent("2400edb296c5", "", digest),
+			inspected: []event.Event{
+				reinspectEvent("2400edb296c5", "", digest),
+				reinspectEvent("2400edb296c5", "10.88.0.5", digest),
+			},
+			expectedCalls: 2,
+			expectedEvt: func() *event.Event {
+				evt := reinspectEvent("2400edb296c5", "10.88.0.5", digest)
+				evt.Update = true
+				return &evt
+			}(),
+		},
+		"Incomplete": {
+			cfg: `{"reinspect_retries":3,"reinspect_fields":["ip"]}`,
+			created: func() event.Event {
+				evt := reinspectEvent("2400edb296c5", "10.88.0.5", "")
+				evt.Incomplete = true
+				return evt
+			}(),
+			inspected:     []event.Event{reinspectEvent("2400edb296c5", "10.88.0.5", digest)},
+			expectedCalls: 1,
+			expectedEvt: func() *event.Event {
+				evt := reinspectEvent("2400edb296c5", "10.88.0.5", digest)
+				evt.Update = true
+				return &evt
+			}(),
+		},
+		"Partial": {
+			cfg: `{"reinspect_retries":3,"reinspect_fields":["ip"]}`,
+			created: func() event.Event {
+				evt := reinspectEvent("2400edb296c5", "", "")
+				evt.Partial = true
+				return evt
+			}(),
+			inspected:     []event.Event{reinspectEvent("2400edb296c5", "10.88.0.5", digest)},
+			expectedCalls: 1,
+			expectedEvt: func() *event.Event {
+				evt := reinspectEvent("2400edb296c5", "10.88.0.5", digest)
+				evt.Update = true
+				return &evt
+			}(),
+		},
+		"Never filled": {
+			cfg:           `{"reinspect_retries":2,"reinspect_fields":["ip","imagedigest"]}`,
+			created:       reinspectEvent("2400edb296c5", "", digest),
+			inspected:     []event.Event{reinspectEvent("2400edb296c5", "", digest)},
+			expectedCalls: 2,
+		},
+		"Complete": {
+			cfg:       `{"reinspect_retries":3,"reinspect_fields":["ip","imagedigest"]}`,
+			created:   reinspectEvent("2400edb296c5", "10.88.0.5", digest),
+			inspected: []event.Event{reinspectEvent("2400edb296c5", "10.88.0.5", digest)},
+		},
+		"Not a configured field": {
+			cfg:       `{"reinspect_retries":3,"reinspect_fields":["ip"]}`,
+			created:   reinspectEvent("2400edb296c5", "10.88.0.5", ""),
+			inspected: []event.Event{reinspectEvent("2400edb296c5", "10.88.0.5", digest)},
+		},
+		"Disabled": {
+			cfg:       `{"reinspect_retries":0,"reinspect_fields":["ip","imagedigest"]}`,
+			created:   reinspectEvent("2400edb296c5", "", digest),
+			inspected: []event.Event{reinspectEvent("2400edb296c5", "10.88.0.5", digest)},
+		},
+		"Removed meanwhile": {
+			cfg:       `{"reinspect_retries":3,"reinspect_fields":["ip","imagedigest"]}`,
+			created:   reinspectEvent("2400edb296c5", "", digest),
+			inspected: []event.Event{reinspectEvent("2400edb296c5", "10.88.0.5", digest)},
+			removed:   true,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, config.Load(tc.cfg))
+			engine := &inspectEngine{evts: tc.inspected}
+			r := NewReinspectEngine(context.Background(), []Engine{engine})
+
+			ctx, cancel := context.WithCancel(context.Background())
+			wg := sync.WaitGroup{}
+			t.Cleanup(func() {
+				cancel()
+				wg.Wait()
+			})
+			ch, err := r.Listen(ctx, &wg)
+			require.NoError(t, err)
+
+			r.(Reinspecter).Reinspect(tc.created)
+			if tc.removed {
+				removed := tc.created
+				removed.IsCreate = false
+				r.(Reinspecter).Reinspect(removed)
+			}
+
+			// Long enough for the first two retries
+			select {
+			case evt := <-ch:
+				require.NotNil(t, tc.expectedEvt, "unexpected event")
+				assert.Equal(t, *tc.expectedEvt, evt)
+			case <-time.After(4 * reinspectBackoff):
+				assert.Nil(t, tc.expectedEvt, "missing event")
+			}
+			assert.Equal(t, tc.expectedCalls, engine.getCalls())
+			// Done with the container
+			_, pending := r.(*reinspector).next()
+			assert.False(t, pending)
+		})
+	}
+}
+
+func TestReinspectBounds(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"reinspect_retries":3,"reinspect_fields":["ip","imagedigest"]}`)
+	})
+	require.NoError(t, config.Load(`{"reinspect_retries":3,"reinspect_fields":["ip"]}`))
+	r := NewReinspectEngine(context.Background(), []Engine{&inspectEngine{}}).(*reinspector)
+
+	for i := 0; i < maxReinspects+10; i++ {
+		r.Reinspect(reinspectEvent(fmt.Sprintf("%012d", i), "", ""))
+	}
+	assert.Len(t, r.pending, maxReinspects)
+
+	// Later events of a pending container replace its metadata, without rescheduling it
+	due := r.pending["000000000000"].due
+	update := reinspectEvent("000000000000", "", "sha256:b9ff")
+	update.Update = true
+	r.Reinspect(update)
+	assert.Equal(t, update, r.pending["000000000000"].evt)
+	assert.Equal(t, due, r.pending["000000000000"].due)
+	// Until complete
+	r.Reinspect(reinspectEvent("000000000000", "10.88.0.5", ""))
+	assert.NotContains(t, r.pending, "000000000000")
+}
@@ -0,0 +1,123 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"testing"
+)
+
+// validateSchema implements the subset of JSON Schema generated by event.Schema().
+func validateSchema(schema map[string]any, val any, path string) error {
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		for _, sub := range anyOf {
+			if validateSchema(sub.(map[string]any), val, path) == nil {
+				return nil
+			}
+		}
+		return fmt.Errorf("%s: no anyOf alternative matches %v", path, val)
+	}
+	if c, ok := schema["const"]; ok {
+		if fmt.Sprint(c) != fmt.Sprint(val) {
+			return fmt.Errorf("%s: expected const %v, got %v", path, c, val)
+		}
+		return nil
+	}
+	switch schema["type"] {
+	case "null":
+		if val != nil {
+			return fmt.Errorf("%s: expected null", path)
+		}
+	case "boolean":
+		if _, ok := val.(bool); !ok {
+			return fmt.Errorf("%s: expected boolean", path)
+		}
+	case "string":
+		if _, ok := val.(string); !ok {
+			return fmt.Errorf("%s: expected string", path)
+		}
+	case "integer":
+		f, ok := val.(float64)
+		if !ok || f != float64(int64(f)) {
+			return fmt.Errorf("%s: expected integer", path)
+		}
+	case "number":
+		if _, ok := val.(float64); !ok {
+			return fmt.Errorf("%s: expected number", path)
+		}
+	case "array":
+		arr, ok := val.([]any)
+		if !ok {
+			return fmt.Errorf("%s: expected array", path)
+		}
+		for i, item := range arr {
+			if err := validateSchema(schema["items"].(map[string]any), item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	case "object":
+		obj, ok := val.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: expected object", path)
+		}
+		if required, ok := schema["required"].([]any); ok {
+			for _, r := range required {
+				if _, ok := obj[r.(string)]; !ok {
+					return fmt.Errorf("%s: missing required property %s", path, r)
+				}
+			}
+		}
+		properties, _ := schema["properties"].(map[string]any)
+		for key, v := range obj {
+			sub, ok := properties[key].(map[string]any)
+			if !ok {
+				switch additional := schema["additionalProperties"].(type) {
+				case bool:
+					if !additional {
+						return fmt.Errorf("%s: unexpected property %s", path, key)
+					}
+					continue
+				case map[string]any:
+					sub = additional
+				default:
+					continue
+				}
+			}
+			if err := validateSchema(sub, v, path+"."+key); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func assertMatchesSchema(t *testing.T, evt event.Event) {
+	var schema map[string]any
+	require.NoError(t, json.Unmarshal([]byte(event.Schema()), &schema))
+
+	var val any
+	require.NoError(t, json.Unmarshal([]byte(evt.String()), &val))
+	assert.NoError(t, validateSchema(schema, val, "$"))
+}
+
+func TestEventSchema(t *testing.T) {
+	tCases := map[string]event.Event{
+		"Empty": {},
+		"Containerd minimal": {Info: event.Info{
+			Container: event.Container{
+				Type:   typeContainerd.ToCTValue(),
+				Engine: string(typeContainerd),
+				ID:     "2400edb296c5",
+				FullID: "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+			},
+		}},
+	}
+
+	for name, evt := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assertMatchesSchema(t, evt)
+		})
+	}
+}
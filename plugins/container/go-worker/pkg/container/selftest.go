@@ -0,0 +1,134 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"sort"
+	"time"
+)
+
+// SelfTestTimeout bounds the whole self-test, whatever the number of engines.
+const SelfTestTimeout = 10 * time.Second
+
+// errSelfTestTimeout is reported for the engines that did not complete the self-test in time.
+var errSelfTestTimeout = errors.New("self-test timed out")
+
+// versioner is implemented by the engines able to report the API version of their runtime.
+type versioner interface {
+	apiVersion(ctx context.Context) (string, error)
+}
+
+// SelfTestResult is the outcome of the self-test of an engine socket.
+// Fields are left empty past the step that failed, reported by Error.
+type SelfTestResult struct {
+	Name   string `json:"name"`
+	Socket string `json:"socket"`
+	// ConnectLatencyMs is the time taken to create the engine client, that connects to the runtime when needed.
+	ConnectLatencyMs float64 `json:"connect_latency_ms"`
+	APIVersion       string  `json:"api_version"`
+	Containers       int     `json:"containers"`
+	// Inspected is the ID of the container inspected, if any container is visible.
+	Inspected string `json:"inspected"`
+	Error     string `json:"error,omitempty"`
+}
+
+// SelfTestReport is the outcome of the self-test of all the configured engines.
+type SelfTestReport struct {
+	Engines []SelfTestResult `json:"engines"`
+}
+
+// SelfTest checks, in parallel, that the socket of each generator can be connected to, listing its containers
+// and inspecting one of them; engines that are enabled but excluded from the build are reported as failed.
+// Each engine gets its own clients, so that it is safe to run along with the worker, and the engine status is untouched.
+// It returns within timeout, reporting the engines still being tested as timed out.
+func SelfTest(ctx context.Context, generators []EngineGenerator, timeout time.Duration) SelfTestReport {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	results := make([]SelfTestResult, len(generators))
+	type indexed struct {
+		idx int
+		res SelfTestResult
+	}
+	// Buffered, so that tests completing after the timeout never block.
+	resCh := make(chan indexed, len(generators))
+	for i, g := range generators {
+		results[i] = SelfTestResult{Name: g.Name, Socket: g.Socket, Error: errSelfTestTimeout.Error()}
+		go func() {
+			resCh <- indexed{idx: i, res: selfTest(ctx, g)}
+		}()
+	}
+wait:
+	for pending := len(generators); pending > 0; pending-- {
+		select {
+		case r := <-resCh:
+			results[r.idx] = r.res
+		case <-ctx.Done():
+			break wait
+		}
+	}
+
+	c := config.Get()
+	for _, t := range goEngines {
+		if _, ok := engineGenerators[t]; !ok && c.SocketsEngines[string(t)].Enabled {
+			results = append(results, SelfTestResult{Name: string(t), Error: "engine excluded from the build"})
+		}
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Name != results[j].Name {
+			return results[i].Name < results[j].Name
+		}
+		return results[i].Socket < results[j].Socket
+	})
+	return SelfTestReport{Engines: results}
+}
+
+// selfTest runs the self-test of a single engine socket.
+func selfTest(ctx context.Context, g EngineGenerator) (res SelfTestResult) {
+	res = SelfTestResult{Name: g.Name, Socket: g.Socket}
+	defer func() {
+		if r := recover(); r != nil {
+			res.Error = fmt.Sprintf("panic: %v", r)
+		}
+	}()
+
+	if !g.Remote && !socketExists(g.Socket) {
+		res.Error = "socket not found"
+		return res
+	}
+	start := time.Now()
+	e, err := g.New(ctx)
+	if err != nil {
+		res.Error = fmt.Sprintf("connect: %v", err)
+		return res
+	}
+	res.ConnectLatencyMs = float64(time.Since(start).Microseconds()) / 1000
+	defer CloseEngine(e)
+
+	if v, ok := e.(versioner); ok {
+		if res.APIVersion, err = v.apiVersion(ctx); err != nil {
+			res.Error = fmt.Sprintf("version: %v", err)
+			return res
+		}
+	}
+	ctrs, err := e.List(ctx)
+	if err != nil {
+		res.Error = fmt.Sprintf("list: %v", err)
+		return res
+	}
+	res.Containers = len(ctrs)
+	if g, ok := e.(getter); ok && len(ctrs) > 0 {
+		id := ctrs[0].FullID
+		if id == "" {
+			id = ctrs[0].ID
+		}
+		if _, err = g.get(ctx, id); err != nil {
+			res.Error = fmt.Sprintf("inspect %s: %v", id, err)
+			return res
+		}
+		res.Inspected = id
+	}
+	return res
+}
@@ -0,0 +1,100 @@
+package container
+
+import (
+	"context"
+	"errors"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// selfTestEngine is a fakeEngine that can be inspected, and reports its API version.
+type selfTestEngine struct {
+	fakeEngine
+	listErr    error
+	inspectErr error
+}
+
+func (s *selfTestEngine) List(ctx context.Context) ([]event.Event, error) {
+	if s.listErr != nil {
+		return nil, s.listErr
+	}
+	return s.fakeEngine.List(ctx)
+}
+
+func (s *selfTestEngine) get(_ context.Context, containerId string) (*event.Event, error) {
+	if s.inspectErr != nil {
+		return nil, s.inspectErr
+	}
+	return &event.Event{Info: event.Info{Container: event.Container{FullID: containerId}}}, nil
+}
+
+func (s *selfTestEngine) apiVersion(_ context.Context) (string, error) {
+	return "1.47", nil
+}
+
+func TestSelfTest(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "fake.sock")
+	assert.NoError(t, os.WriteFile(socket, nil, 0600))
+	generator := func(e *selfTestEngine) EngineGenerator {
+		e.socket = socket
+		return EngineGenerator{Name: "fake", Socket: socket, New: func(_ context.Context) (Engine, error) {
+			return e, nil
+		}}
+	}
+
+	tCases := map[string]struct {
+		generator      EngineGenerator
+		expectedResult SelfTestResult
+	}{
+		"Inspected": {
+			generator: generator(&selfTestEngine{}),
+			expectedResult: SelfTestResult{Name: "fake", Socket: socket, APIVersion: "1.47", Containers: 1,
+				Inspected: socket},
+		},
+		"Not inspectable": {
+			generator:      fakeGenerator(socket, 0, false),
+			expectedResult: SelfTestResult{Name: "fake", Socket: socket, Containers: 1},
+		},
+		"Socket not found": {
+			generator:      fakeGenerator("/run/missing.sock", 0, false),
+			expectedResult: SelfTestResult{Name: "fake", Socket: "/run/missing.sock", Error: "socket not found"},
+		},
+		"Connect failure": {
+			generator: fakeGenerator(socket, 0, true),
+			expectedResult: SelfTestResult{Name: "fake", Socket: socket,
+				Error: "connect: connection refused"},
+		},
+		"List failure": {
+			generator: generator(&selfTestEngine{listErr: errors.New("permission denied")}),
+			expectedResult: SelfTestResult{Name: "fake", Socket: socket, APIVersion: "1.47",
+				Error: "list: permission denied"},
+		},
+		"Inspect failure": {
+			generator: generator(&selfTestEngine{inspectErr: errors.New("no such container")}),
+			expectedResult: SelfTestResult{Name: "fake", Socket: socket, APIVersion: "1.47", Containers: 1,
+				Error: "inspect " + socket + ": no such container"},
+		},
+		"Timed out": {
+			generator:      fakeGenerator(socket, time.Hour, false),
+			expectedResult: SelfTestResult{Name: "fake", Socket: socket, Error: errSelfTestTimeout.Error()},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			start := time.Now()
+			report := SelfTest(context.Background(), []EngineGenerator{tc.generator}, 100*time.Millisecond)
+			assert.Less(t, time.Since(start), time.Second)
+			if assert.Len(t, report.Engines, 1) {
+				res := report.Engines[0]
+				assert.GreaterOrEqual(t, res.ConnectLatencyMs, float64(0))
+				res.ConnectLatencyMs = 0
+				assert.Equal(t, tc.expectedResult, res)
+			}
+		})
+	}
+}
@@ -0,0 +1,111 @@
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"slices"
+	"sync"
+)
+
+// filterableStates are the container states the engine `states` may select.
+var filterableStates = []string{
+	event.StateCreated,
+	event.StateRunning,
+	event.StatePaused,
+	event.StateRestarting,
+	event.StateExited,
+}
+
+// stateFilter drops the events of the containers whose state is not among the engine `states`,
+// eg: to only report running containers. Containers reported once keep being reported
+// through their events in the selected states, and their removal; the removal of the never reported ones is dropped.
+// The first event reported for a container is never an update, since the consumer did not get the previous ones.
+// A nil stateFilter drops nothing.
+type stateFilter struct {
+	states []string
+
+	mu sync.Mutex
+	// The full IDs of the reported containers, until removed
+	reported map[string]struct{}
+}
+
+// newStateFilter returns the stateFilter of the engine, or nil if it reports all states.
+func newStateFilter(engine engineType) *stateFilter {
+	states := make([]string, 0)
+	for _, state := range config.GetStates(string(engine)) {
+		if !slices.Contains(filterableStates, state) {
+			logger.Warnf("engine %s: invalid state %q, ignoring it", engine, state)
+			continue
+		}
+		states = append(states, state)
+	}
+	if len(states) == 0 {
+		return nil
+	}
+	return &stateFilter{states: states, reported: make(map[string]struct{})}
+}
+
+// dropsState returns whether the event must be dropped, keeping track of the reported containers.
+func (f *stateFilter) dropsState(evt *event.Event) bool {
+	if f == nil {
+		return false
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	_, reported := f.reported[evt.FullID]
+	if !evt.IsCreate {
+		delete(f.reported, evt.FullID)
+		return !reported
+	}
+	if !slices.Contains(f.states, evt.State) {
+		return true
+	}
+	if !reported {
+		f.reported[evt.FullID] = struct{}{}
+		evt.Update = false
+	}
+	return false
+}
+
+// filterStates drops the listed events of the containers in the states not reported.
+func (f *stateFilter) filterStates(evts []event.Event) []event.Event {
+	if f == nil {
+		return evts
+	}
+	res := evts[:0]
+	for _, evt := range evts {
+		if !f.dropsState(&evt) {
+			res = append(res, evt)
+		}
+	}
+	return res
+}
+
+// forwardStates returns a channel forwarding the events of the engine listener inCh,
+// but the ones of the containers in the states not reported; it gets closed with inCh,
+// that is drained once ctx is done.
+func (f *stateFilter) forwardStates(ctx context.Context, wg *sync.WaitGroup, e Engine, inCh <-chan event.Event) <-chan event.Event {
+	if f == nil {
+		return inCh
+	}
+	outCh := make(chan event.Event)
+	GoListener(wg, e, func() {
+		defer close(outCh)
+		for evt := range inCh {
+			if f.dropsState(&evt) {
+				continue
+			}
+			select {
+			case outCh <- evt:
+			case <-ctx.Done():
+				// Unblock the listener until it exits
+				for range inCh {
+				}
+				return
+			}
+		}
+	})
+	return outCh
+}
@@ -0,0 +1,142 @@
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"sync"
+	"testing"
+)
+
+func stateEvent(id, state string, isCreate, update bool) event.Event {
+	return event.Event{
+		IsCreate: isCreate,
+		Info: event.Info{
+			Container: event.Container{
+				ID:     id,
+				FullID: id + "d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+				State:  state,
+			},
+			Update: update,
+		},
+	}
+}
+
+func TestStateFilter(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"states":null}}}`)
+	})
+	// A container created then started, with the `both` emit_on mode, that exits and is removed
+	lifecycle := []event.Event{
+		stateEvent("2400edb296c5", event.StateCreated, true, false),
+		stateEvent("2400edb296c5", event.StateRunning, true, true),
+		stateEvent("2400edb296c5", event.StateExited, true, true),
+		stateEvent("2400edb296c5", event.StateRemoved, false, false),
+	}
+	// A container that never starts
+	neverStarted := []event.Event{
+		stateEvent("3511fec307d6", event.StateCreated, true, false),
+		stateEvent("3511fec307d6", event.StateRemoved, false, false),
+	}
+
+	tCases := map[string]struct {
+		cfg          string
+		evts         []event.Event
+		expectedEvts []event.Event
+	}{
+		"All states": {
+			cfg:          `{"engines":{"docker":{"states":null}}}`,
+			evts:         lifecycle,
+			expectedEvts: lifecycle,
+		},
+		"Running": {
+			cfg:  `{"engines":{"docker":{"states":["running"]}}}`,
+			evts: lifecycle,
+			expectedEvts: []event.Event{
+				// Not an update, as the first one reported
+				stateEvent("2400edb296c5", event.StateRunning, true, false),
+				lifecycle[3],
+			},
+		},
+		"Running, never started": {
+			cfg:          `{"engines":{"docker":{"states":["running"]}}}`,
+			evts:         neverStarted,
+			expectedEvts: []event.Event{},
+		},
+		"Created and exited": {
+			cfg:          `{"engines":{"docker":{"states":["created","exited"]}}}`,
+			evts:         lifecycle,
+			expectedEvts: []event.Event{lifecycle[0], lifecycle[2], lifecycle[3]},
+		},
+		"Invalid states": {
+			cfg:  `{"engines":{"docker":{"states":["removed","up","running"]}}}`,
+			evts: append(append([]event.Event{}, neverStarted...), lifecycle...),
+			expectedEvts: []event.Event{
+				stateEvent("2400edb296c5", event.StateRunning, true, false),
+				lifecycle[3],
+			},
+		},
+		"Only invalid states": {
+			cfg:          `{"engines":{"docker":{"states":["removed"]}}}`,
+			evts:         neverStarted,
+			expectedEvts: neverStarted,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, config.Load(tc.cfg))
+			f := newStateFilter(typeDocker)
+			assert.Equal(t, tc.expectedEvts, f.filterStates(append([]event.Event{}, tc.evts...)))
+			if f != nil {
+				assert.Empty(t, f.reported)
+			}
+		})
+	}
+}
+
+func TestForwardStates(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"docker":{"states":null}}}`)
+	})
+	require.NoError(t, config.Load(`{"engines":{"docker":{"states":["running"]}}}`))
+	f := newStateFilter(typeDocker)
+	// Reported by the initial listing
+	listed := f.filterStates([]event.Event{stateEvent("2400edb296c5", event.StateRunning, true, false)})
+	require.Len(t, listed, 1)
+
+	inCh := make(chan event.Event)
+	wg := sync.WaitGroup{}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	outCh := f.forwardStates(ctx, &wg, &fakeEngine{}, inCh)
+	evts := []event.Event{
+		stateEvent("3511fec307d6", event.StateCreated, true, false),
+		stateEvent("2400edb296c5", event.StateExited, true, true),
+		stateEvent("2400edb296c5", event.StateRunning, true, true),
+		stateEvent("3511fec307d6", event.StateRemoved, false, false),
+		stateEvent("2400edb296c5", event.StateRemoved, false, false),
+	}
+	go func() {
+		for _, evt := range evts {
+			inCh <- evt
+		}
+		close(inCh)
+	}()
+
+	forwarded := make([]event.Event, 0)
+	for evt := range outCh {
+		forwarded = append(forwarded, evt)
+	}
+	wg.Wait()
+	// Restarted, still an update of the listed container
+	assert.Equal(t, []event.Event{evts[2], evts[4]}, forwarded)
+	assert.Empty(t, f.reported)
+
+	// A nil stateFilter drops nothing
+	var none *stateFilter
+	assert.Equal(t, (<-chan event.Event)(inCh), none.forwardStates(ctx, &wg, &fakeEngine{}, inCh))
+	assert.Equal(t, evts, none.filterStates(append([]event.Event{}, evts...)))
+}
@@ -0,0 +1,226 @@
+package container
+
+import (
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"runtime/debug"
+	"sort"
+	"sync"
+	"time"
+)
+
+type EngineState string
+
+const (
+	EngineConnecting EngineState = "connecting"
+	EngineRunning    EngineState = "running"
+	EngineStopped    EngineState = "stopped"
+	EngineFailed     EngineState = "failed"
+)
+
+// maxOpenClients bounds the clients of an engine open at once: the engine one, its copies used
+// to fetch and re-inspect containers, plus transient ones, like a self-test or a reconnection
+// racing with the teardown of the previous engine.
+const maxOpenClients = 5
+
+// EngineStatus is the status of a single engine, as exposed to the plugin.
+type EngineStatus struct {
+	Name   string      `json:"name"`
+	Socket string      `json:"socket"`
+	State  EngineState `json:"state"`
+	Error  string      `json:"error,omitempty"`
+	// OpenConnections is the number of clients of the engine currently open, each holding its runtime connections.
+	OpenConnections int `json:"open_connections"`
+	// DeadlineHits is the number of container events sent incomplete, since their inspection took
+	// longer than `event_deadline_ms`.
+	DeadlineHits uint64 `json:"deadline_hits"`
+	// Retries is the number of consecutive failed attempts of the engine to reach its runtime,
+	// eg: while its daemon is down, and BackoffMs the wait before the next one; both get back to 0 once it succeeds.
+	Retries   int   `json:"retries"`
+	BackoffMs int64 `json:"backoff_ms"`
+	// Reconnects counts the times the engine reached its runtime again after failing:
+	// a steadily increasing count means the engine is flapping.
+	Reconnects uint64 `json:"reconnects"`
+}
+
+type engineKey struct {
+	name   string
+	socket string
+}
+
+var (
+	statusMu sync.Mutex
+	statuses = make(map[engineKey]*EngineStatus)
+	// Open clients, by engine, kept across the engine status resets.
+	openClients = make(map[engineKey]int)
+	// Events sent incomplete, by engine.
+	deadlineHits = make(map[engineKey]uint64)
+	// Retry state of the engines failing to reach their runtime, and their reconnections, by engine.
+	backoffs   = make(map[engineKey]backoffState)
+	reconnects = make(map[engineKey]uint64)
+)
+
+type backoffState struct {
+	retries int
+	wait    time.Duration
+}
+
+// SetEngineState updates the status of an engine; err, if any, is reported as the failure reason.
+// The fetcher engine, that has no name, is not tracked.
+func SetEngineState(e Engine, state EngineState, err error) {
+	if e.Name() == "" {
+		return
+	}
+	setState(e.Name(), e.Sock(), state, err)
+}
+
+func setState(name, socket string, state EngineState, err error) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	key := engineKey{name: name, socket: socket}
+	st, ok := statuses[key]
+	if !ok {
+		st = &EngineStatus{Name: name, Socket: socket}
+		statuses[key] = st
+	}
+	st.State = state
+	st.Error = ""
+	if err != nil {
+		st.Error = err.Error()
+	}
+}
+
+func forgetState(name, socket string) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	delete(statuses, engineKey{name: name, socket: socket})
+}
+
+// GetEngineState returns the current state of an engine, if tracked.
+func GetEngineState(e Engine) (EngineState, bool) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	st, ok := statuses[engineKey{name: e.Name(), socket: e.Sock()}]
+	if !ok {
+		return "", false
+	}
+	return st.State, true
+}
+
+// Status returns a snapshot of all tracked engines status, sorted by name and socket.
+func Status() []EngineStatus {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	res := make([]EngineStatus, 0, len(statuses))
+	for key, st := range statuses {
+		st.OpenConnections = openClients[key]
+		st.DeadlineHits = deadlineHits[key]
+		st.Retries = backoffs[key].retries
+		st.BackoffMs = backoffs[key].wait.Milliseconds()
+		st.Reconnects = reconnects[key]
+		res = append(res, *st)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Name != res[j].Name {
+			return res[i].Name < res[j].Name
+		}
+		return res[i].Socket < res[j].Socket
+	})
+	return res
+}
+
+// ResetStatus drops all tracked engines status.
+func ResetStatus() {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	statuses = make(map[engineKey]*EngineStatus)
+	deadlineHits = make(map[engineKey]uint64)
+	backoffs = make(map[engineKey]backoffState)
+	reconnects = make(map[engineKey]uint64)
+}
+
+// addDeadlineHit accounts an event of the engine sent incomplete.
+func addDeadlineHit(e Engine) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	deadlineHits[engineKey{name: e.Name(), socket: e.Sock()}]++
+}
+
+// setBackoff reports the retries of an engine failing to reach its runtime, along with the wait before the next one.
+func setBackoff(key engineKey, retries int, wait time.Duration) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	backoffs[key] = backoffState{retries: retries, wait: wait}
+}
+
+// recovered accounts an engine reaching its runtime again, after failing.
+func recovered(key engineKey) {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	delete(backoffs, key)
+	reconnects[key]++
+}
+
+// clientRef accounts an open client of an engine in its status, until released.
+type clientRef struct {
+	key  engineKey
+	once sync.Once
+}
+
+// openClient accounts a new client of the engine with the given name and socket.
+func openClient(name, socket string) *clientRef {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	key := engineKey{name: name, socket: socket}
+	openClients[key]++
+	return &clientRef{key: key}
+}
+
+// release accounts the client as closed, returning whether it was open:
+// engines close their client only once, and never the one of a nil clientRef.
+func (r *clientRef) release() bool {
+	if r == nil {
+		return false
+	}
+	released := false
+	r.once.Do(func() {
+		statusMu.Lock()
+		defer statusMu.Unlock()
+		if openClients[r.key]--; openClients[r.key] <= 0 {
+			delete(openClients, r.key)
+		}
+		released = true
+	})
+	return released
+}
+
+// countOpenClients returns the number of open clients of the engine with the given name and socket.
+func countOpenClients(name, socket string) int {
+	statusMu.Lock()
+	defer statusMu.Unlock()
+	return openClients[engineKey{name: name, socket: socket}]
+}
+
+// GoListener runs fn in a new goroutine tracked by wg.
+// A panic in fn is recovered and logged, and the engine is marked as failed,
+// so that a single misbehaving engine cannot take down the whole worker.
+// fn is expected to close its output channel through a defer,
+// so that the worker loop stops listening on it.
+func GoListener(wg *sync.WaitGroup, e Engine, fn func()) {
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer func() {
+			if r := recover(); r != nil {
+				stack := debug.Stack()
+				if p, ok := r.(jobPanic); ok {
+					// Raised again, the stack of the job is the meaningful one
+					r, stack = p.value, p.stack
+				}
+				logger.Errorf("engine %s (%s) panicked: %v\n%s", e.Name(), e.Sock(), r, stack)
+				SetEngineState(e, EngineFailed, fmt.Errorf("panic: %v", r))
+			}
+		}()
+		fn()
+	}()
+}
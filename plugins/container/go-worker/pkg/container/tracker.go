@@ -0,0 +1,27 @@
+package container
+
+import "context"
+
+// CreateTracker is told about the creates the engine listeners are still inspecting,
+// so that the remove events of their containers, racing through other listeners,
+// are not delivered before them. Its methods must be safe for concurrent use.
+type CreateTracker interface {
+	// StartCreate tracks the create of container id as in flight.
+	StartCreate(id string)
+	// DropCreate stops tracking the create of container id, that will not be sent.
+	DropCreate(id string)
+}
+
+type createTrackerKey struct{}
+
+// WithCreateTracker returns a copy of ctx handing the creates inspected by the listeners
+// run with it to t.
+func WithCreateTracker(ctx context.Context, t CreateTracker) context.Context {
+	return context.WithValue(ctx, createTrackerKey{}, t)
+}
+
+// createTrackerFrom returns the CreateTracker of ctx, if any.
+func createTrackerFrom(ctx context.Context) (CreateTracker, bool) {
+	t, ok := ctx.Value(createTrackerKey{}).(CreateTracker)
+	return t, ok && t != nil
+}
@@ -0,0 +1,124 @@
+package container
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"github.com/fsnotify/fsnotify"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// SocketsPollInterval is how often WatchSockets checks the sockets,
+// on top of the inotify notifications for their parent directories.
+const SocketsPollInterval = 5 * time.Second
+
+// SocketChange is a change of an engine socket after startup, as reported by WatchSockets.
+type SocketChange struct {
+	// Discovered is the engine whose socket appeared, once connected.
+	Discovered *Discovered
+	// Name and Socket identify the engine whose socket went away, when Discovered is nil.
+	Name   string
+	Socket string
+}
+
+// WatchSockets watches the sockets of generators, reporting the ones appearing after startup,
+// once their engine connects, and the ones going away.
+// Sockets existing when called are expected to be handled by Discover; remote generators are skipped.
+// Parent directories are watched through inotify, when possible;
+// all sockets are also checked every pollInterval, for the directories that do not exist yet
+// or cannot be watched. An engine failing to connect is retried on the next check.
+// The channel is closed once ctx is done.
+func WatchSockets(ctx context.Context, generators []EngineGenerator, pollInterval time.Duration) <-chan SocketChange {
+	attached := make([]bool, len(generators))
+	for i, g := range generators {
+		attached[i] = g.Remote || socketExists(g.Socket)
+	}
+
+	notifyCh, closeNotify := watchDirs(generators)
+	outCh := make(chan SocketChange)
+	go func() {
+		defer close(outCh)
+		defer closeNotify()
+		ticker := time.NewTicker(pollInterval)
+		defer ticker.Stop()
+		send := func(change SocketChange) bool {
+			select {
+			case outCh <- change:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-notifyCh:
+			}
+			for i, g := range generators {
+				if g.Remote {
+					continue
+				}
+				exists := socketExists(g.Socket)
+				switch {
+				case exists && !attached[i]:
+					logger.Infof("socket %s of engine %s appeared", g.Socket, g.Name)
+					setState(g.Name, g.Socket, EngineConnecting, nil)
+					d := discover(ctx, g, i, 0)
+					if d == nil {
+						continue
+					}
+					attached[i] = true
+					if !send(SocketChange{Discovered: d}) {
+						CloseEngine(d.Engine)
+						return
+					}
+				case !exists && attached[i]:
+					attached[i] = false
+					if !send(SocketChange{Name: g.Name, Socket: g.Socket}) {
+						return
+					}
+				}
+			}
+		}
+	}()
+	return outCh
+}
+
+// watchDirs returns a channel notified of the changes to the parent directories of the sockets,
+// along with the function to stop watching them.
+// The channel is nil, thus never notified, if inotify cannot be used.
+func watchDirs(generators []EngineGenerator) (<-chan fsnotify.Event, func()) {
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		logger.Warnf("failed to watch sockets through inotify, polling them: %v", err)
+		return nil, func() {}
+	}
+	watched := make(map[string]bool)
+	for _, g := range generators {
+		dir := filepath.Dir(g.Socket)
+		if g.Remote || watched[dir] {
+			continue
+		}
+		// Directories not existing yet are only polled
+		if err := w.Add(dir); err == nil {
+			watched[dir] = true
+		}
+	}
+	go func() {
+		// Errors, like an overflow, are covered by polling
+		for range w.Errors {
+		}
+	}()
+	return w.Events, func() {
+		_ = w.Close()
+	}
+}
+
+func socketExists(socket string) bool {
+	// Like Generators(), errors other than NotExist still count as existing
+	_, err := os.Stat(socket)
+	return !os.IsNotExist(err)
+}
@@ -0,0 +1,76 @@
+package container
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func waitOnChange(t *testing.T, ch <-chan SocketChange) SocketChange {
+	select {
+	case ret := <-ch:
+		return ret
+	case <-time.After(5 * time.Second):
+		t.Fatal("timed out waiting for socket change")
+	}
+	return SocketChange{}
+}
+
+func TestWatchSockets(t *testing.T) {
+	tCases := map[string]struct {
+		// Whether the socket dir exists when the watch starts
+		dirExists    bool
+		pollInterval time.Duration
+	}{
+		"Inotify": {
+			dirExists: true,
+			// Never polling
+			pollInterval: time.Hour,
+		},
+		"Polling": {
+			dirExists:    false,
+			pollInterval: 10 * time.Millisecond,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "run")
+			if tc.dirExists {
+				require.NoError(t, os.Mkdir(dir, 0o755))
+			}
+			socket := filepath.Join(dir, "fake.sock")
+			existing := filepath.Join(t.TempDir(), "existing.sock")
+			require.NoError(t, os.WriteFile(existing, nil, 0o644))
+
+			ctx, cancel := context.WithCancel(context.Background())
+			changes := WatchSockets(ctx, []EngineGenerator{
+				fakeGenerator(existing, 0, false),
+				fakeGenerator(socket, 0, false),
+			}, tc.pollInterval)
+
+			// Appeared after startup
+			require.NoError(t, os.MkdirAll(dir, 0o755))
+			require.NoError(t, os.WriteFile(socket, nil, 0o644))
+			change := waitOnChange(t, changes)
+			require.NotNil(t, change.Discovered)
+			assert.Equal(t, socket, change.Discovered.Engine.Sock())
+			assert.Len(t, change.Discovered.Containers, 1)
+
+			// Went away
+			require.NoError(t, os.Remove(socket))
+			change = waitOnChange(t, changes)
+			assert.Nil(t, change.Discovered)
+			assert.Equal(t, "fake", change.Name)
+			assert.Equal(t, socket, change.Socket)
+
+			cancel()
+			for range changes {
+			}
+		})
+	}
+}
@@ -1,6 +1,83 @@
 package event
 
-import "encoding/json"
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// SchemaVersion is the version of the JSON layout produced by Info.String().
+// Consumers can branch on the top-level `schema_version` key instead of
+// guessing field presence; bump it whenever the serialized structure changes.
+//
+// History:
+//   - 1: first versioned layout; same fields as the unversioned one.
+//   - 2: added `state`.
+//   - 3: added `exit_code`, `oom_killed` and `finished_at`.
+//   - 4: added `networks`.
+//   - 5: added top-level `update`.
+//   - 6: added `userns_mode`, `uid_mappings` and `gid_mappings`.
+//   - 7: added fallback events, with a top-level `error`, for containers that cannot be serialized.
+//   - 8: added `entrypoint` and `cmd`.
+//   - 9: added `cgroup_path` and `cgroups_version`.
+//   - 10: added `network_aliases`.
+//   - 11: added `image_pulled_at`.
+//   - 12: added `shared_namespace_target`.
+//   - 13: added top-level `seq`.
+//   - 14: added `restart_count` and `last_restart_reason`.
+//   - 15: added `devices`.
+//   - 16: added `runtime` and `runtime_raw`.
+//   - 17: added top-level `incomplete`.
+//   - 18: added `image_os`, `image_architecture`, `image_variant` and `host_architecture`.
+//   - 19: added top-level `partial`.
+//   - 20: added `engine`, also to the fallback events.
+const SchemaVersion = 20
+
+// Container states, as reported by Container.State.
+// Runtime specific states are normalized to these ones.
+const (
+	StateCreated    = "created"
+	StateRunning    = "running"
+	StatePaused     = "paused"
+	StateRestarting = "restarting"
+	StateExited     = "exited"
+	StateRemoved    = "removed"
+	StateUnknown    = "unknown"
+)
+
+// Restart reasons, as reported by Container.LastRestartReason.
+const (
+	// RestartReasonOOM is for containers restarted after getting OOM killed.
+	RestartReasonOOM = "oom"
+	// RestartReasonError is for containers restarted after exiting with a non-zero code.
+	RestartReasonError = "error"
+	// RestartReasonPolicy is for containers restarted after exiting successfully,
+	// eg: by an `always` restart policy.
+	RestartReasonPolicy = "policy"
+)
+
+// Low-level OCI runtimes, as reported by Container.Runtime.
+const (
+	RuntimeRunc   = "runc"
+	RuntimeCrun   = "crun"
+	RuntimeKata   = "kata"
+	RuntimeGVisor = "gvisor"
+	// RuntimeNvidia is the NVIDIA container runtime, wrapping runc to expose the GPUs.
+	RuntimeNvidia = "nvidia"
+	// RuntimeOther is for the runtimes not listed above, see Container.RuntimeRaw.
+	RuntimeOther = "other"
+	// RuntimeUnknown is for engines not reporting the runtime.
+	RuntimeUnknown = "unknown"
+)
+
+// User namespace modes, as reported by Container.UsernsMode.
+const (
+	// UsernsHost is for containers sharing the host user namespace.
+	UsernsHost = "host"
+	// UsernsPrivate is for containers running in their own, remapped, user namespace.
+	UsernsPrivate = "private"
+)
 
 type PortMapping struct {
 	HostIP        uint32 `json:"HostIp"`
@@ -16,22 +93,43 @@ type Mount struct {
 	Propagation string `json:"Propagation"`
 }
 
+// Network is a network the container is attached to.
+// Fields are empty when not reported by the engine.
+type Network struct {
+	Name        string   `json:"name"`
+	IPAddresses []string `json:"ip_addresses"`
+	MAC         string   `json:"mac"`
+	Interface   string   `json:"interface"`
+}
+
+// IDMapping maps a range of user or group IDs of the container to the host ones.
+type IDMapping struct {
+	ContainerID uint32 `json:"container_id"`
+	HostID      uint32 `json:"host_id"`
+	Size        uint32 `json:"size"`
+}
+
 type Probe struct {
 	Exe  string   `json:"exe"`
 	Args []string `json:"args"`
 }
 
+// Container holds the container metadata sent to the plugin.
+// Fields added after schema version 1 are annotated with the
+// SchemaVersion that introduced them.
+// The `legacy` tag names the field in the legacy layout, when it differs
+// from `container.` followed by its json name: see SetLegacyLayout.
 type Container struct {
 	Type             int               `json:"type"`
 	ID               string            `json:"id"`
 	Name             string            `json:"name"`
 	Image            string            `json:"image"`
-	ImageDigest      string            `json:"imagedigest"`
-	ImageID          string            `json:"imageid"`
-	ImageRepo        string            `json:"imagerepo"`
-	ImageTag         string            `json:"imagetag"`
-	User             string            `json:"User"`
-	CniJson          string            `json:"cni_json"` // cri only
+	ImageDigest      string            `json:"imagedigest" legacy:"container.image.digest"`
+	ImageID          string            `json:"imageid" legacy:"container.image.id"`
+	ImageRepo        string            `json:"imagerepo" legacy:"container.image.repository"`
+	ImageTag         string            `json:"imagetag" legacy:"container.image.tag"`
+	User             string            `json:"User" legacy:"container.user"`
+	CniJson          string            `json:"cni_json" legacy:"container.cni.json"` // cri only
 	CPUPeriod        int64             `json:"cpu_period"`
 	CPUQuota         int64             `json:"cpu_quota"`
 	CPUShares        int64             `json:"cpu_shares"`
@@ -48,20 +146,93 @@ type Container struct {
 	Labels           map[string]string `json:"labels"`
 	MemoryLimit      int64             `json:"memory_limit"`
 	SwapLimit        int64             `json:"swap_limit"`
-	PodSandboxID     string            `json:"pod_sandbox_id"` // cri only
+	PodSandboxID     string            `json:"pod_sandbox_id" legacy:"k8s.pod.full_sandbox_id"` // cri only
 	Privileged       bool              `json:"privileged"`
-	PodSandboxLabels map[string]string `json:"pod_sandbox_labels"` // cri only
+	PodSandboxLabels map[string]string `json:"pod_sandbox_labels" legacy:"k8s.pod.labels"` // cri only
 	PortMappings     []PortMapping     `json:"port_mappings"`
-	Mounts           []Mount           `json:"Mounts"`
-	HealthcheckProbe *Probe            `json:"Healthcheck,omitempty"`
-	LivenessProbe    *Probe            `json:"LivenessProbe,omitempty"`
-	ReadinessProbe   *Probe            `json:"ReadinessProbe,omitempty"`
+	Mounts           []Mount           `json:"Mounts" legacy:"container.mounts"`
+	HealthcheckProbe *Probe            `json:"Healthcheck,omitempty" legacy:"container.healthcheck"`
+	LivenessProbe    *Probe            `json:"LivenessProbe,omitempty" legacy:"container.liveness_probe"`
+	ReadinessProbe   *Probe            `json:"ReadinessProbe,omitempty" legacy:"container.readiness_probe"`
+	// State is the container state when the event was generated.
+	// A create event does not imply a running container:
+	// eg: a docker container that is created but never started
+	// gets a `created` create event followed by a `removed` remove event.
+	State string `json:"state"` // since schema v2
+	// ExitCode, OOMKilled and FinishedAt (unix seconds) are only meaningful
+	// for `exited` and `removed` states.
+	// ExitCode is -1 when the exit status is unknown, eg: when the container
+	// got removed before its exit could be observed or inspected.
+	ExitCode   int   `json:"exit_code"`   // since schema v3
+	OOMKilled  bool  `json:"oom_killed"`  // since schema v3
+	FinishedAt int64 `json:"finished_at"` // since schema v3
+	// Networks may be empty on create events, for containers
+	// whose network gets only attached when they start.
+	Networks []Network `json:"networks"` // since schema v4
+	// UsernsMode is empty when the user namespace could not be detected.
+	// Mappings are only reported for the `private` mode, when known.
+	UsernsMode  string      `json:"userns_mode"`  // since schema v6
+	UIDMappings []IDMapping `json:"uid_mappings"` // since schema v6
+	GIDMappings []IDMapping `json:"gid_mappings"` // since schema v6
+	// Entrypoint and Cmd are the configured command, as argv.
+	// Engines only reporting the resolved argv, like containerd, set all of it as Entrypoint.
+	Entrypoint []string `json:"entrypoint"` // since schema v8
+	Cmd        []string `json:"cmd"`        // since schema v8
+	// CgroupPath is relative to the root of the host cgroup hierarchy, like in /proc/<pid>/cgroup,
+	// eg: /system.slice/docker-<id>.scope; on cgroups v1, it is the one of the cpu controller.
+	// It is empty, like CgroupsVersion is 0, when unknown.
+	CgroupPath     string `json:"cgroup_path"`     // since schema v9
+	CgroupsVersion int    `json:"cgroups_version"` // since schema v9
+	// NetworkAliases are the names the container can be resolved by, on all its networks,
+	// sorted and without duplicates; containers on the default docker bridge have none.
+	NetworkAliases []string `json:"network_aliases"` // since schema v10
+	// ImagePulledAt (unix seconds) is when the image landed on the node, as far as the engine tells,
+	// unlike the image build time: containerd reports when its image record was last updated,
+	// docker when the image was last tagged locally, falling back to the build time; CRI runtimes
+	// only expose the image build time. It is 0 when unknown.
+	ImagePulledAt int64 `json:"image_pulled_at"` // since schema v11
+	// SharedNamespaceTarget is the ID of the container whose network namespace, or else pid one,
+	// this container joins, eg: docker `--network container:<id>`, or CRI containers joining
+	// their pod sandbox. It is empty when not sharing another container namespace.
+	SharedNamespaceTarget string `json:"shared_namespace_target"` // since schema v12
+	// RestartCount is the number of times the container got restarted, and LastRestartReason
+	// the cause of the last restart, empty when unknown: successive restarts of a crash-looping
+	// container are reported as updates with an increasing count.
+	// Only docker reports them.
+	RestartCount      int    `json:"restart_count"`       // since schema v14
+	LastRestartReason string `json:"last_restart_reason"` // since schema v14
+	// Devices are the devices the container has access to, sorted: the host paths of the mapped
+	// device nodes, or their container path when only known by the runtime spec, and the GPUs
+	// or other devices allocated by the runtime, as CDI names, eg: `nvidia.com/gpu=0`.
+	// GPUs requested by count only are reported by their kind, eg: `nvidia.com/gpu`.
+	// Privileged containers have access to all the host devices, even if not listed.
+	Devices []string `json:"devices"` // since schema v15
+	// Runtime is the low-level OCI runtime running the container, normalized to one of the Runtime constants,
+	// and RuntimeRaw its name as reported by the engine, eg: `io.containerd.kata.v2` or `runsc`.
+	// Containerd reports the binary of the runc shim instead of its name, when configured,
+	// eg: `nvidia-container-runtime`. RuntimeRaw is empty when the runtime is unknown.
+	// Only docker, podman and containerd report them.
+	Runtime    string `json:"runtime"`     // since schema v16
+	RuntimeRaw string `json:"runtime_raw"` // since schema v16
+	// ImageOS, ImageArchitecture and ImageVariant are the platform the image is built for, as named by OCI,
+	// eg: `linux`, `arm64` and `v8`; for images pulled from a manifest list, the platform selected for the
+	// local image, not the list one. They are empty when unknown; podman does not report the variant.
+	// HostArchitecture is the architecture of the node, named the same way, eg: `amd64`, so that containers
+	// running emulated foreign-architecture images can be told apart.
+	ImageOS           string `json:"image_os"`           // since schema v18
+	ImageArchitecture string `json:"image_architecture"` // since schema v18
+	ImageVariant      string `json:"image_variant"`      // since schema v18
+	HostArchitecture  string `json:"host_architecture"`  // since schema v18
+	// Engine is the name of the engine that reported the container, eg: `docker` or `cri`,
+	// telling apart the containers of engines running side by side, whose IDs may overlap.
+	Engine string `json:"engine"` // since schema v20
 }
 
 // Info struct wraps Container because we need the `container` struct in the json for backward compatibility.
 // Format:
 /*
 {
+  "schema_version": 20,
   "container": {
     "type": 0,
     "id": "2400edb296c5",
@@ -107,12 +278,87 @@ type Container struct {
         "RW": true,
         "Propagation": "rprivate"
       }
-    ]
-  }
+    ],
+    "state": "running",
+    "exit_code": 0,
+    "oom_killed": false,
+    "finished_at": 0,
+    "networks": [
+      {
+        "name": "podman",
+        "ip_addresses": [
+          "10.88.0.5"
+        ],
+        "mac": "8a:5c:3f:2e:1d:0b",
+        "interface": ""
+      }
+    ],
+    "userns_mode": "private",
+    "uid_mappings": [
+      {
+        "container_id": 0,
+        "host_id": 100000,
+        "size": 65536
+      }
+    ],
+    "gid_mappings": [
+      {
+        "container_id": 0,
+        "host_id": 100000,
+        "size": 65536
+      }
+    ],
+    "entrypoint": [],
+    "cmd": [
+      "/bin/bash"
+    ],
+    "cgroup_path": "/system.slice/docker-2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d.scope",
+    "cgroups_version": 2,
+    "network_aliases": [],
+    "image_pulled_at": 1730977790,
+    "shared_namespace_target": "",
+    "restart_count": 0,
+    "last_restart_reason": "",
+    "devices": [
+      "/dev/fuse",
+      "nvidia.com/gpu=0"
+    ],
+    "runtime": "runc",
+    "runtime_raw": "runc",
+    "image_os": "linux",
+    "image_architecture": "amd64",
+    "image_variant": "",
+    "host_architecture": "amd64",
+    "engine": "docker"
+  },
+  "update": false,
+  "seq": 42,
+  "incomplete": false,
+  "partial": false
 }
 */
 type Info struct {
 	Container `json:"container"`
+	// Update is set for events refreshing a container already reported
+	// by a previous event, eg: on start, with the `both` emit_on mode.
+	Update bool `json:"update"` // since schema v5
+	// Seq numbers the events sent by the worker, across all engines, starting from 1
+	// when it starts: a gap in the sequence means the consumer missed events.
+	// Replayed events get a new number, like any other event sent.
+	Seq uint64 `json:"seq"` // since schema v13
+	// Incomplete is set for degraded events, only carrying the container metadata known before its inspection
+	// got past the engine `event_deadline_ms`: an update follows once the container is inspected again.
+	Incomplete bool `json:"incomplete"` // since schema v17
+	// Partial is set for degraded events, only carrying the container metadata known from the engine event,
+	// as its inspection failed, eg: for a short-lived container already removed. An update follows
+	// if the container can be inspected again.
+	Partial bool `json:"partial"` // since schema v19
+}
+
+// Degraded returns whether the event misses the metadata of its container inspection,
+// either as Incomplete or as Partial.
+func (i *Info) Degraded() bool {
+	return i.Incomplete || i.Partial
 }
 
 type Event struct {
@@ -120,10 +366,98 @@ type Event struct {
 	IsCreate bool
 }
 
-func (i *Info) String() string {
-	str, err := json.Marshal(i)
+// versionedInfo adds the schema version next to the `container` object.
+type versionedInfo struct {
+	SchemaVersion int `json:"schema_version"`
+	*Info
+}
+
+// sentinelInfo is sent in place of the fallback layout, should it ever fail to serialize:
+// a well-formed object the consumer can still parse, only carrying the schema version and the error.
+var sentinelInfo = fmt.Sprintf(`{"schema_version":%d,"error":"failed to marshal the event"}`, SchemaVersion)
+
+// fallbackInfo is the minimal layout sent in place of an event that cannot be serialized,
+// so that the consumer still learns the container exists.
+type fallbackInfo struct {
+	SchemaVersion int `json:"schema_version"`
+	Container     struct {
+		Type   int    `json:"type"`
+		ID     string `json:"id"`
+		FullID string `json:"full_id"`
+		Engine string `json:"engine"` // since schema v20
+	} `json:"container"`
+	Update bool   `json:"update"`
+	Error  string `json:"error"` // since schema v7
+	Seq    uint64 `json:"seq"`   // since schema v13
+}
+
+// Marshal returns the JSON layout of the event, the legacy one if selected by SetLegacyLayout.
+// Strings holding invalid UTF-8, like labels from containerd annotations,
+// get the invalid bytes replaced by the Unicode replacement rune, instead of failing;
+// control characters, like NUL, are escaped.
+func (i *Info) Marshal() (string, error) {
+	var v any = versionedInfo{SchemaVersion: SchemaVersion, Info: i}
+	if legacyLayout {
+		v = legacyInfo{Info: i}
+	}
+	str, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal container %s: %w", i.FullID, err)
+	}
+	return string(str), nil
+}
+
+// Fallback returns the minimal JSON layout to be sent in place of the event,
+// when Marshal fails with err: it only carries the container type and IDs,
+// along with the error.
+func (i *Info) Fallback(err error) string {
+	if legacyLayout {
+		return i.legacyFallback(err)
+	}
+	fallback := fallbackInfo{SchemaVersion: SchemaVersion, Update: i.Update, Error: err.Error(), Seq: i.Seq}
+	fallback.Container.Type = i.Type
+	fallback.Container.ID = i.ID
+	fallback.Container.FullID = i.FullID
+	fallback.Container.Engine = i.Engine
+	return marshalFallback(fallback)
+}
+
+// marshalFallback returns the JSON layout of a fallback event, or sentinelInfo if it cannot be serialized.
+func marshalFallback(fallback any) string {
+	str, err := json.Marshal(fallback)
 	if err != nil {
-		return ""
+		return sentinelInfo
 	}
 	return string(str)
 }
+
+// String returns the JSON layout of the event, or its fallback one if it cannot be serialized:
+// it is always valid JSON, never empty.
+func (i *Info) String() string {
+	str, err := i.Marshal()
+	if err != nil {
+		return i.Fallback(err)
+	}
+	return str
+}
+
+// EmptyFields returns the fields, among the given json names, that are empty in the container,
+// eg: an `ip` not assigned yet. Unknown names are never reported.
+func (c *Container) EmptyFields(names []string) []string {
+	empty := make([]string, 0)
+	v := reflect.ValueOf(c).Elem()
+	for _, name := range names {
+		for i := 0; i < v.NumField(); i++ {
+			tag, _, _ := strings.Cut(v.Type().Field(i).Tag.Get("json"), ",")
+			if tag != name {
+				continue
+			}
+			f := v.Field(i)
+			if f.IsZero() || ((f.Kind() == reflect.Slice || f.Kind() == reflect.Map) && f.Len() == 0) {
+				empty = append(empty, name)
+			}
+			break
+		}
+	}
+	return empty
+}
@@ -0,0 +1,163 @@
+package event
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestMarshalInvalidUTF8(t *testing.T) {
+	info := Info{Container: Container{
+		ID:     "2400edb296c5",
+		FullID: "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+		// As found in containerd annotations
+		Labels: map[string]string{"io.annotation\xff": "caf\xe9"},
+		Env:    []string{"FOO=\xc3\x28"},
+	}}
+
+	str, err := info.Marshal()
+	require.NoError(t, err)
+	assert.True(t, utf8.ValidString(str))
+
+	var decoded versionedInfo
+	require.NoError(t, json.Unmarshal([]byte(str), &decoded))
+	assert.Equal(t, map[string]string{"io.annotation�": "caf�"}, decoded.Labels)
+	assert.Equal(t, []string{"FOO=�("}, decoded.Env)
+}
+
+// failingMarshaler fails to serialize, like an event that cannot be.
+type failingMarshaler struct{}
+
+func (failingMarshaler) MarshalJSON() ([]byte, error) {
+	return nil, errors.New("marshal failure")
+}
+
+func TestMarshalFallback(t *testing.T) {
+	tCases := map[string]struct {
+		legacy bool
+	}{
+		"Default": {legacy: false},
+		"Legacy":  {legacy: true},
+	}
+
+	t.Cleanup(func() {
+		SetLegacyLayout(false)
+	})
+	info := Info{
+		Container: Container{
+			Type:   0,
+			ID:     "2400edb296c5",
+			FullID: "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+			Image:  "fedora:38",
+			Engine: "docker",
+		},
+		Update: true,
+		Seq:    42,
+	}
+	_, marshalErr := json.Marshal(failingMarshaler{})
+	require.Error(t, marshalErr)
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			SetLegacyLayout(tc.legacy)
+
+			str := info.Fallback(marshalErr)
+			require.True(t, json.Valid([]byte(str)))
+			var fields map[string]any
+			require.NoError(t, json.Unmarshal([]byte(str), &fields))
+			assert.Equal(t, float64(SchemaVersion), fields["schema_version"])
+			assert.Equal(t, true, fields["update"])
+			assert.Equal(t, float64(info.Seq), fields["seq"])
+			assert.Contains(t, fields["error"], "marshal failure")
+			if tc.legacy {
+				return
+			}
+
+			var fallback fallbackInfo
+			require.NoError(t, json.Unmarshal([]byte(str), &fallback))
+			assert.Equal(t, info.Type, fallback.Container.Type)
+			assert.Equal(t, info.ID, fallback.Container.ID)
+			assert.Equal(t, info.FullID, fallback.Container.FullID)
+			assert.Equal(t, info.Engine, fallback.Container.Engine)
+		})
+	}
+}
+
+func TestMarshalFallbackSentinel(t *testing.T) {
+	assert.True(t, json.Valid([]byte(sentinelInfo)))
+	assert.Equal(t, sentinelInfo, marshalFallback(failingMarshaler{}))
+	assert.Equal(t, sentinelInfo, marshalFallback(map[string]any{"error": failingMarshaler{}}))
+	assert.Equal(t, sentinelInfo, marshalFallback(math.NaN()))
+}
+
+// FuzzInfoString feeds the string fields of the containers, like the names and the labels,
+// with arbitrary bytes: the event must always be valid JSON, never holding raw control characters.
+func FuzzInfoString(f *testing.F) {
+	for _, seed := range []string{
+		"nginx",
+		"\x00\x01\x1f\x7f",
+		"\t\r\n\b\f",
+		`"quoted" \backslashed\ </script>&`,
+		"\u2028\u2029",
+		"caf\xe9 \xc3\x28 \xff\xfe",
+		"\xed\xa0\x80",
+		"日本語 ℃ 🐳",
+		"\ufeffBOM",
+	} {
+		f.Add(seed, false)
+		f.Add(seed, true)
+	}
+
+	f.Fuzz(func(t *testing.T, s string, legacy bool) {
+		SetLegacyLayout(legacy)
+		defer SetLegacyLayout(false)
+		info := Info{Container: Container{
+			ID:         "2400edb296c5",
+			FullID:     "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+			Name:       s,
+			Image:      s + ":latest",
+			Labels:     map[string]string{s: s, "io.kubernetes.pod.name": s},
+			Env:        []string{"FOO=" + s, s},
+			Entrypoint: []string{"/bin/sh", s},
+			Cmd:        []string{"-c", s},
+			Engine:     "docker",
+		}}
+
+		str := info.String()
+		require.True(t, json.Valid([]byte(str)), str)
+		require.True(t, utf8.ValidString(str))
+		for _, r := range str {
+			require.False(t, r < 0x20, "raw control character %q", r)
+		}
+		// Marshal never fails on strings
+		var fields map[string]any
+		require.NoError(t, json.Unmarshal([]byte(str), &fields))
+		require.NotContains(t, fields, "error")
+
+		if legacy || !utf8.ValidString(s) {
+			return
+		}
+		var decoded versionedInfo
+		require.NoError(t, json.Unmarshal([]byte(str), &decoded))
+		assert.Equal(t, s, decoded.Name)
+		assert.Equal(t, s, decoded.Labels[s])
+		assert.Equal(t, []string{"FOO=" + s, s}, decoded.Env)
+		assert.Equal(t, []string{"/bin/sh", s}, decoded.Entrypoint)
+		assert.Equal(t, []string{"-c", s}, decoded.Cmd)
+	})
+}
+
+func TestEmptyFields(t *testing.T) {
+	ctr := Container{
+		ID:     "2400edb296c5",
+		Ip:     "",
+		Labels: map[string]string{},
+		Env:    []string{"FOO=bar"},
+	}
+	assert.Equal(t, []string{"ip", "imagedigest", "labels"},
+		ctr.EmptyFields([]string{"id", "ip", "imagedigest", "labels", "env", "not_a_field"}))
+	assert.Empty(t, ctr.EmptyFields(nil))
+}
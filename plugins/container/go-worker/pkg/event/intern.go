@@ -0,0 +1,181 @@
+package event
+
+import (
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+)
+
+// defaultPoolSize bounds the number of distinct strings interned by Intern.
+const defaultPoolSize = 1 << 16
+
+var pool = newStringPool(defaultPoolSize)
+
+// Intern makes the repeated strings of the event, like image names and label keys,
+// share their storage with the ones of the events previously interned.
+// Strings are owned by the event container, of the event engine, until a removal event
+// for it gets interned, that releases them instead.
+func Intern(evt *Event) {
+	pool.internEvent(evt)
+}
+
+// poolEntry is a reference counted interned string.
+type poolEntry struct {
+	mu      sync.Mutex
+	s       string
+	refs    int
+	evicted bool
+}
+
+// stringPool is a bounded, reference counted, string pool safe for concurrent use.
+// Once full, strings are returned as they are.
+type stringPool struct {
+	entries sync.Map // string -> *poolEntry
+	size    atomic.Int64
+	maxSize int64
+	// Interned strings of each container, released on its removal.
+	owned sync.Map // owner key -> []*poolEntry
+}
+
+func newStringPool(maxSize int) *stringPool {
+	return &stringPool{maxSize: int64(maxSize)}
+}
+
+// intern returns the pooled copy of s, taking a reference on it.
+// ok is false when s did not get pooled.
+func (p *stringPool) intern(s string) (string, bool) {
+	entry := p.ref(s)
+	if entry == nil {
+		return s, false
+	}
+	return entry.s, true
+}
+
+// ref returns the pool entry of s, taking a reference on it, or nil when s did not get pooled.
+func (p *stringPool) ref(s string) *poolEntry {
+	if s == "" {
+		return nil
+	}
+	for {
+		val, loaded := p.entries.Load(s)
+		if !loaded {
+			if p.size.Load() >= p.maxSize {
+				return nil
+			}
+			// Clone it, not to retain the possibly larger string s is a substring of.
+			val, loaded = p.entries.LoadOrStore(s, &poolEntry{s: strings.Clone(s)})
+			if !loaded {
+				p.size.Add(1)
+			}
+		}
+		entry := val.(*poolEntry)
+		entry.mu.Lock()
+		if entry.evicted {
+			// Concurrently released; retry with a new entry
+			entry.mu.Unlock()
+			continue
+		}
+		entry.refs++
+		entry.mu.Unlock()
+		return entry
+	}
+}
+
+// release drops a reference taken by intern, evicting s once unreferenced.
+func (p *stringPool) release(s string) {
+	if val, ok := p.entries.Load(s); ok {
+		p.unref(val.(*poolEntry))
+	}
+}
+
+// unref drops a reference taken by ref, evicting the entry once unreferenced.
+func (p *stringPool) unref(entry *poolEntry) {
+	entry.mu.Lock()
+	defer entry.mu.Unlock()
+	entry.refs--
+	if entry.refs <= 0 && !entry.evicted {
+		entry.evicted = true
+		p.entries.CompareAndDelete(entry.s, entry)
+		p.size.Add(-1)
+	}
+}
+
+// len returns the number of interned strings.
+func (p *stringPool) len() int {
+	return int(p.size.Load())
+}
+
+// ownerKey returns the key of the strings owned by a container: the same ID might be reported
+// by several engines, each view owning its own strings, as the worker caches them separately.
+func ownerKey(ctr *Container) string {
+	id := ctr.FullID
+	if id == "" {
+		id = ctr.ID
+	}
+	if id == "" || ctr.Engine == "" {
+		return id
+	}
+	return ctr.Engine + "/" + id
+}
+
+func (p *stringPool) internEvent(evt *Event) {
+	id := ownerKey(&evt.Container)
+	if !evt.IsCreate {
+		if owned, ok := p.owned.LoadAndDelete(id); ok {
+			for _, entry := range owned.([]*poolEntry) {
+				p.unref(entry)
+			}
+		}
+		return
+	}
+
+	owned := make([]*poolEntry, 0)
+	intern := func(s *string) {
+		if entry := p.ref(*s); entry != nil {
+			*s = entry.s
+			owned = append(owned, entry)
+		}
+	}
+	internMap := func(m map[string]string) map[string]string {
+		if m == nil {
+			return nil
+		}
+		// Keys cannot be replaced in place
+		interned := make(map[string]string, len(m))
+		for k, v := range m {
+			intern(&k)
+			intern(&v)
+			interned[k] = v
+		}
+		return interned
+	}
+
+	ctr := &evt.Container
+	intern(&ctr.Image)
+	intern(&ctr.ImageDigest)
+	intern(&ctr.ImageID)
+	intern(&ctr.ImageRepo)
+	intern(&ctr.ImageTag)
+	intern(&ctr.User)
+	intern(&ctr.PodSandboxID)
+	intern(&ctr.State)
+	for i := range ctr.Env {
+		intern(&ctr.Env[i])
+	}
+	for i := range ctr.Mounts {
+		intern(&ctr.Mounts[i].Source)
+		intern(&ctr.Mounts[i].Destination)
+		intern(&ctr.Mounts[i].Mode)
+		intern(&ctr.Mounts[i].Propagation)
+	}
+	ctr.Labels = internMap(ctr.Labels)
+	ctr.PodSandboxLabels = internMap(ctr.PodSandboxLabels)
+
+	// Updates of an already interned container replace its previous strings
+	if previous, loaded := p.owned.Swap(id, slices.Clip(owned)); loaded {
+		for _, entry := range previous.([]*poolEntry) {
+			p.unref(entry)
+		}
+	}
+}
@@ -0,0 +1,236 @@
+package event
+
+import (
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"runtime"
+	"strings"
+	"sync"
+	"testing"
+	"unsafe"
+)
+
+// newTestEvent returns the event of container i, with freshly allocated
+// strings like the ones decoded from the engines responses.
+func newTestEvent(i int, isCreate bool) Event {
+	clone := func(format string, args ...any) string {
+		return strings.Clone(fmt.Sprintf(format, args...))
+	}
+	image := i % 20
+	evt := Event{
+		Info: Info{
+			Container: Container{
+				ID:          clone("%012d", i),
+				FullID:      clone("%064d", i),
+				Image:       clone("registry.example.com/team/app-%d:1.0.%d", image, image),
+				ImageDigest: clone("sha256:%064d", image),
+				ImageID:     clone("%064d", image),
+				ImageRepo:   clone("registry.example.com/team/app-%d", image),
+				ImageTag:    clone("1.0.%d", image),
+				State:       clone(StateRunning),
+				Env: []string{
+					clone("PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin"),
+					clone("JAVA_HOME=/opt/java/openjdk"),
+					clone("JAVA_OPTS=-XX:+UseContainerSupport -XX:MaxRAMPercentage=75.0 -Dfile.encoding=UTF-8"),
+					clone("APP_CONFIG=/etc/app-%d/config.yaml", image),
+					clone("KUBERNETES_SERVICE_HOST=10.96.0.1"),
+					clone("KUBERNETES_SERVICE_PORT=443"),
+				},
+				Labels: map[string]string{
+					clone("app.kubernetes.io/name"):               clone("app-%d", image),
+					clone("app.kubernetes.io/managed-by"):         clone("helm"),
+					clone("app.kubernetes.io/version"):            clone("1.0.%d", image),
+					clone("helm.sh/chart"):                        clone("app-%d-1.0.%d", image, image),
+					clone("io.kubernetes.container.name"):         clone("app-%d", image),
+					clone("io.kubernetes.pod.namespace"):          clone("production"),
+					clone("org.opencontainers.image.description"): clone("Application %d, built from the team monorepo", image),
+					clone("io.kubernetes.pod.name"):               clone("app-%d-%d", image, i),
+				},
+			},
+		},
+		IsCreate: isCreate,
+	}
+	// Service links, injected in all the pods of the namespace
+	for svc := 0; svc < 20; svc++ {
+		evt.Env = append(evt.Env,
+			clone("APP_%d_SERVICE_HOST=10.96.12.%d", svc, svc),
+			clone("APP_%d_PORT=tcp://10.96.12.%d:8080", svc, svc))
+	}
+	return evt
+}
+
+func TestStringPool(t *testing.T) {
+	tCases := map[string]struct {
+		maxSize      int
+		interned     []string
+		released     []string
+		expectedLen  int
+		expectedPool []bool
+	}{
+		"Shared": {
+			maxSize:      10,
+			interned:     []string{"a", "a", "b"},
+			expectedLen:  2,
+			expectedPool: []bool{true, true, true},
+		},
+		"Bounded": {
+			maxSize:      1,
+			interned:     []string{"a", "b", "a"},
+			expectedLen:  1,
+			expectedPool: []bool{true, false, true},
+		},
+		"Empty string": {
+			maxSize:      10,
+			interned:     []string{""},
+			expectedLen:  0,
+			expectedPool: []bool{false},
+		},
+		"Released": {
+			maxSize:      10,
+			interned:     []string{"a", "a", "b"},
+			released:     []string{"a", "b"},
+			expectedLen:  1,
+			expectedPool: []bool{true, true, true},
+		},
+		"Fully released": {
+			maxSize:      10,
+			interned:     []string{"a", "b"},
+			released:     []string{"a", "b", "c"},
+			expectedLen:  0,
+			expectedPool: []bool{true, true},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			p := newStringPool(tc.maxSize)
+			pooled := make([]bool, 0, len(tc.interned))
+			for _, s := range tc.interned {
+				interned, ok := p.intern(s)
+				assert.Equal(t, s, interned)
+				pooled = append(pooled, ok)
+			}
+			for _, s := range tc.released {
+				p.release(s)
+			}
+			assert.Equal(t, tc.expectedPool, pooled)
+			assert.Equal(t, tc.expectedLen, p.len())
+		})
+	}
+}
+
+func TestInternEvent(t *testing.T) {
+	p := newStringPool(defaultPoolSize)
+	first := newTestEvent(0, true)
+	second := newTestEvent(20, true)
+	p.internEvent(&first)
+	p.internEvent(&second)
+
+	// Same image: same backing storage
+	assert.Equal(t, newTestEvent(0, true), first)
+	assert.Same(t, unsafeStringData(first.Image), unsafeStringData(second.Image))
+	for k, v := range first.Labels {
+		if k == "io.kubernetes.pod.name" {
+			continue
+		}
+		assert.Same(t, unsafeStringData(v), unsafeStringData(second.Labels[k]))
+	}
+
+	// Updates do not take further references
+	size := p.len()
+	update := newTestEvent(0, true)
+	p.internEvent(&update)
+	assert.Equal(t, size, p.len())
+
+	// Removal events release the container strings
+	p.internEvent(&Event{Info: Info{Container: Container{FullID: first.FullID}}, IsCreate: false})
+	assert.Less(t, p.len(), size)
+	p.internEvent(&Event{Info: Info{Container: Container{FullID: second.FullID}}, IsCreate: false})
+	assert.Equal(t, 0, p.len())
+}
+
+func TestInternEventEngines(t *testing.T) {
+	p := newStringPool(defaultPoolSize)
+	docker := newTestEvent(0, true)
+	docker.Engine = "docker"
+	containerd := newTestEvent(0, true)
+	containerd.Engine = "containerd"
+	p.internEvent(&docker)
+	p.internEvent(&containerd)
+	size := p.len()
+
+	// Updates of a view only replace its own strings
+	update := newTestEvent(0, true)
+	update.Engine = "containerd"
+	p.internEvent(&update)
+	assert.Equal(t, size, p.len())
+
+	// Removed by one engine, the strings of the other view are still pooled
+	p.internEvent(&Event{Info: Info{Container: Container{FullID: docker.FullID, Engine: "containerd"}}, IsCreate: false})
+	assert.Equal(t, size, p.len())
+	for _, s := range []string{docker.Image, docker.Labels["io.kubernetes.pod.name"], docker.Env[0]} {
+		interned, ok := p.intern(s)
+		assert.True(t, ok)
+		assert.Same(t, unsafeStringData(s), unsafeStringData(interned))
+		p.release(s)
+	}
+
+	p.internEvent(&Event{Info: Info{Container: Container{FullID: docker.FullID, Engine: "docker"}}, IsCreate: false})
+	assert.Equal(t, 0, p.len())
+}
+
+func TestStringPoolConcurrent(t *testing.T) {
+	p := newStringPool(defaultPoolSize)
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for n := 0; n < 1000; n++ {
+				evt := newTestEvent(n%50, true)
+				p.internEvent(&evt)
+				p.internEvent(&Event{Info: Info{Container: Container{FullID: evt.FullID}}, IsCreate: false})
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Nothing leaked
+	assert.Equal(t, 0, p.len())
+}
+
+func unsafeStringData(s string) *byte {
+	return unsafe.StringData(s)
+}
+
+// BenchmarkIntern reports the steady state heap retained by 10k containers events.
+func BenchmarkIntern(b *testing.B) {
+	const numContainers = 10000
+	for _, withIntern := range []bool{false, true} {
+		b.Run(fmt.Sprintf("intern=%v", withIntern), func(b *testing.B) {
+			var retainedBytes uint64
+			for n := 0; n < b.N; n++ {
+				p := newStringPool(defaultPoolSize)
+				before := heapInUse()
+				evts := make([]Event, numContainers)
+				for i := range evts {
+					evts[i] = newTestEvent(i, true)
+					if withIntern {
+						p.internEvent(&evts[i])
+					}
+				}
+				retainedBytes += heapInUse() - before
+				runtime.KeepAlive(evts)
+				runtime.KeepAlive(p)
+			}
+			b.ReportMetric(float64(retainedBytes)/float64(b.N)/(1<<20), "heap-MB")
+		})
+	}
+}
+
+func heapInUse() uint64 {
+	var stats runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&stats)
+	return stats.HeapAlloc
+}
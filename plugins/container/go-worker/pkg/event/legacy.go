@@ -0,0 +1,126 @@
+package event
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+// legacyLayout selects the legacy layout for Info.String() and Schema(); see SetLegacyLayout.
+var legacyLayout bool
+
+// SetLegacyLayout selects the JSON layout produced by Info.String(), and described by Schema(),
+// for all the events: the default one, or the legacy one.
+// The legacy layout, matching the naming of the former built-in container engine fields,
+// flattens the container object into the top-level one, keying every container field
+// by its field name, eg: `container.id` or `container.image.repository`.
+// Both layouts are built from the same Container fields, so that they never drift apart.
+func SetLegacyLayout(legacy bool) {
+	legacyLayout = legacy
+}
+
+// legacyField is a Container field, as reported by the legacy layout.
+type legacyField struct {
+	index     int
+	name      string
+	omitEmpty bool
+	typ       reflect.Type
+}
+
+// legacyFields are the Container fields in the legacy layout, named by their `legacy` tag,
+// or `container.` followed by their json name.
+var legacyFields = func() []legacyField {
+	t := reflect.TypeOf(Container{})
+	fields := make([]legacyField, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, opts, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" || !f.IsExported() {
+			continue
+		}
+		if legacy, ok := f.Tag.Lookup("legacy"); ok {
+			name = legacy
+		} else {
+			name = "container." + name
+		}
+		fields = append(fields, legacyField{
+			index:     i,
+			name:      name,
+			omitEmpty: strings.Contains(opts, "omitempty"),
+			typ:       f.Type,
+		})
+	}
+	return fields
+}()
+
+// legacyName returns the legacy layout name of the Container field.
+func legacyName(field string) string {
+	f, _ := reflect.TypeOf(Container{}).FieldByName(field)
+	for _, lf := range legacyFields {
+		if lf.index == f.Index[0] {
+			return lf.name
+		}
+	}
+	return ""
+}
+
+// legacyInfo marshals Info in the legacy layout.
+type legacyInfo struct {
+	*Info
+}
+
+func (l legacyInfo) MarshalJSON() ([]byte, error) {
+	fields := map[string]any{
+		"schema_version": SchemaVersion,
+		"update":         l.Update,
+		"seq":            l.Seq,
+		"incomplete":     l.Incomplete,
+		"partial":        l.Partial,
+	}
+	ctr := reflect.ValueOf(&l.Container).Elem()
+	for _, f := range legacyFields {
+		v := ctr.Field(f.index)
+		if f.omitEmpty && v.IsZero() {
+			continue
+		}
+		fields[f.name] = v.Interface()
+	}
+	return json.Marshal(fields)
+}
+
+// legacyFallback is the legacy layout of fallbackInfo.
+func (i *Info) legacyFallback(err error) string {
+	fallback := map[string]any{
+		"schema_version":     SchemaVersion,
+		legacyName("Type"):   i.Type,
+		legacyName("ID"):     i.ID,
+		legacyName("FullID"): i.FullID,
+		legacyName("Engine"): i.Engine,
+		"update":             i.Update,
+		"error":              err.Error(),
+		"seq":                i.Seq,
+	}
+	return marshalFallback(fallback)
+}
+
+// legacySchema returns the schema of the legacy layout, the default one
+// with the container properties moved to the top-level object.
+func legacySchema() map[string]any {
+	schema := typeSchema(reflect.TypeOf(versionedInfo{}))
+	properties := schema["properties"].(map[string]any)
+	delete(properties, "container")
+	required := make([]string, 0)
+	for _, name := range schema["required"].([]string) {
+		if name != "container" {
+			required = append(required, name)
+		}
+	}
+	for _, f := range legacyFields {
+		properties[f.name] = typeSchema(f.typ)
+		if !f.omitEmpty {
+			required = append(required, f.name)
+		}
+	}
+	schema["required"] = required
+	return schema
+}
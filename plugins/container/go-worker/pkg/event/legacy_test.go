@@ -0,0 +1,142 @@
+package event
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var updateGolden = flag.Bool("update", false, "update the golden files")
+
+func goldenInfo() Info {
+	return Info{
+		Container: Container{
+			Type:              7,
+			ID:                "2400edb296c5",
+			Name:              "web",
+			Image:             "fedora:38",
+			ImageDigest:       "sha256:b9ff6f23cceb5bde20bb1f79b492b98d71ef7a7ae518ca1b15b26661a11e6a94",
+			ImageID:           "0ca0fed353fb77c247abada85aebc667fd1f5fa0b5f6ab1efb26867ba18f2f0a",
+			ImageRepo:         "fedora",
+			ImageTag:          "38",
+			User:              "0",
+			CPUPeriod:         100000,
+			CPUShares:         1024,
+			CreatedTime:       1730977803,
+			Env:               []string{"FGC=f38"},
+			FullID:            "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+			Ip:                "10.88.0.5",
+			Size:              -1,
+			Labels:            map[string]string{"app": "web"},
+			PodSandboxID:      "6a2ecd8c9ee2e2b4bd3c3e7fa2a2a8a91d1ee8d42d97a5ac1f6b04e3f3bf5b3c",
+			PodSandboxLabels:  map[string]string{"tier": "frontend"},
+			PortMappings:      []PortMapping{{HostIP: 0, HostPort: 8080, ContainerPort: 80}},
+			Mounts:            []Mount{{Source: "/data", Destination: "/data", RW: true, Propagation: "rprivate"}},
+			LivenessProbe:     &Probe{Exe: "curl", Args: []string{"localhost"}},
+			State:             StateRunning,
+			Networks:          []Network{{Name: "podman", IPAddresses: []string{"10.88.0.5"}, MAC: "8a:5c:3f:2e:1d:0b"}},
+			UsernsMode:        UsernsHost,
+			UIDMappings:       []IDMapping{},
+			GIDMappings:       []IDMapping{},
+			Entrypoint:        []string{},
+			Cmd:               []string{"/bin/bash"},
+			CgroupsVersion:    2,
+			NetworkAliases:    []string{"web-0"},
+			Devices:           []string{"/dev/fuse", "nvidia.com/gpu=0"},
+			Runtime:           RuntimeCrun,
+			RuntimeRaw:        "crun",
+			ImagePulledAt:     1730977790,
+			ImageOS:           "linux",
+			ImageArchitecture: "arm64",
+			ImageVariant:      "v8",
+			HostArchitecture:  "amd64",
+			Engine:            "podman",
+		},
+		Update:     true,
+		Seq:        42,
+		Incomplete: true,
+	}
+}
+
+func TestLayoutGolden(t *testing.T) {
+	tCases := map[string]struct {
+		legacy bool
+		golden string
+	}{
+		"Default": {legacy: false, golden: "default.json"},
+		"Legacy":  {legacy: true, golden: "legacy.json"},
+	}
+
+	t.Cleanup(func() {
+		SetLegacyLayout(false)
+	})
+	info := goldenInfo()
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			SetLegacyLayout(tc.legacy)
+			str, err := info.Marshal()
+			require.NoError(t, err)
+			var indented bytes.Buffer
+			require.NoError(t, json.Indent(&indented, []byte(str), "", "  "))
+			indented.WriteByte('\n')
+
+			path := filepath.Join("testdata", tc.golden)
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(path, indented.Bytes(), 0644))
+			}
+			expected, err := os.ReadFile(path)
+			require.NoError(t, err)
+			assert.Equal(t, string(expected), indented.String())
+		})
+	}
+}
+
+func TestLegacyLayout(t *testing.T) {
+	t.Cleanup(func() {
+		SetLegacyLayout(false)
+	})
+	SetLegacyLayout(true)
+	info := goldenInfo()
+
+	var decoded map[string]any
+	require.NoError(t, json.Unmarshal([]byte(info.String()), &decoded))
+	assert.Equal(t, "2400edb296c5", decoded["container.id"])
+	assert.Equal(t, "fedora", decoded["container.image.repository"])
+	assert.NotContains(t, decoded, "container")
+	// Empty probes are omitted, like in the default layout
+	assert.Contains(t, decoded, "container.liveness_probe")
+	assert.NotContains(t, decoded, "container.healthcheck")
+
+	// The schema describes the legacy layout
+	var schema struct {
+		Properties map[string]any `json:"properties"`
+		Required   []string       `json:"required"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(Schema()), &schema))
+	for key := range decoded {
+		assert.Contains(t, schema.Properties, key)
+	}
+	for _, key := range schema.Required {
+		assert.Contains(t, decoded, key)
+	}
+
+	// So does the fallback event
+	var fallback map[string]any
+	require.NoError(t, json.Unmarshal([]byte(info.Fallback(errors.New("unsupported value"))), &fallback))
+	assert.Equal(t, map[string]any{
+		"schema_version":    float64(SchemaVersion),
+		"container.type":    float64(7),
+		"container.id":      "2400edb296c5",
+		"container.full_id": "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d",
+		"container.engine":  "podman",
+		"update":            true,
+		"error":             "unsupported value",
+		"seq":               float64(42),
+	}, fallback)
+}
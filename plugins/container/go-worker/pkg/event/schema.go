@@ -0,0 +1,113 @@
+package event
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+)
+
+const jsonSchemaDraft = "https://json-schema.org/draft/2020-12/schema"
+
+// Schema returns a JSON Schema document describing the JSON produced by Info.String(),
+// in the layout selected by SetLegacyLayout.
+// It is generated through reflection from the json struct tags,
+// so that it can never drift from the actual serialized layout.
+func Schema() string {
+	var schema map[string]any
+	if legacyLayout {
+		schema = legacySchema()
+	} else {
+		schema = typeSchema(reflect.TypeOf(versionedInfo{}))
+	}
+	schema["$schema"] = jsonSchemaDraft
+	schema["title"] = "container event"
+	schema["properties"].(map[string]any)["schema_version"] = map[string]any{
+		"const": SchemaVersion,
+	}
+	str, err := json.Marshal(schema)
+	if err != nil {
+		return ""
+	}
+	return string(str)
+}
+
+// typeSchema returns the schema for a Go type, following encoding/json rules.
+func typeSchema(t reflect.Type) map[string]any {
+	switch t.Kind() {
+	case reflect.Pointer:
+		return nullable(typeSchema(t.Elem()))
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		// nil slices are serialized as null
+		return nullable(map[string]any{
+			"type":  "array",
+			"items": typeSchema(t.Elem()),
+		})
+	case reflect.Map:
+		// nil maps are serialized as null
+		return nullable(map[string]any{
+			"type":                 "object",
+			"additionalProperties": typeSchema(t.Elem()),
+		})
+	case reflect.Struct:
+		properties := make(map[string]any)
+		required := make([]string, 0)
+		structSchema(t, properties, &required)
+		return map[string]any{
+			"type":                 "object",
+			"properties":           properties,
+			"required":             required,
+			"additionalProperties": false,
+		}
+	default:
+		// Any other kind is not serializable by encoding/json
+		return map[string]any{}
+	}
+}
+
+// structSchema fills properties and required fields for struct t,
+// flattening untagged embedded structs like encoding/json does.
+func structSchema(t reflect.Type, properties map[string]any, required *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag, hasTag := f.Tag.Lookup("json")
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "-" && opts == "" {
+			continue
+		}
+		if f.Anonymous && !hasTag {
+			ft := f.Type
+			if ft.Kind() == reflect.Pointer {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				structSchema(ft, properties, required)
+				continue
+			}
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		properties[name] = typeSchema(f.Type)
+		if !strings.Contains(opts, "omitempty") {
+			*required = append(*required, name)
+		}
+	}
+}
+
+func nullable(schema map[string]any) map[string]any {
+	return map[string]any{
+		"anyOf": []any{schema, map[string]any{"type": "null"}},
+	}
+}
@@ -0,0 +1,61 @@
+package logger
+
+import (
+	"fmt"
+	"sync/atomic"
+)
+
+// Severity mirrors the plugin API `ss_plugin_log_severity` values,
+// so that it can be passed as is to the C side.
+type Severity int
+
+const (
+	SeverityError   Severity = 3
+	SeverityWarning Severity = 4
+	SeverityInfo    Severity = 6
+	SeverityDebug   Severity = 7
+	SeverityTrace   Severity = 8
+)
+
+// Sink receives each formatted log message.
+type Sink func(severity Severity, msg string)
+
+var sink atomic.Pointer[Sink]
+
+// SetSink sets the function every log is forwarded to.
+// A nil sink discards all logs, which is the default.
+func SetSink(s Sink) {
+	if s == nil {
+		sink.Store(nil)
+		return
+	}
+	sink.Store(&s)
+}
+
+func logf(severity Severity, format string, args ...any) {
+	s := sink.Load()
+	if s == nil {
+		return
+	}
+	(*s)(severity, fmt.Sprintf(format, args...))
+}
+
+func Errorf(format string, args ...any) {
+	logf(SeverityError, format, args...)
+}
+
+func Warnf(format string, args ...any) {
+	logf(SeverityWarning, format, args...)
+}
+
+func Infof(format string, args ...any) {
+	logf(SeverityInfo, format, args...)
+}
+
+func Debugf(format string, args ...any) {
+	logf(SeverityDebug, format, args...)
+}
+
+func Tracef(format string, args ...any) {
+	logf(SeverityTrace, format, args...)
+}
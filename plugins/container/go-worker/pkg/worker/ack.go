@@ -0,0 +1,93 @@
+package worker
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// maxPendingAcks bounds the acknowledgements retained above the low-water mark, waiting for the missing ones.
+const maxPendingAcks = 4096
+
+// ackTracker tracks the events acknowledged by the consumer, by their sequence number, see event.Info.Seq.
+// Its low-water mark is the highest sequence number up to which all the events got acknowledged,
+// or were never delivered, as dropped: the consumer can checkpoint it, to ask for the events
+// past it once restarted.
+// Delivering an event is a single atomic store, and reading the low-water mark an atomic load;
+// only acknowledgements, and drops, take the lock.
+// A nil ackTracker tracks nothing. It is safe for concurrent use.
+type ackTracker struct {
+	// delivered is the sequence number of the last event the callback accepted, or dropped.
+	delivered atomic.Uint64
+	// low is the low-water mark.
+	low atomic.Uint64
+
+	mu sync.Mutex
+	// The events acknowledged, or dropped, past low+1, by sequence number.
+	pending map[uint64]struct{}
+}
+
+func newAckTracker() *ackTracker {
+	return &ackTracker{pending: make(map[uint64]struct{})}
+}
+
+// deliver records the event as delivered, once the callback returned; events are delivered in order.
+func (a *ackTracker) deliver(seq uint64) {
+	if a == nil {
+		return
+	}
+	a.delivered.Store(seq)
+}
+
+// drop records the event as never delivered to the consumer, so that it does not hold back the low-water mark.
+func (a *ackTracker) drop(seq uint64) {
+	if a == nil {
+		return
+	}
+	a.delivered.Store(seq)
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.settle(seq)
+}
+
+// ack records the delivered event as acknowledged, advancing the low-water mark if it was the next one.
+// Acknowledging an event twice is a no-op. Returns false if the event was not delivered,
+// or if too many acknowledgements are already waiting for the missing ones.
+func (a *ackTracker) ack(seq uint64) bool {
+	if a == nil || seq == 0 || seq > a.delivered.Load() {
+		return false
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if seq != a.low.Load()+1 && len(a.pending) >= maxPendingAcks {
+		return false
+	}
+	a.settle(seq)
+	return true
+}
+
+// settle marks the event as done with, draining the pending ones that follow it. Called with mu held.
+func (a *ackTracker) settle(seq uint64) {
+	low := a.low.Load()
+	if seq <= low {
+		return
+	}
+	if seq != low+1 {
+		a.pending[seq] = struct{}{}
+		return
+	}
+	for low = seq; ; low++ {
+		if _, ok := a.pending[low+1]; !ok {
+			break
+		}
+		delete(a.pending, low+1)
+	}
+	a.low.Store(low)
+}
+
+// lowWaterMark returns the highest sequence number up to which all the events got acknowledged, or dropped.
+func (a *ackTracker) lowWaterMark() uint64 {
+	if a == nil {
+		return 0
+	}
+	return a.low.Load()
+}
@@ -0,0 +1,90 @@
+package worker
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+)
+
+type engineKey struct {
+	name   string
+	socket string
+}
+
+// containerCache tracks the containers reported by each engine, to find the ones
+// removed while nobody was listening, eg: while the engine was stopped or the worker restarting.
+// It is not safe for concurrent use.
+type containerCache struct {
+	engines map[engineKey]map[string]event.Container
+}
+
+// knownContainers outlives the worker, like the plugin containers cache does across restarts.
+var knownContainers = newContainerCache()
+
+func newContainerCache() *containerCache {
+	return &containerCache{engines: make(map[engineKey]map[string]event.Container)}
+}
+
+func cacheKey(e container.Engine) engineKey {
+	return engineKey{name: e.Name(), socket: e.Sock()}
+}
+
+// containerKey identifies a container by its engine, if known, and its ID,
+// so that the containers of different engines never collide, eg: while migrating from an engine to another.
+func containerKey(ctr *event.Container) string {
+	id := ctr.FullID
+	if id == "" {
+		id = ctr.ID
+	}
+	if id == "" || ctr.Engine == "" {
+		return id
+	}
+	return ctr.Engine + "/" + id
+}
+
+// observe tracks the container of an event sent for engine e, forgetting it once removed.
+// Events of the fetcher engine, that has no name, are not tracked,
+// since their containers belong to other engines.
+func (c *containerCache) observe(e container.Engine, evt event.Event) {
+	key := containerKey(&evt.Container)
+	if e.Name() == "" || key == "" {
+		return
+	}
+	ctrs, ok := c.engines[cacheKey(e)]
+	if !ok {
+		ctrs = make(map[string]event.Container)
+		c.engines[cacheKey(e)] = ctrs
+	}
+	if !evt.IsCreate {
+		delete(ctrs, key)
+		return
+	}
+	// Only what is needed for the synthetic removal
+	ctrs[key] = event.Container{Type: evt.Type, ID: evt.ID, FullID: evt.FullID, Engine: evt.Engine}
+}
+
+// reconcile returns the events to be sent for the freshly listed containers of engine e:
+// a synthetic removal for each tracked container that is not listed anymore, followed by the listed ones.
+// When the listing is not complete, eg: it failed, no removal is synthesized.
+func (c *containerCache) reconcile(e container.Engine, listed []event.Event, complete bool) []event.Event {
+	evts := make([]event.Event, 0, len(listed))
+	if complete {
+		present := make(map[string]struct{}, len(listed))
+		for i := range listed {
+			present[containerKey(&listed[i].Container)] = struct{}{}
+		}
+		for key, ctr := range c.engines[cacheKey(e)] {
+			if _, ok := present[key]; ok {
+				continue
+			}
+			logger.Debugf("container %s of engine %s (%s) went away while not listening", key, e.Name(), e.Sock())
+			ctr.State = event.StateRemoved
+			evts = append(evts, event.Event{Info: event.Info{Container: ctr}, IsCreate: false})
+		}
+	}
+	evts = append(evts, listed...)
+	for _, evt := range evts {
+		c.observe(e, evt)
+	}
+	return evts
+}
@@ -0,0 +1,174 @@
+package worker
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"reflect"
+	"slices"
+	"sort"
+)
+
+// lifecycleFields are the Container fields always taken from the preferred view when merging,
+// since they describe the lifecycle observed by its engine.
+var lifecycleFields = []string{"Type", "Engine", "State", "ExitCode", "OOMKilled", "FinishedAt"}
+
+// duplicates are the views of a container, by the engines reporting it.
+type duplicates struct {
+	// The last create event of each engine, by order of first report.
+	views []event.Event
+	// The event last delivered in place of the views, if any.
+	reported *event.Event
+}
+
+// dedupPolicy applies the `duplicate_ids` policy to the containers reported by several engines
+// with the same ID, eg: a docker container also seen by containerd, delivering a single view of them:
+// the one of the preferred engine, by `engine_priority`, or else the first engine reporting the container;
+// with DuplicateIDsMerge, the fields it leaves empty are filled in by the other views, see mergeViews.
+// The removal of the container is only delivered once all the engines removed it.
+// A nil dedupPolicy delivers the events of each engine. It is not safe for concurrent use.
+type dedupPolicy struct {
+	merge bool
+	// The rank of the engines in `engine_priority`, by name.
+	priority map[string]int
+
+	// The views of the containers, by full ID, until removed by all the engines.
+	ctrs map[string]*duplicates
+}
+
+// newDedupPolicy returns the configured dedupPolicy, or nil if each engine events are delivered.
+func newDedupPolicy() *dedupPolicy {
+	mode := config.GetDuplicateIDs()
+	switch mode {
+	case config.DuplicateIDsPrefer, config.DuplicateIDsMerge:
+	case config.DuplicateIDsAll, "":
+		return nil
+	default:
+		logger.Warnf("invalid duplicate_ids %q, reporting all the engines events", mode)
+		return nil
+	}
+	priority := make(map[string]int)
+	for i, engine := range config.GetEnginePriority() {
+		if _, ok := priority[engine]; !ok {
+			priority[engine] = i
+		}
+	}
+	return &dedupPolicy{
+		merge:    mode == config.DuplicateIDsMerge,
+		priority: priority,
+		ctrs:     make(map[string]*duplicates),
+	}
+}
+
+// apply returns the events to deliver in place of evt, along with the containers previously delivered
+// that the ones to deliver supersede, since reported by another engine.
+func (d *dedupPolicy) apply(evt event.Event) ([]event.Event, []event.Container) {
+	id := evt.FullID
+	if id == "" {
+		id = evt.ID
+	}
+	if d == nil || id == "" {
+		return []event.Event{evt}, nil
+	}
+	dups, ok := d.ctrs[id]
+	if !ok {
+		if !evt.IsCreate {
+			// Never reported
+			return []event.Event{evt}, nil
+		}
+		dups = &duplicates{}
+		d.ctrs[id] = dups
+	}
+	i := slices.IndexFunc(dups.views, func(view event.Event) bool {
+		return view.Engine == evt.Engine
+	})
+	switch {
+	case !evt.IsCreate && i >= 0:
+		dups.views = slices.Delete(dups.views, i, i+1)
+	case !evt.IsCreate:
+	case i >= 0:
+		dups.views[i] = evt
+	default:
+		dups.views = append(dups.views, evt)
+	}
+	if len(dups.views) == 0 {
+		// Removed by all the engines
+		delete(d.ctrs, id)
+		return []event.Event{evt}, nil
+	}
+
+	next := d.resolve(dups.views)
+	var superseded []event.Container
+	if prev := dups.reported; prev != nil {
+		if next.Engine == prev.Engine {
+			if next.Engine != evt.Engine && reflect.DeepEqual(next.Container, prev.Container) {
+				// Another engine view changed, not the delivered one
+				return nil, nil
+			}
+		} else {
+			superseded = append(superseded, prev.Container)
+		}
+		if next.Engine != evt.Engine || next.Engine != prev.Engine {
+			// The consumer already got the container
+			next.Update = true
+		}
+	}
+	dups.reported = &next
+	return []event.Event{next}, superseded
+}
+
+// resolve returns the event to deliver for the views of a container.
+func (d *dedupPolicy) resolve(views []event.Event) event.Event {
+	sorted := slices.Clone(views)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return d.rank(sorted[i].Engine) < d.rank(sorted[j].Engine)
+	})
+	if !d.merge {
+		return sorted[0]
+	}
+	return mergeViews(sorted)
+}
+
+// rank returns the priority of an engine, the lower the better; engines not in `engine_priority` come last.
+func (d *dedupPolicy) rank(engine string) int {
+	if rank, ok := d.priority[engine]; ok {
+		return rank
+	}
+	return len(d.priority)
+}
+
+// mergeViews returns the first view, with each Container field it leaves empty, like 0 or false,
+// filled in by the first of the other views setting it; maps, like the labels, are merged key by key,
+// the first view setting a key winning. The lifecycleFields, like the event flags, are the ones of the first view.
+func mergeViews(views []event.Event) event.Event {
+	merged := views[0]
+	dst := reflect.ValueOf(&merged.Container).Elem()
+	for i := 0; i < dst.NumField(); i++ {
+		if slices.Contains(lifecycleFields, dst.Type().Field(i).Name) {
+			continue
+		}
+		field := dst.Field(i)
+		for _, view := range views[1:] {
+			src := reflect.ValueOf(view.Container).Field(i)
+			if src.IsZero() {
+				continue
+			}
+			if field.Kind() != reflect.Map {
+				if field.IsZero() {
+					field.Set(src)
+				}
+				continue
+			}
+			// Never modify the maps of the views
+			m := reflect.MakeMapWithSize(field.Type(), field.Len()+src.Len())
+			for _, from := range []reflect.Value{src, field} {
+				iter := from.MapRange()
+				for iter.Next() {
+					m.SetMapIndex(iter.Key(), iter.Value())
+				}
+			}
+			field.Set(m)
+		}
+	}
+	return merged
+}
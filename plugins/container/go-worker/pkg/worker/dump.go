@@ -0,0 +1,66 @@
+package worker
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"io"
+	"os"
+	"sync"
+)
+
+// eventDump writes the JSON of each dispatched event as a line, as sent to the callback,
+// to capture the event stream without a consumer, eg: for bug reports.
+// A nil eventDump writes nothing. It is safe for concurrent use.
+type eventDump struct {
+	mu sync.Mutex
+	w  io.Writer
+	// The file opened by openEventDump, if any.
+	f *os.File
+	// only skips the callback, the events being considered delivered once written.
+	only bool
+	// failed is set after the first failed write, logged once.
+	failed bool
+}
+
+// openEventDump returns an eventDump appending to the file at path, or writing to the standard output
+// for config.EventDumpStdout.
+func openEventDump(path string, only bool) (*eventDump, error) {
+	if path == config.EventDumpStdout {
+		return &eventDump{w: os.Stdout, only: only}, nil
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0o600)
+	if err != nil {
+		return nil, err
+	}
+	return &eventDump{w: f, f: f, only: only}, nil
+}
+
+// write writes the event JSON, followed by a newline.
+func (d *eventDump) write(evtJson string) {
+	if d == nil {
+		return
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	if _, err := io.WriteString(d.w, evtJson+"\n"); err != nil && !d.failed {
+		d.failed = true
+		logger.Warnf("failed to dump events: %v", err)
+	}
+}
+
+// exclusive returns whether the events are only dumped, not sent to the callback.
+func (d *eventDump) exclusive() bool {
+	return d != nil && d.only
+}
+
+// close closes the dump file, if any; other writers are left open.
+func (d *eventDump) close() error {
+	if d == nil || d.f == nil {
+		return nil
+	}
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	err := d.f.Close()
+	d.f = nil
+	return err
+}
@@ -0,0 +1,456 @@
+package worker
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"reflect"
+	"runtime/debug"
+	"time"
+)
+
+const (
+	ctxDoneIdx     = 0
+	lateEnginesIdx = 1
+	callbacksIdx   = 2
+	controlsIdx    = 3
+	socketsIdx     = 4
+	heldIdx        = 5
+	retriesIdx     = 6
+
+	// A failed callback is retried by the worker loop up to callbackMaxRetries times,
+	// doubling the wait starting from callbackRetryBackoff, before dropping the event.
+	callbackMaxRetries   = 3
+	callbackRetryBackoff = time.Millisecond
+)
+
+// engineControl asks the worker loop to stop or start listening on a single engine.
+// The outcome is sent on reply.
+type engineControl struct {
+	name   string
+	socket string
+	start  bool
+	reply  chan<- bool
+}
+
+// listener is an engine being listened on through its own cancellable context.
+type listener struct {
+	engine  container.Engine
+	cancel  context.CancelFunc
+	stopped bool
+}
+
+// loop dispatches events from all containerEngines, and from the ones delivered on lateEngines,
+// that connected after the worker started, until ctx is done.
+// Callbacks attached through AttachCallback replace the worker one, once the events retained
+// by its replay buffer are replayed to them as initial state.
+// Each engine listens with its own context, derived from ctx, so that controls can stop
+// and start them independently; a started engine lists its containers again, since
+// it missed their events while stopped, synthesizing the removal of the ones that went away.
+// Engines whose socket appears after startup, as reported on sockets, are attached like late ones,
+// and torn down when their socket goes away.
+// Removes racing with the in-flight create of their container, tracked by the worker creates,
+// are held until the create gets delivered.
+// Reinspecter engines, attached late or not, are notified of the events sent by the other listeners.
+// The events refused by the callback are retried on a timer, the ones dispatched meanwhile queued behind them.
+// The containers reported by several engines with the same ID are delivered as configured by `duplicate_ids`.
+func (w *Worker) loop(ctx context.Context, containerEngines []container.Engine, lateEngines <-chan container.Discovered,
+	sockets <-chan container.SocketChange) {
+	var evt event.Event
+	cb := w.cb
+
+	// We need to use a reflect.SelectCase here since
+	// we will need to select a variable number of channels
+	cases := make([]reflect.SelectCase, 0)
+
+	// Listener owning each case, nil for the fixed ones.
+	listeners := make([]*listener, 0)
+
+	// All the engines, listened on or not.
+	known := append([]container.Engine(nil), containerEngines...)
+
+	// Emplace back case for `ctx.Done` channel
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(ctx.Done()),
+	})
+	listeners = append(listeners, nil)
+
+	// Emplace back case for late engines channel
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(lateEngines),
+	})
+	listeners = append(listeners, nil)
+
+	// Emplace back case for attached callbacks channel
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(w.callbackCh),
+	})
+	listeners = append(listeners, nil)
+
+	// Emplace back case for engine controls channel
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(w.controlCh),
+	})
+	listeners = append(listeners, nil)
+
+	// Emplace back case for engine sockets changes channel
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(sockets),
+	})
+	listeners = append(listeners, nil)
+
+	// Emplace back case for the expiration of the removes held by the worker creates
+	heldTimer := time.NewTimer(time.Hour)
+	heldTimer.Stop()
+	defer heldTimer.Stop()
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(heldTimer.C),
+	})
+	listeners = append(listeners, nil)
+
+	// Emplace back case for the retries of the events refused by the callback
+	retriesTimer := time.NewTimer(time.Hour)
+	retriesTimer.Stop()
+	defer retriesTimer.Stop()
+	cases = append(cases, reflect.SelectCase{
+		Dir:  reflect.SelectRecv,
+		Chan: reflect.ValueOf(retriesTimer.C),
+	})
+	listeners = append(listeners, nil)
+
+	deliver := func(evt event.Event) {
+		for _, evt := range w.deduplicate(evt) {
+			event.Intern(&evt)
+			w.track(evt)
+			w.replay.push(evt)
+			w.dispatch(cb, evt, false)
+		}
+	}
+
+	// deliverOrdered delivers an event sent by the listener of source, never before the create of its container,
+	// then notifies the other engines re-inspecting containers reported with incomplete metadata.
+	deliverOrdered := func(source container.Engine, evt event.Event) {
+		for _, ordered := range w.creates.push(evt, time.Now()) {
+			deliver(ordered)
+			for _, engine := range known {
+				if r, ok := engine.(container.Reinspecter); ok && engine != source {
+					r.Reinspect(ordered)
+				}
+			}
+		}
+		if first, ok := w.creates.next(); ok {
+			heldTimer.Reset(time.Until(first))
+		}
+	}
+
+	listen := func(engine container.Engine) bool {
+		// The creates the listener is still inspecting hold the removes sent by the other ones
+		engineCtx, cancel := context.WithCancel(container.WithCreateTracker(ctx, w.creates))
+		ch, err := engine.Listen(engineCtx, &w.wg)
+		if err != nil {
+			cancel()
+			logger.Warnf("failed to listen on engine %s (%s): %v", engine.Name(), engine.Sock(), err)
+			container.SetEngineState(engine, container.EngineFailed, err)
+			return false
+		}
+		container.SetEngineState(engine, container.EngineRunning, nil)
+		cases = append(cases, reflect.SelectCase{
+			Dir:  reflect.SelectRecv,
+			Chan: reflect.ValueOf(ch),
+		})
+		listeners = append(listeners, &listener{engine: engine, cancel: cancel})
+		return true
+	}
+
+	// attach listens on an engine connected after startup, sending its pre-existing containers.
+	attach := func(d container.Discovered) {
+		for _, ctr := range w.cache.reconcile(d.Engine, d.Containers, d.ListErr == nil) {
+			deliver(ctr)
+		}
+		for _, engine := range containerEngines {
+			if a, ok := engine.(container.Attacher); ok {
+				a.Attach(d.Engine)
+			}
+		}
+		known = append(known, d.Engine)
+		listen(d.Engine)
+	}
+
+	// listening returns the listener of an engine, if not stopped.
+	listening := func(name, socket string) *listener {
+		for _, l := range listeners {
+			if l != nil && !l.stopped && l.engine.Name() == name && l.engine.Sock() == socket {
+				return l
+			}
+		}
+		return nil
+	}
+
+	// teardown stops listening on an engine whose socket went away, and forgets it, closing its client.
+	teardown := func(name, socket string) {
+		if l := listening(name, socket); l != nil {
+			// Its case is removed once the listener closes its channel
+			l.stopped = true
+			l.cancel()
+		}
+		for i, engine := range known {
+			if engine.Name() != name || engine.Sock() != socket {
+				continue
+			}
+			for _, other := range containerEngines {
+				if a, ok := other.(container.Attacher); ok {
+					a.Detach(engine)
+				}
+			}
+			known = append(known[:i], known[i+1:]...)
+			container.CloseEngine(engine)
+			return
+		}
+	}
+
+	// control stops or starts a single engine, returning whether it did.
+	control := func(c engineControl) bool {
+		if l := listening(c.name, c.socket); l != nil {
+			if c.start {
+				// Already listening
+				return false
+			}
+			// Its case is removed once the listener closes its channel
+			logger.Infof("stopping engine %s (%s)", c.name, c.socket)
+			l.stopped = true
+			l.cancel()
+			return true
+		}
+		if !c.start {
+			return false
+		}
+		for _, engine := range known {
+			if engine.Name() == "" || engine.Name() != c.name || engine.Sock() != c.socket {
+				continue
+			}
+			logger.Infof("starting engine %s (%s)", c.name, c.socket)
+			if !listen(engine) {
+				return false
+			}
+			// Listing after listening, not to miss containers in between.
+			listCtx, cancel := context.WithTimeout(ctx, config.GetStartupBudget())
+			containers, err := engine.List(listCtx)
+			cancel()
+			if err != nil {
+				logger.Warnf("failed to list containers of engine %s (%s): %v", c.name, c.socket, err)
+			}
+			for _, ctr := range w.cache.reconcile(engine, containers, err == nil) {
+				deliver(ctr)
+			}
+			return true
+		}
+		return false
+	}
+
+	// Emplace back cases for each container engine listener
+	for _, engine := range containerEngines {
+		listen(engine)
+	}
+
+	for {
+		if due, ok := w.retries.next(); ok {
+			retriesTimer.Reset(time.Until(due))
+		} else {
+			retriesTimer.Stop()
+		}
+		chosen, val, recvOk := reflect.Select(cases)
+		if chosen == ctxDoneIdx {
+			// ctx.Done! Listeners are exiting too, release the engine clients.
+			for _, engine := range known {
+				container.CloseEngine(engine)
+			}
+			w.dropRetries()
+			return
+		}
+		if chosen == lateEnginesIdx {
+			if !recvOk {
+				// No more late engines; a zero Chan case is ignored by reflect.Select.
+				cases[lateEnginesIdx].Chan = reflect.Value{}
+				continue
+			}
+			d, _ := val.Interface().(container.Discovered)
+			logger.Infof("engine %s (%s) connected after startup", d.Engine.Name(), d.Engine.Sock())
+			attach(d)
+			continue
+		}
+		if chosen == socketsIdx {
+			if !recvOk {
+				cases[socketsIdx].Chan = reflect.Value{}
+				continue
+			}
+			change, _ := val.Interface().(container.SocketChange)
+			if change.Discovered != nil {
+				logger.Infof("engine %s (%s) connected to its new socket", change.Discovered.Engine.Name(), change.Discovered.Engine.Sock())
+				attach(*change.Discovered)
+			} else {
+				logger.Infof("tearing down engine %s (%s)", change.Name, change.Socket)
+				teardown(change.Name, change.Socket)
+			}
+			continue
+		}
+		if chosen == callbacksIdx {
+			if !recvOk {
+				cases[callbacksIdx].Chan = reflect.Value{}
+				continue
+			}
+			cb, _ = val.Interface().(Callback)
+			// The events still refused by the previous callback get replayed, if retained
+			w.dropRetries()
+			// Only replayed to the callback
+			for _, replayed := range w.replay.snapshot() {
+				w.dispatchTo(cb, nil, nil, replayed, true)
+			}
+			continue
+		}
+		if chosen == retriesIdx {
+			w.retryDue(time.Now())
+			continue
+		}
+		if chosen == heldIdx {
+			for _, expired := range w.creates.expire(time.Now()) {
+				deliver(expired)
+			}
+			if first, ok := w.creates.next(); ok {
+				heldTimer.Reset(time.Until(first))
+			}
+			continue
+		}
+		if chosen == controlsIdx {
+			if !recvOk {
+				cases[controlsIdx].Chan = reflect.Value{}
+				continue
+			}
+			c, _ := val.Interface().(engineControl)
+			c.reply <- control(c)
+			continue
+		}
+		if recvOk {
+			evt, _ = val.Interface().(event.Event)
+			w.cache.observe(listeners[chosen].engine, evt)
+			deliverOrdered(listeners[chosen].engine, evt)
+		} else {
+			// Remove the stopped goroutine; keep the failed state if it panicked,
+			// unless it got stopped on purpose.
+			l := listeners[chosen]
+			l.cancel()
+			if state, _ := container.GetEngineState(l.engine); l.stopped || state != container.EngineFailed {
+				container.SetEngineState(l.engine, container.EngineStopped, nil)
+			}
+			cases = append(cases[:chosen], cases[chosen+1:]...)
+			listeners = append(listeners[:chosen], listeners[chosen+1:]...)
+		}
+	}
+}
+
+// dispatch numbers the event with the next sequence number, sends it to the worker stream and dumps it if enabled,
+// then sends it to the callback, queueing it for the worker loop to retry it while the consumer refuses it.
+// When all attempts fail the event is dropped and accounted in the worker dropped events,
+// leaving a gap in the sequence seen by the consumer.
+func (w *Worker) dispatch(cb Callback, evt event.Event, initialState bool) {
+	w.dispatchTo(cb, w.stream, w.dump, evt, initialState)
+}
+
+// dispatchTo dispatches the event like dispatch, to stream and dump in place of the worker ones;
+// the replayed events are neither streamed nor dumped again.
+func (w *Worker) dispatchTo(cb Callback, stream *eventStream, dump *eventDump, evt event.Event, initialState bool) {
+	evt.Seq = w.seq.Add(1)
+	if !stream.send(evt, w.done) {
+		// Stopping
+		w.dropped.Add(1)
+		w.acks.drop(evt.Seq)
+		return
+	}
+	skipCallback := stream.exclusive() || w.dump.exclusive()
+	var evtJson string
+	if !skipCallback || dump != nil {
+		var err error
+		if evtJson, err = evt.Marshal(); err != nil {
+			w.fallback.Add(1)
+			logger.Warnf("sending fallback event for container %s: %v", evt.FullID, err)
+			evtJson = evt.Fallback(err)
+		}
+		dump.write(evtJson)
+	}
+	if skipCallback {
+		if stream != nil || dump != nil {
+			w.acks.deliver(evt.Seq)
+		} else {
+			// Never sent to the consumer, nothing to acknowledge
+			w.acks.drop(evt.Seq)
+		}
+		return
+	}
+	p := &pendingCallback{cb: cb, evtJson: evtJson, evt: evt, initialState: initialState, due: time.Now()}
+	// Never before the refused events
+	if w.retries.len() == 0 && w.attempt(p, p.due) {
+		return
+	}
+	if !w.retries.push(p) {
+		w.dropped.Add(1)
+		w.acks.drop(evt.Seq)
+		logger.Warnf("dropped event for container %s: too many events waiting for the consumer", evt.FullID)
+	}
+}
+
+// attempt hands a pending event to its callback. Returns false if the consumer refused it
+// and retries are left, the event being due again after doubling the wait;
+// once all attempts fail the event is dropped.
+func (w *Worker) attempt(p *pendingCallback, now time.Time) bool {
+	if invokeCallback(p.cb, p.evtJson, p.evt, p.initialState) {
+		w.acks.deliver(p.evt.Seq)
+		return true
+	}
+	if p.attempt < callbackMaxRetries {
+		p.due = now.Add(callbackRetryBackoff << p.attempt)
+		p.attempt++
+		return false
+	}
+	w.dropped.Add(1)
+	w.acks.drop(p.evt.Seq)
+	logger.Warnf("dropped event for container %s: consumer refused it %d times", p.evt.FullID, callbackMaxRetries+1)
+	return true
+}
+
+// retryDue hands the pending events due by now to their callback, in order, until one gets refused again.
+func (w *Worker) retryDue(now time.Time) {
+	for {
+		p, ok := w.retries.head()
+		if !ok || now.Before(p.due) || !w.attempt(p, now) {
+			return
+		}
+		w.retries.pop()
+	}
+}
+
+// dropRetries drops the pending events, never handed to their callback.
+func (w *Worker) dropRetries() {
+	for _, p := range w.retries.drain() {
+		w.dropped.Add(1)
+		w.acks.drop(p.evt.Seq)
+	}
+}
+
+// invokeCallback recovers from any panic in the callback,
+// so that a single bad event does not stop the loop; a panic counts as a failure.
+func invokeCallback(cb Callback, evtJson string, evt event.Event, initialState bool) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			logger.Errorf("panic while dispatching event for container %s: %v\n%s", evt.FullID, r, debug.Stack())
+			ok = false
+		}
+	}()
+	return cb(evtJson, evt.IsCreate, initialState)
+}
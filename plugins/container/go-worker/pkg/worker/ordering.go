@@ -0,0 +1,161 @@
+package worker
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Bound for the number of containers tracked by createTracker, for each of its maps.
+const maxTrackedCreates = 4096
+
+// heldRemove is a remove event waiting for the in-flight create of its container.
+type heldRemove struct {
+	evt      event.Event
+	deadline time.Time
+}
+
+// createTracker enforces that the remove event of a container is never delivered before
+// its create, when both race through different listeners, eg: a create fetched on demand, or still
+// inspected by an engine listener, while another one reports the removal. Creates in flight are tracked
+// by container ID, and the matching removes held until the create gets delivered, or times out: the remove
+// is then delivered alone, counted in orphaned, and the late create dropped.
+// Only start, finish, the container.CreateTracker methods, and orphaned, are safe for concurrent use:
+// the other methods belong to the worker loop.
+type createTracker struct {
+	timeout time.Duration
+
+	mu sync.Mutex
+	// When each create in flight started.
+	inflight map[string]time.Time
+
+	held map[string]heldRemove
+	// Containers whose remove got delivered before their create timed out.
+	orphans map[string]struct{}
+	// orphaned counts the remove events delivered alone, since their create timed out.
+	orphaned atomic.Uint64
+}
+
+func newCreateTracker(timeout time.Duration) *createTracker {
+	return &createTracker{
+		timeout:  timeout,
+		inflight: make(map[string]time.Time),
+		held:     make(map[string]heldRemove),
+		orphans:  make(map[string]struct{}),
+	}
+}
+
+// start tracks the create of container id as in flight, since now.
+func (t *createTracker) start(id string, now time.Time) {
+	if id == "" || t.timeout <= 0 {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if _, ok := t.inflight[id]; !ok && len(t.inflight) >= maxTrackedCreates {
+		// Forget the timed out creates first, otherwise an arbitrary one
+		for k, started := range t.inflight {
+			if now.Sub(started) >= t.timeout {
+				delete(t.inflight, k)
+			}
+		}
+		for k := range t.inflight {
+			if len(t.inflight) < maxTrackedCreates {
+				break
+			}
+			delete(t.inflight, k)
+		}
+	}
+	t.inflight[id] = now
+}
+
+// finish stops tracking the create of container id, returning when it started, if still in flight.
+func (t *createTracker) finish(id string, now time.Time) (time.Time, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	started, ok := t.inflight[id]
+	delete(t.inflight, id)
+	return started, ok && now.Sub(started) < t.timeout
+}
+
+// StartCreate implements container.CreateTracker, for the creates inspected by the engine listeners.
+func (t *createTracker) StartCreate(id string) {
+	t.start(id, time.Now())
+}
+
+// DropCreate implements container.CreateTracker.
+func (t *createTracker) DropCreate(id string) {
+	t.finish(id, time.Now())
+}
+
+// push returns the events to be delivered, in order, for evt, received at now.
+func (t *createTracker) push(evt event.Event, now time.Time) []event.Event {
+	id := evt.ID
+	if id == "" {
+		return []event.Event{evt}
+	}
+	if evt.IsCreate {
+		t.finish(id, now)
+		if _, ok := t.orphans[id]; ok {
+			// Its remove has already been delivered: it would be a ghost
+			logger.Debugf("dropping late create event for removed container %s", id)
+			return nil
+		}
+		if held, ok := t.held[id]; ok {
+			delete(t.held, id)
+			return []event.Event{evt, held.evt}
+		}
+		return []event.Event{evt}
+	}
+	if held, ok := t.held[id]; ok {
+		// Still waiting for the same create
+		t.held[id] = heldRemove{evt: evt, deadline: held.deadline}
+		return nil
+	}
+	started, ok := t.finish(id, now)
+	if !ok || len(t.held) >= maxTrackedCreates {
+		return []event.Event{evt}
+	}
+	t.held[id] = heldRemove{evt: evt, deadline: started.Add(t.timeout)}
+	return nil
+}
+
+// expire returns the held removes whose create timed out by now, to be delivered alone.
+func (t *createTracker) expire(now time.Time) []event.Event {
+	evts := make([]event.Event, 0)
+	for id, held := range t.held {
+		if now.Before(held.deadline) {
+			continue
+		}
+		delete(t.held, id)
+		t.orphaned.Add(1)
+		logger.Debugf("create event of container %s timed out, delivering its remove alone", id)
+		if len(t.orphans) >= maxTrackedCreates {
+			// Forget an arbitrary entry
+			for k := range t.orphans {
+				delete(t.orphans, k)
+				break
+			}
+		}
+		t.orphans[id] = struct{}{}
+		evts = append(evts, held.evt)
+	}
+	return evts
+}
+
+// next returns when the first held remove expires, if any.
+func (t *createTracker) next() (time.Time, bool) {
+	var (
+		first time.Time
+		found bool
+	)
+	for _, held := range t.held {
+		if !found || held.deadline.Before(first) {
+			first = held.deadline
+			found = true
+		}
+	}
+	return first, found
+}
@@ -0,0 +1,43 @@
+package worker
+
+import "github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+
+// replayBuffer is a bounded ring buffer retaining the most recent dispatched events,
+// to replay them to callbacks attached after the worker started.
+// A nil replayBuffer retains nothing. It is not safe for concurrent use.
+type replayBuffer struct {
+	events []event.Event
+	next   int
+	full   bool
+}
+
+// newReplayBuffer returns a replayBuffer retaining up to size events, or nil if size is not positive.
+func newReplayBuffer(size int) *replayBuffer {
+	if size <= 0 {
+		return nil
+	}
+	return &replayBuffer{events: make([]event.Event, size)}
+}
+
+// push retains evt, evicting the oldest event when the buffer is full.
+func (r *replayBuffer) push(evt event.Event) {
+	if r == nil {
+		return
+	}
+	r.events[r.next] = evt
+	r.next = (r.next + 1) % len(r.events)
+	if r.next == 0 {
+		r.full = true
+	}
+}
+
+// snapshot returns the retained events, from the oldest to the most recent.
+func (r *replayBuffer) snapshot() []event.Event {
+	if r == nil {
+		return nil
+	}
+	if !r.full {
+		return append([]event.Event(nil), r.events[:r.next]...)
+	}
+	return append(append([]event.Event(nil), r.events[r.next:]...), r.events[:r.next]...)
+}
@@ -0,0 +1,69 @@
+package worker
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"time"
+)
+
+// maxPendingCallbacks bounds the events waiting to be handed to the callback, behind a refused one.
+const maxPendingCallbacks = 1024
+
+// pendingCallback is an event waiting to be handed to its callback, after attempt refusals.
+type pendingCallback struct {
+	cb           Callback
+	evtJson      string
+	evt          event.Event
+	initialState bool
+	attempt      int
+	due          time.Time
+}
+
+// retryQueue holds, in order, the event refused by the consumer and the ones dispatched after it,
+// so that the worker loop retries it on a timer, instead of sleeping, and the consumer
+// still receives the events in order.
+// It is not safe for concurrent use.
+type retryQueue struct {
+	pending []*pendingCallback
+}
+
+// push queues p behind the pending events, returning false if too many are already waiting.
+func (q *retryQueue) push(p *pendingCallback) bool {
+	if len(q.pending) >= maxPendingCallbacks {
+		return false
+	}
+	q.pending = append(q.pending, p)
+	return true
+}
+
+// head returns the first pending event, if any.
+func (q *retryQueue) head() (*pendingCallback, bool) {
+	if len(q.pending) == 0 {
+		return nil, false
+	}
+	return q.pending[0], true
+}
+
+// pop removes the first pending event.
+func (q *retryQueue) pop() {
+	q.pending[0] = nil
+	q.pending = q.pending[1:]
+}
+
+// next returns when the first pending event is due, if any.
+func (q *retryQueue) next() (time.Time, bool) {
+	if p, ok := q.head(); ok {
+		return p.due, true
+	}
+	return time.Time{}, false
+}
+
+// drain removes and returns all the pending events.
+func (q *retryQueue) drain() []*pendingCallback {
+	pending := q.pending
+	q.pending = nil
+	return pending
+}
+
+func (q *retryQueue) len() int {
+	return len(q.pending)
+}
@@ -0,0 +1,43 @@
+package worker
+
+import (
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"sync"
+)
+
+// eventStream sends each dispatched event to a Go channel, for programs embedding the worker.
+// A nil eventStream sends nothing. It is safe for concurrent use.
+type eventStream struct {
+	ch chan<- event.Event
+	// only skips the callback, the events being considered delivered once received from ch.
+	only bool
+	once sync.Once
+}
+
+// send blocks until the event is received from the channel, returning false if done got closed first.
+func (s *eventStream) send(evt event.Event, done <-chan struct{}) bool {
+	if s == nil {
+		return true
+	}
+	select {
+	case s.ch <- evt:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// exclusive returns whether the events are only sent to the channel, not to the callback.
+func (s *eventStream) exclusive() bool {
+	return s != nil && s.only
+}
+
+// close closes the channel, once.
+func (s *eventStream) close() {
+	if s == nil {
+		return
+	}
+	s.once.Do(func() {
+		close(s.ch)
+	})
+}
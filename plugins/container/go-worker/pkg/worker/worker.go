@@ -0,0 +1,415 @@
+package worker
+
+import (
+	"context"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// fetchChSize bounds the containers waiting to be fetched on demand.
+const fetchChSize = 100
+
+// Callback receives the JSON of each container event, whether the container got added,
+// and whether the event belongs to the initial state.
+// It returns false when the consumer could not accept the event.
+type Callback func(json string, added bool, initialState bool) bool
+
+// Status is the status of the worker and of each engine.
+type Status struct {
+	Engines         []container.EngineStatus `json:"engines"`
+	DroppedEvents   uint64                   `json:"dropped_events"`
+	FallbackEvents  uint64                   `json:"fallback_events"`
+	OrphanedRemoves uint64                   `json:"orphaned_removes"`
+	// LastSeq is the sequence number of the last event sent, see event.Info.Seq:
+	// consumers compare it with the last one they got to detect lost events.
+	LastSeq uint64 `json:"last_seq"`
+	// AckedSeq is the sequence number up to which all the events got acknowledged through AckEvent,
+	// or dropped, when `ack_events` is set.
+	AckedSeq uint64 `json:"acked_seq,omitempty"`
+}
+
+// Worker owns the container engines, sending the events of their containers to its callback.
+// Once started through Start, its methods are safe for concurrent use.
+type Worker struct {
+	cb     Callback
+	wg     sync.WaitGroup
+	cancel context.CancelFunc
+	done   <-chan struct{}
+	// started is closed once the worker loop runs, done being set by then.
+	started chan struct{}
+
+	fetchCh    chan string
+	callbackCh chan Callback
+	controlCh  chan engineControl
+
+	// Sockets of the engines connected at startup, by engine name.
+	enabled map[string][]string
+	cache   *containerCache
+	creates *createTracker
+	replay  *replayBuffer
+	dump    *eventDump
+	stream  *eventStream
+	acks    *ackTracker
+	dups    *dedupPolicy
+	retries retryQueue
+
+	containersMu sync.Mutex
+	// The containers reported to the callback, by containerKey.
+	containers map[string]event.Container
+	// The containerKey of the containers, by label key and value.
+	byLabel map[string]map[string]map[string]struct{}
+
+	// dropped counts the events the consumer never accepted.
+	dropped atomic.Uint64
+	// fallback counts the events that could not be serialized, replaced by a fallback one.
+	fallback atomic.Uint64
+	// seq is the sequence number of the last event sent, shared by all the engines.
+	seq atomic.Uint64
+}
+
+func newWorker(cb Callback) *Worker {
+	return &Worker{
+		cb:         cb,
+		fetchCh:    make(chan string, fetchChSize),
+		callbackCh: make(chan Callback, 1),
+		controlCh:  make(chan engineControl),
+		started:    make(chan struct{}),
+		enabled:    make(map[string][]string),
+		cache:      knownContainers,
+		creates:    newCreateTracker(0),
+		containers: make(map[string]event.Container),
+		byLabel:    make(map[string]map[string]map[string]struct{}),
+	}
+}
+
+// New returns a Worker sending the container events to cb, configured by initCfg,
+// the JSON configuration of the engines.
+// The engines status is reset.
+func New(cb Callback, initCfg string) (*Worker, error) {
+	container.ResetStatus()
+	if err := config.Load(initCfg); err != nil {
+		return nil, err
+	}
+	w := newWorker(cb)
+	w.creates = newCreateTracker(config.GetCreateTimeout())
+	// Retain the most recent events for callbacks attached later on.
+	w.replay = newReplayBuffer(config.GetReplayBufferSize())
+	event.SetLegacyLayout(config.GetOutputLayout() == config.OutputLayoutLegacy)
+	if path := config.GetEventDump(); path != "" {
+		dump, err := openEventDump(path, config.IsEventDumpOnly())
+		if err != nil {
+			return nil, err
+		}
+		w.dump = dump
+	}
+	if config.IsAckEventsEnabled() {
+		w.acks = newAckTracker()
+	}
+	w.dups = newDedupPolicy()
+	return w, nil
+}
+
+// DumpTo writes the JSON of each event to out as a line, in addition to sending it to the callback,
+// or in place of it if only is set; it replaces the `event_dump` one, and must be called before Start.
+func (w *Worker) DumpTo(out io.Writer, only bool) {
+	_ = w.dump.close()
+	w.dump = &eventDump{w: out, only: only}
+}
+
+// StreamTo sends each event to ch, in addition to sending its JSON to the callback, or in place of it if only is set,
+// for Go programs embedding the worker; it must be called before Start.
+// The events are sent in order, the worker waiting for each one to be received: ch is expected to be drained
+// until closed, once the worker loop exits, after Stop or once the Start context is done.
+// The events share their maps and slices with the worker, and must not be modified.
+func (w *Worker) StreamTo(ch chan<- event.Event, only bool) {
+	w.stream = &eventStream{ch: ch, only: only}
+}
+
+// Run runs a worker configured by initCfg, like New, sending the container events to ch in place of a callback,
+// until ctx is done; ch is closed once the worker stopped, or failed to start.
+// See StreamTo.
+func Run(ctx context.Context, initCfg string, ch chan<- event.Event) error {
+	w, err := New(nil, initCfg)
+	if err != nil {
+		close(ch)
+		return err
+	}
+	w.StreamTo(ch, true)
+	if err = w.Start(ctx); err != nil {
+		w.stream.close()
+		return err
+	}
+	<-ctx.Done()
+	w.Stop()
+	return nil
+}
+
+// Start connects to the configured engines, sending their pre-existing containers
+// to the callback as initial state, and listens on them in background, until ctx is done or Stop gets called.
+// Engines not connected within the startup budget, like the ones whose socket appears later on
+// or whose connection is being retried, are attached in background.
+func (w *Worker) Start(ctx context.Context) error {
+	generators, err := container.Generators()
+	if err != nil {
+		return err
+	}
+	ctx, w.cancel = context.WithCancel(ctx)
+	// Not to block streaming the initial state once done
+	w.done = ctx.Done()
+
+	discovered, lateEngines := container.Discover(ctx, generators, config.GetStartupBudget(), config.GetConnectRetryTimeout())
+	sockets := container.WatchSockets(ctx, container.ConfiguredGenerators(), container.SocketsPollInterval)
+
+	containerEngines := make([]container.Engine, 0)
+	for _, d := range discovered {
+		engine := d.Engine
+		containerEngines = append(containerEngines, engine)
+		w.enabled[engine.Name()] = append(w.enabled[engine.Name()], engine.Sock())
+		// Run the callback on all pre-existing containers, and on the ones
+		// that went away since the previous run, if any.
+		for _, ctr := range w.cache.reconcile(engine, d.Containers, d.ListErr == nil) {
+			for _, evt := range w.deduplicate(ctr) {
+				event.Intern(&evt)
+				w.track(evt)
+				w.replay.push(evt)
+				w.dispatch(w.cb, evt, true)
+			}
+		}
+	}
+
+	// Always append the dummy engine that is required to
+	// be able to fetch container infos on the fly given other enabled engines.
+	// Along with the one inspecting again the containers reported with incomplete metadata.
+	containerEngines = append(containerEngines, container.NewFetcherEngine(ctx, w.fetchCh, containerEngines),
+		container.NewReinspectEngine(ctx, containerEngines))
+
+	w.run(ctx, containerEngines, lateEngines, sockets)
+	return nil
+}
+
+// run starts the worker loop in background.
+func (w *Worker) run(ctx context.Context, containerEngines []container.Engine, lateEngines <-chan container.Discovered,
+	sockets <-chan container.SocketChange) {
+	w.done = ctx.Done()
+	close(w.started)
+	w.wg.Add(1)
+	go func() {
+		defer w.wg.Done()
+		// Nothing is sent anymore
+		defer w.stream.close()
+		w.loop(ctx, containerEngines, lateEngines, sockets)
+	}()
+}
+
+// Stop stops listening on all the engines, waiting for their listeners to exit.
+func (w *Worker) Stop() {
+	if w.cancel != nil {
+		w.cancel()
+	}
+	w.wg.Wait()
+	if err := w.dump.close(); err != nil {
+		logger.Warnf("failed to close the event dump: %v", err)
+	}
+}
+
+// Engines returns the sockets of the engines connected at startup, by engine name.
+func (w *Worker) Engines() map[string][]string {
+	return w.enabled
+}
+
+// Containers returns the containers reported to the callback and not removed yet,
+// as last reported, sorted by full ID then engine.
+func (w *Worker) Containers() []event.Container {
+	w.containersMu.Lock()
+	defer w.containersMu.Unlock()
+	ctrs := make([]event.Container, 0, len(w.containers))
+	for _, ctr := range w.containers {
+		ctrs = append(ctrs, ctr)
+	}
+	sortContainers(ctrs)
+	return ctrs
+}
+
+// ListByLabel returns the containers reported to the callback and not removed yet carrying the label,
+// as last reported, sorted by full ID then engine. An empty value matches any value of the label.
+func (w *Worker) ListByLabel(key, value string) []event.Container {
+	w.containersMu.Lock()
+	defer w.containersMu.Unlock()
+	ctrs := make([]event.Container, 0)
+	for v, keys := range w.byLabel[key] {
+		if value != "" && v != value {
+			continue
+		}
+		for k := range keys {
+			ctrs = append(ctrs, w.containers[k])
+		}
+	}
+	sortContainers(ctrs)
+	return ctrs
+}
+
+// sortContainers sorts the containers by full ID, then by engine, for the same container reported by several engines.
+func sortContainers(ctrs []event.Container) {
+	sort.Slice(ctrs, func(i, j int) bool {
+		if ctrs[i].FullID != ctrs[j].FullID {
+			return ctrs[i].FullID < ctrs[j].FullID
+		}
+		return ctrs[i].Engine < ctrs[j].Engine
+	})
+}
+
+// deduplicate applies the `duplicate_ids` policy to an event about to be delivered, returning the events
+// to deliver in its place; the containers they supersede, reported by another engine, are not tracked anymore.
+func (w *Worker) deduplicate(evt event.Event) []event.Event {
+	evts, superseded := w.dups.apply(evt)
+	for _, ctr := range superseded {
+		removed := event.Event{Info: event.Info{Container: ctr}}
+		// Not delivered anymore, its strings are released too
+		event.Intern(&removed)
+		w.track(removed)
+	}
+	return evts
+}
+
+// track keeps the Containers, along with their label index, up to date with a delivered event.
+func (w *Worker) track(evt event.Event) {
+	key := containerKey(&evt.Container)
+	if key == "" {
+		return
+	}
+	w.containersMu.Lock()
+	defer w.containersMu.Unlock()
+	// Updates may change the labels
+	if prev, ok := w.containers[key]; ok {
+		w.unindexLabels(key, prev.Labels)
+	}
+	if evt.IsCreate {
+		w.containers[key] = evt.Container
+		w.indexLabels(key, evt.Labels)
+	} else {
+		delete(w.containers, key)
+	}
+}
+
+func (w *Worker) indexLabels(key string, labels map[string]string) {
+	for k, v := range labels {
+		values, ok := w.byLabel[k]
+		if !ok {
+			values = make(map[string]map[string]struct{})
+			w.byLabel[k] = values
+		}
+		keys, ok := values[v]
+		if !ok {
+			keys = make(map[string]struct{})
+			values[v] = keys
+		}
+		keys[key] = struct{}{}
+	}
+}
+
+func (w *Worker) unindexLabels(key string, labels map[string]string) {
+	for k, v := range labels {
+		keys := w.byLabel[k][v]
+		delete(keys, key)
+		if len(keys) == 0 {
+			delete(w.byLabel[k], v)
+		}
+		if len(w.byLabel[k]) == 0 {
+			delete(w.byLabel, k)
+		}
+	}
+}
+
+// Status returns the status of the worker and of each engine.
+func (w *Worker) Status() Status {
+	return Status{
+		Engines:         container.Status(),
+		DroppedEvents:   w.dropped.Load(),
+		FallbackEvents:  w.fallback.Load(),
+		OrphanedRemoves: w.creates.orphaned.Load(),
+		LastSeq:         w.seq.Load(),
+		AckedSeq:        w.acks.lowWaterMark(),
+	}
+}
+
+// AckEvent acknowledges the event with the given sequence number, once processed by the consumer,
+// in any order; it may be called after Stop, for the events delivered before.
+// Returns false if `ack_events` is not set, if the event was never delivered to the callback,
+// or if too many events past a missing acknowledgement are already acknowledged.
+func (w *Worker) AckEvent(seq uint64) bool {
+	return w.acks.ack(seq)
+}
+
+// AckedSeq returns the sequence number up to which all the events got acknowledged, or dropped:
+// the events past it are the ones the consumer may not have processed. It is 0 if `ack_events` is not set.
+func (w *Worker) AckedSeq() uint64 {
+	return w.acks.lowWaterMark()
+}
+
+// AttachCallback replaces the callback the worker sends events to.
+// When `replay_buffer_size` is set, the most recent events are replayed to cb as initial state.
+// Returns false if a previously attached callback is still pending.
+func (w *Worker) AttachCallback(cb Callback) bool {
+	select {
+	case w.callbackCh <- cb:
+		return true
+	default:
+		return false
+	}
+}
+
+// StopEngine stops listening on the engine with the given name and socket, as reported by Status,
+// leaving the other engines untouched; its state becomes "stopped".
+// Returns false if no such engine is being listened on.
+func (w *Worker) StopEngine(name, socket string) bool {
+	return w.controlEngine(name, socket, false)
+}
+
+// StartEngine starts listening again on an engine stopped by StopEngine, or that stopped on its own;
+// its containers are listed again, to catch up with the ones created in the meantime.
+// Returns false if no such engine exists, if it is already being listened on or if it failed to listen.
+func (w *Worker) StartEngine(name, socket string) bool {
+	return w.controlEngine(name, socket, true)
+}
+
+// controlEngine asks the worker loop to stop or start an engine, waiting for the outcome.
+// Returns false if the worker was not started, nothing reading the controls yet.
+func (w *Worker) controlEngine(name, socket string, start bool) bool {
+	select {
+	case <-w.started:
+	default:
+		return false
+	}
+	reply := make(chan bool, 1)
+	select {
+	case w.controlCh <- engineControl{name: name, socket: socket, start: start, reply: reply}:
+	case <-w.done:
+		return false
+	}
+	select {
+	case ok := <-reply:
+		return ok
+	case <-w.done:
+		return false
+	}
+}
+
+// Fetch asks for the container to be fetched on demand from the engines, its event being sent
+// to the callback once found. Returns false if too many containers are already waiting.
+func (w *Worker) Fetch(containerID string) bool {
+	select {
+	case w.fetchCh <- containerID:
+		// Its remove must not overtake the fetched create
+		w.creates.start(containerID, time.Now())
+		return true
+	default:
+		return false
+	}
+}
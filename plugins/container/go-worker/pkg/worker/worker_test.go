@@ -0,0 +1,1730 @@
+package worker
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container/external/fake"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type noopEngine struct {
+	exitAfter  time.Duration
+	eventAfter time.Duration
+}
+
+func (n *noopEngine) Name() string {
+	return "noop"
+}
+
+func (n *noopEngine) Sock() string {
+	return ""
+}
+
+func (n *noopEngine) List(_ context.Context) ([]event.Event, error) {
+	panic("implement List")
+}
+
+func (n *noopEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
+	wg.Add(1)
+	out := make(chan event.Event)
+	// Random sleep between 5 and 20 ms
+	go func() {
+		defer wg.Done()
+		defer close(out)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(n.exitAfter):
+			return
+		case <-time.After(n.eventAfter):
+			out <- event.Event{}
+		}
+	}()
+	return out, nil
+}
+
+// panicEngine listener panics right away, mimicking a bug in a decode path.
+type panicEngine struct {
+	noopEngine
+}
+
+func (p *panicEngine) Name() string {
+	return "panic"
+}
+
+func (p *panicEngine) Listen(_ context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
+	out := make(chan event.Event)
+	container.GoListener(wg, p, func() {
+		defer close(out)
+		var labels map[string]string
+		labels["foo"] = "bar"
+	})
+	return out, nil
+}
+
+// attacherEngine records the engines attached after startup, and the torn down ones.
+type attacherEngine struct {
+	noopEngine
+	attached []container.Engine
+	detached []container.Engine
+}
+
+func (a *attacherEngine) Attach(e container.Engine) {
+	a.attached = append(a.attached, e)
+}
+
+func (a *attacherEngine) Detach(e container.Engine) {
+	a.detached = append(a.detached, e)
+}
+
+// reinspecterEngine counts the events of the other engines it is notified of.
+type reinspecterEngine struct {
+	noopEngine
+	reinspects atomic.Int32
+}
+
+func (r *reinspecterEngine) Reinspect(event.Event) {
+	r.reinspects.Add(1)
+}
+
+// controlledEngine lists a single container and listens until its context is done.
+type controlledEngine struct {
+	noopEngine
+	listens atomic.Int32
+}
+
+func (c *controlledEngine) Name() string {
+	return "controlled"
+}
+
+func (c *controlledEngine) Sock() string {
+	return "/run/controlled.sock"
+}
+
+func (c *controlledEngine) List(_ context.Context) ([]event.Event, error) {
+	return []event.Event{{IsCreate: true}}, nil
+}
+
+func (c *controlledEngine) Listen(ctx context.Context, wg *sync.WaitGroup) (<-chan event.Event, error) {
+	c.listens.Add(1)
+	out := make(chan event.Event)
+	container.GoListener(wg, c, func() {
+		defer close(out)
+		<-ctx.Done()
+	})
+	return out, nil
+}
+
+func TestWorkerLoop(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	numEvents := 0
+	// generate some noop containerEngines
+	containerEngines := make([]container.Engine, 0)
+	for i := 1; i <= 10; i++ {
+		// Never leave for timeout
+		// Send an event after i ms
+		containerEngines = append(containerEngines, &noopEngine{
+			exitAfter:  time.Duration(math.MaxInt64),
+			eventAfter: time.Duration(i) * time.Millisecond,
+		})
+	}
+
+	// Start worker goroutine
+	w := newWorker(func(jsonEvt string, isCreate bool, _ bool) bool {
+		numEvents++
+		return true
+	})
+	w.run(ctx, containerEngines, nil, nil)
+
+	// Give some time to gouroutines to generate events
+	time.Sleep(20 * time.Millisecond)
+
+	// kill the context
+	cancel()
+
+	// Wait on the wg
+	w.wg.Wait()
+
+	// 1 event for each container engine generated
+	assert.Equal(t, len(containerEngines), numEvents)
+}
+
+func TestWorkerLoopExitBeforeCtxCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	numEvents := 0
+	// generate some noop containerEngines
+	containerEngines := make([]container.Engine, 0)
+	for i := 15; i <= 25; i++ {
+		// Leave after i ms
+		// Never send events
+		containerEngines = append(containerEngines, &noopEngine{
+			exitAfter:  time.Duration(i) * time.Millisecond,
+			eventAfter: time.Duration(math.MaxInt64),
+		})
+	}
+
+	// Start worker goroutine
+	w := newWorker(func(jsonEvt string, isCreate bool, _ bool) bool {
+		numEvents++
+		return true
+	})
+	w.run(ctx, containerEngines, nil, nil)
+
+	// Wait for goroutines to be spawned
+	time.Sleep(5 * time.Millisecond)
+	numGoroutine := runtime.NumGoroutine()
+
+	// Give some time to gouroutines to do their work
+	time.Sleep(20 * time.Millisecond)
+
+	// All worker goroutines left
+	// Use LessOrEqual because our own goroutine that runs the worker loop
+	// might have already left too!
+	assert.LessOrEqual(t, runtime.NumGoroutine(), numGoroutine-10)
+
+	// kill the context
+	cancel()
+
+	// Wait on the wg
+	w.wg.Wait()
+
+	// No event sent
+	assert.Equal(t, 0, numEvents)
+}
+
+func TestWorkerLoopEnginePanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	numEvents := 0
+	panicking := &panicEngine{}
+	containerEngines := []container.Engine{
+		panicking,
+		&noopEngine{
+			exitAfter:  time.Duration(math.MaxInt64),
+			eventAfter: 10 * time.Millisecond,
+		},
+	}
+
+	w := newWorker(func(jsonEvt string, isCreate bool, _ bool) bool {
+		numEvents++
+		return true
+	})
+	w.run(ctx, containerEngines, nil, nil)
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	w.wg.Wait()
+
+	// The healthy engine kept sending events
+	assert.Equal(t, 1, numEvents)
+	state, ok := container.GetEngineState(panicking)
+	assert.True(t, ok)
+	assert.Equal(t, container.EngineFailed, state)
+}
+
+func TestWorkerLoopCallbackPanic(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	numEvents := 0
+	containerEngines := make([]container.Engine, 0)
+	for i := 1; i <= 2; i++ {
+		containerEngines = append(containerEngines, &noopEngine{
+			exitAfter:  time.Duration(math.MaxInt64),
+			eventAfter: time.Duration(i) * 5 * time.Millisecond,
+		})
+	}
+
+	w := newWorker(func(jsonEvt string, isCreate bool, _ bool) bool {
+		numEvents++
+		if numEvents == 1 {
+			panic("consumer failure")
+		}
+		return true
+	})
+	w.run(ctx, containerEngines, nil, nil)
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	w.wg.Wait()
+
+	// The loop survived the first panicking callback, that got retried
+	assert.Equal(t, 3, numEvents)
+}
+
+func TestDispatchCallbackFailures(t *testing.T) {
+	tCases := map[string]struct {
+		failures        int
+		expectedCalls   int
+		expectedDropped uint64
+	}{
+		"Accepted at first attempt": {
+			failures:        0,
+			expectedCalls:   1,
+			expectedDropped: 0,
+		},
+		"Accepted after retries": {
+			failures:        callbackMaxRetries,
+			expectedCalls:   callbackMaxRetries + 1,
+			expectedDropped: 0,
+		},
+		"Always refused": {
+			failures:        math.MaxInt,
+			expectedCalls:   callbackMaxRetries + 1,
+			expectedDropped: 1,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			w := newWorker(nil)
+			calls := 0
+			w.dispatch(func(string, bool, bool) bool {
+				calls++
+				return calls > tc.failures
+			}, event.Event{IsCreate: true}, false)
+			retryAll(w)
+			assert.Equal(t, tc.expectedCalls, calls)
+			assert.Equal(t, tc.expectedDropped, w.dropped.Load())
+		})
+	}
+}
+
+func TestDispatchCallbackRetryOrder(t *testing.T) {
+	w := newWorker(nil)
+	var seqs []uint64
+	refused := false
+	cb := func(evtJson string, _ bool, _ bool) bool {
+		seqs = append(seqs, seqOf(t, evtJson))
+		if !refused {
+			refused = true
+			return false
+		}
+		return true
+	}
+	w.dispatch(cb, event.Event{IsCreate: true}, false)
+	w.dispatch(cb, event.Event{IsCreate: true}, false)
+	// Queued behind the refused one
+	assert.Equal(t, []uint64{1}, seqs)
+	assert.Equal(t, 2, w.retries.len())
+
+	// Not due yet
+	p, _ := w.retries.head()
+	w.retryDue(p.due.Add(-time.Nanosecond))
+	assert.Equal(t, []uint64{1}, seqs)
+
+	w.retryDue(time.Now().Add(time.Hour))
+	assert.Equal(t, []uint64{1, 1, 2}, seqs)
+	assert.Equal(t, 0, w.retries.len())
+	assert.Equal(t, uint64(0), w.dropped.Load())
+
+	// Once stopping, the pending events are dropped
+	refused = false
+	w.dispatch(cb, event.Event{IsCreate: true}, false)
+	w.dropRetries()
+	assert.Equal(t, 0, w.retries.len())
+	assert.Equal(t, uint64(1), w.dropped.Load())
+}
+
+// retryAll retries the events refused by the callback, like the worker loop once due, until none is left.
+func retryAll(w *Worker) {
+	for w.retries.len() > 0 {
+		w.retryDue(time.Now().Add(time.Hour))
+	}
+}
+
+// seqOf returns the sequence number of an event JSON.
+func seqOf(t *testing.T, evtJson string) uint64 {
+	var evt event.Info
+	require.NoError(t, json.Unmarshal([]byte(evtJson), &evt))
+	return evt.Seq
+}
+
+func TestDispatchSequence(t *testing.T) {
+	w := newWorker(nil)
+	seqs := make([]uint64, 0)
+	cb := func(evtJson string, _ bool, _ bool) bool {
+		seq := seqOf(t, evtJson)
+		// Never accept the second event
+		if seq == 2 {
+			return false
+		}
+		seqs = append(seqs, seq)
+		return true
+	}
+	for i := 0; i < 3; i++ {
+		w.dispatch(cb, event.Event{IsCreate: true}, i == 0)
+	}
+	// Replayed events are numbered as well
+	w.dispatch(cb, event.Event{IsCreate: true}, true)
+	retryAll(w)
+
+	// The gap matches the dropped event
+	assert.Equal(t, []uint64{1, 3, 4}, seqs)
+	assert.Equal(t, uint64(1), w.dropped.Load())
+	assert.Equal(t, uint64(4), w.Status().LastSeq)
+}
+
+func TestDispatchDump(t *testing.T) {
+	tCases := map[string]struct {
+		only          bool
+		expectedCalls int
+	}{
+		"Along with the callback":  {only: false, expectedCalls: 3},
+		"In place of the callback": {only: true, expectedCalls: 0},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			w := newWorker(nil)
+			var out bytes.Buffer
+			w.DumpTo(&out, tc.only)
+			sent := make([]string, 0)
+			cb := func(evtJson string, _ bool, _ bool) bool {
+				sent = append(sent, evtJson)
+				return true
+			}
+			for i := 0; i < 3; i++ {
+				w.dispatch(cb, event.Event{IsCreate: true, Info: event.Info{Container: event.Container{ID: fmt.Sprint(i)}}}, false)
+			}
+
+			lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+			require.Len(t, lines, 3)
+			for i, line := range lines {
+				assert.Equal(t, uint64(i+1), seqOf(t, line))
+			}
+			assert.Len(t, sent, tc.expectedCalls)
+			if tc.expectedCalls > 0 {
+				// The very same JSON
+				assert.Equal(t, sent, lines)
+			}
+			assert.Zero(t, w.dropped.Load())
+
+			// Replayed events are only sent to the callback
+			w.dispatchTo(cb, nil, nil, event.Event{IsCreate: true}, true)
+			assert.Equal(t, len(lines), strings.Count(out.String(), "\n"))
+			if tc.expectedCalls > 0 {
+				assert.Len(t, sent, tc.expectedCalls+1)
+			}
+		})
+	}
+}
+
+func TestDispatchStream(t *testing.T) {
+	tCases := map[string]struct {
+		only          bool
+		dump          bool
+		expectedCalls int
+	}{
+		"Along with the callback":     {only: false, expectedCalls: 3},
+		"In place of the callback":    {only: true, expectedCalls: 0},
+		"In place of the dumped ones": {only: true, dump: true, expectedCalls: 0},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			w := newWorker(nil)
+			w.acks = newAckTracker()
+			var out bytes.Buffer
+			if tc.dump {
+				w.DumpTo(&out, false)
+			}
+			ch := make(chan event.Event, 3)
+			w.StreamTo(ch, tc.only)
+			calls := 0
+			cb := func(string, bool, bool) bool {
+				calls++
+				return true
+			}
+			for i := 0; i < 3; i++ {
+				w.dispatch(cb, event.Event{IsCreate: true, Info: event.Info{Container: event.Container{ID: fmt.Sprint(i)}}}, false)
+			}
+			w.stream.close()
+
+			seqs := make([]uint64, 0)
+			for evt := range ch {
+				assert.Equal(t, fmt.Sprint(evt.Seq-1), evt.ID)
+				seqs = append(seqs, evt.Seq)
+			}
+			assert.Equal(t, []uint64{1, 2, 3}, seqs)
+			assert.Equal(t, tc.expectedCalls, calls)
+			if tc.dump {
+				assert.Equal(t, 3, strings.Count(out.String(), "\n"))
+			}
+			// Delivered, to be acknowledged
+			assert.True(t, w.AckEvent(3))
+			assert.Zero(t, w.dropped.Load())
+		})
+	}
+
+	// Stopping while nobody receives
+	w := newWorker(nil)
+	ctx, cancel := context.WithCancel(context.Background())
+	w.done = ctx.Done()
+	w.StreamTo(make(chan event.Event), true)
+	cancel()
+	w.dispatch(nil, event.Event{IsCreate: true}, false)
+	assert.Equal(t, uint64(1), w.dropped.Load())
+}
+
+func TestRun(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "engine.sock")
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"external":null}}`)
+		container.ResetStatus()
+	})
+	server := fake.NewServer()
+	require.NoError(t, server.Start(socket))
+	t.Cleanup(server.Stop)
+	server.Create("c1", `{"id":"c1","name":"listed","image":"fedora:38","state":"running"}`)
+
+	ch := make(chan event.Event)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- Run(ctx, `{"engines":{"external":{"enabled":true,"sockets":["`+socket+`"]}}}`, ch)
+	}()
+
+	evt := <-ch
+	assert.Equal(t, "listed", evt.Name)
+	assert.True(t, evt.IsCreate)
+	assert.Equal(t, uint64(1), evt.Seq)
+	require.Eventually(t, func() bool {
+		return server.Watchers() == 1
+	}, 5*time.Second, 10*time.Millisecond)
+	server.Create("c2", `{"id":"c2","name":"created","image":"fedora:38","state":"running"}`)
+	evt = <-ch
+	assert.Equal(t, "created", evt.Name)
+	assert.Equal(t, uint64(2), evt.Seq)
+	server.Remove("c2")
+	evt = <-ch
+	assert.False(t, evt.IsCreate)
+
+	// Closed once stopped
+	cancel()
+	for range ch {
+	}
+	assert.NoError(t, <-errCh)
+
+	// Closed on failure too
+	ch = make(chan event.Event)
+	assert.Error(t, Run(context.Background(), `{"engines":`, ch))
+	_, ok := <-ch
+	assert.False(t, ok)
+}
+
+func TestWorkerEventDumpFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "events.jsonl")
+	t.Cleanup(func() {
+		_ = config.Load(`{"event_dump":"","event_dump_only":false}`)
+	})
+
+	// Appended to by each worker
+	for i := 0; i < 2; i++ {
+		w, err := New(func(string, bool, bool) bool {
+			t.Error("callback called in dump only mode")
+			return true
+		}, `{"event_dump":"`+path+`","event_dump_only":true}`)
+		require.NoError(t, err)
+		w.dispatch(w.cb, event.Event{IsCreate: true}, true)
+		w.Stop()
+	}
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	lines := strings.Split(strings.TrimSuffix(string(data), "\n"), "\n")
+	require.Len(t, lines, 2)
+	for _, line := range lines {
+		assert.Equal(t, uint64(1), seqOf(t, line))
+	}
+
+	_, err = New(nil, `{"event_dump":"`+filepath.Join(path, "not-a-dir")+`"}`)
+	assert.Error(t, err)
+}
+
+func TestAckTracker(t *testing.T) {
+	tCases := map[string]struct {
+		delivered   uint64
+		dropped     []uint64
+		acks        []uint64
+		expectedOk  []bool
+		expectedLow uint64
+	}{
+		"In order":             {delivered: 3, acks: []uint64{1, 2, 3}, expectedOk: []bool{true, true, true}, expectedLow: 3},
+		"Out of order":         {delivered: 4, acks: []uint64{3, 1, 4}, expectedOk: []bool{true, true, true}, expectedLow: 1},
+		"Out of order, filled": {delivered: 4, acks: []uint64{3, 1, 4, 2}, expectedOk: []bool{true, true, true, true}, expectedLow: 4},
+		"Twice":                {delivered: 2, acks: []uint64{1, 1, 2}, expectedOk: []bool{true, true, true}, expectedLow: 2},
+		"Not delivered":        {delivered: 2, acks: []uint64{0, 3, 1}, expectedOk: []bool{false, false, true}, expectedLow: 1},
+		"Past drops":           {delivered: 4, dropped: []uint64{2, 3}, acks: []uint64{1}, expectedOk: []bool{true}, expectedLow: 3},
+		"Dropped first":        {delivered: 2, dropped: []uint64{1}, acks: []uint64{2}, expectedOk: []bool{true}, expectedLow: 2},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			a := newAckTracker()
+			for seq := uint64(1); seq <= tc.delivered; seq++ {
+				if slices.Contains(tc.dropped, seq) {
+					a.drop(seq)
+				} else {
+					a.deliver(seq)
+				}
+			}
+			for i, seq := range tc.acks {
+				assert.Equal(t, tc.expectedOk[i], a.ack(seq), "ack of %d", seq)
+			}
+			assert.Equal(t, tc.expectedLow, a.lowWaterMark())
+		})
+	}
+}
+
+func TestAckTrackerBounds(t *testing.T) {
+	a := newAckTracker()
+	a.deliver(maxPendingAcks + 2)
+	// All waiting for the first one
+	for seq := uint64(2); seq < maxPendingAcks+2; seq++ {
+		require.True(t, a.ack(seq))
+	}
+	assert.False(t, a.ack(maxPendingAcks+2))
+	// The missing one is always accepted, draining the pending ones
+	assert.True(t, a.ack(1))
+	assert.Equal(t, uint64(maxPendingAcks+1), a.lowWaterMark())
+	assert.Empty(t, a.pending)
+	assert.True(t, a.ack(maxPendingAcks+2))
+	assert.Equal(t, uint64(maxPendingAcks+2), a.lowWaterMark())
+
+	// A nil ackTracker tracks nothing
+	var none *ackTracker
+	none.deliver(1)
+	none.drop(2)
+	assert.False(t, none.ack(1))
+	assert.Zero(t, none.lowWaterMark())
+}
+
+func TestWorkerAckEvents(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"ack_events":false}`)
+	})
+	tCases := map[string]struct {
+		initCfg       string
+		expectedOk    bool
+		expectedAcked uint64
+	}{
+		"Disabled": {initCfg: `{"ack_events":false}`, expectedOk: false, expectedAcked: 0},
+		"Enabled":  {initCfg: `{"ack_events":true}`, expectedOk: true, expectedAcked: 2},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			t.Cleanup(container.ResetStatus)
+			sent := make([]string, 0)
+			w, err := New(func(evtJson string, _ bool, _ bool) bool {
+				sent = append(sent, evtJson)
+				return true
+			}, tc.initCfg)
+			require.NoError(t, err)
+			var ctx context.Context
+			ctx, w.cancel = context.WithCancel(context.Background())
+			w.run(ctx, []container.Engine{&controlledEngine{}}, nil, nil)
+			w.dispatch(w.cb, event.Event{IsCreate: true}, true)
+			w.dispatch(w.cb, event.Event{IsCreate: true}, true)
+			w.dispatch(w.cb, event.Event{IsCreate: true}, true)
+			require.Len(t, sent, 3)
+
+			assert.Equal(t, tc.expectedOk, w.AckEvent(seqOf(t, sent[1])))
+			assert.Zero(t, w.AckedSeq())
+			w.Stop()
+
+			// The events delivered before stopping can still be acknowledged
+			assert.Equal(t, tc.expectedOk, w.AckEvent(seqOf(t, sent[0])))
+			assert.False(t, w.AckEvent(uint64(len(sent)+1)))
+			assert.Equal(t, tc.expectedAcked, w.AckedSeq())
+			assert.Equal(t, tc.expectedAcked, w.Status().AckedSeq)
+		})
+	}
+}
+
+func TestWorkerLoopOverflow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	containerEngines := make([]container.Engine, 0)
+	for i := 1; i <= 5; i++ {
+		containerEngines = append(containerEngines, &noopEngine{
+			exitAfter:  time.Duration(math.MaxInt64),
+			eventAfter: time.Duration(i) * time.Millisecond,
+		})
+	}
+
+	// A consumer whose bounded queue is never drained
+	queue := make(chan string, 3)
+	w := newWorker(func(jsonEvt string, _ bool, _ bool) bool {
+		select {
+		case queue <- jsonEvt:
+			return true
+		default:
+			return false
+		}
+	})
+	w.run(ctx, containerEngines, nil, nil)
+
+	time.Sleep(100 * time.Millisecond)
+	cancel()
+	w.wg.Wait()
+	close(queue)
+
+	var last uint64
+	for evtJson := range queue {
+		seq := seqOf(t, evtJson)
+		assert.Equal(t, last+1, seq)
+		last = seq
+	}
+	// The overflown events are the gap between the last event got and the last one sent
+	status := w.Status()
+	assert.Equal(t, uint64(len(containerEngines)), status.LastSeq)
+	assert.Equal(t, uint64(len(containerEngines)-cap(queue)), status.DroppedEvents)
+	assert.Equal(t, status.LastSeq-last, status.DroppedEvents)
+}
+
+func TestWorkerLoopIntermittentCallback(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	calls := 0
+	delivered := 0
+	containerEngines := make([]container.Engine, 0)
+	for i := 1; i <= 10; i++ {
+		containerEngines = append(containerEngines, &noopEngine{
+			exitAfter:  time.Duration(math.MaxInt64),
+			eventAfter: time.Duration(i) * time.Millisecond,
+		})
+	}
+
+	// Refuse every other call
+	w := newWorker(func(jsonEvt string, isCreate bool, _ bool) bool {
+		calls++
+		if calls%2 == 0 {
+			delivered++
+			return true
+		}
+		return false
+	})
+	w.run(ctx, containerEngines, nil, nil)
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+	w.wg.Wait()
+
+	// Each event got delivered at its second attempt
+	assert.Equal(t, len(containerEngines), delivered)
+	assert.Equal(t, uint64(0), w.dropped.Load())
+}
+
+func TestWorkerLoopLateEngine(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	numEvents := 0
+	numInitialState := 0
+	attacher := &attacherEngine{noopEngine: noopEngine{
+		exitAfter:  time.Duration(math.MaxInt64),
+		eventAfter: time.Duration(math.MaxInt64),
+	}}
+	late := &noopEngine{
+		exitAfter:  time.Duration(math.MaxInt64),
+		eventAfter: 5 * time.Millisecond,
+	}
+	lateEngines := make(chan container.Discovered, 1)
+	lateEngines <- container.Discovered{
+		Engine:     late,
+		Containers: []event.Event{{IsCreate: true}},
+	}
+	close(lateEngines)
+
+	w := newWorker(func(jsonEvt string, isCreate bool, initialState bool) bool {
+		numEvents++
+		if initialState {
+			numInitialState++
+		}
+		return true
+	})
+	w.run(ctx, []container.Engine{attacher}, lateEngines, nil)
+
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	w.wg.Wait()
+
+	// Its pre-existing container, plus the listened one
+	assert.Equal(t, 2, numEvents)
+	assert.Equal(t, 0, numInitialState)
+	assert.Equal(t, []container.Engine{late}, attacher.attached)
+}
+
+func TestWorkerLoopLateReinspecter(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	other := &noopEngine{
+		exitAfter:  time.Duration(math.MaxInt64),
+		eventAfter: 20 * time.Millisecond,
+	}
+	late := &reinspecterEngine{noopEngine: noopEngine{
+		exitAfter:  time.Duration(math.MaxInt64),
+		eventAfter: time.Duration(math.MaxInt64),
+	}}
+	lateEngines := make(chan container.Discovered, 1)
+	lateEngines <- container.Discovered{Engine: late}
+	close(lateEngines)
+
+	w := newWorker(func(string, bool, bool) bool { return true })
+	w.run(ctx, []container.Engine{other}, lateEngines, nil)
+
+	assert.Eventually(t, func() bool {
+		return late.reinspects.Load() == 1
+	}, time.Second, time.Millisecond)
+	cancel()
+	w.wg.Wait()
+}
+
+func TestWorkerLoopCallbackRetry(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var calls atomic.Int32
+	engine := &noopEngine{
+		exitAfter:  time.Duration(math.MaxInt64),
+		eventAfter: 5 * time.Millisecond,
+	}
+
+	w := newWorker(func(string, bool, bool) bool {
+		// Refused at first
+		return calls.Add(1) > callbackMaxRetries
+	})
+	w.run(ctx, []container.Engine{engine, &controlledEngine{}}, nil, nil)
+
+	assert.Eventually(t, func() bool {
+		return calls.Load() == callbackMaxRetries+1
+	}, time.Second, time.Millisecond)
+	// The loop kept serving controls meanwhile
+	assert.True(t, w.StopEngine("controlled", "/run/controlled.sock"))
+	cancel()
+	w.wg.Wait()
+	assert.Equal(t, uint64(0), w.dropped.Load())
+}
+
+func TestDispatchUpdate(t *testing.T) {
+	var (
+		evtJson      string
+		added        bool
+		initialState bool
+	)
+	newWorker(nil).dispatch(func(json string, isCreate bool, initial bool) bool {
+		evtJson, added, initialState = json, isCreate, initial
+		return true
+	}, event.Event{Info: event.Info{Update: true}, IsCreate: true}, false)
+
+	// Updates are still added events, never part of the initial state
+	assert.Contains(t, evtJson, `"update":true`)
+	assert.True(t, added)
+	assert.False(t, initialState)
+}
+
+func TestReplayBuffer(t *testing.T) {
+	evt := func(id string) event.Event {
+		return event.Event{Info: event.Info{Container: event.Container{FullID: id}}, IsCreate: true}
+	}
+	tCases := map[string]struct {
+		size        int
+		pushed      []string
+		expectedIDs []string
+	}{
+		"Disabled": {
+			size:        0,
+			pushed:      []string{"a", "b"},
+			expectedIDs: []string{},
+		},
+		"Not full": {
+			size:        3,
+			pushed:      []string{"a", "b"},
+			expectedIDs: []string{"a", "b"},
+		},
+		"Full": {
+			size:        2,
+			pushed:      []string{"a", "b"},
+			expectedIDs: []string{"a", "b"},
+		},
+		"Wrapped": {
+			size:        2,
+			pushed:      []string{"a", "b", "c"},
+			expectedIDs: []string{"b", "c"},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			replay := newReplayBuffer(tc.size)
+			for _, id := range tc.pushed {
+				replay.push(evt(id))
+			}
+			ids := make([]string, 0)
+			for _, replayed := range replay.snapshot() {
+				ids = append(ids, replayed.FullID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids)
+		})
+	}
+}
+
+func TestWorkerLoopReplay(t *testing.T) {
+	tCases := map[string]struct {
+		replaySize       int
+		expectedReplayed int
+	}{
+		"Disabled": {
+			replaySize:       0,
+			expectedReplayed: 0,
+		},
+		"Larger than events": {
+			replaySize:       10,
+			expectedReplayed: 3,
+		},
+		"Smaller than events": {
+			replaySize:       2,
+			expectedReplayed: 2,
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			ctx, cancel := context.WithCancel(context.Background())
+			containerEngines := make([]container.Engine, 0)
+			for i := 1; i <= 3; i++ {
+				containerEngines = append(containerEngines, &noopEngine{
+					exitAfter:  time.Duration(math.MaxInt64),
+					eventAfter: time.Duration(i) * time.Millisecond,
+				})
+			}
+			missed := 0
+			replayed := 0
+
+			// The first consumer is not ready yet
+			w := newWorker(func(string, bool, bool) bool {
+				missed++
+				return true
+			})
+			w.replay = newReplayBuffer(tc.replaySize)
+			w.run(ctx, containerEngines, nil, nil)
+
+			time.Sleep(20 * time.Millisecond)
+			assert.True(t, w.AttachCallback(func(_ string, _ bool, initialState bool) bool {
+				assert.True(t, initialState)
+				replayed++
+				return true
+			}))
+			time.Sleep(10 * time.Millisecond)
+			cancel()
+			w.wg.Wait()
+
+			assert.Equal(t, len(containerEngines), missed)
+			assert.Equal(t, tc.expectedReplayed, replayed)
+		})
+	}
+}
+
+func TestWorkerLoopEngineControl(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var numEvents atomic.Int32
+	controlled := &controlledEngine{}
+	other := &noopEngine{
+		exitAfter:  time.Duration(math.MaxInt64),
+		eventAfter: time.Duration(math.MaxInt64),
+	}
+
+	w := newWorker(func(string, bool, bool) bool {
+		numEvents.Add(1)
+		return true
+	})
+	w.run(ctx, []container.Engine{controlled, other}, nil, nil)
+
+	control := func(name, socket string, start bool) bool {
+		if start {
+			return w.StartEngine(name, socket)
+		}
+		return w.StopEngine(name, socket)
+	}
+	state := func(e container.Engine) container.EngineState {
+		st, _ := container.GetEngineState(e)
+		return st
+	}
+
+	// Already listening
+	assert.False(t, control("controlled", "/run/controlled.sock", true))
+
+	assert.True(t, control("controlled", "/run/controlled.sock", false))
+	assert.Eventually(t, func() bool {
+		return state(controlled) == container.EngineStopped
+	}, time.Second, time.Millisecond)
+	// Others are untouched
+	assert.Equal(t, container.EngineRunning, state(other))
+	assert.False(t, control("controlled", "/run/controlled.sock", false))
+
+	// Started again, listing its containers
+	assert.True(t, control("controlled", "/run/controlled.sock", true))
+	assert.Equal(t, container.EngineRunning, state(controlled))
+	assert.Equal(t, int32(2), controlled.listens.Load())
+	assert.Equal(t, int32(1), numEvents.Load())
+
+	// Unknown engine
+	assert.False(t, control("controlled", "/run/other.sock", false))
+	assert.False(t, control("controlled", "/run/other.sock", true))
+
+	cancel()
+	w.wg.Wait()
+}
+
+func TestWorkerEngineControlNotStarted(t *testing.T) {
+	w := newWorker(func(string, bool, bool) bool { return true })
+
+	controlled := make(chan struct{})
+	go func() {
+		defer close(controlled)
+		assert.False(t, w.StopEngine("controlled", "/run/controlled.sock"))
+		assert.False(t, w.StartEngine("controlled", "/run/controlled.sock"))
+	}()
+	select {
+	case <-controlled:
+	case <-time.After(time.Second):
+		t.Fatal("engine control blocked before start")
+	}
+}
+
+func TestContainerCache(t *testing.T) {
+	ctr := func(id string, isCreate bool) event.Event {
+		return event.Event{Info: event.Info{Container: event.Container{Type: 0, ID: id[:2], FullID: id}}, IsCreate: isCreate}
+	}
+	type sent struct {
+		id       string
+		isCreate bool
+	}
+	tCases := map[string]struct {
+		observed      []event.Event
+		listed        []event.Event
+		complete      bool
+		expectedSent  []sent
+		expectedCache []string
+	}{
+		"Nothing tracked": {
+			listed:        []event.Event{ctr("aaaa", true)},
+			complete:      true,
+			expectedSent:  []sent{{"aaaa", true}},
+			expectedCache: []string{"aaaa"},
+		},
+		"Went away": {
+			observed:      []event.Event{ctr("aaaa", true), ctr("bbbb", true)},
+			listed:        []event.Event{ctr("bbbb", true)},
+			complete:      true,
+			expectedSent:  []sent{{"aaaa", false}, {"bbbb", true}},
+			expectedCache: []string{"bbbb"},
+		},
+		"Already removed": {
+			observed:      []event.Event{ctr("aaaa", true), ctr("aaaa", false)},
+			listed:        []event.Event{},
+			complete:      true,
+			expectedSent:  []sent{},
+			expectedCache: []string{},
+		},
+		"Incomplete listing": {
+			observed:      []event.Event{ctr("aaaa", true), ctr("bbbb", true)},
+			listed:        []event.Event{ctr("bbbb", true)},
+			complete:      false,
+			expectedSent:  []sent{{"bbbb", true}},
+			expectedCache: []string{"aaaa", "bbbb"},
+		},
+	}
+
+	engine := &controlledEngine{}
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			cache := newContainerCache()
+			for _, evt := range tc.observed {
+				cache.observe(engine, evt)
+			}
+			evts := cache.reconcile(engine, tc.listed, tc.complete)
+			sentEvts := make([]sent, 0, len(evts))
+			for _, evt := range evts {
+				sentEvts = append(sentEvts, sent{evt.FullID, evt.IsCreate})
+				if !evt.IsCreate {
+					assert.Equal(t, event.StateRemoved, evt.State)
+					assert.Equal(t, evt.FullID[:2], evt.ID)
+				}
+			}
+			assert.Equal(t, tc.expectedSent, sentEvts)
+			cached := make([]string, 0)
+			for id := range cache.engines[cacheKey(engine)] {
+				cached = append(cached, id)
+			}
+			assert.ElementsMatch(t, tc.expectedCache, cached)
+		})
+	}
+
+	// Fetched containers belong to other engines
+	cache := newContainerCache()
+	cache.observe(&noopEngine{}, ctr("aaaa", true))
+	cache.observe(container.NewFetcherEngine(context.Background(), nil, nil), ctr("bbbb", true))
+	assert.Len(t, cache.engines, 1)
+}
+
+func TestWorkerLoopReconcile(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	late := &controlledEngine{}
+	gone := event.Event{Info: event.Info{Container: event.Container{ID: "gone", FullID: "gone"}}, IsCreate: true}
+	kept := event.Event{Info: event.Info{Container: event.Container{ID: "kept", FullID: "kept"}}, IsCreate: true}
+
+	// Tracked by a previous run
+	cache := newContainerCache()
+	cache.observe(late, gone)
+	cache.observe(late, kept)
+
+	lateEngines := make(chan container.Discovered, 1)
+	lateEngines <- container.Discovered{
+		Engine:     late,
+		Containers: []event.Event{kept},
+	}
+	close(lateEngines)
+
+	type sent struct {
+		json     string
+		isCreate bool
+	}
+	received := make(chan sent, 10)
+	w := newWorker(func(jsonEvt string, isCreate bool, _ bool) bool {
+		received <- sent{jsonEvt, isCreate}
+		return true
+	})
+	w.cache = cache
+	w.run(ctx, nil, lateEngines, nil)
+
+	removed := <-received
+	assert.False(t, removed.isCreate)
+	assert.Contains(t, removed.json, `"full_id":"gone"`)
+	assert.Contains(t, removed.json, `"state":"removed"`)
+	listed := <-received
+	assert.True(t, listed.isCreate)
+	assert.Contains(t, listed.json, `"full_id":"kept"`)
+
+	cancel()
+	w.wg.Wait()
+}
+
+func TestWorkerLoopSockets(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	var numEvents atomic.Int32
+	attacher := &attacherEngine{noopEngine: noopEngine{
+		exitAfter:  time.Duration(math.MaxInt64),
+		eventAfter: time.Duration(math.MaxInt64),
+	}}
+	appeared := &controlledEngine{}
+	sockets := make(chan container.SocketChange)
+
+	w := newWorker(func(string, bool, bool) bool {
+		numEvents.Add(1)
+		return true
+	})
+	w.run(ctx, []container.Engine{attacher}, nil, sockets)
+
+	control := func(start bool) bool {
+		return w.controlEngine(appeared.Name(), appeared.Sock(), start)
+	}
+	state := func() container.EngineState {
+		st, _ := container.GetEngineState(appeared)
+		return st
+	}
+
+	// Its socket appeared
+	sockets <- container.SocketChange{Discovered: &container.Discovered{
+		Engine:     appeared,
+		Containers: []event.Event{{IsCreate: true}},
+	}}
+	// Served once the appearance got handled
+	assert.False(t, control(true))
+	assert.Equal(t, container.EngineRunning, state())
+	assert.Equal(t, int32(1), numEvents.Load())
+	assert.Equal(t, []container.Engine{appeared}, attacher.attached)
+
+	// Its socket went away
+	sockets <- container.SocketChange{Name: appeared.Name(), Socket: appeared.Sock()}
+	assert.Eventually(t, func() bool {
+		return state() == container.EngineStopped
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []container.Engine{appeared}, attacher.detached)
+	// Forgotten, it cannot be started anymore
+	assert.False(t, control(true))
+
+	cancel()
+	w.wg.Wait()
+}
+
+func TestCreateTracker(t *testing.T) {
+	const timeout = 2 * time.Second
+	now := time.Now()
+	ctr := func(id string, isCreate bool) event.Event {
+		return event.Event{Info: event.Info{Container: event.Container{ID: id, FullID: id}}, IsCreate: isCreate}
+	}
+	type step struct {
+		start    string
+		push     *event.Event
+		expire   bool
+		after    time.Duration
+		expected []event.Event
+	}
+	push := func(id string, isCreate bool) *event.Event {
+		evt := ctr(id, isCreate)
+		return &evt
+	}
+
+	tCases := map[string]struct {
+		steps            []step
+		expectedOrphaned uint64
+	}{
+		"Not in flight": {
+			steps: []step{
+				{push: push("c1", false), expected: []event.Event{ctr("c1", false)}},
+				{push: push("c1", true), expected: []event.Event{ctr("c1", true)}},
+			},
+		},
+		"Remove held until its create": {
+			steps: []step{
+				{start: "c1"},
+				{push: push("c1", false), expected: nil},
+				{expire: true, after: time.Second, expected: []event.Event{}},
+				{push: push("c1", true), after: time.Second, expected: []event.Event{ctr("c1", true), ctr("c1", false)}},
+				// No longer tracked
+				{push: push("c1", false), after: time.Second, expected: []event.Event{ctr("c1", false)}},
+			},
+		},
+		"Duplicated remove": {
+			steps: []step{
+				{start: "c1"},
+				{push: push("c1", false), expected: nil},
+				{push: push("c1", false), expected: nil},
+				{push: push("c1", true), expected: []event.Event{ctr("c1", true), ctr("c1", false)}},
+			},
+		},
+		"Create timed out": {
+			steps: []step{
+				{start: "c1"},
+				{push: push("c1", false), expected: nil},
+				{expire: true, after: timeout, expected: []event.Event{ctr("c1", false)}},
+				// Its remove has been delivered already
+				{push: push("c1", true), after: timeout, expected: nil},
+			},
+			expectedOrphaned: 1,
+		},
+		"Remove after the create timed out": {
+			steps: []step{
+				{start: "c1"},
+				{push: push("c1", false), after: timeout, expected: []event.Event{ctr("c1", false)}},
+			},
+		},
+		"Other containers are not held": {
+			steps: []step{
+				{start: "c1"},
+				{push: push("c2", false), expected: []event.Event{ctr("c2", false)}},
+				{push: push("c1", true), expected: []event.Event{ctr("c1", true)}},
+			},
+		},
+		"Empty ID": {
+			steps: []step{
+				{start: ""},
+				{push: push("", false), expected: []event.Event{ctr("", false)}},
+			},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			tracker := newCreateTracker(timeout)
+			for i, s := range tc.steps {
+				at := now.Add(s.after)
+				switch {
+				case s.push != nil:
+					assert.Equal(t, s.expected, tracker.push(*s.push, at), i)
+				case s.expire:
+					assert.Equal(t, s.expected, tracker.expire(at), i)
+				default:
+					tracker.start(s.start, at)
+				}
+			}
+			assert.Equal(t, tc.expectedOrphaned, tracker.orphaned.Load())
+			_, pending := tracker.next()
+			assert.False(t, pending)
+			assert.Empty(t, tracker.inflight)
+		})
+	}
+}
+
+func TestCreateTrackerBounds(t *testing.T) {
+	now := time.Now()
+	tracker := newCreateTracker(time.Second)
+	for i := 0; i < 2*maxTrackedCreates; i++ {
+		tracker.start(fmt.Sprintf("c%d", i), now)
+	}
+	assert.Len(t, tracker.inflight, maxTrackedCreates)
+
+	for i := 0; i < 2*maxTrackedCreates; i++ {
+		tracker.push(event.Event{Info: event.Info{Container: event.Container{ID: fmt.Sprintf("c%d", i)}}}, now)
+	}
+	assert.Len(t, tracker.held, maxTrackedCreates)
+	tracker.expire(now.Add(time.Second))
+	assert.Empty(t, tracker.held)
+	assert.Len(t, tracker.orphans, maxTrackedCreates)
+
+	// Disabled
+	tracker = newCreateTracker(0)
+	tracker.start("c1", now)
+	assert.Empty(t, tracker.inflight)
+}
+
+// streamEngine forwards the events sent on evts.
+type streamEngine struct {
+	noopEngine
+	name string
+	evts chan event.Event
+}
+
+func (s *streamEngine) Name() string {
+	return s.name
+}
+
+func (s *streamEngine) Listen(_ context.Context, _ *sync.WaitGroup) (<-chan event.Event, error) {
+	return s.evts, nil
+}
+
+func TestWorkerLoopCreateBeforeRemove(t *testing.T) {
+	const (
+		containers = 10000
+		inFlight   = 256
+	)
+
+	// Creates are fetched on demand, while the engine listener reports the removals
+	fetcher := &streamEngine{name: "fetcher", evts: make(chan event.Event)}
+	remover := &streamEngine{name: "remover", evts: make(chan event.Event)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	created := make(map[string]bool, containers)
+	var violations, delivered atomic.Int32
+	w := newWorker(func(jsonEvt string, isCreate bool, _ bool) bool {
+		var info event.Info
+		if err := json.Unmarshal([]byte(jsonEvt), &info); err != nil {
+			t.Error(err)
+		}
+		if isCreate {
+			created[info.ID] = true
+		} else if !created[info.ID] {
+			violations.Add(1)
+		}
+		delivered.Add(1)
+		return true
+	})
+	w.creates = newCreateTracker(time.Minute)
+	w.run(ctx, []container.Engine{fetcher, remover}, nil, nil)
+
+	sleep := func() {
+		time.Sleep(time.Duration(rand.Intn(500)) * time.Microsecond)
+	}
+	slots := make(chan struct{}, inFlight)
+	senders := sync.WaitGroup{}
+	for _, i := range rand.Perm(containers) {
+		id := fmt.Sprintf("%012d", i)
+		slots <- struct{}{}
+		w.creates.start(id, time.Now())
+		senders.Add(2)
+		go func() {
+			defer senders.Done()
+			defer func() { <-slots }()
+			sleep()
+			fetcher.evts <- event.Event{Info: event.Info{Container: event.Container{ID: id, FullID: id}}, IsCreate: true}
+		}()
+		go func() {
+			defer senders.Done()
+			sleep()
+			remover.evts <- event.Event{Info: event.Info{Container: event.Container{ID: id, FullID: id}}}
+		}()
+	}
+	senders.Wait()
+	assert.Eventually(t, func() bool {
+		return delivered.Load() == 2*containers
+	}, 10*time.Second, time.Millisecond)
+
+	cancel()
+	w.wg.Wait()
+	assert.Zero(t, violations.Load())
+	assert.Zero(t, w.creates.orphaned.Load())
+	assert.Empty(t, w.creates.inflight)
+	assert.Empty(t, w.creates.held)
+}
+
+func TestWorkerContainers(t *testing.T) {
+	_, err := New(nil, `{"label_max_len":"not a number"}`)
+	assert.Error(t, err)
+
+	engine := &streamEngine{name: "stream", evts: make(chan event.Event)}
+	ctr := func(id string, isCreate bool) event.Event {
+		return event.Event{Info: event.Info{Container: event.Container{ID: id, FullID: id}}, IsCreate: isCreate}
+	}
+	var delivered atomic.Int32
+	w := newWorker(func(string, bool, bool) bool {
+		delivered.Add(1)
+		return true
+	})
+	var ctx context.Context
+	ctx, w.cancel = context.WithCancel(context.Background())
+	w.run(ctx, []container.Engine{engine}, nil, nil)
+
+	engine.evts <- ctr("bbbb", true)
+	engine.evts <- ctr("aaaa", true)
+	engine.evts <- ctr("cccc", true)
+	engine.evts <- ctr("bbbb", false)
+	assert.Eventually(t, func() bool {
+		return delivered.Load() == 4
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []event.Container{ctr("aaaa", true).Container, ctr("cccc", true).Container}, w.Containers())
+
+	// Fetch requests are bounded
+	for i := 0; i < fetchChSize; i++ {
+		assert.True(t, w.Fetch(fmt.Sprintf("%012d", i)))
+	}
+	assert.False(t, w.Fetch("2400edb296c5"))
+	assert.Zero(t, w.Status().DroppedEvents)
+
+	w.Stop()
+	// Stopped: nothing to control anymore
+	assert.False(t, w.StartEngine(engine.Name(), engine.Sock()))
+}
+
+func TestWorkerContainersEngines(t *testing.T) {
+	ctr := func(engine, id string, isCreate bool) event.Event {
+		return event.Event{Info: event.Info{Container: event.Container{ID: id[:12], FullID: id, Engine: engine,
+			Labels: map[string]string{"team": "falco"}}}, IsCreate: isCreate}
+	}
+	const id = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+	w := newWorker(nil)
+	// The same container, seen by both engines while migrating
+	w.track(ctr("docker", id, true))
+	w.track(ctr("containerd", id, true))
+	expected := []event.Container{ctr("containerd", id, true).Container, ctr("docker", id, true).Container}
+	assert.Equal(t, expected, w.Containers())
+	assert.Equal(t, expected, w.ListByLabel("team", "falco"))
+
+	w.track(ctr("docker", id, false))
+	assert.Equal(t, []event.Container{ctr("containerd", id, true).Container}, w.Containers())
+
+	// The synthetic removals keep the engine
+	cache := newContainerCache()
+	engine := &controlledEngine{}
+	cache.observe(engine, ctr("containerd", id, true))
+	evts := cache.reconcile(engine, nil, true)
+	require.Len(t, evts, 1)
+	assert.False(t, evts[0].IsCreate)
+	assert.Equal(t, "containerd", evts[0].Engine)
+}
+
+func TestDedupPolicy(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"duplicate_ids":"all","engine_priority":null}`)
+	})
+	const id = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+	view := func(engine string, isCreate, update bool, name, ip string, labels map[string]string) event.Event {
+		return event.Event{Info: event.Info{Container: event.Container{ID: id[:12], FullID: id, Engine: engine,
+			Name: name, Ip: ip, Labels: labels, State: event.StateRunning}, Update: update}, IsCreate: isCreate}
+	}
+	docker := view("docker", true, false, "nginx", "", map[string]string{"team": "falco", "app": "nginx"})
+	containerd := view("containerd", true, false, "", "172.17.0.2", map[string]string{"team": "sysdig", "ns": "moby"})
+	// containerd view with the docker one fields filled in
+	merged := view("containerd", true, true, "nginx", "172.17.0.2", map[string]string{"team": "sysdig", "ns": "moby", "app": "nginx"})
+	removed := func(evt event.Event) event.Event {
+		evt.IsCreate = false
+		return evt
+	}
+	asUpdate := func(evt event.Event) event.Event {
+		evt.Update = true
+		return evt
+	}
+
+	tCases := map[string]struct {
+		cfg                string
+		evts               []event.Event
+		expectedEvts       []event.Event
+		expectedSuperseded []string
+	}{
+		"All": {
+			cfg:          `{"duplicate_ids":"all","engine_priority":["containerd"]}`,
+			evts:         []event.Event{docker, containerd, removed(docker), removed(containerd)},
+			expectedEvts: []event.Event{docker, containerd, removed(docker), removed(containerd)},
+		},
+		"Invalid": {
+			cfg:          `{"duplicate_ids":"first","engine_priority":["containerd"]}`,
+			evts:         []event.Event{docker, containerd},
+			expectedEvts: []event.Event{docker, containerd},
+		},
+		"Prefer, first reported": {
+			cfg:          `{"duplicate_ids":"prefer","engine_priority":null}`,
+			evts:         []event.Event{docker, containerd, asUpdate(containerd), removed(containerd), removed(docker)},
+			expectedEvts: []event.Event{docker, removed(docker)},
+		},
+		"Prefer, by priority": {
+			cfg:  `{"duplicate_ids":"prefer","engine_priority":["containerd","docker"]}`,
+			evts: []event.Event{docker, containerd, asUpdate(docker), asUpdate(containerd), removed(containerd), removed(docker)},
+			expectedEvts: []event.Event{
+				docker,
+				// Switched to the preferred one
+				asUpdate(containerd),
+				asUpdate(containerd),
+				// Still reported by docker
+				asUpdate(docker),
+				removed(docker),
+			},
+			expectedSuperseded: []string{"docker", "containerd"},
+		},
+		"Prefer, removed before reported": {
+			cfg:          `{"duplicate_ids":"prefer","engine_priority":["containerd"]}`,
+			evts:         []event.Event{removed(docker), docker, removed(containerd), removed(docker)},
+			expectedEvts: []event.Event{removed(docker), docker, removed(docker)},
+		},
+		"Merge": {
+			cfg:  `{"duplicate_ids":"merge","engine_priority":["containerd"]}`,
+			evts: []event.Event{docker, containerd, asUpdate(docker), removed(docker), removed(containerd)},
+			expectedEvts: []event.Event{
+				docker,
+				merged,
+				// The docker view did not change
+				// The docker fields are gone
+				asUpdate(containerd),
+				removed(containerd),
+			},
+			expectedSuperseded: []string{"docker"},
+		},
+		"Merge, conflicting lifecycle": {
+			cfg: `{"duplicate_ids":"merge","engine_priority":["containerd"]}`,
+			evts: []event.Event{containerd, func() event.Event {
+				exited := docker
+				exited.State = event.StateExited
+				exited.ExitCode = 1
+				exited.FinishedAt = 1700000000
+				return asUpdate(exited)
+			}(), removed(docker), removed(containerd)},
+			expectedEvts: []event.Event{containerd, merged, asUpdate(containerd), removed(containerd)},
+		},
+	}
+
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			require.NoError(t, config.Load(tc.cfg))
+			d := newDedupPolicy()
+			evts := make([]event.Event, 0)
+			superseded := make([]string, 0)
+			for _, evt := range tc.evts {
+				out, sup := d.apply(evt)
+				evts = append(evts, out...)
+				for _, ctr := range sup {
+					superseded = append(superseded, ctr.Engine)
+				}
+			}
+			assert.Equal(t, tc.expectedEvts, evts)
+			if tc.expectedSuperseded == nil {
+				tc.expectedSuperseded = []string{}
+			}
+			assert.Equal(t, tc.expectedSuperseded, superseded)
+			if d != nil {
+				assert.Empty(t, d.ctrs)
+			}
+		})
+	}
+
+	// The views are never modified by the merge
+	assert.Equal(t, map[string]string{"team": "sysdig", "ns": "moby"}, containerd.Labels)
+}
+
+func TestWorkerDuplicateIDs(t *testing.T) {
+	t.Cleanup(func() {
+		_ = config.Load(`{"duplicate_ids":"all","engine_priority":null}`)
+		container.ResetStatus()
+	})
+	w, err := New(nil, `{"duplicate_ids":"prefer","engine_priority":["containerd"]}`)
+	require.NoError(t, err)
+	const id = "2400edb296c5d631fef083a30c680f71801b0409a9676ee546c084d0087d7c7d"
+	ctr := func(engine string, isCreate bool) event.Event {
+		return event.Event{Info: event.Info{Container: event.Container{ID: id[:12], FullID: id, Engine: engine}}, IsCreate: isCreate}
+	}
+	deliver := func(evt event.Event) {
+		for _, evt := range w.deduplicate(evt) {
+			w.track(evt)
+		}
+	}
+
+	deliver(ctr("docker", true))
+	deliver(ctr("containerd", true))
+	// The docker container got superseded
+	assert.Equal(t, []event.Container{ctr("containerd", true).Container}, w.Containers())
+	deliver(ctr("containerd", true))
+	deliver(ctr("containerd", false))
+	assert.Equal(t, []event.Container{ctr("docker", true).Container}, w.Containers())
+	deliver(ctr("docker", false))
+	assert.Empty(t, w.Containers())
+}
+
+// countingListener counts the connections it accepted that are still open:
+// the server closes them once their client goes away.
+type countingListener struct {
+	net.Listener
+	open *atomic.Int32
+}
+
+func (l countingListener) Accept() (net.Conn, error) {
+	conn, err := l.Listener.Accept()
+	if err != nil {
+		return nil, err
+	}
+	l.open.Add(1)
+	return &countedConn{Conn: conn, open: l.open}, nil
+}
+
+type countedConn struct {
+	net.Conn
+	once sync.Once
+	open *atomic.Int32
+}
+
+func (c *countedConn) Close() error {
+	c.once.Do(func() {
+		c.open.Add(-1)
+	})
+	return c.Conn.Close()
+}
+
+func TestWorkerFlappingSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "engine.sock")
+	require.NoError(t, config.Load(`{"engines":{"external":{"enabled":true,"sockets":["`+socket+`"]}}}`))
+	t.Cleanup(func() {
+		_ = config.Load(`{"engines":{"external":null}}`)
+	})
+	container.ResetStatus()
+	t.Cleanup(container.ResetStatus)
+
+	// The server outlives its sockets, keeping the connections of the clients not closed
+	server := fake.NewServer()
+	t.Cleanup(server.Stop)
+	var open atomic.Int32
+
+	w := newWorker(func(string, bool, bool) bool {
+		return true
+	})
+	ctx, cancel := context.WithCancel(context.Background())
+	sockets := container.WatchSockets(ctx, container.ConfiguredGenerators(), 10*time.Millisecond)
+	w.run(ctx, []container.Engine{container.NewFetcherEngine(ctx, w.fetchCh, nil), container.NewReinspectEngine(ctx, nil)},
+		nil, sockets)
+
+	status := func() container.EngineStatus {
+		for _, st := range container.Status() {
+			if st.Socket == socket {
+				return st
+			}
+		}
+		return container.EngineStatus{}
+	}
+	for i := 0; i < 3; i++ {
+		// The socket appears
+		l, err := net.Listen("unix", socket)
+		require.NoError(t, err)
+		l.(*net.UnixListener).SetUnlinkOnClose(false)
+		t.Cleanup(func() {
+			_ = l.Close()
+		})
+		server.Serve(countingListener{Listener: l, open: &open})
+		require.Eventually(t, func() bool {
+			return status().State == container.EngineRunning
+		}, 5*time.Second, 10*time.Millisecond)
+		// The engine, along with its fetcher and reinspector copies
+		assert.Equal(t, 3, status().OpenConnections)
+		// Connected by the engine listener and the fetcher copy
+		require.True(t, w.Fetch("missing"))
+		require.Eventually(t, func() bool {
+			return open.Load() == 2
+		}, 5*time.Second, 10*time.Millisecond)
+
+		// The socket goes away: the previous clients get closed
+		require.NoError(t, os.Remove(socket))
+		require.Eventually(t, func() bool {
+			return status().State == container.EngineStopped && open.Load() == 0
+		}, 5*time.Second, 10*time.Millisecond)
+		assert.Zero(t, status().OpenConnections)
+	}
+
+	cancel()
+	w.wg.Wait()
+}
+
+func TestWorkerListByLabel(t *testing.T) {
+	ctr := func(id string, labels map[string]string) event.Container {
+		return event.Container{ID: id, FullID: id, Labels: labels}
+	}
+	w := newWorker(nil)
+	w.track(event.Event{Info: event.Info{Container: ctr("aaaa", map[string]string{"app": "web", "team": "falco"})}, IsCreate: true})
+	w.track(event.Event{Info: event.Info{Container: ctr("bbbb", map[string]string{"app": "db"})}, IsCreate: true})
+	w.track(event.Event{Info: event.Info{Container: ctr("cccc", map[string]string{"app": "web"})}, IsCreate: true})
+
+	tCases := map[string]struct {
+		key      string
+		value    string
+		expected []string
+	}{
+		"Value":         {key: "app", value: "web", expected: []string{"aaaa", "cccc"}},
+		"Any value":     {key: "app", expected: []string{"aaaa", "bbbb", "cccc"}},
+		"Other label":   {key: "team", value: "falco", expected: []string{"aaaa"}},
+		"Missing value": {key: "app", value: "cache", expected: []string{}},
+		"Missing label": {key: "tier", expected: []string{}},
+	}
+	ids := func(ctrs []event.Container) []string {
+		res := make([]string, 0, len(ctrs))
+		for _, c := range ctrs {
+			res = append(res, c.FullID)
+		}
+		return res
+	}
+	for name, tc := range tCases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, ids(w.ListByLabel(tc.key, tc.value)))
+		})
+	}
+
+	// Updates replace the labels, removes drop them
+	w.track(event.Event{Info: event.Info{Container: ctr("cccc", map[string]string{"app": "cache"})}, IsCreate: true})
+	w.track(event.Event{Info: event.Info{Container: ctr("aaaa", nil)}, IsCreate: false})
+	assert.Empty(t, w.ListByLabel("app", "web"))
+	assert.Empty(t, w.ListByLabel("team", ""))
+	assert.Equal(t, []string{"cccc"}, ids(w.ListByLabel("app", "cache")))
+	assert.Equal(t, map[string]map[string]map[string]struct{}{
+		"app": {"db": {"bbbb": {}}, "cache": {"cccc": {}}},
+	}, w.byLabel)
+
+	// Consistent under concurrent updates
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			id := fmt.Sprintf("%04d", i)
+			for j := 0; j < 100; j++ {
+				w.track(event.Event{Info: event.Info{Container: ctr(id, map[string]string{"app": fmt.Sprint(j % 3)})}, IsCreate: true})
+				_ = w.ListByLabel("app", "")
+			}
+			w.track(event.Event{Info: event.Info{Container: ctr(id, nil)}, IsCreate: false})
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, []string{"bbbb", "cccc"}, ids(w.ListByLabel("app", "")))
+}
@@ -2,9 +2,12 @@ package main
 
 /*
 #include <stdbool.h>
+#include <stdlib.h>
 typedef const char cchar_t;
-typedef void (*async_cb)(const char *json, bool added, bool initial_state);
-void makeCallback(const char *json, bool added, bool initial_state, async_cb cb);
+typedef bool (*async_cb)(const char *json, bool added, bool initial_state);
+typedef void (*log_cb)(const char *msg, int severity);
+bool makeCallback(const char *json, bool added, bool initial_state, async_cb cb);
+void makeLogCallback(const char *msg, int severity, log_cb cb);
 */
 import "C"
 
@@ -12,92 +15,73 @@ import (
 	"context"
 	"encoding/json"
 	"github.com/falcosecurity/plugin-sdk-go/pkg/ptr"
-	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/config"
 	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/container"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/event"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/logger"
+	"github.com/falcosecurity/plugins/plugins/container/go-worker/pkg/worker"
 	"runtime"
 	"runtime/cgo"
-	"sync"
+	"strings"
+	"sync/atomic"
 	"unsafe"
 )
 
 type PluginCtx struct {
-	wg           sync.WaitGroup
-	ctxCancel    context.CancelFunc
 	stringBuffer ptr.StringBuffer
 	pinner       runtime.Pinner
-	fetchCh      chan string
+	worker       *worker.Worker
 }
 
-//export StartWorker
-func StartWorker(cb C.async_cb, initCfg *C.cchar_t, enabledSocks **C.cchar_t) unsafe.Pointer {
-	var (
-		pluginCtx PluginCtx
-		ctx       context.Context
-	)
-	const fetchChSize = 100
-	ctx, pluginCtx.ctxCancel = context.WithCancel(context.Background())
+// lastWorker is the worker started last, reported by GetWorkerStatus, and acknowledged by AckEvent
+// even once stopped.
+var lastWorker atomic.Pointer[worker.Worker]
 
+// callback wraps the C callback cb into a worker.Callback, writing events to the plugin string buffer.
+func (p *PluginCtx) callback(cb C.async_cb) worker.Callback {
 	// See https://github.com/enobufs/go-calls-c-pointer/blob/master/counter_api.go
-	goCb := func(containerJson string, added bool, initialState bool) {
+	return func(containerJson string, added bool, initialState bool) bool {
 		if containerJson == "" {
-			return
+			// Nothing to deliver
+			return true
 		}
 		// Go cannot call C-function pointers. Instead, use
 		// a C-function to have it call the function pointer.
-		pluginCtx.stringBuffer.Write(containerJson)
+		p.stringBuffer.Write(containerJson)
 		cadded := C.bool(added)
 		cinitialState := C.bool(initialState)
-		cStr := (*C.char)(pluginCtx.stringBuffer.CharPtr())
-		C.makeCallback(cStr, cadded, cinitialState, cb)
+		cStr := (*C.char)(p.stringBuffer.CharPtr())
+		return bool(C.makeCallback(cStr, cadded, cinitialState, cb))
 	}
+}
 
-	err := config.Load(ptr.GoString(unsafe.Pointer(initCfg)))
-	if err != nil {
-		return nil
+//export StartWorker
+func StartWorker(cb C.async_cb, logCb C.log_cb, initCfg *C.cchar_t, enabledSocks **C.cchar_t) unsafe.Pointer {
+	var pluginCtx PluginCtx
+
+	// logCb is optional; it may be called concurrently from any goroutine.
+	if logCb != nil {
+		logger.SetSink(func(severity logger.Severity, msg string) {
+			cMsg := C.CString(msg)
+			C.makeLogCallback(cMsg, C.int(severity), logCb)
+			C.free(unsafe.Pointer(cMsg))
+		})
 	}
+	lastWorker.Store(nil)
 
-	generators, err := container.Generators()
+	w, err := worker.New(pluginCtx.callback(cb), ptr.GoString(unsafe.Pointer(initCfg)))
 	if err != nil {
 		return nil
 	}
-
-	containerEngines := make([]container.Engine, 0)
-	enabledEngines := make(map[string][]string)
-	for _, generator := range generators {
-		engine, err := generator(ctx)
-		if err != nil {
-			continue
-		}
-		containerEngines = append(containerEngines, engine)
-		if _, ok := enabledEngines[engine.Name()]; !ok {
-			enabledEngines[engine.Name()] = make([]string, 0)
-		}
-		enabledEngines[engine.Name()] = append(enabledEngines[engine.Name()], engine.Sock())
-		// List all pre-existing containers and run `goCb` on all of them
-		containers, err := engine.List(ctx)
-		if err == nil {
-			for _, ctr := range containers {
-				goCb(ctr.String(), true, true)
-			}
-		}
+	if err = w.Start(context.Background()); err != nil {
+		return nil
 	}
-
-	pluginCtx.fetchCh = make(chan string, fetchChSize)
-
-	// Always append the dummy engine that is required to
-	// be able to fetch container infos on the fly given other enabled engines.
-	containerEngines = append(containerEngines, container.NewFetcherEngine(ctx, pluginCtx.fetchCh, containerEngines))
+	pluginCtx.worker = w
+	lastWorker.Store(w)
 
 	// Store json of attached sockets in `enabledSocks`
-	bytes, _ := json.Marshal(enabledEngines)
+	bytes, _ := json.Marshal(w.Engines())
 	*enabledSocks = C.CString(string(bytes))
 
-	// Start worker goroutine
-	pluginCtx.wg.Add(1)
-	go func() {
-		defer pluginCtx.wg.Done()
-		workerLoop(ctx, goCb, containerEngines, &pluginCtx.wg)
-	}()
 	h := cgo.NewHandle(&pluginCtx)
 	pluginCtx.pinner.Pin(&h)
 	return unsafe.Pointer(&h)
@@ -108,14 +92,116 @@ func StopWorker(pCtx unsafe.Pointer) {
 	h := (*cgo.Handle)(pCtx)
 	pluginCtx := h.Value().(*PluginCtx)
 
-	pluginCtx.ctxCancel()
-	pluginCtx.wg.Wait()
+	pluginCtx.worker.Stop()
 	pluginCtx.stringBuffer.Free()
-	close(pluginCtx.fetchCh)
-	pluginCtx.fetchCh = nil
+	pluginCtx.worker = nil
 
 	pluginCtx.pinner.Unpin()
 	h.Delete()
+	logger.SetSink(nil)
+}
+
+// GetWorkerStatus returns a json describing the status of each engine.
+// The returned string is owned by the caller, that must free() it.
+//
+//export GetWorkerStatus
+func GetWorkerStatus() *C.char {
+	status := worker.Status{Engines: container.Status()}
+	if w := lastWorker.Load(); w != nil {
+		status = w.Status()
+	}
+	bytes, _ := json.Marshal(status)
+	return C.CString(string(bytes))
+}
+
+// AckEvent acknowledges the event with the given seq, once processed, when `ack_events` is set.
+// Unlike the context bound exports, it is safe to call after StopWorker, for the events delivered before.
+// Returns false if the event cannot be acknowledged.
+//
+//export AckEvent
+func AckEvent(seq uint64) bool {
+	if w := lastWorker.Load(); w != nil {
+		return w.AckEvent(seq)
+	}
+	return false
+}
+
+// GetAckedSeq returns the seq up to which all the events got acknowledged, or dropped, when `ack_events` is set:
+// consumers checkpoint it, eg: on open(), to decide where to resume from.
+//
+//export GetAckedSeq
+func GetAckedSeq() uint64 {
+	if w := lastWorker.Load(); w != nil {
+		return w.AckedSeq()
+	}
+	return 0
+}
+
+// RunSelfTest checks that each engine configured by the last StartWorker can be connected to,
+// listing its containers and inspecting one of them, and returns a json report for each engine socket.
+// It uses its own clients, so that it is safe to run while a worker is active, and it returns
+// within container.SelfTestTimeout.
+// The returned string is owned by the caller, that must free() it.
+//
+//export RunSelfTest
+func RunSelfTest() *C.char {
+	bytes, _ := json.Marshal(container.SelfTest(context.Background(), container.ConfiguredGenerators(),
+		container.SelfTestTimeout))
+	return C.CString(string(bytes))
+}
+
+// AttachCallback replaces the callback the worker sends events to.
+// When `replay_buffer_size` is set, the most recent events are replayed to cb as initial state.
+// Returns false if a previously attached callback is still pending.
+//
+//export AttachCallback
+func AttachCallback(pCtx unsafe.Pointer, cb C.async_cb) bool {
+	h := (*cgo.Handle)(pCtx)
+	pluginCtx := h.Value().(*PluginCtx)
+
+	return pluginCtx.worker.AttachCallback(pluginCtx.callback(cb))
+}
+
+// StopEngine stops listening on the engine with the given name and socket, as reported by GetWorkerStatus,
+// leaving the other engines untouched; its state becomes "stopped".
+// Returns false if no such engine is being listened on.
+//
+//export StopEngine
+func StopEngine(pCtx unsafe.Pointer, name *C.cchar_t, socket *C.cchar_t) bool {
+	h := (*cgo.Handle)(pCtx)
+	pluginCtx := h.Value().(*PluginCtx)
+
+	return pluginCtx.worker.StopEngine(C.GoString(name), C.GoString(socket))
+}
+
+// StartEngine starts listening again on an engine stopped by StopEngine, or that stopped on its own;
+// its containers are listed again, to catch up with the ones created in the meantime.
+// Returns false if no such engine exists, if it is already being listened on or if it failed to listen.
+//
+//export StartEngine
+func StartEngine(pCtx unsafe.Pointer, name *C.cchar_t, socket *C.cchar_t) bool {
+	h := (*cgo.Handle)(pCtx)
+	pluginCtx := h.Value().(*PluginCtx)
+
+	return pluginCtx.worker.StartEngine(C.GoString(name), C.GoString(socket))
+}
+
+// ListContainersByLabel returns a json array with the event of each container, reported and not removed yet,
+// carrying the label; an empty value matches any value of the label.
+// The returned string is owned by the caller, that must free() it.
+//
+//export ListContainersByLabel
+func ListContainersByLabel(pCtx unsafe.Pointer, key *C.cchar_t, value *C.cchar_t) *C.char {
+	h := (*cgo.Handle)(pCtx)
+	pluginCtx := h.Value().(*PluginCtx)
+
+	ctrs := pluginCtx.worker.ListByLabel(C.GoString(key), C.GoString(value))
+	evts := make([]string, 0, len(ctrs))
+	for _, ctr := range ctrs {
+		info := event.Info{Container: ctr}
+		evts = append(evts, info.String())
+	}
+	return C.CString("[" + strings.Join(evts, ",") + "]")
 }
 
 //export AskForContainerInfo
@@ -123,16 +209,13 @@ func AskForContainerInfo(pCtx unsafe.Pointer, containerId *C.cchar_t) bool {
 	h := (*cgo.Handle)(pCtx)
 	pluginCtx := h.Value().(*PluginCtx)
 
-	containerID := C.GoString(containerId)
-	if pluginCtx.fetchCh != nil {
-		select {
-		case pluginCtx.fetchCh <- containerID:
-			return true
-		default:
-			return false
-		}
-	}
-	// In case the fetch channel is nil a retry from falco
-	// does not make sense, report the containerId as handled
-	return true
+	return pluginCtx.worker.Fetch(C.GoString(containerId))
+}
+
+// GetEventSchema returns the JSON Schema describing the events passed to the callback.
+// The returned string is owned by the caller, that must free() it.
+//
+//export GetEventSchema
+func GetEventSchema() *C.char {
+	return C.CString(event.Schema())
 }
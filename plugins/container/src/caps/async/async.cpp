@@ -44,8 +44,9 @@ bool my_plugin::start_async_events(
                  falcosecurity::_internal::SS_PLUGIN_LOG_SEV_DEBUG);
     nlohmann::json j(m_cfg);
     const char *enabled_engines = nullptr;
+    s_worker_logger = &m_logger;
     m_async_ctx = StartWorker(generate_async_event<ASYNC_HANDLER_GO_WORKER>,
-                              j.dump().c_str(), &enabled_engines);
+                              generate_log, j.dump().c_str(), &enabled_engines);
     m_logger.log(fmt::format("attached engine sockets: {}", enabled_engines),
                  falcosecurity::_internal::SS_PLUGIN_LOG_SEV_DEBUG);
     free((void *)enabled_engines);
@@ -72,6 +73,7 @@ bool my_plugin::stop_async_events() noexcept
         // Implemented by GO worker.go
         StopWorker(m_async_ctx);
         m_async_ctx = nullptr;
+        s_worker_logger = nullptr;
 
         for(int i = 0; i < ASYNC_HANDLER_MAX; i++)
         {
@@ -18,6 +18,9 @@ extern std::unique_ptr<falcosecurity::async_event_handler>
 static std::unordered_map<std::string, std::shared_ptr<const container_info>>
             s_preexisting_containers;
 
+// Set while the go-worker is running; used to forward go-worker logs.
+static falcosecurity::logger *s_worker_logger = nullptr;
+
 static inline uint64_t get_current_time_ns(int sec_shift)
 {
     std::chrono::nanoseconds ns =
@@ -25,9 +28,15 @@ static inline uint64_t get_current_time_ns(int sec_shift)
     return ns.count();
 }
 
+// Returns false when the event could not be pushed,
+// so that the go-worker can retry it or account it as dropped.
 template<async_handler_id id>
-void generate_async_event(const char *json, bool added, bool initial_state)
+bool generate_async_event(const char *json, bool added, bool initial_state)
 {
+    if(s_async_handler[id] == nullptr)
+    {
+        return false;
+    }
     falcosecurity::events::asyncevent_e_encoder enc;
     enc.set_tid(0); // not-existent tid
     std::string msg = json;
@@ -41,9 +50,17 @@ void generate_async_event(const char *json, bool added, bool initial_state)
         //     * when our listening CAP will be triggered,
         //       we need pre-existing containers to be already cached.
         if (initial_state) {
-            auto json_event = nlohmann::json::parse(json);
-            auto cinfo = json_event.get<container_info::ptr_t>();
-            s_preexisting_containers[cinfo->m_id] = cinfo;
+            try
+            {
+                auto json_event = nlohmann::json::parse(json);
+                auto cinfo = json_event.get<container_info::ptr_t>();
+                s_preexisting_containers[container_cache_key(cinfo->m_id)] =
+                        cinfo;
+            }
+            catch(const std::exception &)
+            {
+                return false;
+            }
         }
     }
     else
@@ -52,9 +69,45 @@ void generate_async_event(const char *json, bool added, bool initial_state)
         // enriched
         enc.set_ts(get_current_time_ns(1));
         enc.set_name(ASYNC_EVENT_NAME_REMOVED);
+        // Containers that went away while the worker was down, that
+        // were retained as pre-existing ones by a previous run.
+        if (initial_state) {
+            try
+            {
+                auto json_event = nlohmann::json::parse(json);
+                auto cinfo = json_event.get<container_info::ptr_t>();
+                s_preexisting_containers.erase(
+                        container_cache_key(cinfo->m_id));
+            }
+            catch(const std::exception &)
+            {
+                return false;
+            }
+        }
     }
     enc.set_data((void *)msg.c_str(), msg.size() + 1);
 
-    enc.encode(s_async_handler[id]->writer());
-    s_async_handler[id]->push();
+    try
+    {
+        enc.encode(s_async_handler[id]->writer());
+        s_async_handler[id]->push();
+    }
+    catch(const std::exception &)
+    {
+        return false;
+    }
+    return true;
+}
+
+// Called by the go-worker, possibly from multiple threads.
+// Severity values match ss_plugin_log_severity ones.
+static void generate_log(const char *msg, int severity)
+{
+    if(s_worker_logger != nullptr)
+    {
+        s_worker_logger->log(
+                msg,
+                static_cast<falcosecurity::_internal::ss_plugin_log_severity>(
+                        severity));
+    }
 }
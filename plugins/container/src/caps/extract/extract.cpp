@@ -31,6 +31,7 @@ enum ContainerFields
     TYPE_CONTAINER_DURATION,
     TYPE_CONTAINER_IP_ADDR,
     TYPE_CONTAINER_CNIRESULT,
+    TYPE_CONTAINER_STATE,
     TYPE_CONTAINER_HOST_PID,
     TYPE_CONTAINER_HOST_NETWORK,
     TYPE_CONTAINER_HOST_IPC,
@@ -297,6 +298,12 @@ std::vector<falcosecurity::field_info> my_plugin::get_fields()
              "instances of userspace container engine lookup delays, this "
              "field may not be available "
              "yet."},
+            {ft::FTYPE_STRING, "container.state", "Container State",
+             "The container's lifecycle state as retrieved from the container "
+             "engine: 'created', 'running', 'paused', 'restarting', 'exited', "
+             "'removed' or 'unknown'. A created container only becomes "
+             "'running' once it starts, reported as an update of its create "
+             "event."},
             {ft::FTYPE_BOOL, "container.host_pid", "Host PID Namespace",
              "'true' if the container is running in the host PID namespace, "
              "'false' otherwise."},
@@ -787,6 +794,9 @@ bool my_plugin::extract(const falcosecurity::extract_fields_input &in)
     case TYPE_CONTAINER_CNIRESULT:
         req.set_value(cinfo->m_pod_sandbox_cniresult);
         break;
+    case TYPE_CONTAINER_STATE:
+        req.set_value(cinfo->m_state);
+        break;
     case TYPE_CONTAINER_HOST_PID:
         req.set_value(cinfo->m_host_pid);
         break;
@@ -74,19 +74,30 @@ bool my_plugin::parse_async_event(const falcosecurity::parse_event_input& in)
     }
     auto json_event = nlohmann::json::parse(json_charbuf_pointer);
     auto cinfo = json_event.get<container_info::ptr_t>();
+    if(json_event.contains("error"))
+    {
+        // Fallback event, only carrying the container type and IDs
+        m_logger.log(fmt::format("Partial infos for container {}: {}",
+                                 cinfo->m_id,
+                                 json_event["error"].get<std::string>()),
+                     falcosecurity::_internal::SS_PLUGIN_LOG_SEV_WARNING);
+    }
     if(added)
     {
-        m_logger.log(fmt::format("Adding container: {}", cinfo->m_id),
+        m_logger.log(fmt::format("{} container: {}",
+                                 json_event.value("update", false) ? "Updating"
+                                                                   : "Adding",
+                                 cinfo->m_id),
                      falcosecurity::_internal::SS_PLUGIN_LOG_SEV_TRACE);
-        m_containers[cinfo->m_id] = cinfo;
+        m_containers[container_cache_key(cinfo->m_id)] = cinfo;
         m_last_container = cinfo;
-        m_asked_containers.erase(cinfo->m_id);
+        m_asked_containers.erase(container_cache_key(cinfo->m_id));
     }
     else
     {
         m_logger.log(fmt::format("Removing container: {}", cinfo->m_id),
                      falcosecurity::_internal::SS_PLUGIN_LOG_SEV_TRACE);
-        m_containers.erase(cinfo->m_id);
+        m_containers.erase(container_cache_key(cinfo->m_id));
     }
 
     // Update n_containers metric
@@ -151,6 +151,9 @@ class container_info
     std::string m_pod_sandbox_cniresult;
     bool m_is_pod_sandbox;
     std::string m_container_user;
+    // Lifecycle state, e.g. "created" until the container starts: one of
+    // created, running, paused, restarting, exited, removed, or unknown.
+    std::string m_state;
 
     /**
      * The time at which the container was created (IN SECONDS), cast from a
@@ -87,10 +87,49 @@ void from_json(const nlohmann::json& j, container_port_mapping& port)
     port.m_container_port = j.value("ContainerPort", 0);
 }
 
+/*
+ * With `output_layout: legacy`, the worker flattens the container object into
+ * the top-level one, keying each field by its legacy field name, eg:
+ * "container.image.repository": map them back to the default layout keys.
+ */
+static nlohmann::json legacy_container(const nlohmann::json& j)
+{
+    static const std::map<std::string, std::string> renamed = {
+            {"container.image.digest", "imagedigest"},
+            {"container.image.id", "imageid"},
+            {"container.image.repository", "imagerepo"},
+            {"container.image.tag", "imagetag"},
+            {"container.user", "User"},
+            {"container.cni.json", "cni_json"},
+            {"k8s.pod.full_sandbox_id", "pod_sandbox_id"},
+            {"k8s.pod.labels", "pod_sandbox_labels"},
+            {"container.mounts", "Mounts"},
+            {"container.healthcheck", "Healthcheck"},
+            {"container.liveness_probe", "LivenessProbe"},
+            {"container.readiness_probe", "ReadinessProbe"}};
+    const std::string prefix = "container.";
+
+    nlohmann::json container = nlohmann::json::object();
+    for(const auto& item : j.items())
+    {
+        const auto& key = item.key();
+        if(auto it = renamed.find(key); it != renamed.end())
+        {
+            container[it->second] = item.value();
+        }
+        else if(key.rfind(prefix, 0) == 0)
+        {
+            container[key.substr(prefix.length())] = item.value();
+        }
+    }
+    return container;
+}
+
 void from_json(const nlohmann::json& j, container_info::ptr_t& cinfo)
 {
     container_info::ptr_t info = std::make_shared<container_info>();
-    const nlohmann::json& container = j["container"];
+    const nlohmann::json container =
+            j.contains("container") ? j["container"] : legacy_container(j);
     info->m_type = container.value("type", CT_UNKNOWN);
     info->m_id = container.value("id", "");
     info->m_name = container.value("name", "");
@@ -119,6 +158,7 @@ void from_json(const nlohmann::json& j, container_info::ptr_t& cinfo)
     info->m_swap_limit = container.value("swap_limit", 0);
     info->m_pod_sandbox_id = container.value("pod_sandbox_id", "");
     info->m_privileged = container.value("privileged", false);
+    info->m_state = container.value("state", "");
     object_from_json(container, "pod_sandbox_labels",
                      info->m_pod_sandbox_labels);
     object_from_json(container, "port_mappings", info->m_port_mappings);
@@ -197,6 +237,7 @@ void to_json(nlohmann::json& j,
     j["swap_limit"] = cinfo->m_swap_limit;
     j["pod_sandbox_id"] = cinfo->m_pod_sandbox_id;
     j["privileged"] = cinfo->m_privileged;
+    j["state"] = cinfo->m_state;
     j["pod_sandbox_labels"] = cinfo->m_pod_sandbox_labels;
     j["port_mappings"] = cinfo->m_port_mappings;
     j["Mounts"] = cinfo->m_mounts;
@@ -0,0 +1,14 @@
+#pragma once
+
+#include "lxc.h"
+
+// LXD instances run in lxc cgroups; their metadata is retrieved by the
+// go-worker, listening on the LXD events stream.
+class lxd : public lxc
+{
+    container_info::ptr_t
+    to_container(const std::string& container_id) override
+    {
+        return nullptr;
+    }
+};
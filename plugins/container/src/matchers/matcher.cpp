@@ -5,10 +5,12 @@
 #include "cri.h"
 #include "containerd.h"
 #include "lxc.h"
+#include "lxd.h"
 #include "libvirt_lxc.h"
 #include "static_container.h"
 
-matcher_manager::matcher_manager(const Engines& cfg)
+matcher_manager::matcher_manager(const Engines& cfg,
+                                 const std::string& host_root)
 {
     if(cfg.static_ctr.enabled)
     {
@@ -39,6 +41,13 @@ matcher_manager::matcher_manager(const Engines& cfg)
         auto containerd_engine = std::make_shared<containerd>();
         m_matchers.push_back(containerd_engine);
     }
+    // LXD instances share the lxc cgroups layout; when LXD is running,
+    // attach them to the go-worker metadata instead of the generic lxc one.
+    if(cfg.lxd.enabled && cfg.lxd.any_socket_exists(host_root))
+    {
+        auto lxd_engine = std::make_shared<lxd>();
+        m_matchers.push_back(lxd_engine);
+    }
     if(cfg.lxc.enabled)
     {
         auto lxc_engine = std::make_shared<lxc>();
@@ -23,7 +23,7 @@ class cgroup_matcher
 class matcher_manager
 {
     public:
-    matcher_manager(const Engines& cfg);
+    matcher_manager(const Engines& cfg, const std::string& host_root);
 
     bool match_cgroup(const std::string& cgroup, std::string& container_id,
                       container_info::ptr_t& ctr);
@@ -83,7 +83,7 @@ bool my_plugin::init(falcosecurity::init_input& in)
     m_logger.log("init the plugin",
                  falcosecurity::_internal::SS_PLUGIN_LOG_SEV_DEBUG);
 
-    m_mgr = std::make_unique<matcher_manager>(m_cfg.engines);
+    m_mgr = std::make_unique<matcher_manager>(m_cfg.engines, m_cfg.host_root);
 
     try
     {
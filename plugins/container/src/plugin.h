@@ -21,6 +21,20 @@ limitations under the License.
 #include <unordered_map>
 #include <unordered_set>
 
+// Containers reported by the go-worker are cached by their short ID,
+// that is the one extracted by the matchers from the thread cgroups,
+// so that lookups keep working whatever the configured id_format.
+// IDs that are not 64 chars hex strings, like lxd instance names, are kept as is.
+static inline std::string container_cache_key(const std::string& id)
+{
+    if(id.size() == 64 &&
+       id.find_first_not_of("0123456789abcdefABCDEF") == std::string::npos)
+    {
+        return id.substr(0, SHORT_ID_LEN);
+    }
+    return id;
+}
+
 enum command_category
 {
     CAT_NONE = 0,
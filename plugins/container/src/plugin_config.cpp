@@ -14,10 +14,33 @@ void from_json(const nlohmann::json& j, SimpleEngine& engine)
     engine.enabled = j.value("enabled", true);
 }
 
+void from_json(const nlohmann::json& j, EngineTLS& tls)
+{
+    tls.ca = j.value("ca", "");
+    tls.cert = j.value("cert", "");
+    tls.key = j.value("key", "");
+}
+
 void from_json(const nlohmann::json& j, SocketsEngine& engine)
 {
     engine.enabled = j.value("enabled", true);
     engine.sockets = j.value("sockets", std::vector<std::string>{});
+    engine.emit_on = j.value("emit_on", EMIT_ON_CREATE);
+    engine.label_filter = j.value("label_filter",
+                                  std::map<std::string, std::string>{});
+    engine.poll_interval_ms =
+            j.value("poll_interval_ms", DEFAULT_POLL_INTERVAL_MS);
+    engine.inspect_concurrency =
+            j.value("inspect_concurrency", DEFAULT_INSPECT_CONCURRENCY);
+    engine.endpoint = j.value("endpoint", "");
+    engine.tls = j.value("tls", EngineTLS{});
+    if(j.contains("infra_deny"))
+    {
+        engine.infra_deny = j["infra_deny"].get<std::vector<std::string>>();
+    }
+    engine.infra_allow =
+            j.value("infra_allow", std::vector<std::string>{});
+    engine.states = j.value("states", std::vector<std::string>{});
 }
 
 void from_json(const nlohmann::json& j, Engines& engines)
@@ -31,6 +54,11 @@ void from_json(const nlohmann::json& j, Engines& engines)
     engines.podman = j.value("podman", SocketsEngine{});
     engines.cri = j.value("cri", SocketsEngine{});
     engines.containerd = j.value("containerd", SocketsEngine{});
+    engines.lxd = j.value("lxd", SocketsEngine{});
+    // Out of tree runtimes have no default socket: disabled unless configured.
+    SocketsEngine external;
+    external.enabled = false;
+    engines.external = j.value("external", external);
 }
 
 void from_json(const nlohmann::json& j, PluginConfig& cfg)
@@ -53,8 +81,34 @@ void from_json(const nlohmann::json& j, PluginConfig& cfg)
         {
             cfg.hooks |= HOOK_START;
         }
+        else if(hook == "exit")
+        {
+            cfg.hooks |= HOOK_EXIT;
+        }
     }
 
+    cfg.id_format = j.value("id_format", ID_FORMAT_SHORT);
+    cfg.startup_budget_ms =
+            j.value("startup_budget_ms", DEFAULT_STARTUP_BUDGET_MS);
+    cfg.connect_retry_timeout_ms = j.value("connect_retry_timeout_ms",
+                                           DEFAULT_CONNECT_RETRY_TIMEOUT_MS);
+    cfg.replay_buffer_size = j.value("replay_buffer_size", 0);
+    cfg.create_timeout_ms =
+            j.value("create_timeout_ms", DEFAULT_CREATE_TIMEOUT_MS);
+    cfg.event_deadline_ms =
+            j.value("event_deadline_ms", DEFAULT_EVENT_DEADLINE_MS);
+    cfg.reinspect_retries =
+            j.value("reinspect_retries", DEFAULT_REINSPECT_RETRIES);
+    cfg.reinspect_fields = j.value(
+            "reinspect_fields", std::vector<std::string>{"ip", "imagedigest"});
+    cfg.event_dump = j.value("event_dump", "");
+    cfg.event_dump_only = j.value("event_dump_only", false);
+    cfg.ack_events = j.value("ack_events", false);
+    cfg.duplicate_ids = j.value("duplicate_ids", DUPLICATE_IDS_ALL);
+    cfg.engine_priority =
+            j.value("engine_priority", std::vector<std::string>{});
+    cfg.output_layout = j.value("output_layout", OUTPUT_LAYOUT_DEFAULT);
+
     cfg.engines = j.value("engines", Engines{});
 
     // Set default sockets if emtpy
@@ -105,22 +159,69 @@ void from_json(const nlohmann::json& j, PluginConfig& cfg)
                 "/run/host-containerd/containerd.sock"); // bottlerocket host
                                                          // containers socket
     }
+    if(cfg.engines.lxd.sockets.empty())
+    {
+        cfg.engines.lxd.sockets.emplace_back(
+                "/var/snap/lxd/common/lxd/unix.socket");
+        cfg.engines.lxd.sockets.emplace_back("/var/lib/lxd/unix.socket");
+    }
 }
 
 void to_json(nlohmann::json& j, const Engines& engines)
 {
     j = nlohmann::json{{"docker",
                         {{"enabled", engines.docker.enabled},
-                         {"sockets", engines.docker.sockets}}},
+                         {"sockets", engines.docker.sockets},
+                         {"emit_on", engines.docker.emit_on},
+                         {"label_filter", engines.docker.label_filter},
+                         {"poll_interval_ms",
+                          engines.docker.poll_interval_ms},
+                         {"inspect_concurrency",
+                          engines.docker.inspect_concurrency},
+                         {"states", engines.docker.states}}},
                        {"podman",
                         {{"enabled", engines.podman.enabled},
-                         {"sockets", engines.podman.sockets}}},
+                         {"sockets", engines.podman.sockets},
+                         {"emit_on", engines.podman.emit_on}}},
                        {"cri",
                         {{"enabled", engines.cri.enabled},
-                         {"sockets", engines.cri.sockets}}},
+                         {"sockets", engines.cri.sockets},
+                         {"emit_on", engines.cri.emit_on},
+                         {"endpoint", engines.cri.endpoint},
+                         {"tls",
+                          {{"ca", engines.cri.tls.ca},
+                           {"cert", engines.cri.tls.cert},
+                           {"key", engines.cri.tls.key}}}}},
                        {"containerd",
                         {{"enabled", engines.containerd.enabled},
-                         {"sockets", engines.containerd.sockets}}}};
+                         {"sockets", engines.containerd.sockets},
+                         {"emit_on", engines.containerd.emit_on}}},
+                       {"lxd",
+                        {{"enabled", engines.lxd.enabled},
+                         {"sockets", engines.lxd.sockets},
+                         {"emit_on", engines.lxd.emit_on}}},
+                       {"external",
+                        {{"enabled", engines.external.enabled},
+                         {"sockets", engines.external.sockets},
+                         {"poll_interval_ms",
+                          engines.external.poll_interval_ms}}}};
+
+    const std::pair<const char*, const SocketsEngine&> sockets_engines[] = {
+            {"docker", engines.docker},
+            {"podman", engines.podman},
+            {"cri", engines.cri},
+            {"containerd", engines.containerd},
+            {"lxd", engines.lxd},
+            {"external", engines.external}};
+    for(const auto& [name, engine] : sockets_engines)
+    {
+        // Left out when unset, for the worker to apply its defaults
+        if(engine.infra_deny.has_value())
+        {
+            j[name]["infra_deny"] = engine.infra_deny.value();
+        }
+        j[name]["infra_allow"] = engine.infra_allow;
+    }
 }
 
 void to_json(nlohmann::json& j, const PluginConfig& cfg)
@@ -129,5 +230,19 @@ void to_json(nlohmann::json& j, const PluginConfig& cfg)
     j["with_size"] = cfg.with_size;
     j["host_root"] = cfg.host_root;
     j["hooks"] = cfg.hooks;
+    j["id_format"] = cfg.id_format;
+    j["startup_budget_ms"] = cfg.startup_budget_ms;
+    j["connect_retry_timeout_ms"] = cfg.connect_retry_timeout_ms;
+    j["replay_buffer_size"] = cfg.replay_buffer_size;
+    j["create_timeout_ms"] = cfg.create_timeout_ms;
+    j["event_deadline_ms"] = cfg.event_deadline_ms;
+    j["reinspect_retries"] = cfg.reinspect_retries;
+    j["reinspect_fields"] = cfg.reinspect_fields;
+    j["event_dump"] = cfg.event_dump;
+    j["event_dump_only"] = cfg.event_dump_only;
+    j["ack_events"] = cfg.ack_events;
+    j["duplicate_ids"] = cfg.duplicate_ids;
+    j["engine_priority"] = cfg.engine_priority;
+    j["output_layout"] = cfg.output_layout;
     j["engines"] = cfg.engines;
 }
@@ -1,13 +1,37 @@
 #pragma once
 
+#include <filesystem>
+#include <optional>
 #include <nlohmann/json.hpp>
 #include <fmt/core.h>
 #include <falcosecurity/sdk.h>
 
 #define DEFAULT_LABEL_MAX_LEN 100
+#define DEFAULT_STARTUP_BUDGET_MS 5000
+#define DEFAULT_CONNECT_RETRY_TIMEOUT_MS 30000
+#define DEFAULT_POLL_INTERVAL_MS 2000
+#define DEFAULT_INSPECT_CONCURRENCY 4
+#define DEFAULT_CREATE_TIMEOUT_MS 2000
+#define DEFAULT_EVENT_DEADLINE_MS 2000
+#define DEFAULT_REINSPECT_RETRIES 3
 
 #define HOOK_CREATE 1
 #define HOOK_START 2
+#define HOOK_EXIT 4
+
+#define ID_FORMAT_SHORT "short"
+#define ID_FORMAT_FULL "full"
+
+#define EMIT_ON_CREATE "create"
+#define EMIT_ON_START "start"
+#define EMIT_ON_BOTH "both"
+
+#define DUPLICATE_IDS_ALL "all"
+#define DUPLICATE_IDS_PREFER "prefer"
+#define DUPLICATE_IDS_MERGE "merge"
+
+#define OUTPUT_LAYOUT_DEFAULT "default"
+#define OUTPUT_LAYOUT_LEGACY "legacy"
 
 struct SimpleEngine
 {
@@ -16,12 +40,35 @@ struct SimpleEngine
     SimpleEngine() { enabled = true; }
 };
 
+struct EngineTLS
+{
+    std::string ca;
+    std::string cert;
+    std::string key;
+};
+
 struct SocketsEngine
 {
     bool enabled;
     std::vector<std::string> sockets;
-
-    SocketsEngine() { enabled = true; }
+    std::string emit_on;
+    std::map<std::string, std::string> label_filter;
+    int poll_interval_ms;
+    int inspect_concurrency;
+    std::string endpoint;
+    EngineTLS tls;
+    // Unset to hide the engine default infrastructure containers
+    std::optional<std::vector<std::string>> infra_deny;
+    std::vector<std::string> infra_allow;
+    std::vector<std::string> states;
+
+    SocketsEngine()
+    {
+        enabled = true;
+        emit_on = EMIT_ON_CREATE;
+        poll_interval_ms = DEFAULT_POLL_INTERVAL_MS;
+        inspect_concurrency = DEFAULT_INSPECT_CONCURRENCY;
+    }
 
     void log_sockets(falcosecurity::logger& logger,
                      const std::string& host_root) const
@@ -32,6 +79,19 @@ struct SocketsEngine
                                    host_root + socket));
         }
     }
+
+    bool any_socket_exists(const std::string& host_root) const
+    {
+        for(const auto& socket : sockets)
+        {
+            std::error_code ec;
+            if(std::filesystem::exists(host_root + socket, ec))
+            {
+                return true;
+            }
+        }
+        return false;
+    }
 };
 
 struct StaticEngine
@@ -53,6 +113,8 @@ struct Engines
     SocketsEngine podman;
     SocketsEngine cri;
     SocketsEngine containerd;
+    SocketsEngine lxd;
+    SocketsEngine external;
     StaticEngine static_ctr;
 };
 
@@ -61,6 +123,20 @@ struct PluginConfig
     int label_max_len;
     bool with_size;
     uint8_t hooks;
+    std::string id_format;
+    int startup_budget_ms;
+    int connect_retry_timeout_ms;
+    int replay_buffer_size;
+    int create_timeout_ms;
+    int event_deadline_ms;
+    int reinspect_retries;
+    std::vector<std::string> reinspect_fields;
+    std::string event_dump;
+    bool event_dump_only;
+    bool ack_events;
+    std::string duplicate_ids;
+    std::vector<std::string> engine_priority;
+    std::string output_layout;
     std::string host_root;
     Engines engines;
 
@@ -69,6 +145,18 @@ struct PluginConfig
         label_max_len = DEFAULT_LABEL_MAX_LEN;
         with_size = false;
         hooks = HOOK_CREATE;
+        id_format = ID_FORMAT_SHORT;
+        startup_budget_ms = DEFAULT_STARTUP_BUDGET_MS;
+        connect_retry_timeout_ms = DEFAULT_CONNECT_RETRY_TIMEOUT_MS;
+        replay_buffer_size = 0;
+        create_timeout_ms = DEFAULT_CREATE_TIMEOUT_MS;
+        event_deadline_ms = DEFAULT_EVENT_DEADLINE_MS;
+        reinspect_retries = DEFAULT_REINSPECT_RETRIES;
+        reinspect_fields = {"ip", "imagedigest"};
+        event_dump_only = false;
+        ack_events = false;
+        duplicate_ids = DUPLICATE_IDS_ALL;
+        output_layout = OUTPUT_LAYOUT_DEFAULT;
         if(const char* hroot = std::getenv("HOST_ROOT"))
         {
             host_root = hroot;
@@ -108,6 +196,16 @@ struct PluginConfig
             logger.log("Enabled 'containerd' container engine.");
             engines.containerd.log_sockets(logger, host_root);
         }
+        if(engines.lxd.enabled)
+        {
+            logger.log("Enabled 'lxd' container engine.");
+            engines.lxd.log_sockets(logger, host_root);
+        }
+        if(engines.external.enabled)
+        {
+            logger.log("Enabled 'external' container engine.");
+            engines.external.log_sockets(logger, host_root);
+        }
         if(engines.lxc.enabled)
         {
             logger.log("Enabled 'lxc' container engine.");
@@ -23,11 +23,107 @@ const char plugin_schema_string[] = LONG_STRING_CONST(
       "items": {
         "enum": [
           "create",
-          "start"
+          "start",
+          "exit"
         ]
       },
       "title": "Hooks to be attached.",
-      "description": "Hooks to be attached from the engines SDKs. Some fields are not available in 'create' hook. By default, we only attach 'create' that is guaranteed to be notified before first process starts."
+      "description": "Hooks to be attached from the engines SDKs. Some fields are not available in 'create' hook. By default, we only attach 'create' that is guaranteed to be notified before first process starts. 'exit' sends an update with the exit code when a container exits."
+    },
+    "id_format": {
+      "type": "string",
+      "enum": [
+        "short",
+        "full"
+      ],
+      "title": "Reported container ID format",
+      "description": "Whether container events report the 12 chars short container ID or the full one as the container ID. The full ID is always reported in the full_id field. Default: 'short'."
+    },
+    "startup_budget_ms": {
+      "type": "integer",
+      "minimum": 0,
+      "title": "Engines startup budget",
+      "description": "Maximum time, in milliseconds, the plugin init waits for container engines to connect. Engines connecting later are attached in background. Default: 5000."
+    },
+    "connect_retry_timeout_ms": {
+      "type": "integer",
+      "minimum": 0,
+      "title": "Engines connection retry timeout",
+      "description": "Maximum time, in milliseconds, the connection of an engine failing at startup, like a runtime not serving its socket yet, is retried with backoff before giving up. 0 disables the retries. Default: 30000."
+    },
+    "replay_buffer_size": {
+      "type": "integer",
+      "minimum": 0,
+      "title": "Events replay buffer size",
+      "description": "Number of most recent container events retained by the go-worker, to be replayed as initial state to a callback attached after startup. Default: 0, disabled."
+    },
+    "create_timeout_ms": {
+      "type": "integer",
+      "minimum": 0,
+      "title": "Create event timeout",
+      "description": "Maximum time, in milliseconds, the remove event of a container is held while its create event is still being fetched, so that it is never delivered first. Once elapsed, the remove is delivered alone and the late create dropped. Default: 2000; 0 disables it."
+    },
+    "event_deadline_ms": {
+      "type": "integer",
+      "minimum": 0,
+      "title": "Event inspection deadline",
+      "description": "Maximum time, in milliseconds, the inspection of a container may take before its event is sent with the metadata known so far, flagged as incomplete; the container is then inspected again in background. Default: 2000; 0 disables it."
+    },
+    "reinspect_retries": {
+      "type": "integer",
+      "minimum": 0,
+      "title": "Container re-inspections",
+      "description": "Maximum number of times a container whose event misses any of the reinspect_fields is inspected again, with increasing delay; an update event is sent once a re-inspection fills in a missing field. Default: 3; 0 disables it."
+    },
+    "reinspect_fields": {
+      "type": "array",
+      "items": {
+        "type": "string"
+      },
+      "title": "Container re-inspection fields",
+      "description": "Container fields, by their name in the container event JSON, whose emptiness triggers the re-inspection of the container. Default: ['ip', 'imagedigest']."
+    },
+    "event_dump": {
+      "type": "string",
+      "title": "Container events dump",
+      "description": "Where the JSON of each container event is written as a line, for debugging: 'stdout', or the path of a file, appended to. Default: ''; disabled."
+    },
+    "event_dump_only": {
+      "type": "boolean",
+      "title": "Only dump the container events",
+      "description": "Whether the container events are only written to the event_dump, not sent to the plugin, eg: to capture the event stream alone. Default: false."
+    },
+    "ack_events": {
+      "type": "boolean",
+      "title": "Acknowledge the container events",
+      "description": "Whether the consumer acknowledges each container event once processed, by its seq, to track the highest seq up to which all the events got processed, eg: to checkpoint it. Default: false."
+    },
+    "duplicate_ids": {
+      "type": "string",
+      "enum": [
+        "all",
+        "prefer",
+        "merge"
+      ],
+      "title": "Duplicate container IDs policy",
+      "description": "How a container reported by several engines under the same ID, eg: a docker container also seen by containerd, gets reported: 'all' reports the events of each engine, 'prefer' only the ones of the engine coming first in engine_priority, 'merge' the ones of that engine, with the fields it leaves empty filled in by the other engines. Default: 'all'."
+    },
+    "engine_priority": {
+      "type": "array",
+      "items": {
+        "type": "string"
+      },
+      "title": "Engines priority",
+      "description": "Engine names, by decreasing priority, used by the 'prefer' and 'merge' duplicate_ids policies; engines not listed come last, by order of first report of the container. Default: []."
+    },
+    "output_layout": {
+      "type": "string",
+      "enum": [
+        "default",
+        "legacy"
+      ],
+      "title": "Container events JSON layout",
+      "description": "The layout of the container events JSON: 'legacy' keys the container fields by the field names of the former built-in container engine, eg: container.image.repository, for the event_dump consumers migrating from it. The plugin parses both. Default: 'default'."
     },
     "engines": {
       "$ref": "#/definitions/Engines",
@@ -41,17 +137,23 @@ const char plugin_schema_string[] = LONG_STRING_CONST(
       "additionalProperties": false,
       "properties": {
         "docker": {
-          "$ref": "#/definitions/SocketsContainer"
+          "$ref": "#/definitions/DockerSocketsContainer"
         },
         "podman": {
-          "$ref": "#/definitions/SocketsContainer"
+          "$ref": "#/definitions/EmitOnSocketsContainer"
         },
         "containerd": {
-          "$ref": "#/definitions/SocketsContainer"
+          "$ref": "#/definitions/EmitOnSocketsContainer"
         },
         "cri": {
+          "$ref": "#/definitions/CriSocketsContainer"
+        },
+        "lxd": {
           "$ref": "#/definitions/SocketsContainer"
         },
+        "external": {
+          "$ref": "#/definitions/ExternalSocketsContainer"
+        },
         "lxc": {
           "$ref": "#/definitions/SimpleContainer"
         },
@@ -80,6 +182,22 @@ const char plugin_schema_string[] = LONG_STRING_CONST(
       "type": "string",
       "minLength": 1
     },
+    "InfraDeny": {
+      "type": "array",
+      "items": {
+        "type": "string",
+        "pattern": "^(label:[^=]+(=.*)?|name:.+|image:.+)$"
+      },
+      "description": "Rules matching the infrastructure containers of the engine, not reported: 'label:key', 'label:key=value', 'name:<glob>' or 'image:<glob>'. An empty list reports all containers. Default: the engine own infrastructure containers, like buildx builders for docker or pod infra containers for podman."
+    },
+    "InfraAllow": {
+      "type": "array",
+      "items": {
+        "type": "string",
+        "pattern": "^(label:[^=]+(=.*)?|name:.+|image:.+)$"
+      },
+      "description": "Rules, in the same format as infra_deny, matching containers that are reported even when matching infra_deny. Default: none."
+    },
     "SimpleContainer": {
       "type": "object",
       "additionalProperties": false,
@@ -105,6 +223,12 @@ const char plugin_schema_string[] = LONG_STRING_CONST(
           "items": {
             "type": "string"
           }
+        },
+        "infra_deny": {
+          "$ref": "#/definitions/InfraDeny"
+        },
+        "infra_allow": {
+          "$ref": "#/definitions/InfraAllow"
         }
       },
       "required": [
@@ -113,6 +237,187 @@ const char plugin_schema_string[] = LONG_STRING_CONST(
       ],
       "title": "SocketsContainer"
     },
+    "CriSocketsContainer": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "enabled": {
+          "type": "boolean"
+        },
+        "sockets": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "endpoint": {
+          "type": "string",
+          "description": "Network endpoint of the CRI runtime, eg: a CRI proxy, as 'host:port', reached over mTLS in place of the sockets. Ignored unless tls is configured."
+        },
+        "tls": {
+          "type": "object",
+          "additionalProperties": false,
+          "properties": {
+            "ca": {
+              "type": "string",
+              "description": "PEM file of the CA the endpoint is verified with. Default: the system CAs."
+            },
+            "cert": {
+              "type": "string",
+              "description": "PEM file of the client certificate."
+            },
+            "key": {
+              "type": "string",
+              "description": "PEM file of the client certificate key."
+            }
+          },
+          "title": "TLS config of the endpoint"
+        },
+        "infra_deny": {
+          "$ref": "#/definitions/InfraDeny"
+        },
+        "infra_allow": {
+          "$ref": "#/definitions/InfraAllow"
+        }
+      },
+      "required": [
+        "enabled",
+        "sockets"
+      ],
+      "title": "CriSocketsContainer"
+    },
+    "EmitOnSocketsContainer": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "enabled": {
+          "type": "boolean"
+        },
+        "sockets": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "emit_on": {
+          "type": "string",
+          "enum": [
+            "create",
+            "start",
+            "both"
+          ],
+          "description": "Lifecycle step container events are sent on. 'start' skips containers that never start; 'both' sends an update on start. Default: 'create'."
+        },
+        "infra_deny": {
+          "$ref": "#/definitions/InfraDeny"
+        },
+        "infra_allow": {
+          "$ref": "#/definitions/InfraAllow"
+        }
+      },
+      "required": [
+        "enabled",
+        "sockets"
+      ],
+      "title": "EmitOnSocketsContainer"
+    },
+    "DockerSocketsContainer": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "enabled": {
+          "type": "boolean"
+        },
+        "sockets": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "emit_on": {
+          "type": "string",
+          "enum": [
+            "create",
+            "start",
+            "both"
+          ],
+          "description": "Lifecycle step container events are sent on. 'start' skips containers that never start; 'both' sends an update on start. Default: 'create'."
+        },
+        "label_filter": {
+          "type": "object",
+          "additionalProperties": {
+            "type": "string"
+          },
+          "description": "Labels containers must all carry to be reported, filtered by the daemon; an empty value matches any value. Default: all containers are reported."
+        },
+        "poll_interval_ms": {
+          "type": "integer",
+          "minimum": 1,
+          "description": "Interval, in milliseconds, of the containers listings used in place of the events stream, when the daemon does not serve it. Default: 2000."
+        },
+        "inspect_concurrency": {
+          "type": "integer",
+          "minimum": 1,
+          "description": "Maximum number of container inspect calls run at once, to build the container events. Default: 4."
+        },
+        "infra_deny": {
+          "$ref": "#/definitions/InfraDeny"
+        },
+        "infra_allow": {
+          "$ref": "#/definitions/InfraAllow"
+        },
+        "states": {
+          "type": "array",
+          "items": {
+            "type": "string",
+            "enum": [
+              "created",
+              "running",
+              "paused",
+              "restarting",
+              "exited"
+            ]
+          },
+          "description": "States of the containers reported, applied to both the initial listing and the events; containers already reported still get their removal reported. Default: all states are reported."
+        }
+      },
+      "required": [
+        "enabled",
+        "sockets"
+      ],
+      "title": "DockerSocketsContainer"
+    },
+    "ExternalSocketsContainer": {
+      "type": "object",
+      "additionalProperties": false,
+      "properties": {
+        "enabled": {
+          "type": "boolean"
+        },
+        "sockets": {
+          "type": "array",
+          "items": {
+            "type": "string"
+          }
+        },
+        "poll_interval_ms": {
+          "type": "integer",
+          "minimum": 1,
+          "description": "Interval, in milliseconds, of the containers listings used in place of Watch, when the engine does not implement it. Default: 2000."
+        },
+        "infra_deny": {
+          "$ref": "#/definitions/InfraDeny"
+        },
+        "infra_allow": {
+          "$ref": "#/definitions/InfraAllow"
+        }
+      },
+      "required": [
+        "enabled",
+        "sockets"
+      ],
+      "title": "ExternalSocketsContainer"
+    },
     "StaticContainer": {
       "type": "object",
       "additionalProperties": false,
@@ -39,7 +39,8 @@ TEST(plugin_config, from_json)
   },
   "label_max_len": 120,
   "with_size": true,
-  "hooks": ["start"]
+  "hooks": ["start"],
+  "output_layout": "legacy"
 })";
     auto config_json = nlohmann::json::parse(config);
 
@@ -56,6 +57,7 @@ TEST(plugin_config, from_json)
     EXPECT_TRUE(cfg.with_size);
     EXPECT_EQ(cfg.label_max_len, 120);
     EXPECT_EQ(cfg.hooks, HOOK_START);
+    EXPECT_EQ(cfg.output_layout, OUTPUT_LAYOUT_LEGACY);
 }
 
 TEST(plugin_config, from_json_missing_engines)
@@ -101,41 +103,89 @@ TEST(plugin_config, from_json_empty_json)
     EXPECT_FALSE(cfg.with_size);
     EXPECT_EQ(cfg.label_max_len, DEFAULT_LABEL_MAX_LEN);
     EXPECT_EQ(cfg.hooks, HOOK_CREATE);
+    EXPECT_EQ(cfg.output_layout, OUTPUT_LAYOUT_DEFAULT);
 }
 
 TEST(plugin_config, to_json)
 {
     std::string expected_config = R"({
+  "ack_events": false,
+  "connect_retry_timeout_ms": 30000,
+  "create_timeout_ms": 2000,
+  "duplicate_ids": "all",
+  "engine_priority": [],
   "engines": {
     "containerd": {
+      "emit_on": "create",
       "enabled": true,
+      "infra_allow": [],
       "sockets": [
         "/run/containerd/containerd.sock"
       ]
     },
     "cri": {
+      "emit_on": "create",
       "enabled": true,
+      "endpoint": "",
+      "infra_allow": [],
       "sockets": [
         "/run/crio/crio.sock"
-      ]
+      ],
+      "tls": {
+        "ca": "",
+        "cert": "",
+        "key": ""
+      }
     },
     "docker": {
+      "emit_on": "create",
       "enabled": true,
+      "infra_allow": [],
+      "inspect_concurrency": 4,
+      "label_filter": {},
+      "poll_interval_ms": 2000,
       "sockets": [
         "/var/run/docker.sock"
-      ]
+      ],
+      "states": []
+    },
+    "external": {
+      "enabled": true,
+      "infra_allow": [],
+      "poll_interval_ms": 2000,
+      "sockets": []
+    },
+    "lxd": {
+      "emit_on": "create",
+      "enabled": true,
+      "infra_allow": [],
+      "sockets": []
     },
     "podman": {
+      "emit_on": "create",
       "enabled": false,
+      "infra_allow": [],
       "sockets": [
         "/run/podman/podman.sock",
         "/run/user/1000/podman/podman.sock"
       ]
     }
   },
+  "event_deadline_ms": 2000,
+  "event_dump": "",
+  "event_dump_only": false,
   "hooks": 3,
   "host_root": "",
+  "id_format": "short",
   "label_max_len": 120,
+  "output_layout": "default",
+  "reinspect_fields": [
+    "ip",
+    "imagedigest"
+  ],
+  "reinspect_retries": 3,
+  "replay_buffer_size": 0,
+  "startup_budget_ms": 5000,
   "with_size": true
 })";
     auto cfg = PluginConfig{};
@@ -48,4 +48,46 @@ TEST(container_info_json, null_healthcheck)
 })";
     auto json_event = nlohmann::json::parse(json);
     ASSERT_NO_THROW(json_event.get<container_info::ptr_t>());
-}
\ No newline at end of file
+}
+TEST(container_info_json, state)
+{
+    std::string json = R"({
+    "container": {
+        "type": 0,
+        "id": "fee3a77211e1",
+        "state": "created"
+    },
+    "update": false
+})";
+    auto cinfo = nlohmann::json::parse(json).get<container_info::ptr_t>();
+    ASSERT_EQ(cinfo->m_state, "created");
+
+    // Not reported by older workers
+    cinfo = nlohmann::json::parse(R"({"container": {"id": "fee3a77211e1"}})")
+                    .get<container_info::ptr_t>();
+    ASSERT_EQ(cinfo->m_state, "");
+}
+
+TEST(container_info_json, legacy_layout)
+{
+    std::string json = R"({
+    "schema_version": 20,
+    "container.type": 0,
+    "container.id": "fee3a77211e1",
+    "container.image.repository": "fedora",
+    "k8s.pod.labels": {
+        "app": "web"
+    },
+    "container.healthcheck": {
+        "exe": "/usr/bin/healthcheck",
+        "args": null
+    },
+    "update": false
+})";
+    auto cinfo = nlohmann::json::parse(json).get<container_info::ptr_t>();
+    ASSERT_EQ(cinfo->m_id, "fee3a77211e1");
+    ASSERT_EQ(cinfo->m_imagerepo, "fedora");
+    ASSERT_EQ(cinfo->m_pod_sandbox_labels.at("app"), "web");
+    ASSERT_EQ(cinfo->m_health_probes.size(), 1);
+    ASSERT_EQ(cinfo->m_health_probes.front().m_exe, "/usr/bin/healthcheck");
+}